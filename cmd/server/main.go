@@ -57,6 +57,8 @@ func main() {
 
 	log.Info("正在关闭服务器...")
 
+	appInstance.Stop()
+
 	// 停止周期性配置更新服务
 	StopPeriodicConfigUpdate()
 
@@ -8,6 +8,8 @@ const (
 const (
 	AsrTypeFunAsr = "funasr"
 	AsrTypeDoubao = "doubao"
+	AsrTypeMock   = "mock"
+	AsrTypeOpenAI = "openai"
 )
 
 const (
@@ -15,6 +17,8 @@ const (
 	LlmTypeOllama  = "ollama"
 	LlmTypeEinoLLM = "eino_llm"
 	LlmTypeEino    = "eino"
+	LlmTypeMock    = "mock"
+	LlmTypeChain   = "chain"
 )
 
 const (
@@ -24,4 +28,14 @@ const (
 	TtsTypeEdge        = "edge"
 	TtsTypeEdgeOffline = "edge_offline"
 	TtsTypeXiaozhi     = "xiaozhi"
+	TtsTypeOpenAI      = "openai"
+	TtsTypeMock        = "mock"
+	TtsTypeFailover    = "failover"
+)
+
+// 智能体语音识别速度, 决定断句的快慢
+const (
+	AsrSpeedNormal  = "normal"
+	AsrSpeedPatient = "patient"
+	AsrSpeedFast    = "fast"
 )
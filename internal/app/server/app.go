@@ -2,13 +2,25 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
 	"time"
 	"xiaozhi-esp32-server-golang/internal/app/mqtt_server"
+	"xiaozhi-esp32-server-golang/internal/app/server/auth"
 	"xiaozhi-esp32-server-golang/internal/app/server/chat"
+	"xiaozhi-esp32-server-golang/internal/app/server/cluster"
 	"xiaozhi-esp32-server-golang/internal/app/server/manager_client"
 	"xiaozhi-esp32-server-golang/internal/app/server/mqtt_udp"
 	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	"xiaozhi-esp32-server-golang/internal/app/server/webrtc"
 	"xiaozhi-esp32-server-golang/internal/app/server/websocket"
+	"xiaozhi-esp32-server-golang/internal/domain/history"
+	"xiaozhi-esp32-server-golang/internal/domain/knowledge"
+	llm_memory "xiaozhi-esp32-server-golang/internal/domain/llm/memory"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/domain/recorder"
 	log "xiaozhi-esp32-server-golang/logger"
 
 	cmap "github.com/orcaman/concurrent-map/v2"
@@ -20,6 +32,10 @@ import (
 type App struct {
 	wsServer       *websocket.WebSocketServer
 	mqttUdpAdapter *mqtt_udp.MqttUdpAdapter
+	webrtcServer   *webrtc.WebRTCServer
+
+	// 多实例部署时的设备归属和节点间转发, 未开启时为 nil
+	cluster *cluster.Cluster
 
 	// ChatManager管理 - 使用concurrent map
 	chatManagers cmap.ConcurrentMap[string, *chat.ChatManager]
@@ -30,7 +46,9 @@ func NewApp() *App {
 	app := &App{
 		chatManagers: cmap.New[*chat.ChatManager](),
 	}
+	app.cluster = app.newCluster()
 	app.wsServer = app.newWebSocketServer()
+	app.webrtcServer = app.newWebRTCServer()
 	app.mqttUdpAdapter, err = app.newMqttUdpAdapter()
 	if err != nil {
 		log.Errorf("newMqttUdpAdapter err: %+v", err)
@@ -40,6 +58,16 @@ func NewApp() *App {
 }
 
 func (a *App) Run() {
+	// 对话记录推送和知识库来源依赖 manager, 需在接受连接前注册
+	a.registerHistorySink()
+	a.registerKnowledgeSource()
+	a.startCluster()
+
+	// WebRTC 信令与 websocket 共用 HTTP 端口
+	if a.webrtcServer != nil {
+		a.webrtcServer.Register(http.DefaultServeMux)
+	}
+	a.registerAdminAPI(http.DefaultServeMux)
 	go a.wsServer.Start()
 	if viper.GetBool("mqtt_server.enable") {
 		go func() {
@@ -57,6 +85,8 @@ func (a *App) Run() {
 	// 注册聊天相关的本地MCP工具
 	a.registerChatMCPTools()
 
+	// 注册 manager 下发的请求处理
+	a.registerManagerRequestHandlers()
 	select {} // 阻塞主线程
 }
 
@@ -91,7 +121,21 @@ func (app *App) newUdpServer() (*mqtt_udp.UdpServer, error) {
 	externalHost := viper.GetString("udp.external_host")
 	externalPort := viper.GetInt("udp.external_port")
 
-	udpServer := mqtt_udp.NewUDPServer(udpPort, externalHost, externalPort)
+	var opts []mqtt_udp.UdpServerOption
+	// 抖动缓冲默认开启
+	if !viper.IsSet("udp.jitter_buffer.enable") || viper.GetBool("udp.jitter_buffer.enable") {
+		maxDelayMs := viper.GetInt("udp.jitter_buffer.max_delay_ms")
+		if maxDelayMs <= 0 {
+			maxDelayMs = 80
+		}
+		maxPackets := viper.GetInt("udp.jitter_buffer.max_packets")
+		if maxPackets <= 0 {
+			maxPackets = 8
+		}
+		opts = append(opts, mqtt_udp.WithJitterBuffer(time.Duration(maxDelayMs)*time.Millisecond, maxPackets))
+	}
+
+	udpServer := mqtt_udp.NewUDPServer(udpPort, externalHost, externalPort, opts...)
 	err := udpServer.Start()
 	if err != nil {
 		log.Fatalf("udpServer.Start err: %+v", err)
@@ -102,7 +146,25 @@ func (app *App) newUdpServer() (*mqtt_udp.UdpServer, error) {
 
 func (app *App) newWebSocketServer() *websocket.WebSocketServer {
 	port := viper.GetInt("websocket.port")
-	return websocket.NewWebSocketServer(port, websocket.WithOnNewConnection(app.OnNewConnection))
+	return websocket.NewWebSocketServer(port,
+		websocket.WithOnNewConnection(app.OnNewConnection),
+		websocket.WithOnSpeak(app.Speak),
+	)
+}
+
+func (app *App) newWebRTCServer() *webrtc.WebRTCServer {
+	if !viper.GetBool("webrtc.enable") {
+		return nil
+	}
+	config := webrtc.Config{
+		ICEServers: viper.GetStringSlice("webrtc.ice_servers"),
+		PublicIP:   viper.GetString("webrtc.public_ip"),
+		UDPPortMin: uint16(viper.GetUint("webrtc.udp_port_min")),
+		UDPPortMax: uint16(viper.GetUint("webrtc.udp_port_max")),
+	}
+	return webrtc.NewWebRTCServer(config,
+		webrtc.WithOnNewConnection(app.OnNewConnection),
+	)
 }
 
 func (app *App) startMqttServer() error {
@@ -115,12 +177,32 @@ func (a *App) OnNewConnection(transport types.IConn) {
 
 	// 检查是否已存在该设备的ChatManager
 	if existingManager, exists := a.chatManagers.Get(deviceID); exists {
-		log.Infof("设备 %s 已存在ChatManager，先关闭旧的连接", deviceID)
-		// 关闭旧的ChatManager
-		existingManager.Close()
-		a.chatManagers.Remove(deviceID)
+		// 读取 hello 判断能否恢复会话, 旧连接可能已断开等待重连, 也可能尚未感知断线
+		// mqtt_udp 在回调返回后才投递 hello, 需异步读取
+		go func() {
+			conn, resumed := existingManager.TryResume(transport)
+			if resumed {
+				return
+			}
+			a.closeExistingManager(deviceID, existingManager)
+			a.startChatManager(deviceID, conn)
+		}()
+		return
 	}
 
+	a.startChatManager(deviceID, transport)
+}
+
+func (a *App) closeExistingManager(deviceID string, existingManager *chat.ChatManager) {
+	log.Infof("设备 %s 已存在ChatManager，先关闭旧的连接", deviceID)
+	// 关闭旧的ChatManager
+	existingManager.Close()
+	a.chatManagers.RemoveCb(deviceID, func(key string, v *chat.ChatManager, exists bool) bool {
+		return exists && v == existingManager
+	})
+}
+
+func (a *App) startChatManager(deviceID string, transport types.IConn) {
 	// 创建新的ChatManager
 	chatManager, err := chat.NewChatManager(deviceID, transport)
 	if err != nil {
@@ -204,9 +286,257 @@ func (s *App) registerChatMCPTools() {
 }
 
 func (s *App) DeviceOnline(deviceID string) {
+	s.claimDevice(deviceID)
 	manager_client.SendDeviceActiveRequest(context.Background(), deviceID)
 }
 
 func (s *App) DeviceOffline(deviceID string) {
+	// 设备已重连到其它节点时, 由该节点维护在线状态
+	if !s.releaseDevice(deviceID) {
+		return
+	}
 	manager_client.SendDeviceInactiveRequest(context.Background(), deviceID)
 }
+
+// Speak 服务端主动向设备下发播报, 设备不在线时返回 Online 为 false
+// 开启集群且设备连接在其它节点时转发给该节点
+func (a *App) Speak(req *chat.SpeakRequest) (*chat.SpeakResult, error) {
+	if nodeID := a.remoteDeviceNode(context.Background(), req.DeviceID); nodeID != "" {
+		return a.forwardSpeak(nodeID, req)
+	}
+	return a.speakLocal(req)
+}
+
+// speakLocal 向连接在本节点的设备下发播报
+func (a *App) speakLocal(req *chat.SpeakRequest) (*chat.SpeakResult, error) {
+	result := &chat.SpeakResult{
+		DeviceID: req.DeviceID,
+	}
+	chatManager, exists := a.GetChatManager(req.DeviceID)
+	if !exists {
+		log.Infof("设备 %s 不在线, 忽略主动播报", req.DeviceID)
+		return result, nil
+	}
+	// 连接已断开等待重连时旧连接已关闭, 按不在线处理
+	if chatManager.IsDetached() {
+		log.Infof("设备 %s 连接已断开等待重连, 忽略主动播报", req.DeviceID)
+		return result, nil
+	}
+	result.Online = true
+	result.Transport = chatManager.GetTransportType()
+
+	if err := chatManager.Speak(req); err != nil {
+		log.Errorf("设备 %s 主动播报失败: %v", req.DeviceID, err)
+		return result, err
+	}
+	return result, nil
+}
+
+// DeviceToolRequest 调用设备上报的 MCP 工具
+type DeviceToolRequest struct {
+	DeviceID  string                 `json:"device_id"`
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// CallDeviceTool 调用设备的 MCP 工具, 开启集群且设备连接在其它节点时转发给该节点
+func (a *App) CallDeviceTool(ctx context.Context, req *DeviceToolRequest) (int, map[string]interface{}, error) {
+	if nodeID := a.remoteDeviceNode(ctx, req.DeviceID); nodeID != "" {
+		return a.cluster.Forward(ctx, nodeID, "/api/device/mcp/call", map[string]interface{}{
+			"device_id": req.DeviceID,
+			"tool":      req.Tool,
+			"arguments": req.Arguments,
+		})
+	}
+	return a.callDeviceToolLocal(ctx, req)
+}
+
+// callDeviceToolLocal 调用连接在本节点的设备的 MCP 工具
+func (a *App) callDeviceToolLocal(ctx context.Context, req *DeviceToolRequest) (int, map[string]interface{}, error) {
+	mcpSession := mcp.GetDeviceMcpClient(req.DeviceID)
+	if mcpSession == nil {
+		return 404, nil, fmt.Errorf("设备 %s 不在线或未上报MCP工具", req.DeviceID)
+	}
+	deviceTool, ok := mcpSession.GetToolByName(req.Tool)
+	if !ok {
+		return 404, nil, fmt.Errorf("设备 %s 不存在工具 %s", req.DeviceID, req.Tool)
+	}
+	arguments := req.Arguments
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
+	argumentsJSON, err := json.Marshal(arguments)
+	if err != nil {
+		return 400, nil, fmt.Errorf("序列化工具参数失败: %v", err)
+	}
+
+	log.Infof("设备 %s 调用工具 %s, 参数: %s", req.DeviceID, req.Tool, argumentsJSON)
+	result, err := deviceTool.InvokableRun(ctx, string(argumentsJSON))
+	if err != nil {
+		return 500, nil, fmt.Errorf("调用工具 %s 失败: %v", req.Tool, err)
+	}
+	return 200, map[string]interface{}{
+		"device_id": req.DeviceID,
+		"tool":      req.Tool,
+		"result":    result,
+	}, nil
+}
+
+// registerManagerRequestHandlers 注册 manager 通过 websocket 下发的请求
+func (a *App) registerManagerRequestHandlers() {
+	manager_client.RegisterRequestHandler("/api/device/speak", a.handleManagerSpeakRequest)
+	manager_client.RegisterRequestHandler("/api/device/mcp/call", a.handleManagerDeviceToolRequest)
+	manager_client.RegisterRequestHandler("/api/auth/revoke", a.handleManagerRevokeTokenRequest)
+	manager_client.RegisterRequestHandler("/api/knowledge/invalidate", a.handleManagerKnowledgeInvalidateRequest)
+	manager_client.RegisterRequestHandler("/api/device/data/delete", a.handleManagerDeleteDeviceDataRequest)
+}
+
+// registerHistorySink 使用 manager 配置时, 每轮对话结束后通过 websocket 异步推送对话记录
+func (a *App) registerHistorySink() {
+	if viper.GetString("config_provider.type") != "manager" || !viper.GetBool("manager.conversation_history") {
+		return
+	}
+	history.SetSink(func(ctx context.Context, turn *history.Turn) error {
+		return manager_client.SendConversationTurnRequest(ctx, turn)
+	})
+	log.Info("对话记录推送已开启")
+}
+
+// registerKnowledgeSource 知识库的文档与分块由 manager 管理, 启动时在后台为有知识库的智能体构建索引
+func (a *App) registerKnowledgeSource() {
+	if viper.GetString("config_provider.type") != "manager" || !viper.GetBool("knowledge.enable") {
+		return
+	}
+	knowledge.SetSource(func(ctx context.Context, agentID string) ([]knowledge.Chunk, error) {
+		var chunks []knowledge.Chunk
+		if err := manager_client.SendKnowledgeChunksRequest(ctx, agentID, &chunks); err != nil {
+			return nil, err
+		}
+		return chunks, nil
+	}, manager_client.SendKnowledgeAgentsRequest)
+	knowledge.Get()
+}
+
+// handleManagerKnowledgeInvalidateRequest 知识库文档变更后, 在后台重新同步
+func (a *App) handleManagerKnowledgeInvalidateRequest(request *manager_client.WebSocketRequest) (int, map[string]interface{}, error) {
+	var req struct {
+		AgentID string `json:"agent_id"`
+	}
+	if err := manager_client.MapToStruct(request.Body, &req); err != nil {
+		return 400, nil, fmt.Errorf("解析请求参数失败: %v", err)
+	}
+	if req.AgentID == "" {
+		return 400, nil, fmt.Errorf("缺少agent_id参数")
+	}
+	if retriever := knowledge.Get(); retriever != nil {
+		retriever.Invalidate(req.AgentID)
+	}
+	return 200, map[string]interface{}{"agent_id": req.AgentID}, nil
+}
+
+// handleManagerDeleteDeviceDataRequest 隐私删除, 清除设备在 Redis 中的 LLM 历史、记忆摘要以及会话录音
+func (a *App) handleManagerDeleteDeviceDataRequest(request *manager_client.WebSocketRequest) (int, map[string]interface{}, error) {
+	var req struct {
+		DeviceID string `json:"device_id"`
+	}
+	if err := manager_client.MapToStruct(request.Body, &req); err != nil {
+		return 400, nil, fmt.Errorf("解析请求参数失败: %v", err)
+	}
+	if req.DeviceID == "" {
+		return 400, nil, fmt.Errorf("缺少device_id参数")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := llm_memory.Get().DeleteDeviceMemory(ctx, req.DeviceID); err != nil {
+		return 500, nil, fmt.Errorf("删除设备 %s 的对话记忆失败: %v", req.DeviceID, err)
+	}
+	if err := recorder.DeleteDevice(ctx, req.DeviceID); err != nil {
+		return 500, nil, fmt.Errorf("删除设备 %s 的录音失败: %v", req.DeviceID, err)
+	}
+	log.Infof("已删除设备 %s 的对话记忆和录音", req.DeviceID)
+	return 200, map[string]interface{}{"device_id": req.DeviceID}, nil
+}
+
+// handleManagerRevokeTokenRequest 吊销设备令牌, 指定 token 时只吊销该令牌, 否则吊销设备的全部令牌
+func (a *App) handleManagerRevokeTokenRequest(request *manager_client.WebSocketRequest) (int, map[string]interface{}, error) {
+	var req struct {
+		DeviceID string `json:"device_id"`
+		Token    string `json:"token"`
+	}
+	if err := manager_client.MapToStruct(request.Body, &req); err != nil {
+		return 400, nil, fmt.Errorf("解析请求参数失败: %v", err)
+	}
+
+	ctx := context.Background()
+	if req.Token != "" {
+		deviceID, err := auth.A().RevokeToken(ctx, req.Token)
+		if err != nil {
+			return 500, nil, err
+		}
+		if deviceID == "" {
+			return 200, map[string]interface{}{"revoked": 0}, nil
+		}
+		closed := a.closeDevice(ctx, deviceID)
+		return 200, map[string]interface{}{"device_id": deviceID, "revoked": 1, "closed": closed}, nil
+	}
+	if req.DeviceID == "" {
+		return 400, nil, fmt.Errorf("缺少device_id或token参数")
+	}
+	count, err := auth.A().RevokeDeviceTokens(ctx, req.DeviceID)
+	if err != nil {
+		return 500, nil, err
+	}
+	// 吊销后断开设备当前的会话, 重连时需重新认证
+	closed := a.closeDevice(ctx, req.DeviceID)
+	return 200, map[string]interface{}{"device_id": req.DeviceID, "revoked": count, "closed": closed}, nil
+}
+
+func (a *App) handleManagerSpeakRequest(request *manager_client.WebSocketRequest) (int, map[string]interface{}, error) {
+	return a.handleSpeak(request.Body, a.Speak)
+}
+
+// handleManagerDeviceToolRequest 调用设备上报的 MCP 工具
+func (a *App) handleManagerDeviceToolRequest(request *manager_client.WebSocketRequest) (int, map[string]interface{}, error) {
+	return a.handleDeviceTool(context.Background(), request.Body, a.CallDeviceTool)
+}
+
+// handleDeviceTool 解析工具调用请求, manager 下发时由 CallDeviceTool 处理, 其它节点转发时只在本节点调用
+func (a *App) handleDeviceTool(ctx context.Context, reqBody map[string]interface{}, call func(context.Context, *DeviceToolRequest) (int, map[string]interface{}, error)) (int, map[string]interface{}, error) {
+	var req DeviceToolRequest
+	if err := manager_client.MapToStruct(reqBody, &req); err != nil {
+		return 400, nil, fmt.Errorf("解析请求参数失败: %v", err)
+	}
+	if req.DeviceID == "" {
+		return 400, nil, fmt.Errorf("缺少device_id参数")
+	}
+	if req.Tool == "" {
+		return 400, nil, fmt.Errorf("缺少tool参数")
+	}
+	return call(ctx, &req)
+}
+
+// handleSpeak 解析播报请求, manager 下发时由 Speak 处理, 其它节点转发时只在本节点播报
+func (a *App) handleSpeak(reqBody map[string]interface{}, speak func(*chat.SpeakRequest) (*chat.SpeakResult, error)) (int, map[string]interface{}, error) {
+	var req chat.SpeakRequest
+	if err := manager_client.MapToStruct(reqBody, &req); err != nil {
+		return 400, nil, fmt.Errorf("解析请求参数失败: %v", err)
+	}
+	if req.DeviceID == "" {
+		return 400, nil, fmt.Errorf("缺少device_id参数")
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		return 400, nil, fmt.Errorf("缺少text参数")
+	}
+
+	result, err := speak(&req)
+	body := map[string]interface{}{
+		"device_id": result.DeviceID,
+		"online":    result.Online,
+		"transport": result.Transport,
+	}
+	if err != nil {
+		return 500, body, err
+	}
+	return 200, body, nil
+}
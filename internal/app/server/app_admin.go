@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/chat"
+	llm_memory "xiaozhi-esp32-server-golang/internal/domain/llm/memory"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	adminAPIPrefix = "/xiaozhi/admin/sessions"
+	// 查看会话时默认返回的对话条数
+	adminDialogueLimit = 20
+	// 未指定时长时设备调试日志的有效期
+	adminDebugDuration = 10 * time.Minute
+)
+
+// registerAdminAPI 注册查看和管理本节点在线会话的接口, 需配置 admin_api.token
+func (a *App) registerAdminAPI(mux *http.ServeMux) {
+	if !viper.GetBool("admin_api.enable") {
+		return
+	}
+	if viper.GetString("admin_api.token") == "" {
+		log.Errorf("管理接口未配置 admin_api.token, 不开启")
+		return
+	}
+	mux.HandleFunc(adminAPIPrefix, a.handleAdminAPI)
+	mux.HandleFunc(adminAPIPrefix+"/", a.handleAdminAPI)
+	log.Infof("管理接口端点: %s", adminAPIPrefix)
+}
+
+// handleAdminAPI 路由:
+// GET  /xiaozhi/admin/sessions                              在线会话列表
+// GET  /xiaozhi/admin/sessions/{device_id}?limit=20         会话详情, 含最近对话和 MCP 工具
+// POST /xiaozhi/admin/sessions/{device_id}/close            断开设备
+// POST /xiaozhi/admin/sessions/{device_id}/clear_history    清空对话历史
+// POST /xiaozhi/admin/sessions/{device_id}/debug            临时开启设备调试日志
+func (a *App) handleAdminAPI(w http.ResponseWriter, r *http.Request) {
+	authToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(authToken), []byte(viper.GetString("admin_api.token"))) != 1 {
+		log.Warnf("管理接口认证失败")
+		http.Error(w, "认证失败", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, adminAPIPrefix), "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "不支持的HTTP方法", http.StatusMethodNotAllowed)
+			return
+		}
+		a.handleAdminListSessions(w, r)
+		return
+	}
+
+	deviceID, action, _ := strings.Cut(path, "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		a.handleAdminGetSession(w, r, deviceID)
+	case action == "close" && r.Method == http.MethodPost:
+		a.handleAdminCloseSession(w, r, deviceID)
+	case action == "clear_history" && r.Method == http.MethodPost:
+		a.handleAdminClearHistory(w, r, deviceID)
+	case action == "debug" && r.Method == http.MethodPost:
+		a.handleAdminDeviceDebug(w, r, deviceID)
+	case action == "" || action == "close" || action == "clear_history" || action == "debug":
+		http.Error(w, "不支持的HTTP方法", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// adminNodeID 开启集群时返回本节点ID, 列表只包含本节点的会话
+func (a *App) adminNodeID() string {
+	if a.cluster == nil {
+		return ""
+	}
+	return a.cluster.NodeID()
+}
+
+func (a *App) handleAdminListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions := make([]chat.SessionInfo, 0, a.chatManagers.Count())
+	for tuple := range a.chatManagers.IterBuffered() {
+		sessions = append(sessions, tuple.Val.Info())
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].DeviceID < sessions[j].DeviceID
+	})
+	writeAdminJSON(w, map[string]interface{}{
+		"node_id":  a.adminNodeID(),
+		"count":    len(sessions),
+		"sessions": sessions,
+	})
+}
+
+func (a *App) handleAdminGetSession(w http.ResponseWriter, r *http.Request, deviceID string) {
+	chatManager, ok := a.GetChatManager(deviceID)
+	if !ok {
+		http.Error(w, "设备不在线", http.StatusNotFound)
+		return
+	}
+	limit := adminDialogueLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	debugUntil, debug := log.DeviceDebugUntil(deviceID)
+
+	body := map[string]interface{}{
+		"node_id":  a.adminNodeID(),
+		"session":  chatManager.Info(),
+		"dialogue": chatManager.RecentDialogue(limit),
+		"tools":    chatManager.Tools(r.Context()),
+		"debug":    debug,
+	}
+	if debug {
+		body["debug_until"] = debugUntil.Unix()
+	}
+	writeAdminJSON(w, body)
+}
+
+func (a *App) handleAdminCloseSession(w http.ResponseWriter, r *http.Request, deviceID string) {
+	closed := a.CloseChatManager(deviceID)
+	if closed {
+		log.Infof("管理接口断开设备 %s", deviceID)
+	}
+	writeAdminJSON(w, map[string]interface{}{
+		"device_id": deviceID,
+		"closed":    closed,
+	})
+}
+
+// handleAdminClearHistory 设备不在线时只清空持久化的对话历史和各智能体下的记忆摘要
+func (a *App) handleAdminClearHistory(w http.ResponseWriter, r *http.Request, deviceID string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var err error
+	if chatManager, ok := a.GetChatManager(deviceID); ok {
+		err = chatManager.ClearHistory(ctx)
+	} else {
+		err = llm_memory.Get().ResetMemory(ctx, deviceID, "")
+	}
+	if err != nil {
+		log.Errorf("设备 %s 清空对话历史失败: %v", deviceID, err)
+		http.Error(w, "清空对话历史失败", http.StatusInternalServerError)
+		return
+	}
+	log.Infof("管理接口清空设备 %s 的对话历史", deviceID)
+	writeAdminJSON(w, map[string]interface{}{
+		"device_id": deviceID,
+		"cleared":   true,
+	})
+}
+
+// handleAdminDeviceDebug 临时输出设备的调试日志, duration_seconds 为 0 时关闭
+func (a *App) handleAdminDeviceDebug(w http.ResponseWriter, r *http.Request, deviceID string) {
+	var req struct {
+		DurationSeconds *int `json:"duration_seconds"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "请求体解析失败", http.StatusBadRequest)
+			return
+		}
+	}
+	duration := adminDebugDuration
+	if req.DurationSeconds != nil {
+		duration = time.Duration(*req.DurationSeconds) * time.Second
+	}
+
+	log.SetDeviceDebug(deviceID, duration)
+	body := map[string]interface{}{
+		"device_id": deviceID,
+		"debug":     duration > 0,
+	}
+	if duration > 0 {
+		body["debug_until"] = time.Now().Add(duration).Unix()
+		log.Infof("管理接口开启设备 %s 调试日志 %v", deviceID, duration)
+	} else {
+		log.Infof("管理接口关闭设备 %s 调试日志", deviceID)
+	}
+	writeAdminJSON(w, body)
+}
+
+func writeAdminJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Errorf("管理接口响应编码失败: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/chat"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	cmap "github.com/orcaman/concurrent-map/v2"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAPI(t *testing.T) {
+	viper.Set("admin_api.enable", true)
+	viper.Set("admin_api.token", "secret")
+	defer viper.Set("admin_api.enable", false)
+
+	app := &App{chatManagers: cmap.New[*chat.ChatManager]()}
+	mux := http.NewServeMux()
+	app.registerAdminAPI(mux)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/xiaozhi/admin/sessions", "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/xiaozhi/admin/sessions", "wrong", "").Code)
+
+	rec := do("GET", "/xiaozhi/admin/sessions", "secret", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list struct {
+		Count    int                `json:"count"`
+		Sessions []chat.SessionInfo `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Equal(t, 0, list.Count)
+	assert.Empty(t, list.Sessions)
+
+	assert.Equal(t, http.StatusNotFound, do("GET", "/xiaozhi/admin/sessions/d1", "secret", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do("GET", "/xiaozhi/admin/sessions/d1/close", "secret", "").Code)
+	assert.Equal(t, http.StatusNotFound, do("POST", "/xiaozhi/admin/sessions/d1/unknown", "secret", "").Code)
+
+	rec = do("POST", "/xiaozhi/admin/sessions/d1/close", "secret", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"closed":false`)
+
+	// 开启设备调试日志, 再关闭
+	rec = do("POST", "/xiaozhi/admin/sessions/d1/debug", "secret", `{"duration_seconds":60}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, debug := log.DeviceDebugUntil("d1")
+	assert.True(t, debug)
+
+	rec = do("POST", "/xiaozhi/admin/sessions/d1/debug", "secret", `{"duration_seconds":0}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, debug = log.DeviceDebugUntil("d1")
+	assert.False(t, debug)
+}
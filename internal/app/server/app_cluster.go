@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/chat"
+	"xiaozhi-esp32-server-golang/internal/app/server/cluster"
+	"xiaozhi-esp32-server-golang/internal/app/server/manager_client"
+	redisdb "xiaozhi-esp32-server-golang/internal/db/redis"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/spf13/viper"
+)
+
+// newCluster 开启集群时设备归属和节点注册保存在 redis 中, 未初始化 redis 时不开启
+func (a *App) newCluster() *cluster.Cluster {
+	if !viper.GetBool("cluster.enable") {
+		return nil
+	}
+	client := redisdb.GetClient()
+	if client == nil {
+		log.Errorf("集群依赖 redis, redis 未初始化, 以单节点运行")
+		return nil
+	}
+	config := cluster.Config{
+		NodeID:         cluster.LocalNodeID(),
+		KeyPrefix:      viper.GetString("redis.key_prefix"),
+		NodeTTL:        time.Duration(viper.GetInt("cluster.node_ttl_seconds")) * time.Second,
+		RequestTimeout: time.Duration(viper.GetInt("cluster.request_timeout_seconds")) * time.Second,
+	}
+	return cluster.New(client, config, cluster.WithLocalDevices(a.chatManagers.Keys))
+}
+
+// startCluster 注册节点间转发的请求并启动集群, 需在接受连接前调用
+func (a *App) startCluster() {
+	if a.cluster == nil {
+		return
+	}
+	a.cluster.Handle("/api/device/speak", func(ctx context.Context, body map[string]interface{}) (int, map[string]interface{}, error) {
+		return a.handleSpeak(body, a.speakLocal)
+	})
+	a.cluster.Handle("/api/device/mcp/call", func(ctx context.Context, body map[string]interface{}) (int, map[string]interface{}, error) {
+		return a.handleDeviceTool(ctx, body, a.callDeviceToolLocal)
+	})
+	a.cluster.Handle("/cluster/device/close", a.handleClusterDeviceClose)
+
+	if err := a.cluster.Start(); err != nil {
+		log.Errorf("启动集群失败, 以单节点运行: %v", err)
+		a.cluster = nil
+	}
+}
+
+// Stop 退出前释放本节点持有的设备, 其它节点不再向本节点转发
+func (a *App) Stop() {
+	if a.cluster != nil {
+		a.cluster.Stop()
+	}
+}
+
+// remoteDeviceNode 设备连接在其它节点时返回该节点, 在本节点、不在线或未开启集群时为空
+func (a *App) remoteDeviceNode(ctx context.Context, deviceID string) string {
+	if a.cluster == nil {
+		return ""
+	}
+	if _, ok := a.chatManagers.Get(deviceID); ok {
+		return ""
+	}
+	nodeID, err := a.cluster.DeviceNode(ctx, deviceID)
+	if err != nil {
+		log.Errorf("查询设备 %s 所在节点失败: %v", deviceID, err)
+		return ""
+	}
+	if nodeID == a.cluster.NodeID() {
+		return ""
+	}
+	return nodeID
+}
+
+// claimDevice 设备上线时记录归属, 之前连接在其它节点时通知该节点关闭旧会话
+func (a *App) claimDevice(deviceID string) {
+	if a.cluster == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	prev, err := a.cluster.ClaimDevice(ctx, deviceID)
+	if err != nil {
+		log.Errorf("记录设备 %s 所在节点失败: %v", deviceID, err)
+		return
+	}
+	if prev == "" || prev == a.cluster.NodeID() {
+		return
+	}
+	log.Infof("设备 %s 从节点 %s 切换到本节点, 关闭旧会话", deviceID, prev)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, _, err := a.cluster.Forward(ctx, prev, "/cluster/device/close", map[string]interface{}{
+			"device_id": deviceID,
+		}); err != nil {
+			log.Warnf("通知节点 %s 关闭设备 %s 失败: %v", prev, deviceID, err)
+		}
+	}()
+}
+
+// releaseDevice 设备下线时清除归属, 设备已连接到其它节点时返回 false
+func (a *App) releaseDevice(deviceID string) bool {
+	if a.cluster == nil {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	released, err := a.cluster.ReleaseDevice(ctx, deviceID)
+	if err != nil {
+		log.Errorf("清除设备 %s 所在节点失败: %v", deviceID, err)
+		return true
+	}
+	return released
+}
+
+// handleClusterDeviceClose 设备已连接到其它节点, 关闭本节点的旧会话
+func (a *App) handleClusterDeviceClose(ctx context.Context, body map[string]interface{}) (int, map[string]interface{}, error) {
+	deviceID, _ := body["device_id"].(string)
+	if deviceID == "" {
+		return 400, nil, fmt.Errorf("缺少device_id参数")
+	}
+	closed := a.CloseChatManager(deviceID)
+	return 200, map[string]interface{}{"device_id": deviceID, "closed": closed}, nil
+}
+
+// closeDevice 关闭设备的会话, 设备连接在其它节点时通知该节点关闭
+func (a *App) closeDevice(ctx context.Context, deviceID string) bool {
+	nodeID := a.remoteDeviceNode(ctx, deviceID)
+	if nodeID == "" {
+		return a.CloseChatManager(deviceID)
+	}
+	_, body, err := a.cluster.Forward(ctx, nodeID, "/cluster/device/close", map[string]interface{}{
+		"device_id": deviceID,
+	})
+	if err != nil {
+		log.Warnf("通知节点 %s 关闭设备 %s 失败: %v", nodeID, deviceID, err)
+		return false
+	}
+	closed, _ := body["closed"].(bool)
+	return closed
+}
+
+// forwardSpeak 设备连接在其它节点时由该节点下发播报
+func (a *App) forwardSpeak(nodeID string, req *chat.SpeakRequest) (*chat.SpeakResult, error) {
+	result := &chat.SpeakResult{
+		DeviceID: req.DeviceID,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	status, body, err := a.cluster.Forward(ctx, nodeID, "/api/device/speak", map[string]interface{}{
+		"device_id": req.DeviceID,
+		"text":      req.Text,
+		"use_llm":   req.UseLlm,
+		"interrupt": req.Interrupt,
+	})
+	if body != nil {
+		if err := manager_client.MapToStruct(body, result); err != nil {
+			log.Errorf("解析节点 %s 播报结果失败: %v", nodeID, err)
+		}
+	}
+	switch {
+	case status == 404:
+		// 节点上已没有该设备的会话
+		result.Online = false
+		return result, nil
+	case err != nil:
+		return result, err
+	case status < 200 || status >= 300:
+		return result, fmt.Errorf("节点 %s 播报失败, 状态码: %d", nodeID, status)
+	}
+	return result, nil
+}
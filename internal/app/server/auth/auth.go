@@ -6,6 +6,11 @@ import (
 	"errors"
 	"sync"
 	"time"
+
+	i_redis "xiaozhi-esp32-server-golang/internal/db/redis"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
 )
 
 // ClientSession 表示一个客户端会话
@@ -20,8 +25,10 @@ type ClientSession struct {
 type AuthManager struct {
 	sessions map[string]*ClientSession
 	mutex    sync.RWMutex
-	// 令牌映射
-	tokens map[string]string // token -> deviceID
+	// 令牌存储, 未配置 redis 时为 nil, 使用本地 tokens
+	redisClient *redis.Client
+	keyPrefix   string
+	tokens      map[string]*TokenInfo // token -> TokenInfo
 }
 
 var authManager *AuthManager
@@ -38,8 +45,10 @@ func A() *AuthManager {
 // NewAuthManager 创建新的认证管理器
 func NewAuthManager() *AuthManager {
 	return &AuthManager{
-		sessions: make(map[string]*ClientSession),
-		tokens:   make(map[string]string),
+		sessions:    make(map[string]*ClientSession),
+		redisClient: i_redis.GetClient(),
+		keyPrefix:   viper.GetString("redis.key_prefix"),
+		tokens:      make(map[string]*TokenInfo),
 	}
 }
 
@@ -101,6 +110,13 @@ func (am *AuthManager) CleanupSessions(maxAge time.Duration) {
 			delete(am.sessions, id)
 		}
 	}
+
+	// 本地令牌过期清理, redis 中的令牌依赖 key 过期
+	for token, info := range am.tokens {
+		if info.ExpireAt <= now.Unix() {
+			delete(am.tokens, token)
+		}
+	}
 }
 
 // generateClientSessionID 生成随机会话ID
@@ -111,42 +127,3 @@ func generateClientSessionID() (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(b), nil
 }
-
-// ValidateToken 验证令牌
-func (am *AuthManager) ValidateToken(token string) bool {
-	return true
-	// 移除 "Bearer " 前缀
-	if len(token) > 7 && token[:7] == "Bearer " {
-		token = token[7:]
-	}
-
-	am.mutex.RLock()
-	_, exists := am.tokens[token]
-	am.mutex.RUnlock()
-
-	return exists
-}
-
-// RegisterToken 注册令牌
-func (am *AuthManager) RegisterToken(token string, deviceID string) {
-	// 移除 "Bearer " 前缀
-	if len(token) > 7 && token[:7] == "Bearer " {
-		token = token[7:]
-	}
-
-	am.mutex.Lock()
-	am.tokens[token] = deviceID
-	am.mutex.Unlock()
-}
-
-// RemoveToken 移除令牌
-func (am *AuthManager) RemoveToken(token string) {
-	// 移除 "Bearer " 前缀
-	if len(token) > 7 && token[:7] == "Bearer " {
-		token = token[7:]
-	}
-
-	am.mutex.Lock()
-	delete(am.tokens, token)
-	am.mutex.Unlock()
-}
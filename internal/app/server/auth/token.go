@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+// TokenInfo 令牌绑定的设备信息
+type TokenInfo struct {
+	DeviceID  string `json:"device_id"`
+	ClientID  string `json:"client_id"`
+	ExpireAt  int64  `json:"expire_at"` // unix 秒
+	CreatedAt int64  `json:"created_at"`
+}
+
+var ErrInvalidToken = errors.New("无效的令牌")
+
+// getTokenExpire 令牌有效期, 默认30天
+func getTokenExpire() time.Duration {
+	hours := viper.GetInt("auth.token_expire_hours")
+	if hours <= 0 {
+		hours = 720
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func (am *AuthManager) getTokenKey(token string) string {
+	return fmt.Sprintf("%s:auth:token:%s", am.keyPrefix, token)
+}
+
+// getDeviceTokenKey 设备下各 clientId 对应的令牌, HASH clientId -> token
+func (am *AuthManager) getDeviceTokenKey(deviceID string) string {
+	return fmt.Sprintf("%s:auth:device:%s", am.keyPrefix, deviceID)
+}
+
+func trimBearer(token string) string {
+	return strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+}
+
+// IssueToken 为设备签发令牌, 已有令牌剩余有效期超过一半时直接复用
+func (am *AuthManager) IssueToken(ctx context.Context, deviceID string, clientID string) (string, error) {
+	expire := getTokenExpire()
+	now := time.Now()
+
+	if token, info, err := am.getDeviceToken(ctx, deviceID, clientID); err != nil {
+		return "", err
+	} else if info != nil && time.Unix(info.ExpireAt, 0).Sub(now) > expire/2 {
+		return token, nil
+	}
+
+	token, err := generateClientSessionID()
+	if err != nil {
+		return "", err
+	}
+	info := &TokenInfo{
+		DeviceID:  deviceID,
+		ClientID:  clientID,
+		ExpireAt:  now.Add(expire).Unix(),
+		CreatedAt: now.Unix(),
+	}
+
+	if am.redisClient == nil {
+		am.mutex.Lock()
+		am.tokens[token] = info
+		am.mutex.Unlock()
+		return token, nil
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	deviceKey := am.getDeviceTokenKey(deviceID)
+	pipe := am.redisClient.TxPipeline()
+	pipe.Set(ctx, am.getTokenKey(token), data, expire)
+	pipe.HSet(ctx, deviceKey, clientID, token)
+	pipe.Expire(ctx, deviceKey, expire)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", fmt.Errorf("保存令牌失败: %w", err)
+	}
+
+	log.Infof("设备 %s 签发新令牌, 过期时间: %s", deviceID, time.Unix(info.ExpireAt, 0).Format(time.DateTime))
+	return token, nil
+}
+
+// getDeviceToken 获取设备 clientId 当前的有效令牌, 不存在时返回 nil
+func (am *AuthManager) getDeviceToken(ctx context.Context, deviceID string, clientID string) (string, *TokenInfo, error) {
+	if am.redisClient == nil {
+		am.mutex.RLock()
+		defer am.mutex.RUnlock()
+		for token, info := range am.tokens {
+			if info.DeviceID == deviceID && info.ClientID == clientID && info.ExpireAt > time.Now().Unix() {
+				return token, info, nil
+			}
+		}
+		return "", nil, nil
+	}
+
+	token, err := am.redisClient.HGet(ctx, am.getDeviceTokenKey(deviceID), clientID).Result()
+	if err == redis.Nil {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("获取设备令牌失败: %w", err)
+	}
+	info, err := am.getTokenInfo(ctx, token)
+	if err != nil || info == nil {
+		return "", nil, err
+	}
+	return token, info, nil
+}
+
+// getTokenInfo 获取令牌信息, 令牌不存在或已过期时返回 nil
+func (am *AuthManager) getTokenInfo(ctx context.Context, token string) (*TokenInfo, error) {
+	if am.redisClient == nil {
+		am.mutex.RLock()
+		info, ok := am.tokens[token]
+		am.mutex.RUnlock()
+		if !ok || info.ExpireAt <= time.Now().Unix() {
+			return nil, nil
+		}
+		return info, nil
+	}
+
+	data, err := am.redisClient.Get(ctx, am.getTokenKey(token)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取令牌失败: %w", err)
+	}
+	var info TokenInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("解析令牌失败: %w", err)
+	}
+	return &info, nil
+}
+
+// ValidateToken 验证令牌是否有效且与 Device-Id/Client-Id 绑定, 令牌签发时绑定了 clientId 的必须携带一致的 Client-Id
+func (am *AuthManager) ValidateToken(ctx context.Context, token string, deviceID string, clientID string) error {
+	token = trimBearer(token)
+	if token == "" {
+		return ErrInvalidToken
+	}
+
+	info, err := am.getTokenInfo(ctx, token)
+	if err != nil {
+		return err
+	}
+	if info == nil || info.DeviceID != deviceID {
+		return ErrInvalidToken
+	}
+	if info.ClientID != "" && info.ClientID != clientID {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// RevokeToken 吊销单个令牌, 返回令牌绑定的设备ID, 令牌不存在时为空
+func (am *AuthManager) RevokeToken(ctx context.Context, token string) (string, error) {
+	token = trimBearer(token)
+	info, err := am.getTokenInfo(ctx, token)
+	if err != nil || info == nil {
+		return "", err
+	}
+
+	if am.redisClient == nil {
+		am.mutex.Lock()
+		delete(am.tokens, token)
+		am.mutex.Unlock()
+		return info.DeviceID, nil
+	}
+
+	pipe := am.redisClient.TxPipeline()
+	pipe.Del(ctx, am.getTokenKey(token))
+	pipe.HDel(ctx, am.getDeviceTokenKey(info.DeviceID), info.ClientID)
+	if _, err = pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return info.DeviceID, nil
+}
+
+// RevokeDeviceTokens 吊销设备的所有令牌, 返回吊销的数量
+func (am *AuthManager) RevokeDeviceTokens(ctx context.Context, deviceID string) (int, error) {
+	if am.redisClient == nil {
+		am.mutex.Lock()
+		defer am.mutex.Unlock()
+		count := 0
+		for token, info := range am.tokens {
+			if info.DeviceID == deviceID {
+				delete(am.tokens, token)
+				count++
+			}
+		}
+		return count, nil
+	}
+
+	deviceKey := am.getDeviceTokenKey(deviceID)
+	tokens, err := am.redisClient.HGetAll(ctx, deviceKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("获取设备令牌失败: %w", err)
+	}
+
+	keys := []string{deviceKey}
+	for _, token := range tokens {
+		keys = append(keys, am.getTokenKey(token))
+	}
+	if err := am.redisClient.Del(ctx, keys...).Err(); err != nil {
+		return 0, fmt.Errorf("删除设备令牌失败: %w", err)
+	}
+
+	log.Infof("设备 %s 的 %d 个令牌已吊销", deviceID, len(tokens))
+	return len(tokens), nil
+}
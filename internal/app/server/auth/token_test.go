@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenLifecycle(t *testing.T) {
+	ctx := context.Background()
+	am := NewAuthManager()
+
+	token, err := am.IssueToken(ctx, "device-1", "client-1")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	// 有效期内重复签发复用同一令牌
+	again, err := am.IssueToken(ctx, "device-1", "client-1")
+	assert.NoError(t, err)
+	assert.Equal(t, token, again)
+
+	assert.NoError(t, am.ValidateToken(ctx, "Bearer "+token, "device-1", "client-1"))
+	assert.ErrorIs(t, am.ValidateToken(ctx, token, "device-2", "client-1"), ErrInvalidToken)
+	assert.ErrorIs(t, am.ValidateToken(ctx, token, "device-1", "client-2"), ErrInvalidToken)
+	// 令牌绑定了 clientId 时必须携带 Client-Id
+	assert.ErrorIs(t, am.ValidateToken(ctx, token, "device-1", ""), ErrInvalidToken)
+
+	count, err := am.RevokeDeviceTokens(ctx, "device-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.ErrorIs(t, am.ValidateToken(ctx, token, "device-1", "client-1"), ErrInvalidToken)
+}
+
+func TestRevokeToken(t *testing.T) {
+	ctx := context.Background()
+	am := NewAuthManager()
+
+	token, err := am.IssueToken(ctx, "device-1", "client-1")
+	assert.NoError(t, err)
+
+	deviceID, err := am.RevokeToken(ctx, "Bearer "+token)
+	assert.NoError(t, err)
+	assert.Equal(t, "device-1", deviceID)
+	assert.ErrorIs(t, am.ValidateToken(ctx, token, "device-1", "client-1"), ErrInvalidToken)
+
+	deviceID, err = am.RevokeToken(ctx, token)
+	assert.NoError(t, err)
+	assert.Empty(t, deviceID)
+}
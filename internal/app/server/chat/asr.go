@@ -6,6 +6,7 @@ import (
 	"time"
 	. "xiaozhi-esp32-server-golang/internal/data/client"
 	"xiaozhi-esp32-server-golang/internal/domain/audio"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -14,12 +15,24 @@ type ASRManagerOption func(*ASRManager)
 type ASRManager struct {
 	clientState     *ClientState
 	serverTransport *ServerTransport
+
+	bargeIn    *bargeInDetector    //服务端打断, 未开启时为 nil
+	bargeInPcm []float32           //攒够 vad 所需长度的音频
+	onBargeIn  func(pcm []float32) //触发打断时回调, pcm 为用户已说的话
+}
+
+// WithOnBargeIn 设置服务端打断的回调
+func WithOnBargeIn(f func(pcm []float32)) ASRManagerOption {
+	return func(a *ASRManager) {
+		a.onBargeIn = f
+	}
 }
 
 func NewASRManager(clientState *ClientState, serverTransport *ServerTransport, opts ...ASRManagerOption) *ASRManager {
 	asr := &ASRManager{
 		clientState:     clientState,
 		serverTransport: serverTransport,
+		bargeIn:         newBargeInDetector(),
 	}
 	for _, opt := range opts {
 		opt(asr)
@@ -45,20 +58,21 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 		}
 
 		for {
-			pcmFrame := make([]float32, frameSize)
+			// 丢包补偿的音频与当前帧一起解码输出
+			pcmFrame := make([]float32, frameSize*(1+audio.MaxConcealFrames))
 
 			select {
 			case opusFrame, ok := <-state.OpusAudioBuffer:
-				log.Debugf("processAsrAudio 收到音频数据, len: %d", len(opusFrame))
+				a.clientState.Logger.Debugf("processAsrAudio 收到音频数据, len: %d", len(opusFrame))
 				if !ok {
-					log.Debugf("processAsrAudio 音频通道已关闭")
+					a.clientState.Logger.Debugf("processAsrAudio 音频通道已关闭")
 					return
 				}
 
 				var skipVad bool
 				var haveVoice bool
 				clientHaveVoice := state.GetClientHaveVoice()
-				if state.Asr.AutoEnd || state.ListenMode == "manual" {
+				if state.Asr.AutoEnd || state.GetListenMode() == "manual" {
 					skipVad = true         //跳过vad
 					clientHaveVoice = true //之前有声音
 					haveVoice = true       //本次有声音
@@ -66,6 +80,7 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 
 				if state.GetClientVoiceStop() { //已停止 说话 则不接收音频数据
 					//log.Infof("客户端停止说话, 跳过音频数据")
+					a.detectBargeIn(opusFrame, pcmFrame, audioProcesser, vadNeedGetCount)
 					continue
 				}
 
@@ -76,6 +91,10 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 					log.Errorf("解码失败: %v", err)
 					continue
 				}
+				// 丢包标记, 等下一帧到达时补偿
+				if n == 0 {
+					continue
+				}
 
 				var vadPcmData []float32
 				pcmData := pcmFrame[:n]
@@ -83,9 +102,10 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 					//如果已经检测到语音, 则不进行vad检测, 直接将pcmData传给asr
 					if state.VadProvider == nil {
 						// 初始化vad
-						err = state.Vad.Init(state.DeviceConfig.Vad.Provider, state.DeviceConfig.Vad.Config)
+						err = state.Vad.Init(state.DeviceConfig.Vad.Provider, state.GetVadConfig())
 						if err != nil {
 							log.Errorf("初始化vad失败: %v", err)
+							metrics.IncProviderError("vad", state.DeviceConfig.Vad.Provider)
 							continue
 						}
 					}
@@ -100,6 +120,7 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 
 						if err != nil {
 							log.Errorf("processAsrAudio VAD检测失败: %v", err)
+							metrics.IncProviderError("vad", state.DeviceConfig.Vad.Provider)
 							//删除
 							continue
 						}
@@ -141,6 +162,7 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 					//vad识别成功, 往asr音频通道里发送数据
 					//log.Infof("vad识别成功, 往asr音频通道里发送数据, len: %d", len(pcmData))
 					state.Asr.AddAudioData(pcmData)
+					state.Recorder.WriteInput(pcmData)
 				}
 
 				//已经有语音了, 但本次没有检测到语音, 则需要判断是否已经停止说话
@@ -161,10 +183,64 @@ func (a *ASRManager) ProcessVadAudio(ctx context.Context, onClose func()) {
 	}()
 }
 
+// detectBargeIn tts 播放期间继续对上行音频做 vad, 用户持续说话时打断播放
+func (a *ASRManager) detectBargeIn(opusFrame []byte, pcmFrame []float32, audioProcesser *audio.AudioProcesser, vadNeedGetCount int) {
+	state := a.clientState
+	if a.bargeIn == nil || a.onBargeIn == nil {
+		return
+	}
+	// 手动拾音由设备控制; 没有回声消除的设备会听到自己的声音
+	if !state.GetTtsStart() || state.GetListenMode() == "manual" || (a.bargeIn.config.RequireAec && !state.DeviceAec) {
+		if a.bargeIn.Active() {
+			a.bargeIn.Reset()
+			a.bargeInPcm = nil
+			state.Vad.Reset()
+		}
+		return
+	}
+
+	n, err := audioProcesser.DecoderFloat32(opusFrame, pcmFrame)
+	if err != nil {
+		log.Errorf("解码失败: %v", err)
+		return
+	}
+	if n == 0 {
+		return
+	}
+	a.bargeInPcm = append(a.bargeInPcm, pcmFrame[:n]...)
+	frameSize := state.AsrAudioBuffer.PcmFrameSize
+	if len(a.bargeInPcm) < vadNeedGetCount*frameSize {
+		return
+	}
+	pcmData := a.bargeInPcm
+	a.bargeInPcm = nil
+
+	if state.VadProvider == nil {
+		if err := state.Vad.Init(state.DeviceConfig.Vad.Provider, state.GetVadConfig()); err != nil {
+			log.Errorf("初始化vad失败: %v", err)
+			metrics.IncProviderError("vad", state.DeviceConfig.Vad.Provider)
+			return
+		}
+	}
+	state.VadProvider.Reset()
+	haveVoice, err := state.VadProvider.IsVADExt(pcmData, state.InputAudioFormat.SampleRate, frameSize)
+	if err != nil {
+		log.Errorf("打断检测 VAD 失败: %v", err)
+		metrics.IncProviderError("vad", state.DeviceConfig.Vad.Provider)
+		return
+	}
+
+	if a.bargeIn.Feed(pcmData, haveVoice, vadNeedGetCount*state.InputAudioFormat.FrameDuration, time.Now()) {
+		speech := a.bargeIn.Speech()
+		a.bargeIn.Reset()
+		a.onBargeIn(speech)
+	}
+}
+
 // restartAsrRecognition 重启ASR识别
 func (a *ASRManager) RestartAsrRecognition(ctx context.Context) error {
 	state := a.clientState
-	log.Debugf("重启ASR识别开始")
+	a.clientState.Logger.Debugf("重启ASR识别开始")
 
 	// 取消当前ASR上下文
 	if state.Asr.Cancel != nil {
@@ -189,10 +265,11 @@ func (a *ASRManager) RestartAsrRecognition(ctx context.Context) error {
 	asrResultChannel, err := state.AsrProvider.StreamingRecognize(state.Asr.Ctx, state.Asr.AsrAudioChannel)
 	if err != nil {
 		log.Errorf("重启ASR流式识别失败: %v", err)
+		metrics.IncProviderError("asr", state.DeviceConfig.Asr.Provider)
 		return fmt.Errorf("重启ASR流式识别失败: %v", err)
 	}
 
 	state.AsrResultChannel = asrResultChannel
-	log.Debugf("重启ASR识别成功")
+	a.clientState.Logger.Debugf("重启ASR识别成功")
 	return nil
 }
@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"math"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// 检测到的语音中允许的最长停顿, 超过后重新计时
+const bargeInMaxGapMs = 120
+
+// 服务端打断后, 设备在该时间内发来的 listen start 不再重置识别
+const bargeInListenWindow = 2 * time.Second
+
+// bargeInConfig 服务端打断配置, 对应 config.yaml 中的 barge_in
+type bargeInConfig struct {
+	MinSpeechMs int     // 持续说话多久触发打断
+	MinEnergyDb float64 // 语音帧的最低能量(dBFS), 低于该值视为回声或噪声
+	GraceMs     int     // tts 开始播放后的保护时长, 期间不检测
+	CooldownMs  int     // 两次打断的最小间隔
+	RequireAec  bool    // 仅对声明了 aec 的设备开启
+}
+
+// bargeInDetector tts 播放期间检测用户是否开始说话
+type bargeInDetector struct {
+	config bargeInConfig
+
+	playingSince time.Time
+	lastTrigger  time.Time
+	speechMs     int
+	gapMs        int
+	speech       []float32 // 本次检测到的语音, 触发后送入新一轮 asr
+}
+
+// newBargeInDetector 未开启服务端打断时返回 nil
+func newBargeInDetector() *bargeInDetector {
+	if !viper.GetBool("barge_in.enable") {
+		return nil
+	}
+	config := bargeInConfig{
+		MinSpeechMs: viper.GetInt("barge_in.min_speech_ms"),
+		MinEnergyDb: viper.GetFloat64("barge_in.min_energy_db"),
+		GraceMs:     viper.GetInt("barge_in.grace_ms"),
+		CooldownMs:  viper.GetInt("barge_in.cooldown_ms"),
+		RequireAec:  true,
+	}
+	if viper.IsSet("barge_in.require_aec") {
+		config.RequireAec = viper.GetBool("barge_in.require_aec")
+	}
+	if config.MinSpeechMs <= 0 {
+		config.MinSpeechMs = 300
+	}
+	if config.MinEnergyDb == 0 {
+		config.MinEnergyDb = -40
+	}
+	return &bargeInDetector{config: config}
+}
+
+// Reset tts 播放结束或打断后调用
+func (d *bargeInDetector) Reset() {
+	d.playingSince = time.Time{}
+	d.resetSpeech()
+}
+
+func (d *bargeInDetector) resetSpeech() {
+	d.speechMs = 0
+	d.gapMs = 0
+	d.speech = nil
+}
+
+// Active 是否处于播放检测中
+func (d *bargeInDetector) Active() bool {
+	return !d.playingSince.IsZero()
+}
+
+// Feed 输入一段播放期间收到的音频及其 vad 结果, 返回 true 表示应当打断
+func (d *bargeInDetector) Feed(pcm []float32, haveVoice bool, durationMs int, now time.Time) bool {
+	if d.playingSince.IsZero() {
+		d.playingSince = now
+	}
+	// 刚开始播放时设备端回声消除尚未收敛, 且刚打断过时不再触发
+	if now.Sub(d.playingSince) < time.Duration(d.config.GraceMs)*time.Millisecond ||
+		now.Sub(d.lastTrigger) < time.Duration(d.config.CooldownMs)*time.Millisecond {
+		return false
+	}
+
+	if haveVoice && energyDb(pcm) >= d.config.MinEnergyDb {
+		d.speechMs += durationMs
+		d.gapMs = 0
+		d.speech = append(d.speech, pcm...)
+	} else if d.speechMs > 0 {
+		d.gapMs += durationMs
+		if d.gapMs > bargeInMaxGapMs {
+			d.resetSpeech()
+			return false
+		}
+		d.speech = append(d.speech, pcm...)
+	}
+
+	if d.speechMs < d.config.MinSpeechMs {
+		return false
+	}
+	d.lastTrigger = now
+	return true
+}
+
+// Speech 触发打断的语音
+func (d *bargeInDetector) Speech() []float32 {
+	return d.speech
+}
+
+// energyDb 计算音频的均方根能量, 单位 dBFS
+func energyDb(pcm []float32) float64 {
+	if len(pcm) == 0 {
+		return math.Inf(-1)
+	}
+	var sum float64
+	for _, v := range pcm {
+		sum += float64(v) * float64(v)
+	}
+	rms := math.Sqrt(sum / float64(len(pcm)))
+	if rms == 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(rms)
+}
@@ -0,0 +1,73 @@
+package chat
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tone 生成指定能量(dBFS)的 60ms 正弦音频
+func tone(db float64) []float32 {
+	amplitude := math.Pow(10, db/20) * math.Sqrt2
+	pcm := make([]float32, 960)
+	for i := range pcm {
+		pcm[i] = float32(amplitude * math.Sin(2*math.Pi*440*float64(i)/16000))
+	}
+	return pcm
+}
+
+func TestBargeInDetector(t *testing.T) {
+	d := &bargeInDetector{config: bargeInConfig{
+		MinSpeechMs: 300,
+		MinEnergyDb: -40,
+		GraceMs:     500,
+		CooldownMs:  2000,
+	}}
+	now := time.Now()
+	feed := func(pcm []float32, haveVoice bool) bool {
+		triggered := d.Feed(pcm, haveVoice, 60, now)
+		now = now.Add(60 * time.Millisecond)
+		return triggered
+	}
+
+	// 播放刚开始的保护时间内不检测
+	for i := 0; i < 8; i++ {
+		assert.False(t, feed(tone(-20), true))
+	}
+	assert.Empty(t, d.Speech())
+
+	// 能量不足视为回声
+	for i := 0; i < 10; i++ {
+		assert.False(t, feed(tone(-50), true))
+	}
+
+	// 短暂停顿不影响计时, 停顿过长重新计时
+	for i := 0; i < 3; i++ {
+		assert.False(t, feed(tone(-20), true))
+	}
+	assert.False(t, feed(tone(-20), false))
+	assert.False(t, feed(tone(-20), true))
+	assert.False(t, feed(tone(-20), false))
+	assert.False(t, feed(tone(-20), false))
+	assert.False(t, feed(tone(-20), false))
+	assert.Empty(t, d.Speech())
+
+	for i := 0; i < 4; i++ {
+		assert.False(t, feed(tone(-20), true))
+	}
+	assert.True(t, feed(tone(-20), true))
+	assert.Len(t, d.Speech(), 5*960)
+
+	// 冷却时间(2s)内不再触发, 之后重新计时
+	d.Reset()
+	for i := 0; i < 33; i++ {
+		assert.False(t, feed(tone(-20), true))
+	}
+	assert.Empty(t, d.Speech())
+	for i := 0; i < 4; i++ {
+		assert.False(t, feed(tone(-20), true))
+	}
+	assert.True(t, feed(tone(-20), true))
+}
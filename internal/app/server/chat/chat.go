@@ -2,7 +2,9 @@ package chat
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/spf13/viper"
 
@@ -11,8 +13,10 @@ import (
 	types_audio "xiaozhi-esp32-server-golang/internal/data/audio"
 	. "xiaozhi-esp32-server-golang/internal/data/client"
 	userconfig "xiaozhi-esp32-server-golang/internal/domain/config"
+	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_memory "xiaozhi-esp32-server-golang/internal/domain/llm/memory"
 	"xiaozhi-esp32-server-golang/internal/domain/vad/silero_vad"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -24,6 +28,13 @@ type ChatManager struct {
 	session     *ChatSession
 	ctx         context.Context
 	cancel      context.CancelFunc
+
+	mu         sync.Mutex
+	closing    bool
+	detached   bool // 连接已断开, 等待设备重连恢复会话
+	graceTimer *time.Timer
+
+	startedAt time.Time
 }
 
 type ChatManagerOption func(*ChatManager)
@@ -32,6 +43,7 @@ func NewChatManager(deviceID string, transport types_conn.IConn, options ...Chat
 	cm := &ChatManager{
 		DeviceID:  deviceID,
 		transport: transport,
+		startedAt: time.Now(),
 	}
 
 	for _, option := range options {
@@ -42,7 +54,7 @@ func NewChatManager(deviceID string, transport types_conn.IConn, options ...Chat
 
 	cm.ctx, cm.cancel = context.WithCancel(ctx)
 
-	cm.transport.OnClose(cm.OnClose)
+	cm.watchTransport(cm.transport)
 
 	clientState, err := GenClientState(cm.ctx, cm.DeviceID)
 	if err != nil {
@@ -81,10 +93,10 @@ func GenClientState(pctx context.Context, deviceID string) (*ClientState, error)
 	// 创建带取消功能的上下文
 	ctx, cancel := context.WithCancel(pctx)
 
-	maxSilenceDuration := viper.GetInt64("chat.chat_max_silence_duration")
-	if maxSilenceDuration == 0 {
-		maxSilenceDuration = 200
-	}
+	// 根据智能体的语音识别速度决定断句的静音阈值
+	asrSpeedProfile := GetAsrSpeedProfile(deviceConfig.AsrSpeed)
+	logger := log.WithDevice(deviceID)
+	logger.Debugf("asr_speed: %s, 断句参数: %+v", deviceConfig.AsrSpeed, asrSpeedProfile)
 
 	isDeviceActivated, err := configProvider.IsDeviceActivated(ctx, deviceID, "")
 	if err != nil {
@@ -98,6 +110,7 @@ func GenClientState(pctx context.Context, deviceID string) (*ClientState, error)
 		ListenMode:   "auto",
 		DeviceID:     deviceID,
 		AgentID:      deviceConfig.AgentId,
+		Logger:       logger,
 		Ctx:          ctx,
 		Cancel:       cancel,
 		SystemPrompt: deviceConfig.SystemPrompt,
@@ -118,7 +131,7 @@ func GenClientState(pctx context.Context, deviceID string) (*ClientState, error)
 			HaveVoice:            false,
 			HaveVoiceLastTime:    0,
 			VoiceStop:            false,
-			SilenceThresholdTime: maxSilenceDuration,
+			SilenceThresholdTime: asrSpeedProfile.SilenceDuration,
 		},
 		SessionCtx: Ctx{},
 	}
@@ -129,6 +142,14 @@ func GenClientState(pctx context.Context, deviceID string) (*ClientState, error)
 	}
 	clientState.InitMessages(historyMessages)
 
+	// 注入长期记忆
+	injectMemorySummary(ctx, clientState)
+
+	// 引导 LLM 在回复开头输出表情
+	if viper.GetBool("emotion.enable") {
+		clientState.SystemPrompt = fmt.Sprintf("%s\n%s", clientState.SystemPrompt, llm.EmotionPrompt)
+	}
+
 	ttsType := clientState.DeviceConfig.Tts.Provider
 	//如果使用 xiaozhi tts，则固定使用24000hz, 20ms帧长
 	if ttsType == constants.TtsTypeXiaozhi || ttsType == constants.TtsTypeEdgeOffline {
@@ -145,14 +166,30 @@ func (c *ChatManager) Start() error {
 		log.Errorf("ChatManager启动失败: %v", err)
 		return err
 	}
+
+	activeSessions := metrics.ActiveSessions.WithLabelValues(c.GetTransportType())
+	activeSessions.Inc()
+	defer activeSessions.Dec()
+
 	select {
 	case <-c.ctx.Done():
 	}
+
+	// 会话结束, 进行长期记忆总结
+	summaryMemoryAsync(c.clientState, sessionEndSummaryMinCount)
 	return nil
 }
 
 // 主动关闭断开连接
 func (c *ChatManager) Close() error {
+	c.mu.Lock()
+	c.closing = true
+	c.detached = false
+	if c.graceTimer != nil {
+		c.graceTimer.Stop()
+	}
+	c.mu.Unlock()
+
 	if c.clientState != nil {
 		log.Infof("主动关闭断开连接, 设备 %s", c.clientState.DeviceID)
 	}
@@ -168,9 +205,21 @@ func (c *ChatManager) Close() error {
 }
 
 func (c *ChatManager) OnClose(deviceId string) {
+	c.mu.Lock()
+	if c.detached {
+		c.mu.Unlock()
+		return
+	}
 	log.Infof("设备 %s 断开连接", deviceId)
+	detached := c.detach()
+	transport := c.transport
+	c.mu.Unlock()
+
+	if detached {
+		transport.Close()
+		return
+	}
 	c.cancel()
-	return
 }
 
 func (c *ChatManager) GetClientState() *ClientState {
@@ -180,3 +229,9 @@ func (c *ChatManager) GetClientState() *ClientState {
 func (c *ChatManager) GetDeviceId() string {
 	return c.clientState.DeviceID
 }
+
+func (c *ChatManager) GetTransportType() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.transport.GetTransportType()
+}
@@ -0,0 +1,346 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/auth"
+	types_conn "xiaozhi-esp32-server-golang/internal/app/server/types"
+	. "xiaozhi-esp32-server-golang/internal/data/msg"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	tts_mock "xiaozhi-esp32-server-golang/internal/domain/tts/mock"
+)
+
+// fakeConn 内存中的 IConn 实现, 模拟设备端
+type fakeConn struct {
+	deviceID  string
+	recvCmd   chan []byte
+	recvAudio chan []byte
+	sentCmd   chan []byte
+	sentAudio chan []byte
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	onClose   func(deviceId string)
+}
+
+func newFakeConn(deviceID string) *fakeConn {
+	return &fakeConn{
+		deviceID:  deviceID,
+		recvCmd:   make(chan []byte, 10),
+		recvAudio: make(chan []byte, 100),
+		sentCmd:   make(chan []byte, 100),
+		sentAudio: make(chan []byte, 1000),
+		closed:    make(chan struct{}),
+	}
+}
+
+func (c *fakeConn) SendCmd(msg []byte) error {
+	c.sentCmd <- msg
+	return nil
+}
+
+func (c *fakeConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	return c.recv(ctx, c.recvCmd, timeout)
+}
+
+func (c *fakeConn) SendAudio(audio []byte) error {
+	c.sentAudio <- audio
+	return nil
+}
+
+func (c *fakeConn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	return c.recv(ctx, c.recvAudio, timeout)
+}
+
+func (c *fakeConn) recv(ctx context.Context, ch chan []byte, timeout int) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, errors.New("connection is closed")
+	case msg := <-ch:
+		return msg, nil
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return nil, errors.New("timeout")
+	}
+}
+
+func (c *fakeConn) GetDeviceID() string {
+	return c.deviceID
+}
+
+func (c *fakeConn) Close() error {
+	first := false
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		first = true
+	})
+	// 断开回调中可能再次调用 Close
+	if first && c.onClose != nil {
+		c.onClose(c.deviceID)
+	}
+	return nil
+}
+
+func (c *fakeConn) OnClose(f func(deviceId string)) {
+	c.onClose = f
+}
+
+func (c *fakeConn) CloseAudioChannel() error {
+	return nil
+}
+
+func (c *fakeConn) GetTransportType() string {
+	return types_conn.TransportTypeWebsocket
+}
+
+func (c *fakeConn) GetData(key string) (interface{}, error) {
+	return nil, errors.New("not found")
+}
+
+func (c *fakeConn) sendCmd(t *testing.T, msg interface{}) {
+	data, err := json.Marshal(msg)
+	require.NoError(t, err)
+	c.recvCmd <- data
+}
+
+// waitCmd 等待下一条服务端信令
+func (c *fakeConn) waitCmd(t *testing.T) ServerMessage {
+	select {
+	case data := <-c.sentCmd:
+		var msg ServerMessage
+		require.NoError(t, json.Unmarshal(data, &msg))
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待服务端消息超时")
+	}
+	return ServerMessage{}
+}
+
+func setupMockConfig() {
+	viper.Set("config_provider.type", "redis")
+	viper.Set("auth.enable", false)
+	viper.Set("emotion.enable", false)
+	viper.Set("memory.summary.enable", false)
+	viper.Set("system_prompt", "你是小智")
+
+	viper.Set("vad.provider", "webrtc_vad")
+	viper.Set("asr.provider", "mock")
+	viper.Set("asr.mock", map[string]interface{}{
+		"text": "你好",
+		"transcripts": []interface{}{
+			map[string]interface{}{"min_duration": 300, "text": "今天天气怎么样"},
+		},
+	})
+	viper.Set("llm.provider", "mock")
+	viper.Set("llm.mock", map[string]interface{}{
+		"type":  "mock",
+		"reply": "今天是晴天。",
+	})
+	viper.Set("tts.provider", "mock")
+	viper.Set("tts.mock", map[string]interface{}{
+		"mode":        "tone",
+		"ms_per_char": 60,
+	})
+}
+
+func TestChatEndToEnd(t *testing.T) {
+	setupMockConfig()
+	require.NoError(t, auth.Init())
+	mcp.GetGlobalMCPManager()
+
+	conn := newFakeConn("e2e-device")
+	cm, err := NewChatManager(conn.deviceID, conn)
+	require.NoError(t, err)
+	go cm.Start()
+	defer cm.Close()
+
+	audioParams := map[string]interface{}{
+		"format":         "opus",
+		"sample_rate":    16000,
+		"channels":       1,
+		"frame_duration": 60,
+	}
+
+	// hello
+	conn.sendCmd(t, map[string]interface{}{
+		"type":         MessageTypeHello,
+		"device_id":    conn.deviceID,
+		"transport":    types_conn.TransportTypeWebsocket,
+		"audio_params": audioParams,
+	})
+	hello := conn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeHello, hello.Type)
+	require.NotNil(t, hello.AudioFormat)
+
+	// listen start, 手动模式跳过 vad
+	conn.sendCmd(t, map[string]interface{}{
+		"type":      MessageTypeListen,
+		"device_id": conn.deviceID,
+		"state":     MessageStateStart,
+		"mode":      "manual",
+	})
+	// 等待 asr 启动后再上传音频
+	time.Sleep(200 * time.Millisecond)
+
+	// 上传约 1s 的音频, 命中 min_duration 300 的识别结果, 不足时返回默认的 "你好"
+	frames, err := tts_mock.NewMockTTSProvider(map[string]interface{}{"ms_per_char": 200}).
+		TextToSpeech(context.Background(), "一二三四五", 16000, 1, 60)
+	require.NoError(t, err)
+	for _, frame := range frames {
+		conn.recvAudio <- frame
+	}
+	require.Eventually(t, func() bool {
+		return len(conn.recvAudio) == 0 && len(cm.clientState.OpusAudioBuffer) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	conn.sendCmd(t, map[string]interface{}{
+		"type":      MessageTypeListen,
+		"device_id": conn.deviceID,
+		"state":     MessageStateStop,
+	})
+
+	stt := conn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeStt, stt.Type)
+	assert.Equal(t, "今天天气怎么样", stt.Text)
+
+	ttsStart := conn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeTts, ttsStart.Type)
+	assert.Equal(t, MessageStateStart, ttsStart.State)
+
+	sentenceStart := conn.waitCmd(t)
+	assert.Equal(t, MessageStateSentenceStart, sentenceStart.State)
+	assert.Equal(t, "今天是晴天。", sentenceStart.Text)
+
+	sentenceEnd := conn.waitCmd(t)
+	assert.Equal(t, MessageStateSentenceEnd, sentenceEnd.State)
+
+	ttsStop := conn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeTts, ttsStop.Type)
+	assert.Equal(t, MessageStateStop, ttsStop.State)
+
+	// 6 个字 * 60ms, 每帧 60ms
+	assert.Equal(t, 6, len(conn.sentAudio))
+}
+
+func TestChatTextOnly(t *testing.T) {
+	setupMockConfig()
+	require.NoError(t, auth.Init())
+	mcp.GetGlobalMCPManager()
+
+	conn := newFakeConn("text-only-device")
+	cm, err := NewChatManager(conn.deviceID, conn)
+	require.NoError(t, err)
+	go cm.Start()
+	defer cm.Close()
+
+	// 纯文本客户端不携带 audio_params
+	conn.sendCmd(t, map[string]interface{}{
+		"type":      MessageTypeHello,
+		"device_id": conn.deviceID,
+		"transport": types_conn.TransportTypeWebsocket,
+		"features":  map[string]bool{"text_only": true},
+	})
+	hello := conn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeHello, hello.Type)
+
+	conn.sendCmd(t, map[string]interface{}{
+		"type":      MessageTypeChat,
+		"device_id": conn.deviceID,
+		"text":      "今天天气怎么样",
+	})
+
+	ttsStart := conn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeTts, ttsStart.Type)
+	assert.Equal(t, MessageStateStart, ttsStart.State)
+
+	text := conn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeText, text.Type)
+	assert.Equal(t, "今天是晴天。", text.Text)
+
+	ttsStop := conn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeTts, ttsStop.Type)
+	assert.Equal(t, MessageStateStop, ttsStop.State)
+
+	assert.Equal(t, 0, len(conn.sentAudio))
+}
+
+func TestChatStreamingInputTTS(t *testing.T) {
+	setupMockConfig()
+	viper.Set("llm.mock", map[string]interface{}{
+		"type":       "mock",
+		"reply":      "今天是晴天。适合出门。",
+		"chunk_size": 3,
+	})
+	viper.Set("tts.mock", map[string]interface{}{
+		"mode":            "tone",
+		"ms_per_char":     60,
+		"streaming_input": true,
+	})
+	defer setupMockConfig()
+	require.NoError(t, auth.Init())
+	mcp.GetGlobalMCPManager()
+
+	conn := newFakeConn("streaming-input-device")
+	cm, err := NewChatManager(conn.deviceID, conn)
+	require.NoError(t, err)
+	go cm.Start()
+	defer cm.Close()
+
+	conn.sendCmd(t, map[string]interface{}{
+		"type":      MessageTypeHello,
+		"device_id": conn.deviceID,
+		"transport": types_conn.TransportTypeWebsocket,
+		"audio_params": map[string]interface{}{
+			"format":         "opus",
+			"sample_rate":    16000,
+			"channels":       1,
+			"frame_duration": 60,
+		},
+	})
+	hello := conn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeHello, hello.Type)
+	assert.True(t, cm.session.ttsManager.supportStreamingInput())
+
+	conn.sendCmd(t, map[string]interface{}{
+		"type":      MessageTypeChat,
+		"device_id": conn.deviceID,
+		"text":      "今天天气怎么样",
+	})
+
+	ttsStart := conn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeTts, ttsStart.Type)
+	assert.Equal(t, MessageStateStart, ttsStart.State)
+
+	// 增量文本直接送入TTS, 字幕仍按句下发, 且在播放到该句时才下发
+	for i, text := range []string{"今天是晴天。", "适合出门。"} {
+		sentenceStart := conn.waitCmd(t)
+		assert.Equal(t, MessageStateSentenceStart, sentenceStart.State)
+		assert.Equal(t, text, sentenceStart.Text)
+		if i == 1 {
+			// 第一句 6 个字 * 60ms, 即 6 帧之后
+			sent := len(conn.sentAudio)
+			assert.True(t, sent == 6 || sent == 7, "sent: %d", sent)
+		}
+		sentenceEnd := conn.waitCmd(t)
+		assert.Equal(t, MessageStateSentenceEnd, sentenceEnd.State)
+		assert.Equal(t, text, sentenceEnd.Text)
+	}
+
+	ttsStop := conn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeTts, ttsStop.Type)
+	assert.Equal(t, MessageStateStop, ttsStop.State)
+
+	// 11 个字 * 60ms, 每帧 60ms
+	assert.Equal(t, 11, len(conn.sentAudio))
+}
@@ -0,0 +1,119 @@
+package chat
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	llm_memory "xiaozhi-esp32-server-golang/internal/domain/llm/memory"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// SessionInfo 会话运行时状态, 供管理接口查询
+type SessionInfo struct {
+	DeviceID      string            `json:"device_id"`
+	AgentID       string            `json:"agent_id"`
+	SessionID     string            `json:"session_id"`
+	Transport     string            `json:"transport"`
+	Status        string            `json:"status"`
+	ListenMode    string            `json:"listen_mode"`
+	Detached      bool              `json:"detached"` // 连接已断开, 等待重连恢复
+	StartedAt     int64             `json:"started_at"`
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	LastActiveAt  int64             `json:"last_active_at"` // 毫秒
+	Providers     map[string]string `json:"providers"`
+}
+
+// DialogueMessage 对话历史中的一条消息
+type DialogueMessage struct {
+	Role      string   `json:"role"`
+	Content   string   `json:"content"`
+	ToolCalls []string `json:"tool_calls,omitempty"`
+}
+
+// SessionTool 会话可用的 MCP 工具, Device 为 true 时由设备上报
+type SessionTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Device      bool   `json:"device"`
+}
+
+// Info 获取会话运行时状态
+func (c *ChatManager) Info() SessionInfo {
+	state := c.clientState
+	config := state.DeviceConfig
+	providers := map[string]string{
+		"asr": config.Asr.Provider,
+		"llm": config.Llm.Provider,
+		"tts": config.Tts.Provider,
+		"vad": config.Vad.Provider,
+	}
+	if modelName, ok := config.Llm.Config["model_name"].(string); ok && modelName != "" {
+		providers["llm_model"] = modelName
+	}
+
+	return SessionInfo{
+		DeviceID:      c.DeviceID,
+		AgentID:       state.AgentID,
+		SessionID:     state.GetSessionID(),
+		Transport:     c.GetTransportType(),
+		Status:        state.GetStatus(),
+		ListenMode:    state.GetListenMode(),
+		Detached:      c.IsDetached(),
+		StartedAt:     c.startedAt.Unix(),
+		UptimeSeconds: int64(time.Since(c.startedAt).Seconds()),
+		LastActiveAt:  c.session.lastActiveAt.Load(),
+		Providers:     providers,
+	}
+}
+
+// RecentDialogue 获取最近 count 条对话
+func (c *ChatManager) RecentDialogue(count int) []DialogueMessage {
+	messages := c.clientState.GetMessages(count)
+	dialogue := make([]DialogueMessage, 0, len(messages))
+	for _, msg := range messages {
+		item := DialogueMessage{
+			Role:    string(msg.Role),
+			Content: msg.Content,
+		}
+		for _, toolCall := range msg.ToolCalls {
+			item.ToolCalls = append(item.ToolCalls, toolCall.Function.Name)
+		}
+		dialogue = append(dialogue, item)
+	}
+	return dialogue
+}
+
+// Tools 获取会话可用的 MCP 工具, 按名称排序
+func (c *ChatManager) Tools(ctx context.Context) []SessionTool {
+	allTools, err := mcp.GetToolsByDeviceId(c.DeviceID, c.clientState.AgentID)
+	if err != nil {
+		log.Errorf("获取设备 %s 的工具失败: %v", c.DeviceID, err)
+	}
+	deviceTools := make(map[string]bool)
+	if mcpSession := mcp.GetDeviceMcpClient(c.DeviceID); mcpSession != nil {
+		for name := range mcpSession.GetTools() {
+			deviceTools[name] = true
+		}
+	}
+
+	tools := make([]SessionTool, 0, len(allTools))
+	for name, invokableTool := range allTools {
+		item := SessionTool{Name: name, Device: deviceTools[name]}
+		if info, err := invokableTool.Info(ctx); err == nil && info != nil {
+			item.Description = info.Desc
+		}
+		tools = append(tools, item)
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name < tools[j].Name
+	})
+	return tools
+}
+
+// ClearHistory 清空当前会话及持久化的对话历史
+func (c *ChatManager) ClearHistory(ctx context.Context) error {
+	c.clientState.ClearMessages()
+	return llm_memory.Get().ResetMemory(ctx, c.DeviceID, c.clientState.AgentID)
+}
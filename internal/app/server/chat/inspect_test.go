@@ -0,0 +1,53 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/auth"
+	types_conn "xiaozhi-esp32-server-golang/internal/app/server/types"
+	. "xiaozhi-esp32-server-golang/internal/data/msg"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+)
+
+func TestChatManagerInspect(t *testing.T) {
+	setupMockConfig()
+	require.NoError(t, auth.Init())
+	mcp.GetGlobalMCPManager()
+
+	conn := newFakeConn("inspect-device")
+	cm, err := NewChatManager(conn.deviceID, conn)
+	require.NoError(t, err)
+	go cm.Start()
+	defer cm.Close()
+
+	conn.sendCmd(t, map[string]interface{}{
+		"type":      MessageTypeHello,
+		"device_id": conn.deviceID,
+		"transport": types_conn.TransportTypeWebsocket,
+		"features":  map[string]bool{"text_only": true},
+	})
+	reply := conn.waitCmd(t)
+
+	info := cm.Info()
+	assert.Equal(t, conn.deviceID, info.DeviceID)
+	assert.Equal(t, reply.SessionID, info.SessionID)
+	assert.Equal(t, types_conn.TransportTypeWebsocket, info.Transport)
+	assert.False(t, info.Detached)
+	assert.NotZero(t, info.LastActiveAt)
+	assert.Contains(t, info.Providers, "llm")
+
+	cm.clientState.AddMessage(&schema.Message{Role: schema.User, Content: "你好"})
+	cm.clientState.AddMessage(&schema.Message{Role: schema.Assistant, Content: "你好呀"})
+	dialogue := cm.RecentDialogue(1)
+	require.Len(t, dialogue, 1)
+	assert.Equal(t, "assistant", dialogue[0].Role)
+	assert.Equal(t, "你好呀", dialogue[0].Content)
+
+	require.NoError(t, cm.ClearHistory(context.Background()))
+	assert.Empty(t, cm.RecentDialogue(10))
+}
@@ -0,0 +1,44 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/viper"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/knowledge"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+//此文件处理 知识库 的检索
+
+func getKnowledgeTimeout() time.Duration {
+	timeoutMs := viper.GetInt("knowledge.timeout_ms")
+	if timeoutMs <= 0 {
+		timeoutMs = 2000
+	}
+	return time.Duration(timeoutMs) * time.Millisecond
+}
+
+// retrieveKnowledge 按智能体检索与用户输入相关的资料, 未开启或检索失败时返回空
+// 索引在后台构建, 这里只向量化问题并查询已有索引, 有超时限制, 避免拖慢本轮回复
+func retrieveKnowledge(ctx context.Context, clientState *ClientState, text string) string {
+	retriever := knowledge.Get()
+	if retriever == nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, getKnowledgeTimeout())
+	defer cancel()
+
+	startTs := time.Now()
+	results, err := retriever.Retrieve(ctx, clientState.AgentID, text)
+	if err != nil {
+		log.Warnf("检索智能体 %s 知识库失败: %v", clientState.AgentID, err)
+		return ""
+	}
+	if len(results) > 0 {
+		log.Infof("检索智能体 %s 知识库, 命中 %d 条, 最高相似度: %.3f, 耗时: %dms", clientState.AgentID, len(results), results[0].Score, time.Since(startTs).Milliseconds())
+	}
+	return knowledge.FormatResults(results)
+}
@@ -12,17 +12,20 @@ import (
 	"time"
 
 	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/history"
 	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
 	llm_memory "xiaozhi-esp32-server-golang/internal/domain/llm/memory"
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
 	"xiaozhi-esp32-server-golang/internal/domain/play_music"
 	"xiaozhi-esp32-server-golang/internal/util"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
 	log "xiaozhi-esp32-server-golang/logger"
 
 	"github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
 	mcp_go "github.com/mark3labs/mcp-go/mcp"
+	"github.com/spf13/viper"
 )
 
 const (
@@ -46,6 +49,7 @@ type LLMManager struct {
 	ttsManager      *TTSManager
 
 	einoTools []*schema.ToolInfo
+	knowledge string // 本轮检索到的知识库资料, 追加到系统提示词
 
 	llmResponseQueue *util.Queue[LLMResponseChannelItem]
 }
@@ -74,7 +78,7 @@ func (l *LLMManager) processLLMResponseQueue(ctx context.Context) {
 			continue
 		}
 
-		log.Debugf("processLLMResponseQueue item: %+v", item)
+		l.clientState.Logger.Debugf("processLLMResponseQueue item: %+v", item)
 		if item.onStartFunc != nil {
 			item.onStartFunc()
 		}
@@ -90,7 +94,7 @@ func (l *LLMManager) ClearLLMResponseQueue() {
 }
 
 func (l *LLMManager) AddTextToTTSQueue(text string) error {
-	log.Debugf("AddTextToTTSQueue text: %s", text)
+	l.clientState.Logger.Debugf("AddTextToTTSQueue text: %s", text)
 	msg := &schema.Message{
 		Role:    schema.User,
 		Content: text,
@@ -110,7 +114,7 @@ func (l *LLMManager) AddTextToTTSQueue(text string) error {
 func (l *LLMManager) HandleLLMResponseChannelAsync(ctx context.Context, userMessage *schema.Message, responseChan chan llm_common.LLMResponseStruct) error {
 	needSendTtsCmd := true
 	val := ctx.Value("nest")
-	log.Debugf("AddLLMResponseChannel nest: %+v", val)
+	l.clientState.Logger.Debugf("AddLLMResponseChannel nest: %+v", val)
 	if nest, ok := val.(int); ok {
 		if nest > 1 {
 			needSendTtsCmd = false
@@ -147,7 +151,7 @@ func (l *LLMManager) HandleLLMResponseChannelAsync(ctx context.Context, userMess
 func (l *LLMManager) HandleLLMResponseChannelSync(ctx context.Context, userMessage *schema.Message, llmResponseChannel chan llm_common.LLMResponseStruct, einoTools []*schema.ToolInfo) (bool, error) {
 	needSendTtsCmd := true
 	val := ctx.Value("nest")
-	log.Debugf("AddLLMResponseChannel nest: %+v", val)
+	l.clientState.Logger.Debugf("AddLLMResponseChannel nest: %+v", val)
 	if nest, ok := val.(int); ok {
 		if nest > 1 {
 			needSendTtsCmd = false
@@ -166,11 +170,11 @@ func (l *LLMManager) HandleLLMResponseChannelSync(ctx context.Context, userMessa
 
 // HandleLLMResponse 处理LLM响应
 func (l *LLMManager) handleLLMResponse(ctx context.Context, userMessage *schema.Message, llmResponseChannel chan llm_common.LLMResponseStruct) (bool, error) {
-	log.Debugf("handleLLMResponse start")
-	defer log.Debugf("handleLLMResponse end")
+	l.clientState.Logger.Debugf("handleLLMResponse start")
+	defer l.clientState.Logger.Debugf("handleLLMResponse end")
 	select {
 	case <-ctx.Done():
-		log.Debugf("handleLLMResponse ctx done, return")
+		l.clientState.Logger.Debugf("handleLLMResponse ctx done, return")
 		return false, nil
 	default:
 	}
@@ -179,6 +183,17 @@ func (l *LLMManager) handleLLMResponse(ctx context.Context, userMessage *schema.
 	var toolCalls []schema.ToolCall
 	var fullText bytes.Buffer
 
+	// 请求时开启了增量输出, 建立流式输入的TTS会话, 与等待LLM首个token并行
+	var stream *ttsStream
+	if streamInput, _ := ctx.Value(ttsStreamKey{}).(bool); streamInput {
+		stream = l.ttsManager.startStream(ctx)
+	}
+	defer func() {
+		if stream != nil {
+			stream.Close()
+		}
+	}()
+
 	//var hasTextResponse bool
 	for {
 		select {
@@ -197,23 +212,53 @@ func (l *LLMManager) handleLLMResponse(ctx context.Context, userMessage *schema.
 					return true, nil
 				}
 
-				log.Debugf("LLM 响应: %+v", llmResponse)
+				l.clientState.Logger.Debugf("LLM 响应: %+v", llmResponse)
+
+				// 仅统计 DoLLmRequest 发起的请求的首个响应
+				if llmDuration, ok := state.TakeLlmDuration(); ok {
+					metrics.ObserveMs(metrics.LlmFirstTokenLatency, llmDuration)
+					state.History.SetLlmFirstTokenMs(llmDuration)
+				}
 
 				if len(llmResponse.ToolCalls) > 0 {
-					log.Debugf("获取到工具: %+v", llmResponse.ToolCalls)
+					l.clientState.Logger.Debugf("获取到工具: %+v", llmResponse.ToolCalls)
 					toolCalls = append(toolCalls, llmResponse.ToolCalls...)
 				}
 
+				if llmResponse.Delta != "" && stream != nil {
+					if err := stream.AppendText(llmResponse.Delta); err != nil {
+						// 等已合成的音频播完, 未播放和之后的句子改为按句合成, 避免两路音频重叠
+						log.Errorf("流式输入TTS发送文本失败, 改为按句合成: %v", err)
+						rest := stream.Drain()
+						stream = nil
+						for _, sentence := range rest {
+							if err := l.ttsManager.handleTextResponse(ctx, sentence, true); err != nil {
+								return true, err
+							}
+						}
+					}
+				}
+
 				if llmResponse.Text != "" {
 					//hasTextResponse = true
 					// 处理文本内容响应
-					if err := l.ttsManager.handleTextResponse(ctx, llmResponse, true); err != nil {
+					if stream != nil {
+						stream.SendSentence(llmResponse)
+					} else if err := l.ttsManager.handleTextResponse(ctx, llmResponse, true); err != nil {
 						return true, err
 					}
 					fullText.WriteString(llmResponse.Text)
 				}
 
 				if llmResponse.IsEnd {
+					// 等待流式合成的音频下发完毕, 再处理工具调用
+					if stream != nil {
+						if err := stream.Finish(); err != nil {
+							log.Errorf("流式输入TTS失败: %v", err)
+						}
+						stream.Close()
+						stream = nil
+					}
 					if len(toolCalls) == 0 {
 						//写到redis中
 						if userMessage != nil {
@@ -225,6 +270,8 @@ func (l *LLMManager) handleLLMResponse(ctx context.Context, userMessage *schema.
 						if strFullText != "" || len(toolCalls) > 0 {
 							l.AddLlmMessage(ctx, schema.AssistantMessage(strFullText, toolCalls))
 						}
+						// 历史消息达到阈值, 进行长期记忆总结
+						summaryMemoryAsync(l.clientState, getSummaryThreshold())
 					}
 					if len(toolCalls) > 0 {
 						/*
@@ -314,11 +361,19 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 		startTs := time.Now().UnixMilli()
 		fcResult, err := tool.InvokableRun(toolCtx, toolCall.Function.Arguments)
 		if err != nil {
+			metrics.ObserveMs(metrics.McpToolCallDuration.WithLabelValues(toolName, "error"), time.Now().UnixMilli()-startTs)
 			log.Errorf("工具调用失败: %v", err)
+			state.History.AddToolCall(history.ToolCall{
+				Name:       toolName,
+				Arguments:  toolCall.Function.Arguments,
+				Result:     err.Error(),
+				DurationMs: time.Now().UnixMilli() - startTs,
+			})
 			addMessageFunc(toolCall, fmt.Sprintf("工具 %s 调用失败: %v", toolName, err))
 			continue
 		}
 		costTs := time.Now().UnixMilli() - startTs
+		metrics.ObserveMs(metrics.McpToolCallDuration.WithLabelValues(toolName, "success"), costTs)
 		invokeToolSuccess = true
 		if len(fcResult) > 2048 {
 			log.Infof("工具调用结果 len: %d, 耗时: %dms", len(fcResult), costTs)
@@ -336,7 +391,7 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 			contentList = mcpResp.GetContent()
 		} else if toolCallResult, ok := l.handleToolResult(fcResult); ok {
 			if toolCallResult.IsError {
-				log.Errorf("工具调用失败: %s, 错误: %s", fcResult, toolCallResult.IsError)
+				log.Errorf("工具调用失败: %s, 错误: %+v", fcResult, toolCallResult.Content)
 			}
 			contentList = toolCallResult.Content
 		}
@@ -345,7 +400,7 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 			//如果有audio数据, 则进行播放
 			for _, content := range contentList {
 				if audioContent, ok := content.(mcp_go.AudioContent); ok {
-					log.Debugf("调用工具 %s 返回音频资源长度: %d", toolName, len(audioContent.Data))
+					l.clientState.Logger.Debugf("调用工具 %s 返回音频资源长度: %d", toolName, len(audioContent.Data))
 
 					mcpContent = "执行成功"
 					//播放音频资源,此时mcpContent是
@@ -357,7 +412,7 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 					shouldStopLLMProcessing = true
 					break
 				} else if resourceLink, ok := content.(mcp_go.ResourceLink); ok {
-					log.Debugf("调用工具 %s 返回资源链接: %+v", toolName, resourceLink)
+					l.clientState.Logger.Debugf("调用工具 %s 返回资源链接: %+v", toolName, resourceLink)
 					mcpContent = "执行成功"
 					err := l.handleResourceLink(ctx, resourceLink, tool, &wg)
 					if err != nil {
@@ -368,7 +423,7 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 					shouldStopLLMProcessing = true
 					break
 				} else if textContent, ok := content.(mcp_go.TextContent); ok {
-					log.Debugf("调用工具 %s 返回文本资源长度: %s", toolName, textContent.Text)
+					l.clientState.Logger.Debugf("调用工具 %s 返回文本资源长度: %s", toolName, textContent.Text)
 					mcpContent += textContent.Text
 				}
 			}
@@ -376,6 +431,13 @@ func (l *LLMManager) handleToolCallResponse(ctx context.Context, userMessage *sc
 				result = mcpContent
 			}
 		}
+		state.History.AddToolCall(history.ToolCall{
+			Name:       toolName,
+			Arguments:  toolCall.Function.Arguments,
+			Result:     result,
+			Success:    true,
+			DurationMs: costTs,
+		})
 		addMessageFunc(toolCall, result)
 	}
 
@@ -440,11 +502,11 @@ func (l *LLMManager) handleResourceLink(ctx context.Context, resourceLink mcp_go
 		for {
 			select {
 			case <-ctx.Done():
-				log.Debugf("资源读取被取消")
+				l.clientState.Logger.Debugf("资源读取被取消")
 				return nil
 			default:
 				pageCount++
-				log.Debugf("读取第 %d 页资源，起始位置: %d, 结束位置: %d", pageCount, start, start+page)
+				l.clientState.Logger.Debugf("读取第 %d 页资源，起始位置: %d, 结束位置: %d", pageCount, start, start+page)
 
 				// 创建带超时的上下文
 				readCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
@@ -480,10 +542,10 @@ func (l *LLMManager) handleResourceLink(ctx context.Context, resourceLink mcp_go
 				for _, content := range resourceResult.Contents {
 					if audioContent, ok := content.(mcp_go.BlobResourceContents); ok {
 						if len(audioContent.Blob) == 0 {
-							log.Debugf("音频数据为空，跳过")
+							l.clientState.Logger.Debugf("音频数据为空，跳过")
 							continue
 						}
-						log.Debugf("第 %d 页 resourceResult len: %d", pageCount, len(audioContent.Blob))
+						l.clientState.Logger.Debugf("第 %d 页 resourceResult len: %d", pageCount, len(audioContent.Blob))
 						rawAudioData, err := base64.StdEncoding.DecodeString(audioContent.Blob)
 						if err != nil {
 							log.Errorf("解码音频数据失败: %v", err)
@@ -491,22 +553,22 @@ func (l *LLMManager) handleResourceLink(ctx context.Context, resourceLink mcp_go
 						}
 
 						if string(rawAudioData) == McpReadResourceStreamDoneFlag {
-							log.Debugf("资源读取完成")
+							l.clientState.Logger.Debugf("资源读取完成")
 							return nil
 						}
 
 						select {
 						case <-ctx.Done():
-							log.Debugf("资源读取被取消")
+							l.clientState.Logger.Debugf("资源读取被取消")
 							return nil
 						case streamChan <- rawAudioData:
 							totalRead += len(rawAudioData)
 							hasData = true
-							log.Debugf("成功发送第 %d 页数据，长度: %d, 累计: %d", pageCount, len(rawAudioData), totalRead)
+							l.clientState.Logger.Debugf("成功发送第 %d 页数据，长度: %d, 累计: %d", pageCount, len(rawAudioData), totalRead)
 						}
 
 						if len(rawAudioData) < page {
-							log.Debugf("资源读取完成")
+							l.clientState.Logger.Debugf("资源读取完成")
 							return nil
 						}
 					}
@@ -597,41 +659,55 @@ func (l *LLMManager) handleToolResult(toolResultStr string) (mcp_go.CallToolResu
 }
 
 func (l *LLMManager) DoLLmRequest(ctx context.Context, userMessage *schema.Message, einoTools []*schema.ToolInfo, isSync bool) error {
-	log.Debugf("发送带工具的 LLM 请求, seesionID: %s, requestEinoMessages: %+v", l.clientState.SessionID, userMessage)
+	l.clientState.Logger.Debugf("发送带工具的 LLM 请求, seesionID: %s, requestEinoMessages: %+v", l.clientState.GetSessionID(), userMessage)
 	clientState := l.clientState
 
 	l.einoTools = einoTools
 	//组装历史消息和当前用户的消息
 	requestMessages := l.GetMessages(ctx, userMessage, MaxMessageCount)
+
+	var opts []llm.HandleOption
+	if viper.GetBool("emotion.enable") {
+		opts = append(opts, llm.WithEmotion())
+	}
+	// TTS支持流式输入时, token 直接送入TTS, 不必等待整句
+	if l.ttsManager.supportStreamingInput() {
+		opts = append(opts, llm.WithDelta())
+		ctx = context.WithValue(ctx, ttsStreamKey{}, true)
+	}
+
 	clientState.SetStatus(ClientStatusLLMStart)
+	clientState.SetStartLlmTs()
 	responseSentences, err := llm.HandleLLMWithContextAndTools(
 		ctx,
 		clientState.LLMProvider,
 		requestMessages,
 		einoTools,
-		l.clientState.SessionID,
+		l.clientState.GetSessionID(),
+		opts...,
 	)
 	if err != nil {
-		log.Errorf("发送带工具的 LLM 请求失败, seesionID: %s, error: %v", l.clientState.SessionID, err)
+		log.Errorf("发送带工具的 LLM 请求失败, seesionID: %s, error: %v", l.clientState.GetSessionID(), err)
+		metrics.IncProviderError("llm", clientState.DeviceConfig.Llm.Provider)
 		return fmt.Errorf("发送带工具的 LLM 请求失败: %v", err)
 	}
 
-	log.Debugf("DoLLmRequest goroutine开始 - SessionID: %s, context状态: %v", l.clientState.SessionID, ctx.Err())
+	l.clientState.Logger.Debugf("DoLLmRequest goroutine开始 - SessionID: %s, context状态: %v", l.clientState.GetSessionID(), ctx.Err())
 
 	if isSync {
 		_, err := l.HandleLLMResponseChannelSync(ctx, userMessage, responseSentences, einoTools)
 		if err != nil {
-			log.Errorf("处理 LLM 响应失败, seesionID: %s, error: %v", l.clientState.SessionID, err)
+			log.Errorf("处理 LLM 响应失败, seesionID: %s, error: %v", l.clientState.GetSessionID(), err)
 			return err
 		}
 	} else {
 		err = l.HandleLLMResponseChannelAsync(ctx, userMessage, responseSentences)
 		if err != nil {
-			log.Errorf("处理 LLM 响应失败, seesionID: %s, error: %v", l.clientState.SessionID, err)
+			log.Errorf("处理 LLM 响应失败, seesionID: %s, error: %v", l.clientState.GetSessionID(), err)
 		}
 	}
 
-	log.Debugf("DoLLmRequest 结束 - SessionID: %s", l.clientState.SessionID)
+	l.clientState.Logger.Debugf("DoLLmRequest 结束 - SessionID: %s", l.clientState.GetSessionID())
 
 	return nil
 }
@@ -641,19 +717,34 @@ func (l *LLMManager) AddLlmMessage(ctx context.Context, msg *schema.Message) err
 		log.Warnf("尝试添加 nil 消息到 LLM 对话历史")
 		return fmt.Errorf("消息不能为 nil")
 	}
+	// 表情标记只用于设备显示, 不写入对话历史
+	if msg.Role == schema.Assistant && msg.Content != "" && viper.GetBool("emotion.enable") {
+		stripped := *msg
+		stripped.Content = llm.RemoveEmotionMarks(msg.Content)
+		msg = &stripped
+	}
 	l.clientState.AddMessage(msg)
-	llm_memory.Get().AddMessage(ctx, l.clientState.DeviceID, *msg)
+	llm_memory.Get().AddMessage(ctx, l.clientState.DeviceID, l.clientState.AgentID, *msg)
 	return nil
 }
 
+// SetKnowledge 设置本轮的知识库资料, 工具调用后的后续请求同样带上
+func (l *LLMManager) SetKnowledge(knowledge string) {
+	l.knowledge = knowledge
+}
+
 func (l *LLMManager) GetMessages(ctx context.Context, userMessage *schema.Message, count int) []*schema.Message {
 	//从dialogue中获取
 	messageList := l.clientState.GetMessages(count)
 
+	systemPrompt := l.clientState.SystemPrompt
+	if l.knowledge != "" {
+		systemPrompt = fmt.Sprintf("%s\n\n%s", systemPrompt, l.knowledge)
+	}
 	retMessage := make([]*schema.Message, 0)
 	retMessage = append(retMessage, &schema.Message{
 		Role:    schema.System,
-		Content: l.clientState.SystemPrompt,
+		Content: systemPrompt,
 	})
 	retMessage = append(retMessage, messageList...)
 	if userMessage != nil {
@@ -0,0 +1,88 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/llm"
+	llm_memory "xiaozhi-esp32-server-golang/internal/domain/llm/memory"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+//此文件处理 长期记忆 的总结与注入
+
+const (
+	// 会话结束时, 至少有一轮对话才进行总结
+	sessionEndSummaryMinCount = 2
+	summaryTimeout            = 60 * time.Second
+)
+
+func isMemorySummaryEnabled() bool {
+	return viper.GetBool("memory.summary.enable")
+}
+
+// getSummaryThreshold 未总结的消息数达到该值时触发总结
+func getSummaryThreshold() int {
+	threshold := viper.GetInt("memory.summary.threshold")
+	if threshold <= 0 {
+		threshold = 20
+	}
+	return threshold
+}
+
+func getSummaryMaxMessages() int {
+	maxMessages := viper.GetInt("memory.summary.max_messages")
+	if maxMessages <= 0 {
+		maxMessages = 60
+	}
+	return maxMessages
+}
+
+// injectMemorySummary 将长期记忆注入系统提示词
+func injectMemorySummary(ctx context.Context, clientState *ClientState) {
+	if !isMemorySummaryEnabled() {
+		return
+	}
+	summary, err := llm_memory.Get().GetSummary(ctx, clientState.DeviceID, clientState.AgentID)
+	if err != nil {
+		log.Errorf("获取设备 %s 记忆摘要失败: %v", clientState.DeviceID, err)
+		return
+	}
+	if summary == "" {
+		return
+	}
+	clientState.SystemPrompt = fmt.Sprintf("%s\n\n# 用户记忆\n以下是根据以往对话总结的用户信息(json), 请在对话中自然地参考, 不要直接复述:\n%s", clientState.SystemPrompt, summary)
+}
+
+// summaryMemoryAsync 异步进行记忆总结, 未总结的消息数不足 minCount 时不进行
+func summaryMemoryAsync(clientState *ClientState, minCount int) {
+	if !isMemorySummaryEnabled() {
+		return
+	}
+
+	deviceID := clientState.DeviceID
+	agentID := clientState.AgentID
+	llmConfig := clientState.DeviceConfig.Llm
+
+	go func() {
+		// 单独创建 llm 实例, 避免与对话共用; 仅在达到总结阈值时才创建
+		newProvider := func() (llm.LLMProvider, error) {
+			llmType, ok := llmConfig.Config["type"].(string)
+			if !ok {
+				return nil, fmt.Errorf("llm 配置缺少 type")
+			}
+			return llm.GetLLMProvider(llmType, llmConfig.Config)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+		defer cancel()
+		err := llm_memory.Get().Summarize(ctx, newProvider, deviceID, agentID, minCount, getSummaryMaxMessages())
+		if err != nil {
+			log.Errorf("设备 %s 记忆总结失败: %v", deviceID, err)
+		}
+	}()
+}
@@ -0,0 +1,181 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	types_conn "xiaozhi-esp32-server-golang/internal/app/server/types"
+	. "xiaozhi-esp32-server-golang/internal/data/client"
+	. "xiaozhi-esp32-server-golang/internal/data/msg"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// 等待重连设备发送 hello 的超时, 秒
+const resumeHelloTimeout = 10
+
+// sessionResumeConfig 断线恢复配置, 对应 config.yaml 中的 session_resume
+type sessionResumeConfig struct {
+	Enable    bool
+	Grace     time.Duration // 断线后保留会话的时长
+	ReplayTts bool          // 恢复后补播断线时未播完的句子
+}
+
+func getSessionResumeConfig() sessionResumeConfig {
+	config := sessionResumeConfig{
+		Enable:    viper.GetBool("session_resume.enable"),
+		Grace:     time.Duration(viper.GetInt("session_resume.grace_seconds")) * time.Second,
+		ReplayTts: viper.GetBool("session_resume.replay_tts"),
+	}
+	if config.Grace <= 0 {
+		config.Grace = 30 * time.Second
+	}
+	return config
+}
+
+// watchTransport 注册连接断开回调, 恢复后旧连接的回调不再生效
+func (c *ChatManager) watchTransport(transport types_conn.IConn) {
+	transport.OnClose(func(deviceId string) {
+		c.mu.Lock()
+		current := c.transport == transport
+		c.mu.Unlock()
+		if current {
+			c.OnClose(deviceId)
+		}
+	})
+}
+
+// detach 连接断开时保留会话, 在 grace 时长内等待设备携带 session_id 重连
+// 未完成 hello、会话已主动关闭或未开启时返回 false
+func (c *ChatManager) detach() bool {
+	config := getSessionResumeConfig()
+	if !config.Enable || c.closing || c.session.closed.Load() || c.clientState.GetSessionID() == "" {
+		return false
+	}
+
+	c.detached = true
+	c.session.Detach(config.ReplayTts)
+	c.graceTimer = time.AfterFunc(config.Grace, c.expire)
+	log.Infof("设备 %s 连接断开, 保留会话 %s 等待重连 %v", c.DeviceID, c.clientState.GetSessionID(), config.Grace)
+	return true
+}
+
+// expire 等待重连超时, 结束会话
+func (c *ChatManager) expire() {
+	c.mu.Lock()
+	if !c.detached {
+		c.mu.Unlock()
+		return
+	}
+	c.detached = false
+	c.mu.Unlock()
+
+	log.Infof("设备 %s 未在等待时间内重连, 结束会话 %s", c.DeviceID, c.clientState.GetSessionID())
+	c.Close()
+}
+
+// IsDetached 连接已断开, 会话正在等待恢复
+func (c *ChatManager) IsDetached() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.detached
+}
+
+// TryResume 读取新连接的首条消息, 为携带当前 session_id 的 hello 时接管该连接并恢复会话
+// 旧连接尚未断开(设备先于服务端感知断线)时, 断开旧连接后接管
+// 返回的连接会重新投递已读取的消息, 未恢复时调用方用它创建新会话
+func (c *ChatManager) TryResume(transport types_conn.IConn) (types_conn.IConn, bool) {
+	message, err := transport.RecvCmd(c.ctx, resumeHelloTimeout)
+	if err != nil {
+		log.Warnf("设备 %s 等待 hello 失败: %v", c.DeviceID, err)
+		return transport, false
+	}
+	conn := &resumeConn{IConn: transport, first: message}
+
+	var msg ClientMessage
+	if err := json.Unmarshal(message, &msg); err != nil || msg.Type != MessageTypeHello || msg.SessionID == "" {
+		return conn, false
+	}
+
+	c.mu.Lock()
+	if c.closing || msg.SessionID != c.clientState.GetSessionID() {
+		c.mu.Unlock()
+		return conn, false
+	}
+	var oldTransport types_conn.IConn
+	if c.detached {
+		if !c.graceTimer.Stop() {
+			c.mu.Unlock()
+			return conn, false
+		}
+		c.detached = false
+	} else {
+		config := getSessionResumeConfig()
+		if !config.Enable || c.session.closed.Load() {
+			c.mu.Unlock()
+			return conn, false
+		}
+		c.session.Detach(config.ReplayTts)
+		oldTransport = c.transport
+	}
+	c.transport = conn
+	c.watchTransport(conn)
+	c.session.Attach(conn)
+	c.mu.Unlock()
+
+	// 旧连接已不是当前连接, 关闭时不再触发断线处理
+	if oldTransport != nil {
+		oldTransport.Close()
+	}
+	log.Infof("设备 %s 重连, 恢复会话 %s", c.DeviceID, msg.SessionID)
+	return conn, true
+}
+
+// Detach 连接断开, 停止播放和收取消息, 保留对话、MCP 及识别状态
+func (s *ChatSession) Detach(replayTts bool) {
+	if replayTts {
+		s.replayText = s.ttsManager.unfinishedText()
+	}
+	s.StopSpeaking(false)
+	if s.connCancel != nil {
+		s.connCancel()
+	}
+}
+
+// Attach 设备重连后切换到新连接, 下一条 hello 沿用当前会话
+func (s *ChatSession) Attach(transport types_conn.IConn) {
+	s.serverTransport.SetTransport(transport)
+	s.resuming = true
+	s.startConnLoops()
+}
+
+// replayUnfinished 补播断线时未播完的句子
+func (s *ChatSession) replayUnfinished() {
+	text := strings.Join(s.replayText, "")
+	s.replayText = nil
+	if text == "" {
+		return
+	}
+	log.Infof("设备 %s 补播未播完的内容: %s", s.clientState.DeviceID, text)
+	if err := s.Speak(&SpeakRequest{DeviceID: s.clientState.DeviceID, Text: text}); err != nil {
+		log.Errorf("设备 %s 补播失败: %v", s.clientState.DeviceID, err)
+	}
+}
+
+// resumeConn 重新投递探测时读取的首条消息
+type resumeConn struct {
+	types_conn.IConn
+	first []byte
+	read  bool
+}
+
+func (r *resumeConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	if !r.read {
+		r.read = true
+		return r.first, nil
+	}
+	return r.IConn.RecvCmd(ctx, timeout)
+}
@@ -0,0 +1,131 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/auth"
+	types_conn "xiaozhi-esp32-server-golang/internal/app/server/types"
+	. "xiaozhi-esp32-server-golang/internal/data/msg"
+	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+)
+
+func TestChatSessionResume(t *testing.T) {
+	setupMockConfig()
+	viper.Set("session_resume.enable", true)
+	viper.Set("session_resume.grace_seconds", 1)
+	viper.Set("session_resume.replay_tts", true)
+	defer viper.Set("session_resume.enable", false)
+	require.NoError(t, auth.Init())
+	mcp.GetGlobalMCPManager()
+
+	conn := newFakeConn("resume-device")
+	cm, err := NewChatManager(conn.deviceID, conn)
+	require.NoError(t, err)
+	go cm.Start()
+	defer cm.Close()
+
+	hello := map[string]interface{}{
+		"type":      MessageTypeHello,
+		"device_id": conn.deviceID,
+		"transport": types_conn.TransportTypeWebsocket,
+		"features":  map[string]bool{"text_only": true},
+	}
+	conn.sendCmd(t, hello)
+	reply := conn.waitCmd(t)
+	require.NotEmpty(t, reply.SessionID)
+	sessionID := reply.SessionID
+
+	// 断线时还有未播完的句子
+	cm.session.ttsManager.addPending("还没播完。")
+	conn.Close()
+	require.True(t, cm.IsDetached())
+
+	// 会话 id 不一致时不恢复
+	other := newFakeConn(conn.deviceID)
+	hello["session_id"] = "other-session"
+	other.sendCmd(t, hello)
+	replayConn, resumed := cm.TryResume(other)
+	assert.False(t, resumed)
+	// 读取的 hello 交给新会话处理
+	msg, err := replayConn.RecvCmd(cm.ctx, 1)
+	require.NoError(t, err)
+	assert.Contains(t, string(msg), "other-session")
+
+	// 携带之前的会话 id 重连
+	newConn := newFakeConn(conn.deviceID)
+	hello["session_id"] = sessionID
+	newConn.sendCmd(t, hello)
+	_, resumed = cm.TryResume(newConn)
+	require.True(t, resumed)
+	assert.False(t, cm.IsDetached())
+
+	reply = newConn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeHello, reply.Type)
+	assert.Equal(t, sessionID, reply.SessionID)
+
+	ttsStart := newConn.waitCmd(t)
+	assert.Equal(t, MessageStateStart, ttsStart.State)
+	text := newConn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeText, text.Type)
+	assert.Equal(t, "还没播完。", text.Text)
+	ttsStop := newConn.waitCmd(t)
+	assert.Equal(t, MessageStateStop, ttsStop.State)
+
+	// 超过等待时间未重连, 会话结束
+	newConn.Close()
+	require.True(t, cm.IsDetached())
+	select {
+	case <-cm.ctx.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("等待重连超时后会话未结束")
+	}
+}
+
+func TestChatSessionResumeBeforeClose(t *testing.T) {
+	setupMockConfig()
+	viper.Set("session_resume.enable", true)
+	defer viper.Set("session_resume.enable", false)
+	require.NoError(t, auth.Init())
+	mcp.GetGlobalMCPManager()
+
+	conn := newFakeConn("resume-live-device")
+	cm, err := NewChatManager(conn.deviceID, conn)
+	require.NoError(t, err)
+	go cm.Start()
+	defer cm.Close()
+
+	hello := map[string]interface{}{
+		"type":      MessageTypeHello,
+		"device_id": conn.deviceID,
+		"transport": types_conn.TransportTypeWebsocket,
+		"features":  map[string]bool{"text_only": true},
+	}
+	conn.sendCmd(t, hello)
+	reply := conn.waitCmd(t)
+	require.NotEmpty(t, reply.SessionID)
+
+	// 服务端尚未感知旧连接断开, 设备已携带会话 id 重连
+	newConn := newFakeConn(conn.deviceID)
+	hello["session_id"] = reply.SessionID
+	newConn.sendCmd(t, hello)
+	_, resumed := cm.TryResume(newConn)
+	require.True(t, resumed)
+	assert.False(t, cm.IsDetached())
+
+	// 旧连接被关闭, 且不会触发断线处理
+	select {
+	case <-conn.closed:
+	default:
+		t.Fatal("旧连接未关闭")
+	}
+	assert.False(t, cm.IsDetached())
+
+	reply = newConn.waitCmd(t)
+	assert.Equal(t, ServerMessageTypeHello, reply.Type)
+	assert.Equal(t, hello["session_id"], reply.SessionID)
+}
@@ -20,6 +20,7 @@ type ServerTransport struct {
 	McpRecvMsgChan chan []byte
 	closed         bool
 	mu             sync.Mutex
+	transportLock  sync.RWMutex
 }
 
 func NewServerTransport(transport types_conn.IConn, clientState *ClientState) *ServerTransport {
@@ -30,17 +31,30 @@ func NewServerTransport(transport types_conn.IConn, clientState *ClientState) *S
 	}
 }
 
+// SetTransport 断线恢复时切换到新的连接
+func (s *ServerTransport) SetTransport(transport types_conn.IConn) {
+	s.transportLock.Lock()
+	defer s.transportLock.Unlock()
+	s.transport = transport
+}
+
+func (s *ServerTransport) conn() types_conn.IConn {
+	s.transportLock.RLock()
+	defer s.transportLock.RUnlock()
+	return s.transport
+}
+
 func (s *ServerTransport) SendTtsStart() error {
 	msg := ServerMessage{
 		Type:      ServerMessageTypeTts,
 		State:     MessageStateStart,
-		SessionID: s.clientState.SessionID,
+		SessionID: s.clientState.GetSessionID(),
 	}
 	bytes, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
-	err = s.transport.SendCmd(bytes)
+	err = s.conn().SendCmd(bytes)
 	if err != nil {
 		return err
 	}
@@ -52,16 +66,17 @@ func (s *ServerTransport) SendTtsStop() error {
 	msg := ServerMessage{
 		Type:      ServerMessageTypeTts,
 		State:     MessageStateStop,
-		SessionID: s.clientState.SessionID,
+		SessionID: s.clientState.GetSessionID(),
 	}
 	bytes, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
-	err = s.transport.SendCmd(bytes)
+	err = s.conn().SendCmd(bytes)
 	if err != nil {
 		return err
 	}
+	s.clientState.SetTtsStart(false)
 	return nil
 }
 
@@ -69,13 +84,13 @@ func (s *ServerTransport) SendMqttGoodbye() error {
 	msg := ServerMessage{
 		Type:      ServerMessageTypeGoodBye,
 		State:     MessageStateStop,
-		SessionID: s.clientState.SessionID,
+		SessionID: s.clientState.GetSessionID(),
 	}
 	bytes, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
-	err = s.transport.SendCmd(bytes)
+	err = s.conn().SendCmd(bytes)
 	if err != nil {
 		return err
 	}
@@ -86,7 +101,7 @@ func (s *ServerTransport) SendHello(transportType string, audioFormat *types_aud
 	msg := ServerMessage{
 		Type:        MessageTypeHello,
 		Text:        "欢迎使用小智服务器",
-		SessionID:   s.clientState.SessionID,
+		SessionID:   s.clientState.GetSessionID(),
 		Transport:   transportType,
 		AudioFormat: audioFormat,
 		Udp:         udpConfig,
@@ -95,7 +110,7 @@ func (s *ServerTransport) SendHello(transportType string, audioFormat *types_aud
 	if err != nil {
 		return err
 	}
-	err = s.transport.SendCmd(bytes)
+	err = s.conn().SendCmd(bytes)
 	if err != nil {
 		return err
 	}
@@ -106,14 +121,14 @@ func (s *ServerTransport) SendIot(msg *ClientMessage) error {
 	resp := ServerMessage{
 		Type:      ServerMessageTypeIot,
 		Text:      msg.Text,
-		SessionID: s.clientState.SessionID,
+		SessionID: s.clientState.GetSessionID(),
 		State:     MessageStateSuccess,
 	}
 	bytes, err := json.Marshal(resp)
 	if err != nil {
 		return err
 	}
-	err = s.transport.SendCmd(bytes)
+	err = s.conn().SendCmd(bytes)
 	if err != nil {
 		return err
 	}
@@ -124,13 +139,13 @@ func (s *ServerTransport) SendAsrResult(text string) error {
 	resp := ServerMessage{
 		Type:      ServerMessageTypeStt,
 		Text:      text,
-		SessionID: s.clientState.SessionID,
+		SessionID: s.clientState.GetSessionID(),
 	}
 	bytes, err := json.Marshal(resp)
 	if err != nil {
 		return err
 	}
-	err = s.transport.SendCmd(bytes)
+	err = s.conn().SendCmd(bytes)
 	if err != nil {
 		return err
 	}
@@ -142,13 +157,13 @@ func (s *ServerTransport) SendSentenceStart(text string) error {
 		Type:      ServerMessageTypeTts,
 		State:     MessageStateSentenceStart,
 		Text:      text,
-		SessionID: s.clientState.SessionID,
+		SessionID: s.clientState.GetSessionID(),
 	}
 	bytes, err := json.Marshal(response)
 	if err != nil {
 		return err
 	}
-	err = s.transport.SendCmd(bytes)
+	err = s.conn().SendCmd(bytes)
 	if err != nil {
 		return err
 	}
@@ -161,13 +176,13 @@ func (s *ServerTransport) SendSentenceEnd(text string) error {
 		Type:      ServerMessageTypeTts,
 		State:     MessageStateSentenceEnd,
 		Text:      text,
-		SessionID: s.clientState.SessionID,
+		SessionID: s.clientState.GetSessionID(),
 	}
 	bytes, err := json.Marshal(response)
 	if err != nil {
 		return err
 	}
-	err = s.transport.SendCmd(bytes)
+	err = s.conn().SendCmd(bytes)
 	if err != nil {
 		return err
 	}
@@ -175,33 +190,62 @@ func (s *ServerTransport) SendSentenceEnd(text string) error {
 	return nil
 }
 
+// SendText 纯文本对话时按句下发 LLM 回复
+func (s *ServerTransport) SendText(text string) error {
+	response := ServerMessage{
+		Type:      ServerMessageTypeText,
+		Text:      text,
+		SessionID: s.clientState.GetSessionID(),
+	}
+	bytes, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return s.conn().SendCmd(bytes)
+}
+
+// SendEmotion 下发表情, text 为表情对应的 emoji
+func (s *ServerTransport) SendEmotion(text string, emotion string) error {
+	response := ServerMessage{
+		Type:      ServerMessageTypeLlm,
+		Text:      text,
+		Emotion:   emotion,
+		SessionID: s.clientState.GetSessionID(),
+	}
+	bytes, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return s.conn().SendCmd(bytes)
+}
+
 func (s *ServerTransport) SendCmd(cmdBytes []byte) error {
-	return s.transport.SendCmd(cmdBytes)
+	return s.conn().SendCmd(cmdBytes)
 }
 
 func (s *ServerTransport) SendAudio(audio []byte) error {
-	return s.transport.SendAudio(audio)
+	return s.conn().SendAudio(audio)
 }
 
 func (s *ServerTransport) GetTransportType() string {
-	return s.transport.GetTransportType()
+	return s.conn().GetTransportType()
 }
 
 func (s *ServerTransport) GetData(key string) (interface{}, error) {
-	return s.transport.GetData(key)
+	return s.conn().GetData(key)
 }
 
 func (s *ServerTransport) SendMcpMsg(payload []byte) error {
 	response := ServerMessage{
 		Type:      MessageTypeMcp,
-		SessionID: s.clientState.SessionID,
+		SessionID: s.clientState.GetSessionID(),
 		PayLoad:   payload,
 	}
 	bytes, err := json.Marshal(response)
 	if err != nil {
 		return err
 	}
-	err = s.transport.SendCmd(bytes)
+	err = s.conn().SendCmd(bytes)
 	if err != nil {
 		return err
 	}
@@ -232,18 +276,18 @@ func (s *ServerTransport) Close() error {
 
 	s.closed = true
 
-	if s.transport.GetTransportType() == types_conn.TransportTypeMqttUdp {
+	if s.conn().GetTransportType() == types_conn.TransportTypeMqttUdp {
 		s.SendMqttGoodbye()
 	}
 
 	close(s.McpRecvMsgChan)
-	return s.transport.Close()
+	return s.conn().Close()
 }
 
 func (s *ServerTransport) RecvAudio(ctx context.Context, timeOut int) ([]byte, error) {
-	return s.transport.RecvAudio(ctx, timeOut)
+	return s.conn().RecvAudio(ctx, timeOut)
 }
 
 func (s *ServerTransport) RecvCmd(ctx context.Context, timeOut int) ([]byte, error) {
-	return s.transport.RecvCmd(ctx, timeOut)
+	return s.conn().RecvCmd(ctx, timeOut)
 }
@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"runtime/debug"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/cloudwego/eino/components/tool"
@@ -15,14 +16,18 @@ import (
 
 	"xiaozhi-esp32-server-golang/internal/app/server/auth"
 	types_conn "xiaozhi-esp32-server-golang/internal/app/server/types"
+	types_audio "xiaozhi-esp32-server-golang/internal/data/audio"
 	. "xiaozhi-esp32-server-golang/internal/data/client"
 	. "xiaozhi-esp32-server-golang/internal/data/msg"
 	user_config "xiaozhi-esp32-server-golang/internal/domain/config"
+	"xiaozhi-esp32-server-golang/internal/domain/history"
 	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/domain/recorder"
 	"xiaozhi-esp32-server-golang/internal/domain/tts"
 	"xiaozhi-esp32-server-golang/internal/util"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -40,8 +45,19 @@ type ChatSession struct {
 
 	ctx    context.Context
 	cancel context.CancelFunc
+	// 收取信令和音频的协程随连接断开退出, 恢复会话时重新启动
+	connCtx    context.Context
+	connCancel context.CancelFunc
+	closed     atomic.Bool
+
+	// 断线恢复后的首个 hello 沿用当前会话, 并补播未播完的句子
+	resuming   bool
+	replayText []string
 
 	chatTextQueue *util.Queue[AsrResponseChannelItem]
+
+	lastBargeInTs int64        //最近一次服务端打断的时间, 毫秒
+	lastActiveAt  atomic.Int64 //最近一次收到设备信令或音频的时间, 毫秒
 }
 
 type ChatSessionOption func(*ChatSession)
@@ -56,7 +72,7 @@ func NewChatSession(clientState *ClientState, serverTransport *ServerTransport,
 		opt(s)
 	}
 
-	s.asrManager = NewASRManager(clientState, serverTransport)
+	s.asrManager = NewASRManager(clientState, serverTransport, WithOnBargeIn(s.OnBargeIn))
 	s.ttsManager = NewTTSManager(clientState, serverTransport)
 	s.llmManager = NewLLMManager(clientState, serverTransport, s.ttsManager)
 
@@ -65,6 +81,7 @@ func NewChatSession(clientState *ClientState, serverTransport *ServerTransport,
 
 func (s *ChatSession) Start(pctx context.Context) error {
 	s.ctx, s.cancel = context.WithCancel(pctx)
+	s.lastActiveAt.Store(time.Now().UnixMilli())
 
 	err := s.InitAsrLlmTts()
 	if err != nil {
@@ -72,8 +89,7 @@ func (s *ChatSession) Start(pctx context.Context) error {
 		return err
 	}
 
-	go s.CmdMessageLoop(s.ctx)   //处理信令消息
-	go s.AudioMessageLoop(s.ctx) //处理音频数据
+	s.startConnLoops()
 	go s.processChatText(s.ctx)  //处理 asr后 的对话消息
 	go s.llmManager.Start(s.ctx) //处理 llm后 的一系列返回消息
 	go s.ttsManager.Start(s.ctx) //处理 tts的 消息队列
@@ -81,6 +97,13 @@ func (s *ChatSession) Start(pctx context.Context) error {
 	return nil
 }
 
+// startConnLoops 启动收取信令和音频的协程
+func (s *ChatSession) startConnLoops() {
+	s.connCtx, s.connCancel = context.WithCancel(s.ctx)
+	go s.CmdMessageLoop(s.connCtx)   //处理信令消息
+	go s.AudioMessageLoop(s.connCtx) //处理音频数据
+}
+
 // 在mqtt 收到type: listen, state: start后进行
 func (c *ChatSession) InitAsrLlmTts() error {
 	ttsConfig := c.clientState.DeviceConfig.Tts
@@ -123,6 +146,7 @@ func (c *ChatSession) CmdMessageLoop(ctx context.Context) {
 			continue
 		}
 		recvFailCount = 0
+		c.lastActiveAt.Store(time.Now().UnixMilli())
 		log.Infof("收到文本消息: %s", string(message))
 		if err := c.HandleTextMessage(message); err != nil {
 			log.Errorf("处理文本消息失败: %v", err)
@@ -135,7 +159,7 @@ func (c *ChatSession) AudioMessageLoop(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Debugf("设备 %s recvCmd context cancel", c.clientState.DeviceID)
+			c.clientState.Logger.Debugf("设备 %s recvCmd context cancel", c.clientState.DeviceID)
 			return
 		default:
 		}
@@ -144,11 +168,12 @@ func (c *ChatSession) AudioMessageLoop(ctx context.Context) {
 			log.Errorf("recv audio error: %v", err)
 			return
 		}
-		log.Debugf("收到音频数据，大小: %d 字节", len(message))
+		c.lastActiveAt.Store(time.Now().UnixMilli())
+		c.clientState.Logger.Debugf("收到音频数据，大小: %d 字节", len(message))
 		isAuth := viper.GetBool("auth.enable")
 		if isAuth {
 			if !c.clientState.IsActivated {
-				log.Debugf("设备 %s 未激活, 跳过音频数据", c.clientState.DeviceID)
+				c.clientState.Logger.Debugf("设备 %s 未激活, 跳过音频数据", c.clientState.DeviceID)
 				continue
 			}
 		}
@@ -185,6 +210,8 @@ func (c *ChatSession) HandleTextMessage(message []byte) error {
 		return c.HandleMcpMessage(&clientMsg)
 	case MessageTypeGoodBye:
 		return c.HandleGoodByeMessage(&clientMsg)
+	case MessageTypeChat:
+		return c.HandleChatMessage(&clientMsg)
 	default:
 		// 未知消息类型，直接回显
 		return fmt.Errorf("未知消息类型: %s", clientMsg.Type)
@@ -204,12 +231,24 @@ func (c *ChatSession) HandleAudioMessage(data []byte) bool {
 
 // handleHelloMessage 处理 hello 消息
 func (s *ChatSession) HandleHelloMessage(msg *ClientMessage) error {
+	var err error
 	if msg.Transport == types_conn.TransportTypeWebsocket {
-		return s.HandleWebsocketHelloMessage(msg)
+		err = s.HandleWebsocketHelloMessage(msg)
 	} else if msg.Transport == types_conn.TransportTypeMqttUdp {
-		return s.HandleMqttHelloMessage(msg)
+		err = s.HandleMqttHelloMessage(msg)
+	} else if msg.Transport == types_conn.TransportTypeWebRTC {
+		err = s.HandleWebRTCHelloMessage(msg)
+	} else {
+		err = fmt.Errorf("不支持的传输类型: %s", msg.Transport)
+	}
+
+	if s.resuming {
+		s.resuming = false
+		if err == nil {
+			s.replayUnfinished()
+		}
 	}
-	return fmt.Errorf("不支持的传输类型: %s", msg.Transport)
+	return err
 }
 
 func (s *ChatSession) HandleMqttHelloMessage(msg *ClientMessage) error {
@@ -250,6 +289,12 @@ func (s *ChatSession) HandleMqttHelloMessage(msg *ClientMessage) error {
 }
 
 func (s *ChatSession) HandleCommonHelloMessage(msg *ClientMessage) error {
+	// 断线恢复, 沿用之前的会话、MCP 和识别协程
+	if s.resuming {
+		log.Infof("设备 %s 恢复会话 %s", msg.DeviceID, s.clientState.GetSessionID())
+		return nil
+	}
+
 	// 创建新会话
 	session, err := auth.A().CreateSession(msg.DeviceID)
 	if err != nil {
@@ -257,7 +302,7 @@ func (s *ChatSession) HandleCommonHelloMessage(msg *ClientMessage) error {
 	}
 
 	// 更新客户端状态
-	s.clientState.SessionID = session.ID
+	s.clientState.SetSessionID(session.ID)
 
 	if isMcp, ok := msg.Features["mcp"]; ok && isMcp {
 		go initMcp(s.clientState, s.serverTransport)
@@ -265,7 +310,33 @@ func (s *ChatSession) HandleCommonHelloMessage(msg *ClientMessage) error {
 
 	clientState := s.clientState
 
-	clientState.InputAudioFormat = *msg.AudioParams
+	// 纯文本对话, 不接收音频也不下发tts音频
+	if msg.Features["text_only"] {
+		clientState.TextOnly = true
+		log.Infof("设备 %s 使用纯文本对话模式", msg.DeviceID)
+	}
+
+	clientState.DeviceAec = msg.Features["aec"]
+
+	if msg.AudioParams != nil {
+		clientState.InputAudioFormat = *msg.AudioParams
+	}
+
+	// 设备开启录音时按轮次归档音频, 重复 hello 时先保存之前的录音
+	if clientState.DeviceConfig.RecordAudio {
+		clientState.Recorder.EndTurn()
+		clientState.Recorder = recorder.NewSessionRecorder(clientState.DeviceID, clientState.GetSessionID(), clientState.InputAudioFormat, clientState.OutputAudioFormat)
+	}
+	clientState.History.EndTurn()
+	clientState.History = history.NewSessionHistory(clientState.DeviceID, clientState.GetSessionID(), clientState.AgentID)
+
+	if msg.AudioParams == nil {
+		if !clientState.TextOnly {
+			return fmt.Errorf("hello 消息缺少 audio_params")
+		}
+		return nil
+	}
+
 	clientState.SetAsrPcmFrameSize(clientState.InputAudioFormat.SampleRate, clientState.InputAudioFormat.Channels, clientState.InputAudioFormat.FrameDuration)
 
 	s.asrManager.ProcessVadAudio(clientState.Ctx, s.Close)
@@ -282,6 +353,25 @@ func (s *ChatSession) HandleWebsocketHelloMessage(msg *ClientMessage) error {
 	return s.serverTransport.SendHello("websocket", &s.clientState.OutputAudioFormat, nil)
 }
 
+// HandleWebRTCHelloMessage 音频已通过 RTP 协商, hello 只交换音频参数
+// 浏览器上行 Opus 默认 20ms 一包, 未携带 audio_params 时按此处理
+func (s *ChatSession) HandleWebRTCHelloMessage(msg *ClientMessage) error {
+	if msg.AudioParams == nil && !msg.Features["text_only"] {
+		msg.AudioParams = &types_audio.AudioFormat{
+			Format:        "opus",
+			SampleRate:    16000,
+			Channels:      1,
+			FrameDuration: 20,
+		}
+	}
+	err := s.HandleCommonHelloMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	return s.serverTransport.SendHello(types_conn.TransportTypeWebRTC, &s.clientState.OutputAudioFormat, nil)
+}
+
 // handleListenMessage 处理监听消息
 func (s *ChatSession) HandleListenMessage(msg *ClientMessage) error {
 	// 根据状态处理
@@ -351,7 +441,7 @@ func (s *ChatSession) HandleNotActivated() {
 		return
 	}
 
-	code, challenge, message, timeoutMs := configProvider.GetActivationInfo(s.clientState.Ctx, s.clientState.DeviceID, "client_id")
+	code, challenge, message, timeoutMs := configProvider.GetActivationInfo(s.clientState.Ctx, s.clientState.DeviceID, "")
 	if code == 0 {
 		log.Errorf("获取激活信息失败: %v", err)
 		return
@@ -440,9 +530,36 @@ func (s *ChatSession) HandleMcpMessage(msg *ClientMessage) error {
 	return nil
 }
 
+// HandleChatMessage 处理文本对话消息, 跳过asr直接进入llm
+func (s *ChatSession) HandleChatMessage(msg *ClientMessage) error {
+	text := strings.TrimSpace(msg.Text)
+	if text == "" {
+		return fmt.Errorf("文本对话消息内容为空")
+	}
+
+	isActivated, err := s.CheckDeviceActivated()
+	if err != nil {
+		log.Errorf("检查设备激活状态失败: %v", err)
+		return err
+	}
+	if !isActivated {
+		return nil
+	}
+
+	// 新的输入打断当前回复
+	s.StopSpeaking(false)
+
+	log.Infof("设备 %s 收到文本对话: %s", s.clientState.DeviceID, text)
+	s.clientState.Recorder.BeginTurn()
+	s.clientState.Recorder.SetAsrText(text)
+	s.clientState.History.BeginTurn()
+	s.clientState.History.SetUserText(text, 0)
+	return s.AddAsrResultToQueue(text)
+}
+
 // 释放udp资源
 func (s *ChatSession) HandleGoodByeMessage(msg *ClientMessage) error {
-	s.serverTransport.transport.CloseAudioChannel()
+	s.serverTransport.conn().CloseAudioChannel()
 	return nil
 }
 
@@ -454,8 +571,8 @@ func (s *ChatSession) CheckDeviceActivated() (bool, error) {
 				log.Errorf("获取配置提供者失败: %v", err)
 				return false, err
 			}
-			//调用接口再次确认激活状态
-			isActivated, err := configProvider.IsDeviceActivated(s.clientState.Ctx, s.clientState.DeviceID, "client_id")
+			//调用接口再次确认激活状态, 连接时已校验过与 Client-Id 绑定的令牌, 这里不再检查 Client-Id
+			isActivated, err := configProvider.IsDeviceActivated(s.clientState.Ctx, s.clientState.DeviceID, "")
 			if err != nil {
 				log.Errorf("获取激活状态失败: %v", err)
 				return false, err
@@ -481,9 +598,16 @@ func (s *ChatSession) HandleListenStart(msg *ClientMessage) error {
 		return nil
 	}
 
+	// 服务端打断时已开始新一轮识别, 设备收到 tts stop 后发来的 listen start 不再重置
+	if msg.Mode != "manual" && s.clientState.GetStatus() == ClientStatusListening &&
+		time.Since(time.UnixMilli(atomic.LoadInt64(&s.lastBargeInTs))) < bargeInListenWindow {
+		log.Infof("设备 %s 打断后的 listen start, 继续当前识别", msg.DeviceID)
+		return nil
+	}
+
 	// 处理拾音模式
 	if msg.Mode != "" {
-		s.clientState.ListenMode = msg.Mode
+		s.clientState.SetListenMode(msg.Mode)
 		log.Infof("设备 %s 拾音模式: %s", msg.DeviceID, msg.Mode)
 	}
 	//if s.clientState.ListenMode == "manual" {
@@ -494,6 +618,26 @@ func (s *ChatSession) HandleListenStart(msg *ClientMessage) error {
 	return s.OnListenStart()
 }
 
+// OnBargeIn 服务端检测到用户在 tts 播放期间说话, 停止播放并开始新一轮识别
+func (s *ChatSession) OnBargeIn(pcm []float32) {
+	log.Infof("设备 %s 播放期间检测到用户说话, 服务端打断", s.clientState.DeviceID)
+	metrics.BargeIns.Inc()
+	atomic.StoreInt64(&s.lastBargeInTs, time.Now().UnixMilli())
+
+	s.StopSpeaking(true)
+	s.clientState.SetStatus(ClientStatusListening)
+	if err := s.OnListenStart(); err != nil {
+		log.Errorf("打断后开始识别失败: %v", err)
+		return
+	}
+
+	// 触发打断的语音作为本轮识别的开头
+	s.clientState.SetClientHaveVoice(true)
+	s.clientState.SetClientHaveVoiceLastTime(time.Now().UnixMilli())
+	s.clientState.Asr.AddAudioData(pcm)
+	s.clientState.Recorder.WriteInput(pcm)
+}
+
 func (s *ChatSession) HandleListenStop() error {
 	/*if s.clientState.ListenMode == "auto" {
 		s.clientState.CancelSessionCtx()
@@ -506,22 +650,24 @@ func (s *ChatSession) HandleListenStop() error {
 }
 
 func (s *ChatSession) OnListenStart() error {
-	log.Debugf("OnListenStart start")
-	defer log.Debugf("OnListenStart end")
+	s.clientState.Logger.Debugf("OnListenStart start")
+	defer s.clientState.Logger.Debugf("OnListenStart end")
 
 	select {
 	case <-s.clientState.Ctx.Done():
-		log.Debugf("OnListenStart Ctx done, return")
+		s.clientState.Logger.Debugf("OnListenStart Ctx done, return")
 		return nil
 	default:
 	}
 
 	s.clientState.Destroy()
+	s.clientState.Recorder.BeginTurn()
+	s.clientState.History.BeginTurn()
 
 	ctx := s.clientState.GetSessionCtx()
 
 	//初始化asr相关
-	if s.clientState.ListenMode == "manual" {
+	if s.clientState.GetListenMode() == "manual" {
 		s.clientState.VoiceStatus.SetClientHaveVoice(true)
 	}
 
@@ -550,7 +696,7 @@ func (s *ChatSession) OnListenStart() error {
 		for {
 			select {
 			case <-ctx.Done():
-				log.Debugf("asr ctx done")
+				s.clientState.Logger.Debugf("asr ctx done")
 				return
 			default:
 			}
@@ -558,18 +704,24 @@ func (s *ChatSession) OnListenStart() error {
 			text, err := s.clientState.RetireAsrResult(ctx)
 			if err != nil {
 				log.Errorf("处理asr结果失败: %v", err)
+				metrics.IncProviderError("asr", s.clientState.DeviceConfig.Asr.Provider)
 				return
 			}
 
 			//统计asr耗时
-			log.Debugf("处理asr结果: %s, 耗时: %d ms", text, s.clientState.GetAsrDuration())
+			s.clientState.Logger.Debugf("处理asr结果: %s, 耗时: %d ms", text, s.clientState.GetAsrDuration())
 
 			if text != "" {
+				asrDuration := s.clientState.GetAsrDuration()
+				metrics.ObserveMs(metrics.AsrFirstResultLatency, asrDuration)
+
 				// 重置重试计数器
 				startIdleTime = 0
 
 				//当获取到asr结果时, 结束语音输入
 				s.clientState.OnVoiceSilence()
+				s.clientState.Recorder.SetAsrText(text)
+				s.clientState.History.SetUserText(text, asrDuration)
 
 				//发送asr消息
 				err = s.serverTransport.SendAsrResult(text)
@@ -587,16 +739,17 @@ func (s *ChatSession) OnListenStart() error {
 			} else {
 				select {
 				case <-ctx.Done():
-					log.Debugf("asr ctx done")
+					s.clientState.Logger.Debugf("asr ctx done")
 					return
 				default:
 				}
-				log.Debugf("ready Restart Asr, s.clientState.Status: %s", s.clientState.Status)
-				if s.clientState.Status == ClientStatusListening || s.clientState.Status == ClientStatusListenStop {
+				status := s.clientState.GetStatus()
+				s.clientState.Logger.Debugf("ready Restart Asr, s.clientState.Status: %s", status)
+				if status == ClientStatusListening || status == ClientStatusListenStop {
 					// text 为空，检查是否需要重新启动ASR
 					diffTs := time.Now().Unix() - startIdleTime
 					if startIdleTime > 0 && diffTs <= maxIdleTime {
-						log.Warnf("ASR识别结果为空，尝试重启ASR识别, diff ts: %s", diffTs)
+						log.Warnf("ASR识别结果为空，尝试重启ASR识别, diff ts: %d", diffTs)
 						if restartErr := s.asrManager.RestartAsrRecognition(ctx); restartErr != nil {
 							log.Errorf("重启ASR识别失败: %v", restartErr)
 							return
@@ -617,7 +770,7 @@ func (s *ChatSession) OnListenStart() error {
 
 // startChat 开始对话
 func (s *ChatSession) AddAsrResultToQueue(text string) error {
-	log.Debugf("AddAsrResultToQueue text: %s", text)
+	s.clientState.Logger.Debugf("AddAsrResultToQueue text: %s", text)
 	item := AsrResponseChannelItem{
 		ctx:  s.clientState.GetSessionCtx(),
 		text: text,
@@ -630,8 +783,8 @@ func (s *ChatSession) AddAsrResultToQueue(text string) error {
 }
 
 func (s *ChatSession) processChatText(ctx context.Context) {
-	log.Debugf("processChatText start")
-	defer log.Debugf("processChatText end")
+	s.clientState.Logger.Debugf("processChatText start")
+	defer s.clientState.Logger.Debugf("processChatText end")
 
 	for {
 		item, err := s.chatTextQueue.Pop(ctx, 0)
@@ -655,7 +808,8 @@ func (s *ChatSession) ClearChatTextQueue() {
 }
 
 func (s *ChatSession) Close() {
-	log.Debugf("ChatSession.Close() 开始清理会话资源, 设备 %s", s.clientState.DeviceID)
+	s.clientState.Logger.Debugf("ChatSession.Close() 开始清理会话资源, 设备 %s", s.clientState.DeviceID)
+	s.closed.Store(true)
 
 	// 停止说话和清理音频相关资源
 	s.StopSpeaking(true)
@@ -663,6 +817,10 @@ func (s *ChatSession) Close() {
 	// 清理聊天文本队列
 	s.ClearChatTextQueue()
 
+	// 保存未结束的录音和对话记录
+	s.clientState.Recorder.EndTurn()
+	s.clientState.History.EndTurn()
+
 	// 关闭服务端传输
 	if s.serverTransport != nil {
 		s.serverTransport.Close()
@@ -671,13 +829,13 @@ func (s *ChatSession) Close() {
 	// 取消会话级别的上下文
 	s.cancel()
 
-	log.Debugf("ChatSession.Close() 会话资源清理完成, 设备 %s", s.clientState.DeviceID)
+	s.clientState.Logger.Debugf("ChatSession.Close() 会话资源清理完成, 设备 %s", s.clientState.DeviceID)
 }
 
 func (s *ChatSession) actionDoChat(ctx context.Context, text string) error {
 	select {
 	case <-ctx.Done():
-		log.Debugf("actionDoChat ctx done, return")
+		s.clientState.Logger.Debugf("actionDoChat ctx done, return")
 		return nil
 	default:
 	}
@@ -694,8 +852,16 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string) error {
 	}
 
 	clientState := s.clientState
+	// 一轮对话的 tts 在 DoLLmRequest 返回时已下发完毕
+	defer func() {
+		if ctx.Err() != nil {
+			clientState.History.SetInterrupted()
+		}
+		clientState.History.EndTurn()
+		clientState.Recorder.EndTurn()
+	}()
 
-	sessionID := clientState.SessionID
+	sessionID := clientState.GetSessionID()
 
 	// 直接创建Eino原生消息
 	userMessage := &schema.Message{
@@ -703,6 +869,31 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string) error {
 		Content: text,
 	}
 
+	einoTools := s.getEinoTools(ctx)
+
+	toolNameList := make([]string, 0)
+	for _, tool := range einoTools {
+		toolNameList = append(toolNameList, tool.Name)
+	}
+
+	// 知识库资料只对本轮生效
+	s.llmManager.SetKnowledge(retrieveKnowledge(ctx, clientState, text))
+	defer s.llmManager.SetKnowledge("")
+
+	// 发送带工具的LLM请求
+	log.Infof("使用 %d 个MCP工具发送LLM请求, tools: %+v", len(einoTools), toolNameList)
+
+	err := s.llmManager.DoLLmRequest(ctx, userMessage, einoTools, true)
+	if err != nil {
+		log.Errorf("发送带工具的 LLM 请求失败, seesionID: %s, error: %v", sessionID, err)
+		return fmt.Errorf("发送带工具的 LLM 请求失败: %v", err)
+	}
+	return nil
+}
+
+// getEinoTools 获取设备可用的MCP及本地工具, 并转换为Eino ToolInfo格式
+func (s *ChatSession) getEinoTools(ctx context.Context) []*schema.ToolInfo {
+	clientState := s.clientState
 	// 获取全局MCP工具列表
 	mcpTools, err := mcp.GetToolsByDeviceId(clientState.DeviceID, clientState.AgentID)
 	if err != nil {
@@ -720,21 +911,7 @@ func (s *ChatSession) actionDoChat(ctx context.Context, text string) error {
 	einoTools, err := llm.ConvertMCPToolsToEinoTools(ctx, mcpToolsInterface)
 	if err != nil {
 		log.Errorf("转换MCP工具失败: %v", err)
-		einoTools = nil
-	}
-
-	toolNameList := make([]string, 0)
-	for _, tool := range einoTools {
-		toolNameList = append(toolNameList, tool.Name)
-	}
-
-	// 发送带工具的LLM请求
-	log.Infof("使用 %d 个MCP工具发送LLM请求, tools: %+v", len(einoTools), toolNameList)
-
-	err = s.llmManager.DoLLmRequest(ctx, userMessage, einoTools, true)
-	if err != nil {
-		log.Errorf("发送带工具的 LLM 请求失败, seesionID: %s, error: %v", sessionID, err)
-		return fmt.Errorf("发送带工具的 LLM 请求失败: %v", err)
+		return nil
 	}
-	return nil
+	return einoTools
 }
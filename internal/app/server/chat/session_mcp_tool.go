@@ -72,7 +72,7 @@ func (c *ChatManager) LocalMcpCloseChat() error {
 
 // 清空历史对话
 func (c *ChatManager) LocalMcpClearHistory() error {
-	llm_memory.Get().ResetMemory(c.ctx, c.DeviceID)
+	llm_memory.Get().ResetMemory(c.ctx, c.DeviceID, c.clientState.AgentID)
 	return nil
 }
 
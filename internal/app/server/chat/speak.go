@@ -0,0 +1,70 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/schema"
+
+	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// SpeakRequest 服务端主动播报请求
+type SpeakRequest struct {
+	DeviceID string `json:"device_id"`
+	// 播报文本, UseLlm 为 true 时作为提示词交给 LLM 生成播报内容
+	Text   string `json:"text"`
+	UseLlm bool   `json:"use_llm"`
+	// 是否打断设备当前正在进行的播报, 为 false 时排队在当前播报之后
+	Interrupt bool `json:"interrupt"`
+}
+
+// SpeakResult 主动播报结果
+type SpeakResult struct {
+	DeviceID  string `json:"device_id"`
+	Online    bool   `json:"online"`
+	Transport string `json:"transport,omitempty"`
+}
+
+// Speak 服务端主动向设备下发播报
+func (c *ChatManager) Speak(req *SpeakRequest) error {
+	if c.session == nil {
+		return fmt.Errorf("设备 %s 会话未初始化", c.DeviceID)
+	}
+	return c.session.Speak(req)
+}
+
+// Speak 将主动播报内容放入 llm 响应队列, 复用 tts start/stop 及 tts 播放流程
+func (s *ChatSession) Speak(req *SpeakRequest) error {
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		return fmt.Errorf("播报内容不能为空")
+	}
+
+	if req.Interrupt {
+		s.StopSpeaking(false)
+	}
+
+	log.Infof("设备 %s 主动播报, use_llm: %t, text: %s", s.clientState.DeviceID, req.UseLlm, text)
+
+	ctx := s.clientState.GetSessionCtx()
+	if req.UseLlm {
+		// 提示词以 system 角色下发, 不写入对话历史, 仅保存 LLM 生成的播报内容
+		promptMessage := &schema.Message{
+			Role:    schema.System,
+			Content: text,
+		}
+		return s.llmManager.DoLLmRequest(ctx, promptMessage, s.getEinoTools(ctx), false)
+	}
+
+	llmResponseChan := make(chan llm_common.LLMResponseStruct, 1)
+	llmResponseChan <- llm_common.LLMResponseStruct{
+		IsStart: true,
+		IsEnd:   true,
+		Text:    text,
+	}
+	close(llmResponseChan)
+	// userMessage 为 nil, 播报文本作为 assistant 消息写入对话历史
+	return s.llmManager.HandleLLMResponseChannelAsync(ctx, nil, llmResponseChan)
+}
@@ -3,11 +3,16 @@ package chat
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 	. "xiaozhi-esp32-server-golang/internal/data/client"
+	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
 	"xiaozhi-esp32-server-golang/internal/util"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
 	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/spf13/viper"
 )
 
 type TTSQueueItem struct {
@@ -27,6 +32,10 @@ type TTSManager struct {
 	clientState     *ClientState
 	serverTransport *ServerTransport
 	ttsQueue        *util.Queue[TTSQueueItem]
+
+	// 已提交合成但未播放完的句子, 断线恢复时补播
+	pendingLock sync.Mutex
+	pending     []string
 }
 
 // NewTTSManager 只接受WithClientState
@@ -60,6 +69,9 @@ func (t *TTSManager) processTTSQueue(ctx context.Context) {
 			item.onStartFunc()
 		}
 		err = t.handleTts(item.ctx, item.llmResponse)
+		if err == nil {
+			t.donePending(item.llmResponse.Text)
+		}
 		if item.onEndFunc != nil {
 			item.onEndFunc(err)
 		}
@@ -68,6 +80,36 @@ func (t *TTSManager) processTTSQueue(ctx context.Context) {
 
 func (t *TTSManager) ClearTTSQueue() {
 	t.ttsQueue.Clear()
+	t.pendingLock.Lock()
+	t.pending = nil
+	t.pendingLock.Unlock()
+}
+
+func (t *TTSManager) addPending(text string) {
+	t.pendingLock.Lock()
+	defer t.pendingLock.Unlock()
+	t.pending = append(t.pending, text)
+}
+
+// donePending 句子播放完毕, 从未播完列表中移除
+func (t *TTSManager) donePending(texts ...string) {
+	t.pendingLock.Lock()
+	defer t.pendingLock.Unlock()
+	for _, text := range texts {
+		for i, pending := range t.pending {
+			if pending == text {
+				t.pending = append(t.pending[:i], t.pending[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// unfinishedText 返回未播放完的句子
+func (t *TTSManager) unfinishedText() []string {
+	t.pendingLock.Lock()
+	defer t.pendingLock.Unlock()
+	return append([]string(nil), t.pending...)
 }
 
 // 处理文本内容响应（异步 TTS 入队）
@@ -85,6 +127,7 @@ func (t *TTSManager) handleTextResponse(ctx context.Context, llmResponse llm_com
 		}
 	}
 
+	t.addPending(llmResponse.Text)
 	t.ttsQueue.Push(ttsQueueItem)
 
 	if isSync {
@@ -105,18 +148,34 @@ func (t *TTSManager) handleTextResponse(ctx context.Context, llmResponse llm_com
 
 // 同步 TTS 处理
 func (t *TTSManager) handleTts(ctx context.Context, llmResponse llm_common.LLMResponseStruct) error {
-	log.Debugf("handleTts start, text: %s", llmResponse.Text)
+	t.clientState.Logger.Debugf("handleTts start, text: %s", llmResponse.Text)
 	if llmResponse.Text == "" {
 		return nil
 	}
+	t.clientState.Recorder.AddReplyText(llmResponse.Text)
+	t.clientState.History.AddAssistantText(llmResponse.Text)
+
+	if t.clientState.TextOnly {
+		t.sendEmotion(llmResponse)
+		if err := t.serverTransport.SendText(llmResponse.Text); err != nil {
+			log.Errorf("发送文本失败: %s, %v", llmResponse.Text, err)
+			return fmt.Errorf("发送文本失败: %s, %v", llmResponse.Text, err)
+		}
+		return nil
+	}
 
 	// 使用带上下文的TTS处理
+	t.clientState.SetStartTtsTs()
 	outputChan, err := t.clientState.TTSProvider.TextToSpeechStream(ctx, llmResponse.Text, t.clientState.OutputAudioFormat.SampleRate, t.clientState.OutputAudioFormat.Channels, t.clientState.OutputAudioFormat.FrameDuration)
 	if err != nil {
 		log.Errorf("生成 TTS 音频失败: %v", err)
+		metrics.IncProviderError("tts", t.clientState.DeviceConfig.Tts.Provider)
 		return fmt.Errorf("生成 TTS 音频失败: %v", err)
 	}
 
+	// 表情需在 sentence_start 之前下发
+	t.sendEmotion(llmResponse)
+
 	if err := t.serverTransport.SendSentenceStart(llmResponse.Text); err != nil {
 		log.Errorf("发送 TTS 文本失败: %s, %v", llmResponse.Text, err)
 		return fmt.Errorf("发送 TTS 文本失败: %s, %v", llmResponse.Text, err)
@@ -136,6 +195,23 @@ func (t *TTSManager) handleTts(ctx context.Context, llmResponse llm_common.LLMRe
 	return nil
 }
 
+// sendEmotion 下发句子对应的表情, 首句未携带表情时按关键词推断
+func (t *TTSManager) sendEmotion(llmResponse llm_common.LLMResponseStruct) {
+	if !viper.GetBool("emotion.enable") {
+		return
+	}
+	emotion := llmResponse.Emotion
+	if emotion == "" && llmResponse.IsStart && viper.GetBool("emotion.classifier") {
+		emotion = llm.ClassifyEmotion(llmResponse.Text)
+	}
+	if emotion == "" {
+		return
+	}
+	if err := t.serverTransport.SendEmotion(llm.GetEmotionEmoji(emotion), emotion); err != nil {
+		log.Errorf("发送表情失败: %s, %v", emotion, err)
+	}
+}
+
 // getAlignedDuration 计算当前时间与开始时间的差值，向上对齐到frameDuration
 func getAlignedDuration(startTime time.Time, frameDuration time.Duration) time.Duration {
 	elapsed := time.Since(startTime)
@@ -145,6 +221,25 @@ func getAlignedDuration(startTime time.Time, frameDuration time.Duration) time.D
 }
 
 func (t *TTSManager) SendTTSAudio(ctx context.Context, audioChan chan []byte, isStart bool) error {
+	return t.sendTTSAudio(ctx, audioChan, isStart, nil)
+}
+
+// sendTTSAudio onFrame 不为 nil 时在下发每帧前调用, 参数为帧序号, 用于按播放进度下发字幕
+func (t *TTSManager) sendTTSAudio(ctx context.Context, audioChan chan []byte, isStart bool, onFrame func(frame int) error) error {
+	// 纯文本对话不下发音频, 丢弃音频帧
+	if t.clientState.TextOnly {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case _, ok := <-audioChan:
+				if !ok {
+					return nil
+				}
+			}
+		}
+	}
+
 	totalFrames := 0 // 跟踪已发送的总帧数
 
 	isStatistic := true
@@ -160,7 +255,7 @@ func (t *TTSManager) SendTTSAudio(ctx context.Context, audioChan chan []byte, is
 	// 基于绝对时间的精确流控
 	frameDuration := time.Duration(t.clientState.OutputAudioFormat.FrameDuration) * time.Millisecond
 
-	log.Debugf("SendTTSAudio 开始，缓存帧数: %d, 帧时长: %v", cacheFrameCount, frameDuration)
+	t.clientState.Logger.Debugf("SendTTSAudio 开始，缓存帧数: %d, 帧时长: %v", cacheFrameCount, frameDuration)
 
 	// 使用滑动窗口机制，确保对端始终缓存 cacheFrameCount 帧数据
 	for {
@@ -178,7 +273,7 @@ func (t *TTSManager) SendTTSAudio(ctx context.Context, audioChan chan []byte, is
 		// 尝试获取并发送下一帧
 		select {
 		case <-ctx.Done():
-			log.Debugf("SendTTSAudio context done, exit")
+			t.clientState.Logger.Debugf("SendTTSAudio context done, exit")
 			return nil
 		case frame, ok := <-audioChan:
 			if !ok {
@@ -188,26 +283,39 @@ func (t *TTSManager) SendTTSAudio(ctx context.Context, audioChan chan []byte, is
 				totalDuration := time.Duration(totalFrames) * frameDuration
 				if totalDuration > elapsed {
 					waitDuration := totalDuration - elapsed
-					log.Debugf("SendTTSAudio 等待客户端播放剩余缓冲: %v (totalFrames=%d, frameDuration=%v)", waitDuration, totalFrames, frameDuration)
+					t.clientState.Logger.Debugf("SendTTSAudio 等待客户端播放剩余缓冲: %v (totalFrames=%d, frameDuration=%v)", waitDuration, totalFrames, frameDuration)
 					time.Sleep(waitDuration)
 				}
-				log.Debugf("SendTTSAudio audioChan closed, exit, 总共发送 %d 帧", totalFrames)
+				t.clientState.Logger.Debugf("SendTTSAudio audioChan closed, exit, 总共发送 %d 帧", totalFrames)
 				return nil
 			}
+			if onFrame != nil {
+				if err := onFrame(totalFrames); err != nil {
+					return err
+				}
+			}
 			// 发送当前帧
 			if err := t.serverTransport.SendAudio(frame); err != nil {
 				log.Errorf("发送 TTS 音频失败: 第 %d 帧, len: %d, 错误: %v", totalFrames, len(frame), err)
 				return fmt.Errorf("发送 TTS 音频 len: %d 失败: %v", len(frame), err)
 			}
+			t.clientState.Recorder.WriteOutput(frame)
 
 			totalFrames++
+			// 仅统计 handleTts 发起的合成, 不包括音乐等资源播放
+			if totalFrames == 1 {
+				if ttsDuration, ok := t.clientState.TakeTtsDuration(); ok {
+					metrics.ObserveMs(metrics.TtsFirstFrameLatency, ttsDuration)
+					t.clientState.History.SetTtsFirstFrameMs(ttsDuration)
+				}
+			}
 			if totalFrames%100 == 0 {
-				log.Debugf("SendTTSAudio 已发送 %d 帧", totalFrames)
+				t.clientState.Logger.Debugf("SendTTSAudio 已发送 %d 帧", totalFrames)
 			}
 
 			// 统计信息记录（仅在开始时记录一次）
 			if isStart && isStatistic && totalFrames == 1 {
-				log.Debugf("从接收音频结束 asr->llm->tts首帧 整体 耗时: %d ms", t.clientState.GetAsrLlmTtsDuration())
+				t.clientState.Logger.Debugf("从接收音频结束 asr->llm->tts首帧 整体 耗时: %d ms", t.clientState.GetAsrLlmTtsDuration())
 				isStatistic = false
 			}
 		}
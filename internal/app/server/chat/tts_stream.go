@@ -0,0 +1,219 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/domain/tts"
+	tts_common "xiaozhi-esp32-server-golang/internal/domain/tts/common"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// ttsStreamKey 请求 ctx 中标记本次 LLM 请求开启了增量输出, 需建立流式输入的TTS会话
+type ttsStreamKey struct{}
+
+// ttsStream 流式输入的合成, LLM 的增量文本直接送入TTS, 音频边合成边下发
+// 句子仍用于字幕(sentence_start)、表情和对话记录, 在下发音频时按帧对齐
+type ttsStream struct {
+	t        *TTSManager
+	ctx      context.Context
+	session  tts_common.StreamingSession
+	started  bool
+	playDone chan error
+
+	mu sync.Mutex
+	// 已收到的句子, next 之前的已下发字幕
+	sentences []streamSentence
+	next      int
+	chars     int
+}
+
+type streamSentence struct {
+	llmResponse llm_common.LLMResponseStruct
+	offset      int // 句子在整段回复中的起始位置, 按 tts_common.CountChars 计
+}
+
+// supportStreamingInput 当前TTS是否开启了流式输入, 纯文本对话不使用
+func (t *TTSManager) supportStreamingInput() bool {
+	if t.clientState.TextOnly || t.clientState.TTSProvider == nil {
+		return false
+	}
+	_, ok := tts.GetStreamingInputProvider(t.clientState.TTSProvider)
+	return ok
+}
+
+// startStream 建立流式输入的合成会话并开始下发音频, 失败时返回 nil, 由调用方按句合成
+func (t *TTSManager) startStream(ctx context.Context) *ttsStream {
+	provider, ok := tts.GetStreamingInputProvider(t.clientState.TTSProvider)
+	if !ok {
+		return nil
+	}
+	format := t.clientState.OutputAudioFormat
+	session, err := provider.StartSession(ctx, format.SampleRate, format.Channels, format.FrameDuration)
+	if err != nil {
+		log.Errorf("建立流式输入TTS会话失败, 改为按句合成: %v", err)
+		metrics.IncProviderError("tts", t.clientState.DeviceConfig.Tts.Provider)
+		return nil
+	}
+
+	s := &ttsStream{
+		t:        t,
+		ctx:      ctx,
+		session:  session,
+		playDone: make(chan error, 1),
+	}
+	go func() {
+		s.playDone <- t.sendTTSAudio(ctx, session.OpusChan(), true, s.onFrame)
+	}()
+	return s
+}
+
+// AppendText 送入增量文本
+func (s *ttsStream) AppendText(text string) error {
+	if !s.started {
+		s.started = true
+		s.t.clientState.SetStartTtsTs()
+	}
+	return s.session.AppendText(text)
+}
+
+// SendSentence 记录完整句子, 音频已通过增量文本合成, 字幕和表情在播放到该句时下发
+func (s *ttsStream) SendSentence(llmResponse llm_common.LLMResponseStruct) {
+	s.mu.Lock()
+	s.sentences = append(s.sentences, streamSentence{llmResponse: llmResponse, offset: s.chars})
+	s.chars += tts_common.CountChars(llmResponse.Text)
+	s.mu.Unlock()
+	s.t.addPending(llmResponse.Text)
+}
+
+// onFrame 下发第 frame 帧前调用, 音频播放到的句子下发字幕
+func (s *ttsStream) onFrame(frame int) error {
+	offset := s.session.TextOffset(frame)
+	for {
+		s.mu.Lock()
+		if s.next >= len(s.sentences) || s.sentences[s.next].offset > offset {
+			s.mu.Unlock()
+			return nil
+		}
+		s.next++
+		prev, current := s.previousText(), s.sentences[s.next-1].llmResponse
+		s.mu.Unlock()
+		if err := s.startSentence(prev, current); err != nil {
+			return err
+		}
+	}
+}
+
+// previousText 上一个已下发字幕的句子, 调用方需持有锁
+func (s *ttsStream) previousText() string {
+	if s.next < 2 {
+		return ""
+	}
+	return s.sentences[s.next-2].llmResponse.Text
+}
+
+// startSentence 结束上一句的字幕, 下发本句的表情和字幕
+func (s *ttsStream) startSentence(prev string, llmResponse llm_common.LLMResponseStruct) error {
+	if prev != "" {
+		if err := s.t.serverTransport.SendSentenceEnd(prev); err != nil {
+			return fmt.Errorf("发送 TTS 文本失败: %s, %v", prev, err)
+		}
+	}
+	s.t.clientState.Recorder.AddReplyText(llmResponse.Text)
+	s.t.clientState.History.AddAssistantText(llmResponse.Text)
+	s.t.sendEmotion(llmResponse)
+	if err := s.t.serverTransport.SendSentenceStart(llmResponse.Text); err != nil {
+		return fmt.Errorf("发送 TTS 文本失败: %s, %v", llmResponse.Text, err)
+	}
+	return nil
+}
+
+// texts 返回 sentences 的文本
+func texts(sentences []streamSentence) []string {
+	result := make([]string, 0, len(sentences))
+	for _, sentence := range sentences {
+		result = append(result, sentence.llmResponse.Text)
+	}
+	return result
+}
+
+// Finish 结束文本输入并等待音频下发完毕
+func (s *ttsStream) Finish() error {
+	if err := s.session.Finish(); err != nil {
+		s.session.Close()
+		return fmt.Errorf("结束流式输入TTS会话失败: %v", err)
+	}
+	var err error
+	select {
+	case err = <-s.playDone:
+	case <-s.ctx.Done():
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// 音频已播完, 服务端分句与本地不一致时剩余句子的字幕在最后补发
+	s.mu.Lock()
+	rest := s.sentences[s.next:]
+	s.next = len(s.sentences)
+	all := texts(s.sentences)
+	s.mu.Unlock()
+	prev := ""
+	if len(all) > len(rest) {
+		prev = all[len(all)-len(rest)-1]
+	}
+	for _, sentence := range rest {
+		if err := s.startSentence(prev, sentence.llmResponse); err != nil {
+			return err
+		}
+		prev = sentence.llmResponse.Text
+	}
+
+	// 音频与句子不对应, 整段播完才视为播放完毕
+	s.t.donePending(all...)
+	if prev != "" {
+		if err := s.t.serverTransport.SendSentenceEnd(prev); err != nil {
+			return fmt.Errorf("发送 TTS 文本失败: %s, %v", prev, err)
+		}
+	}
+	return nil
+}
+
+// Drain 送入文本失败时结束会话, 等已合成的音频下发完, 返回还没开始播放的句子, 由调用方改为按句合成
+func (s *ttsStream) Drain() []llm_common.LLMResponseStruct {
+	s.session.Close()
+	select {
+	case <-s.playDone:
+	case <-s.ctx.Done():
+		return nil
+	}
+
+	s.mu.Lock()
+	all := texts(s.sentences)
+	played := s.next
+	rest := make([]llm_common.LLMResponseStruct, 0, len(s.sentences)-played)
+	for _, sentence := range s.sentences[played:] {
+		rest = append(rest, sentence.llmResponse)
+	}
+	s.next = len(s.sentences)
+	s.mu.Unlock()
+
+	// 未播放的句子按句合成时会重新加入
+	s.t.donePending(all...)
+	if played > 0 {
+		last := all[played-1]
+		if err := s.t.serverTransport.SendSentenceEnd(last); err != nil {
+			log.Errorf("发送 TTS 文本失败: %s, %v", last, err)
+		}
+	}
+	return rest
+}
+
+// Close 释放会话, 可重复调用
+func (s *ttsStream) Close() {
+	s.session.Close()
+}
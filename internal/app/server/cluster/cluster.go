@@ -0,0 +1,434 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// Config 集群配置, 对应 config.yaml 中的 cluster
+type Config struct {
+	NodeID         string
+	KeyPrefix      string
+	NodeTTL        time.Duration // 节点及设备归属的过期时间, 由心跳续期
+	RequestTimeout time.Duration // 转发请求等待响应的超时
+}
+
+// Node 注册在 redis 中的节点信息
+type Node struct {
+	NodeID    string `json:"node_id"`
+	Host      string `json:"host"`
+	Devices   int    `json:"devices"`
+	StartedAt int64  `json:"started_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// Handler 处理其它节点转发的请求, 返回值与 manager 请求处理器一致
+type Handler func(ctx context.Context, body map[string]interface{}) (int, map[string]interface{}, error)
+
+// envelope 节点间通过 pub/sub 传递的请求和响应
+type envelope struct {
+	ID     string                 `json:"id"`
+	From   string                 `json:"from"`
+	Reply  bool                   `json:"reply,omitempty"`
+	Path   string                 `json:"path,omitempty"`
+	Body   map[string]interface{} `json:"body,omitempty"`
+	Status int                    `json:"status,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+var ErrNodeOffline = errors.New("节点不在线")
+
+// 仅当设备仍归属本节点时续期或删除
+var (
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	refreshScript = redis.NewScript(`
+local n = 0
+for _, key in ipairs(KEYS) do
+	if redis.call("GET", key) == ARGV[1] then
+		redis.call("PEXPIRE", key, ARGV[2])
+		n = n + 1
+	end
+end
+return n`)
+)
+
+var (
+	localNodeID     string
+	localNodeIDOnce sync.Once
+)
+
+// LocalNodeID 本节点 id, 未配置 cluster.node_id 时使用 主机名-进程号
+func LocalNodeID() string {
+	localNodeIDOnce.Do(func() {
+		localNodeID = viper.GetString("cluster.node_id")
+		if localNodeID != "" {
+			return
+		}
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			localNodeID = uuid.New().String()
+			return
+		}
+		localNodeID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	})
+	return localNodeID
+}
+
+type Option func(*Cluster)
+
+// WithLocalDevices 本节点在线设备列表, 心跳时续期设备归属
+func WithLocalDevices(localDevices func() []string) Option {
+	return func(c *Cluster) {
+		c.localDevices = localDevices
+	}
+}
+
+// Cluster 多实例部署时的节点注册、设备归属及节点间请求转发
+type Cluster struct {
+	config       Config
+	client       *redis.Client
+	localDevices func() []string
+	startedAt    time.Time
+
+	// 发布到指定频道, 返回收到消息的订阅者数量
+	publish func(ctx context.Context, channel string, data []byte) (int64, error)
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	pending  map[string]chan *envelope
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func New(client *redis.Client, config Config, opts ...Option) *Cluster {
+	if config.NodeID == "" {
+		config.NodeID = LocalNodeID()
+	}
+	if config.NodeTTL <= 0 {
+		config.NodeTTL = 30 * time.Second
+	}
+	if config.RequestTimeout <= 0 {
+		config.RequestTimeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Cluster{
+		config:    config,
+		client:    client,
+		startedAt: time.Now(),
+		handlers:  make(map[string]Handler),
+		pending:   make(map[string]chan *envelope),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	c.publish = func(ctx context.Context, channel string, data []byte) (int64, error) {
+		return c.client.Publish(ctx, channel, data).Result()
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Cluster) NodeID() string {
+	return c.config.NodeID
+}
+
+func (c *Cluster) nodeKey(nodeID string) string {
+	return fmt.Sprintf("%s:cluster:node:%s", c.config.KeyPrefix, nodeID)
+}
+
+func (c *Cluster) deviceKey(deviceID string) string {
+	return fmt.Sprintf("%s:cluster:device:%s", c.config.KeyPrefix, deviceID)
+}
+
+func (c *Cluster) channel(nodeID string) string {
+	return fmt.Sprintf("%s:cluster:rpc:%s", c.config.KeyPrefix, nodeID)
+}
+
+// Handle 注册其它节点可调用的请求路径
+func (c *Cluster) Handle(path string, handler Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[path] = handler
+}
+
+// Start 订阅本节点频道, 注册节点并开始心跳
+func (c *Cluster) Start() error {
+	pubsub := c.client.Subscribe(c.ctx, c.channel(c.config.NodeID))
+	// 等待订阅生效, 避免注册后收不到请求
+	if _, err := pubsub.Receive(c.ctx); err != nil {
+		pubsub.Close()
+		return fmt.Errorf("订阅集群频道失败: %v", err)
+	}
+	if err := c.heartbeat(); err != nil {
+		pubsub.Close()
+		return fmt.Errorf("注册集群节点失败: %v", err)
+	}
+
+	go func() {
+		defer pubsub.Close()
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				c.handleMessage([]byte(msg.Payload))
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(c.config.NodeTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.heartbeat(); err != nil {
+					log.Errorf("集群节点 %s 心跳失败: %v", c.config.NodeID, err)
+				}
+			}
+		}
+	}()
+
+	log.Infof("集群节点 %s 已启动", c.config.NodeID)
+	return nil
+}
+
+// Stop 注销节点并释放本节点的设备
+func (c *Cluster) Stop() {
+	c.cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if c.localDevices != nil {
+		for _, deviceID := range c.localDevices() {
+			c.ReleaseDevice(ctx, deviceID)
+		}
+	}
+	if err := c.client.Del(ctx, c.nodeKey(c.config.NodeID)).Err(); err != nil {
+		log.Errorf("注销集群节点失败: %v", err)
+	}
+}
+
+// heartbeat 续期节点信息和本节点设备的归属
+func (c *Cluster) heartbeat() error {
+	ctx, cancel := context.WithTimeout(c.ctx, 5*time.Second)
+	defer cancel()
+
+	var devices []string
+	if c.localDevices != nil {
+		devices = c.localDevices()
+	}
+	hostname, _ := os.Hostname()
+	node := Node{
+		NodeID:    c.config.NodeID,
+		Host:      hostname,
+		Devices:   len(devices),
+		StartedAt: c.startedAt.Unix(),
+		UpdatedAt: time.Now().Unix(),
+	}
+	data, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Set(ctx, c.nodeKey(c.config.NodeID), data, c.config.NodeTTL).Err(); err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(devices))
+	for _, deviceID := range devices {
+		keys = append(keys, c.deviceKey(deviceID))
+	}
+	return refreshScript.Run(ctx, c.client, keys, c.config.NodeID, c.config.NodeTTL.Milliseconds()).Err()
+}
+
+// Nodes 当前在线的节点
+func (c *Cluster) Nodes(ctx context.Context) ([]Node, error) {
+	var keys []string
+	iter := c.client.Scan(ctx, 0, c.nodeKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	values, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]Node, 0, len(values))
+	for _, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var node Node
+		if err := json.Unmarshal([]byte(str), &node); err != nil {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// ClaimDevice 设备连接到本节点, 返回之前所在的节点, 不存在时为空
+func (c *Cluster) ClaimDevice(ctx context.Context, deviceID string) (string, error) {
+	prev, err := c.client.SetArgs(ctx, c.deviceKey(deviceID), c.config.NodeID, redis.SetArgs{
+		TTL: c.config.NodeTTL,
+		Get: true,
+	}).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return prev, err
+}
+
+// ReleaseDevice 设备断开, 仅当仍归属本节点时删除, 返回是否删除
+// 设备已连接到其它节点时返回 false
+func (c *Cluster) ReleaseDevice(ctx context.Context, deviceID string) (bool, error) {
+	n, err := releaseScript.Run(ctx, c.client, []string{c.deviceKey(deviceID)}, c.config.NodeID).Int()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// DeviceNode 设备所在的节点, 不在线时为空
+func (c *Cluster) DeviceNode(ctx context.Context, deviceID string) (string, error) {
+	nodeID, err := c.client.Get(ctx, c.deviceKey(deviceID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return nodeID, err
+}
+
+// Forward 将请求转发到指定节点并等待响应
+func (c *Cluster) Forward(ctx context.Context, nodeID string, path string, body map[string]interface{}) (int, map[string]interface{}, error) {
+	request := envelope{
+		ID:   uuid.New().String(),
+		From: c.config.NodeID,
+		Path: path,
+		Body: body,
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	replyChan := make(chan *envelope, 1)
+	c.mu.Lock()
+	c.pending[request.ID] = replyChan
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, request.ID)
+		c.mu.Unlock()
+	}()
+
+	receivers, err := c.publish(ctx, c.channel(nodeID), data)
+	if err != nil {
+		return 0, nil, fmt.Errorf("转发请求到节点 %s 失败: %v", nodeID, err)
+	}
+	if receivers == 0 {
+		return 0, nil, fmt.Errorf("%w: %s", ErrNodeOffline, nodeID)
+	}
+
+	timer := time.NewTimer(c.config.RequestTimeout)
+	defer timer.Stop()
+	select {
+	case reply := <-replyChan:
+		if reply.Error != "" {
+			return reply.Status, reply.Body, errors.New(reply.Error)
+		}
+		return reply.Status, reply.Body, nil
+	case <-timer.C:
+		return 0, nil, fmt.Errorf("节点 %s 响应超时", nodeID)
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	}
+}
+
+func (c *Cluster) handleMessage(data []byte) {
+	var msg envelope
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Errorf("解析集群消息失败: %v", err)
+		return
+	}
+
+	if msg.Reply {
+		c.mu.RLock()
+		replyChan, ok := c.pending[msg.ID]
+		c.mu.RUnlock()
+		if !ok {
+			log.Debugf("收到未知的集群响应: %s", msg.ID)
+			return
+		}
+		select {
+		case replyChan <- &msg:
+		default:
+		}
+		return
+	}
+
+	go c.handleRequest(&msg)
+}
+
+func (c *Cluster) handleRequest(request *envelope) {
+	reply := envelope{
+		ID:    request.ID,
+		From:  c.config.NodeID,
+		Reply: true,
+	}
+
+	c.mu.RLock()
+	handler, ok := c.handlers[request.Path]
+	c.mu.RUnlock()
+	if !ok {
+		reply.Status = 404
+		reply.Error = fmt.Sprintf("未知的集群请求路径: %s", request.Path)
+	} else {
+		ctx, cancel := context.WithTimeout(c.ctx, c.config.RequestTimeout)
+		status, body, err := handler(ctx, request.Body)
+		cancel()
+		reply.Status = status
+		reply.Body = body
+		if err != nil {
+			reply.Error = err.Error()
+		}
+	}
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		log.Errorf("序列化集群响应失败: %v", err)
+		return
+	}
+	if _, err := c.publish(c.ctx, c.channel(request.From), data); err != nil {
+		log.Errorf("发送集群响应到节点 %s 失败: %v", request.From, err)
+	}
+}
@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connect 用内存投递代替 redis pub/sub
+func connect(nodes ...*Cluster) {
+	byChannel := make(map[string]*Cluster)
+	for _, node := range nodes {
+		byChannel[node.channel(node.NodeID())] = node
+	}
+	for _, node := range nodes {
+		node.publish = func(ctx context.Context, channel string, data []byte) (int64, error) {
+			target, ok := byChannel[channel]
+			if !ok {
+				return 0, nil
+			}
+			go target.handleMessage(data)
+			return 1, nil
+		}
+	}
+}
+
+func TestForward(t *testing.T) {
+	a := New(nil, Config{NodeID: "node-a", KeyPrefix: "test"})
+	b := New(nil, Config{NodeID: "node-b", KeyPrefix: "test", RequestTimeout: time.Second})
+	connect(a, b)
+
+	b.Handle("/api/device/speak", func(ctx context.Context, body map[string]interface{}) (int, map[string]interface{}, error) {
+		if body["device_id"] == "" {
+			return 400, nil, errors.New("缺少device_id参数")
+		}
+		return 200, map[string]interface{}{"device_id": body["device_id"], "online": true}, nil
+	})
+
+	status, body, err := a.Forward(context.Background(), "node-b", "/api/device/speak", map[string]interface{}{"device_id": "d1"})
+	require.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "d1", body["device_id"])
+	assert.Equal(t, true, body["online"])
+
+	status, _, err = a.Forward(context.Background(), "node-b", "/api/device/speak", map[string]interface{}{"device_id": ""})
+	assert.Equal(t, 400, status)
+	assert.EqualError(t, err, "缺少device_id参数")
+
+	status, _, err = a.Forward(context.Background(), "node-b", "/unknown", nil)
+	assert.Equal(t, 404, status)
+	assert.Error(t, err)
+
+	_, _, err = a.Forward(context.Background(), "node-c", "/api/device/speak", nil)
+	assert.ErrorIs(t, err, ErrNodeOffline)
+}
+
+func TestForwardTimeout(t *testing.T) {
+	a := New(nil, Config{NodeID: "node-a", KeyPrefix: "test", RequestTimeout: 100 * time.Millisecond})
+	b := New(nil, Config{NodeID: "node-b", KeyPrefix: "test"})
+	connect(a, b)
+
+	b.Handle("/slow", func(ctx context.Context, body map[string]interface{}) (int, map[string]interface{}, error) {
+		time.Sleep(time.Second)
+		return 200, nil, nil
+	})
+
+	_, _, err := a.Forward(context.Background(), "node-b", "/slow", nil)
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "超时"))
+}
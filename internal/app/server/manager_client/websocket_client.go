@@ -12,6 +12,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/spf13/viper"
 
+	"xiaozhi-esp32-server-golang/internal/app/server/cluster"
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
 	log "xiaozhi-esp32-server-golang/logger"
 )
@@ -23,6 +24,7 @@ type WebSocketClient struct {
 	responseChans  map[string]chan *WebSocketResponse
 	callbacks      map[string]func(*WebSocketResponse)
 	requestHandler func(*WebSocketRequest) // 处理收到的请求
+	pathHandlers   map[string]RequestHandler
 	mu             sync.RWMutex
 	isConnected    bool
 	connectMu      sync.Mutex
@@ -46,6 +48,9 @@ type WebSocketResponse struct {
 	Error   string                 `json:"error,omitempty"`
 }
 
+// RequestHandler 按路径注册的请求处理器, 返回响应状态码、响应体和错误
+type RequestHandler func(request *WebSocketRequest) (int, map[string]interface{}, error)
+
 var (
 	defaultClient *WebSocketClient
 	clientOnce    sync.Once
@@ -69,6 +74,7 @@ func NewWebSocketClient() *WebSocketClient {
 		requestTimeout: 30 * time.Second,
 		responseChans:  make(map[string]chan *WebSocketResponse),
 		callbacks:      make(map[string]func(*WebSocketResponse)),
+		pathHandlers:   make(map[string]RequestHandler),
 		messageQueue:   make(chan *WebSocketRequest, 100),
 	}
 }
@@ -92,7 +98,8 @@ func (c *WebSocketClient) Connect(ctx context.Context) error {
 
 	// 建立WebSocket连接
 	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{
-		"Origin": []string{c.baseURL},
+		"Origin":  []string{c.baseURL},
+		"Node-Id": []string{cluster.LocalNodeID()},
 	})
 	if err != nil {
 		return fmt.Errorf("WebSocket连接失败: %v", err)
@@ -507,6 +514,14 @@ func (c *WebSocketClient) handleDefaultRequest(request *WebSocketRequest) {
 		}
 
 	default:
+		c.mu.RLock()
+		handler, exists := c.pathHandlers[request.Path]
+		c.mu.RUnlock()
+		if exists {
+			go c.handlePathRequest(request, handler)
+			return
+		}
+
 		log.Warnf("收到未知的WebSocket请求路径: %s, ID: %s", request.Path, request.ID)
 
 		// 发送404响应
@@ -570,6 +585,26 @@ func (c *WebSocketClient) SendResponse(requestID string, status int, body map[st
 	return nil
 }
 
+// handlePathRequest 调用按路径注册的处理器并发送响应
+func (c *WebSocketClient) handlePathRequest(request *WebSocketRequest, handler RequestHandler) {
+	status, body, err := handler(request)
+	errorMsg := ""
+	if err != nil {
+		log.Errorf("处理WebSocket请求失败, path: %s, ID: %s, err: %v", request.Path, request.ID, err)
+		errorMsg = err.Error()
+	}
+	if err := c.SendResponse(request.ID, status, body, errorMsg); err != nil {
+		log.Errorf("发送响应失败: %v", err)
+	}
+}
+
+// RegisterRequestHandler 注册指定路径的请求处理器
+func (c *WebSocketClient) RegisterRequestHandler(path string, handler RequestHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pathHandlers[path] = handler
+}
+
 // SetRequestHandler 设置请求处理器
 func (c *WebSocketClient) SetRequestHandler(handler func(*WebSocketRequest)) {
 	c.mu.Lock()
@@ -577,6 +612,11 @@ func (c *WebSocketClient) SetRequestHandler(handler func(*WebSocketRequest)) {
 	c.requestHandler = handler
 }
 
+// MapToStruct 将请求体转换为struct
+func MapToStruct(data map[string]interface{}, target interface{}) error {
+	return mapToStruct(data, target)
+}
+
 // mapToStruct 辅助函数：将map转换为struct
 func mapToStruct(data map[string]interface{}, target interface{}) error {
 	jsonData, err := json.Marshal(data)
@@ -666,6 +706,10 @@ func SetManagerRequestHandler(handler func(*WebSocketRequest)) {
 	GetDefaultClient().SetRequestHandler(handler)
 }
 
+func RegisterRequestHandler(path string, handler RequestHandler) {
+	GetDefaultClient().RegisterRequestHandler(path, handler)
+}
+
 func SendManagerResponse(requestID string, status int, body map[string]interface{}, errorMsg string) error {
 	return GetDefaultClient().SendResponse(requestID, status, body, errorMsg)
 }
@@ -698,3 +742,66 @@ func SendMcpToolListRequestWithCallback(ctx context.Context, agentID string, cal
 	}
 	return SendManagerRequestWithCallback(ctx, "GET", "/api/mcp/tools", body, callback)
 }
+
+// SendConversationTurnRequest 推送一轮对话记录
+func SendConversationTurnRequest(ctx context.Context, turn interface{}) error {
+	data, err := json.Marshal(turn)
+	if err != nil {
+		return err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+	resp, err := GetDefaultClient().SendRequest(ctx, "POST", "/api/conversation/turn", body)
+	if err != nil {
+		return err
+	}
+	if resp.Status != http.StatusOK {
+		return fmt.Errorf("status: %d, error: %s", resp.Status, resp.Error)
+	}
+	return nil
+}
+
+// SendKnowledgeChunksRequest 获取智能体知识库的全部分块, target 为接收 chunks 的切片指针
+func SendKnowledgeChunksRequest(ctx context.Context, agentID string, target interface{}) error {
+	body := map[string]interface{}{
+		"agent_id": agentID,
+	}
+	resp, err := SendManagerRequest(ctx, "GET", "/api/knowledge/chunks", body)
+	if err != nil {
+		return err
+	}
+	if resp.Status != http.StatusOK {
+		return fmt.Errorf("status: %d, error: %s", resp.Status, resp.Error)
+	}
+	chunks, ok := resp.Body["chunks"]
+	if !ok || chunks == nil {
+		return nil
+	}
+	data, err := json.Marshal(chunks)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// SendKnowledgeAgentsRequest 获取有知识库文档的智能体ID
+func SendKnowledgeAgentsRequest(ctx context.Context) ([]string, error) {
+	resp, err := SendManagerRequest(ctx, "GET", "/api/knowledge/agents", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != http.StatusOK {
+		return nil, fmt.Errorf("status: %d, error: %s", resp.Status, resp.Error)
+	}
+	var agentIDs []string
+	data, err := json.Marshal(resp.Body["agent_ids"])
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &agentIDs); err != nil {
+		return nil, err
+	}
+	return agentIDs, nil
+}
@@ -0,0 +1,230 @@
+package mqtt_udp
+
+import (
+	"errors"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
+)
+
+const (
+	// 重放窗口大小, 与 IPsec/DTLS 相同使用 64 位位图
+	replayWindowSize = 64
+	// 序列号单次前跳的上限, 超过视为伪造, 避免一个伪造的大序列号使后续正常包全部被拒绝
+	replayMaxJump = 16 * replayWindowSize
+	// 连续收到这么多按序递增但被拒绝的包时认为计数已错位, 重新同步
+	resyncCount = 25
+	// 两次重新同步的最小间隔, 限制抓包重放借此回退窗口
+	resyncInterval = 10 * time.Second
+	// 一次丢包最多输出的补偿帧数, 更长的连续丢包不做补偿
+	maxLossMarkers = 3
+)
+
+var (
+	errReplayDuplicate = errors.New("重复的序列号")
+	errReplayTooOld    = errors.New("序列号超出重放窗口")
+	errReplayJump      = errors.New("序列号跳跃过大")
+)
+
+// UdpStats 单个设备的 UDP 收包统计
+type UdpStats struct {
+	Received  uint64 `json:"received"`  // 通过校验的包
+	Lost      uint64 `json:"lost"`      // 等待超时判定丢失的包
+	Reordered uint64 `json:"reordered"` // 乱序到达并已重排的包
+	Late      uint64 `json:"late"`      // 判定丢失后才到达而丢弃的包
+	Duplicate uint64 `json:"duplicate"` // 重复的包
+	Replayed  uint64 `json:"replayed"`  // 超出重放窗口的旧包或跳跃过大的包
+	Resynced  uint64 `json:"resynced"`  // 重放窗口重新同步的次数
+}
+
+// replayWindow 序列号滑动窗口, 拒绝重复、过旧和跳跃过大的包
+// 设备重置序列号时由 UdpSession.ResetSequence 清空; 被拒绝的包连续按序递增时按 resyncInterval 限速重新同步
+type replayWindow struct {
+	started bool
+	highest uint32
+	// 第 i 位表示 highest-i 已收到
+	bitmap uint64
+
+	// 被拒绝的包中按序递增的连续计数
+	rejectedNext uint32
+	rejectedRun  int
+	lastResync   time.Time
+}
+
+// Check 校验序列号, 返回是否因重新同步而接受了该包
+func (w *replayWindow) Check(seq uint32, now time.Time) (bool, error) {
+	if !w.started {
+		w.reset(seq)
+		return false, nil
+	}
+
+	var err error
+	if seq > w.highest {
+		shift := seq - w.highest
+		if shift <= replayMaxJump {
+			if shift >= replayWindowSize {
+				w.bitmap = 1
+			} else {
+				w.bitmap = w.bitmap<<shift | 1
+			}
+			w.highest = seq
+			w.rejectedRun = 0
+			return false, nil
+		}
+		err = errReplayJump
+	} else {
+		diff := w.highest - seq
+		if diff < replayWindowSize {
+			if w.bitmap&(1<<diff) != 0 {
+				return false, errReplayDuplicate
+			}
+			w.bitmap |= 1 << diff
+			return false, nil
+		}
+		err = errReplayTooOld
+	}
+
+	if w.rejectedRun > 0 && seq == w.rejectedNext {
+		w.rejectedRun++
+	} else {
+		w.rejectedRun = 1
+	}
+	w.rejectedNext = seq + 1
+	if w.rejectedRun < resyncCount || (!w.lastResync.IsZero() && now.Sub(w.lastResync) < resyncInterval) {
+		return false, err
+	}
+	w.reset(seq)
+	w.lastResync = now
+	return true, nil
+}
+
+// reset 以 seq 为起点重新开始, 保留上次重新同步的时间
+func (w *replayWindow) reset(seq uint32) {
+	w.started = true
+	w.highest = seq
+	w.bitmap = 1
+	w.rejectedRun = 0
+}
+
+type jitterPacket struct {
+	data    []byte
+	arrival time.Time
+}
+
+// jitterBuffer 按序列号重排音频包
+// 按序到达的包直接输出; 出现空洞时等待缺失的包, 超过 maxDelay 或缓存超过 maxPackets 时判定丢失,
+// 并输出空帧作为丢包标记, 由解码端使用 FEC/PLC 补偿
+type jitterBuffer struct {
+	maxDelay   time.Duration
+	maxPackets int
+	stats      *UdpStats
+
+	started bool
+	next    uint32
+	highest uint32
+	packets map[uint32]jitterPacket
+}
+
+func newJitterBuffer(maxDelay time.Duration, maxPackets int, stats *UdpStats) *jitterBuffer {
+	return &jitterBuffer{
+		maxDelay:   maxDelay,
+		maxPackets: maxPackets,
+		stats:      stats,
+		packets:    make(map[uint32]jitterPacket),
+	}
+}
+
+// Push 放入一个包, 返回可以按序输出的帧
+func (b *jitterBuffer) Push(seq uint32, data []byte, now time.Time) [][]byte {
+	if !b.started {
+		b.started = true
+		b.next = seq
+		b.highest = seq
+	}
+	if seq < b.next {
+		b.stats.Late++
+		metrics.UdpPacketEvents.WithLabelValues("late").Inc()
+		return nil
+	}
+	if _, ok := b.packets[seq]; ok {
+		b.stats.Duplicate++
+		metrics.UdpPacketEvents.WithLabelValues("duplicate").Inc()
+		return nil
+	}
+	if seq < b.highest {
+		b.stats.Reordered++
+		metrics.UdpPacketEvents.WithLabelValues("reordered").Inc()
+	} else {
+		b.highest = seq
+	}
+	b.packets[seq] = jitterPacket{data: data, arrival: now}
+
+	out := b.drain(nil)
+	for len(b.packets) > b.maxPackets {
+		out = b.skipGap(out)
+	}
+	return out
+}
+
+// Poll 检查等待中的空洞是否超时
+func (b *jitterBuffer) Poll(now time.Time) [][]byte {
+	var out [][]byte
+	for len(b.packets) > 0 {
+		oldest := now
+		for _, p := range b.packets {
+			if p.arrival.Before(oldest) {
+				oldest = p.arrival
+			}
+		}
+		if now.Sub(oldest) < b.maxDelay {
+			break
+		}
+		out = b.skipGap(out)
+	}
+	return out
+}
+
+// Flush 按序输出全部缓存的包并重置, 设备重新开始计数时调用
+func (b *jitterBuffer) Flush() [][]byte {
+	var out [][]byte
+	for len(b.packets) > 0 {
+		out = b.skipGap(out)
+	}
+	b.started = false
+	return out
+}
+
+func (b *jitterBuffer) drain(out [][]byte) [][]byte {
+	for {
+		p, ok := b.packets[b.next]
+		if !ok {
+			return out
+		}
+		delete(b.packets, b.next)
+		out = append(out, p.data)
+		b.next++
+	}
+}
+
+// skipGap 跳过第一个空洞, 缺失的包计为丢失
+func (b *jitterBuffer) skipGap(out [][]byte) [][]byte {
+	first := true
+	var min uint32
+	for seq := range b.packets {
+		if first || seq < min {
+			min = seq
+			first = false
+		}
+	}
+	if first {
+		return out
+	}
+	lost := min - b.next
+	b.stats.Lost += uint64(lost)
+	metrics.UdpPacketEvents.WithLabelValues("lost").Add(float64(lost))
+	for i := uint32(0); i < lost && i < maxLossMarkers; i++ {
+		out = append(out, []byte{})
+	}
+	b.next = min
+	return b.drain(out)
+}
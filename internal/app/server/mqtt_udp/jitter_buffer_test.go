@@ -0,0 +1,156 @@
+package mqtt_udp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func frame(seq byte) []byte {
+	return []byte{seq}
+}
+
+func TestReplayWindow(t *testing.T) {
+	var w replayWindow
+	now := time.Now()
+	check := func(seq uint32) error {
+		_, err := w.Check(seq, now)
+		return err
+	}
+	assert.NoError(t, check(1))
+	assert.NoError(t, check(3))
+	// 窗口内乱序
+	assert.NoError(t, check(2))
+	assert.ErrorIs(t, check(2), errReplayDuplicate)
+	assert.ErrorIs(t, check(3), errReplayDuplicate)
+
+	assert.NoError(t, check(100))
+	assert.ErrorIs(t, check(30), errReplayTooOld)
+	assert.NoError(t, check(40))
+
+	// 不足 resyncCount 个的连续旧包不会使窗口重新同步
+	for i := uint32(1); i < resyncCount; i++ {
+		assert.ErrorIs(t, check(i), errReplayTooOld)
+	}
+	assert.NoError(t, check(101))
+}
+
+func TestReplayWindowForgedJump(t *testing.T) {
+	var w replayWindow
+	now := time.Now()
+	for i := uint32(1); i <= 10; i++ {
+		_, err := w.Check(i, now)
+		assert.NoError(t, err)
+	}
+
+	// 伪造的超大序列号被拒绝, 不影响后续正常包
+	_, err := w.Check(0xFFFFFFFF, now)
+	assert.ErrorIs(t, err, errReplayJump)
+	_, err = w.Check(11, now)
+	assert.NoError(t, err)
+
+	// 上限内的伪造跳跃被接受, 正常包连续被拒绝后重新同步
+	_, err = w.Check(11+replayMaxJump, now)
+	assert.NoError(t, err)
+	seq := uint32(12)
+	for ; seq < 12+resyncCount-1; seq++ {
+		_, err = w.Check(seq, now)
+		assert.ErrorIs(t, err, errReplayTooOld)
+	}
+	resynced, err := w.Check(seq, now)
+	assert.NoError(t, err)
+	assert.True(t, resynced)
+	resynced, err = w.Check(seq+1, now)
+	assert.NoError(t, err)
+	assert.False(t, resynced)
+
+	// 重新同步限速, 间隔内再次伪造跳跃后正常包持续被拒绝
+	_, err = w.Check(seq+1+replayMaxJump, now)
+	assert.NoError(t, err)
+	for i := uint32(0); i < 2*resyncCount; i++ {
+		seq++
+		_, err = w.Check(seq+1, now.Add(time.Second))
+		assert.ErrorIs(t, err, errReplayTooOld)
+	}
+	seq++
+	resynced, err = w.Check(seq+1, now.Add(resyncInterval))
+	assert.NoError(t, err)
+	assert.True(t, resynced)
+}
+
+func TestJitterBufferReorder(t *testing.T) {
+	var stats UdpStats
+	b := newJitterBuffer(80*time.Millisecond, 8, &stats)
+	now := time.Now()
+
+	assert.Equal(t, [][]byte{frame(1)}, b.Push(1, frame(1), now))
+	// 2 未到, 等待
+	assert.Empty(t, b.Push(3, frame(3), now))
+	assert.Empty(t, b.Push(4, frame(4), now))
+	assert.Equal(t, [][]byte{frame(2), frame(3), frame(4)}, b.Push(2, frame(2), now))
+	assert.Empty(t, b.Push(3, frame(3), now))
+
+	assert.Equal(t, uint64(1), stats.Reordered)
+	assert.Equal(t, uint64(1), stats.Late)
+	assert.Equal(t, uint64(0), stats.Lost)
+}
+
+func TestJitterBufferLoss(t *testing.T) {
+	var stats UdpStats
+	b := newJitterBuffer(80*time.Millisecond, 8, &stats)
+	now := time.Now()
+
+	b.Push(1, frame(1), now)
+	assert.Empty(t, b.Push(3, frame(3), now))
+	assert.Empty(t, b.Poll(now.Add(50*time.Millisecond)))
+	// 超时后输出丢包标记
+	assert.Equal(t, [][]byte{{}, frame(3)}, b.Poll(now.Add(80*time.Millisecond)))
+	assert.Equal(t, uint64(1), stats.Lost)
+
+	// 迟到的 2 被丢弃
+	assert.Empty(t, b.Push(2, frame(2), now))
+	assert.Equal(t, uint64(1), stats.Late)
+
+	// 长时间丢包只输出有限的标记
+	out := b.Push(20, frame(20), now)
+	assert.Empty(t, out)
+	assert.Equal(t, [][]byte{{}, {}, {}, frame(20)}, b.Poll(now.Add(time.Second)))
+	assert.Equal(t, uint64(17), stats.Lost)
+}
+
+func TestJitterBufferMaxPackets(t *testing.T) {
+	var stats UdpStats
+	b := newJitterBuffer(time.Second, 2, &stats)
+	now := time.Now()
+
+	b.Push(1, frame(1), now)
+	assert.Empty(t, b.Push(3, frame(3), now))
+	assert.Empty(t, b.Push(4, frame(4), now))
+	// 缓存超过上限, 不再等待 2
+	assert.Equal(t, [][]byte{{}, frame(3), frame(4), frame(5)}, b.Push(5, frame(5), now))
+}
+
+func TestUdpSessionPushAudio(t *testing.T) {
+	session := &UdpSession{
+		RecvChannel: make(chan []byte, 10),
+		SendChannel: make(chan []byte, 10),
+		done:        make(chan struct{}),
+	}
+	session.jitter = newJitterBuffer(80*time.Millisecond, 8, &session.stats)
+
+	session.PushAudio(5, frame(5))
+	session.PushAudio(7, frame(7))
+	session.PushAudio(6, frame(6))
+	// hello 后序列号从头开始
+	session.ResetSequence()
+	session.PushAudio(1, frame(1))
+	session.Destroy()
+	session.PushAudio(2, frame(2))
+
+	var frames [][]byte
+	for f := range session.RecvChannel {
+		frames = append(frames, f)
+	}
+	assert.Equal(t, [][]byte{frame(5), frame(6), frame(7), frame(1)}, frames)
+}
@@ -12,6 +12,7 @@ import (
 	"xiaozhi-esp32-server-golang/internal/app/server/types"
 	"xiaozhi-esp32-server-golang/internal/data/client"
 	. "xiaozhi-esp32-server-golang/internal/data/client"
+	client_msg "xiaozhi-esp32-server-golang/internal/data/msg"
 	. "xiaozhi-esp32-server-golang/logger"
 	log "xiaozhi-esp32-server-golang/logger"
 )
@@ -72,7 +73,7 @@ func (s *MqttUdpAdapter) Start() error {
 	const retryInterval = 5 * time.Second
 
 	Info("MqttUdpAdapter开始启动，尝试连接MQTT服务器...")
-	Info("MQTT配置: Broker=%s:%d, ClientID=%s, Username=%s", s.mqttConfig.Broker, s.mqttConfig.Port, s.mqttConfig.ClientID, s.mqttConfig.Username)
+	Infof("MQTT配置: Broker=%s:%d, ClientID=%s, Username=%s", s.mqttConfig.Broker, s.mqttConfig.Port, s.mqttConfig.ClientID, s.mqttConfig.Username)
 
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(fmt.Sprintf("%s://%s:%d", s.mqttConfig.Type, s.mqttConfig.Broker, s.mqttConfig.Port))
@@ -174,10 +175,21 @@ func (s *MqttUdpAdapter) handleDisconnect(deviceId string) {
 		Debugf("handleDisconnect, deviceId: %s not found", deviceId)
 		return
 	}
+	Infof("设备 %s UDP 收包统计: %+v", deviceId, conn.UdpSession.Stats())
 	s.udpServer.CloseSession(conn.UdpSession.ConnId)
 	s.deviceId2Conn.Delete(deviceId)
 }
 
+// GetUdpStats 在线设备的 UDP 收包统计, key 为设备ID
+func (s *MqttUdpAdapter) GetUdpStats() map[string]UdpStats {
+	stats := make(map[string]UdpStats)
+	s.deviceId2Conn.Range(func(key, value interface{}) bool {
+		stats[key.(string)] = value.(*MqttUdpConn).UdpSession.Stats()
+		return true
+	})
+	return stats
+}
+
 // 处理消息
 func (s *MqttUdpAdapter) processMessage() {
 	for {
@@ -218,6 +230,9 @@ func (s *MqttUdpAdapter) processMessage() {
 				deviceSession.OnClose(s.handleDisconnect)
 
 				s.onNewConnection(deviceSession)
+			} else if clientMsg.Type == client_msg.MessageTypeHello {
+				// 设备重新打开音频通道, 序列号从头开始
+				deviceSession.UdpSession.ResetSequence()
 			}
 
 			err := deviceSession.PushMsgToRecvCmd(msg.Payload())
@@ -4,8 +4,13 @@ import (
 	"crypto/cipher"
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 	"net"
+	"sync"
 	"time"
+
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
+	log "xiaozhi-esp32-server-golang/logger"
 )
 
 // Session 表示一个UDP会话
@@ -25,6 +30,13 @@ type UdpSession struct {
 	RemoteSeq   uint32
 	RecvChannel chan []byte //发送的音频数据
 	SendChannel chan []byte //接收的音频数据
+
+	recvLock sync.Mutex
+	replay   replayWindow
+	jitter   *jitterBuffer // 为 nil 时按到达顺序输出
+	stats    UdpStats
+	closed   bool
+	done     chan struct{}
 }
 
 // decrypt 解密数据
@@ -36,11 +48,35 @@ func (s *UdpSession) Decrypt(data []byte) ([]byte, error) {
 	// 提取序列号
 	seqNum := binary.BigEndian.Uint32(data[12:16])
 
-	// 检查序列号
-	/*if seqNum < s.RemoteSeq {
-		return nil, fmt.Errorf("序列号过期: got %d, expected >= %d", seqNum, s.RemoteSeq)
-	}*/
-	s.RemoteSeq = seqNum
+	// 检查序列号, 拒绝重复和超出窗口的旧包
+	s.recvLock.Lock()
+	resynced, err := s.replay.Check(seqNum, time.Now())
+	switch err {
+	case nil:
+		s.stats.Received++
+		if resynced {
+			// 序列号已回到新的起点, 抖动缓冲随之重新开始
+			s.stats.Resynced++
+			metrics.UdpPacketEvents.WithLabelValues("resynced").Inc()
+			log.Warnf("设备 %s 序列号错位, 重放窗口重新同步到 %d", s.DeviceId, seqNum)
+			s.RemoteSeq = seqNum
+			if s.jitter != nil && !s.closed {
+				s.deliver(s.jitter.Flush())
+			}
+		} else if seqNum > s.RemoteSeq {
+			s.RemoteSeq = seqNum
+		}
+	case errReplayDuplicate:
+		s.stats.Duplicate++
+		metrics.UdpPacketEvents.WithLabelValues("duplicate").Inc()
+	default:
+		s.stats.Replayed++
+		metrics.UdpPacketEvents.WithLabelValues("replayed").Inc()
+	}
+	s.recvLock.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("序列号 %d 校验失败: %v", seqNum, err)
+	}
 
 	// 解密数据
 	stream := cipher.NewCTR(s.Block, nonce)
@@ -83,7 +119,76 @@ func (s *UdpSession) GetAesKeyAndNonce() (string, string) {
 	return strAesKey, strFullNonce
 }
 
+// PushAudio 解密后的音频经抖动缓冲重排后放入接收队列, 丢包时放入空帧
+func (s *UdpSession) PushAudio(seq uint32, data []byte) {
+	s.recvLock.Lock()
+	defer s.recvLock.Unlock()
+	if s.closed {
+		return
+	}
+	if s.jitter == nil {
+		s.deliver([][]byte{data})
+		return
+	}
+	s.deliver(s.jitter.Push(seq, data, time.Now()))
+}
+
+// runJitterBuffer 定期输出等待超时的包
+func (s *UdpSession) runJitterBuffer() {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.recvLock.Lock()
+			if !s.closed {
+				s.deliver(s.jitter.Poll(now))
+			}
+			s.recvLock.Unlock()
+		}
+	}
+}
+
+// deliver 调用方需持有 recvLock
+func (s *UdpSession) deliver(frames [][]byte) {
+	for _, frame := range frames {
+		select {
+		case s.RecvChannel <- frame:
+		default:
+			metrics.UdpPacketDrops.Inc()
+			log.Warnf("udpSession.RecvChannel is full, deviceId: %s", s.DeviceId)
+		}
+	}
+}
+
+// ResetSequence 设备每次 hello 后从头计数, 重置重放窗口和抖动缓冲
+func (s *UdpSession) ResetSequence() {
+	s.recvLock.Lock()
+	defer s.recvLock.Unlock()
+	s.replay = replayWindow{}
+	s.RemoteSeq = 0
+	if s.jitter != nil && !s.closed {
+		s.deliver(s.jitter.Flush())
+	}
+}
+
+// Stats 返回收包统计
+func (s *UdpSession) Stats() UdpStats {
+	s.recvLock.Lock()
+	defer s.recvLock.Unlock()
+	return s.stats
+}
+
 func (s *UdpSession) Destroy() {
+	s.recvLock.Lock()
+	defer s.recvLock.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
 	close(s.RecvChannel)
 	close(s.SendChannel)
 }
@@ -31,18 +31,36 @@ type UdpServer struct {
 	nonce2Session sync.Map //nonce => UdpSession
 	addr2Session  sync.Map //addr => UdpSession
 	mqttAdapter   *MqttUdpAdapter
+	// 抖动缓冲, jitterDelay 为 0 时不启用
+	jitterDelay   time.Duration
+	jitterPackets int
 	sync.RWMutex
 }
 
+// UdpServerOption 用于配置 UdpServer 的可选参数
+type UdpServerOption func(*UdpServer)
+
+// WithJitterBuffer 开启抖动缓冲, 空洞最多等待 maxDelay, 最多缓存 maxPackets 个包
+func WithJitterBuffer(maxDelay time.Duration, maxPackets int) UdpServerOption {
+	return func(s *UdpServer) {
+		s.jitterDelay = maxDelay
+		s.jitterPackets = maxPackets
+	}
+}
+
 // NewUDPServer 创建新的UDP服务器
-func NewUDPServer(udpPort int, externalHost string, externalPort int) *UdpServer {
-	return &UdpServer{
+func NewUDPServer(udpPort int, externalHost string, externalPort int, opts ...UdpServerOption) *UdpServer {
+	s := &UdpServer{
 		udpPort:       udpPort,
 		externalHost:  externalHost,
 		externalPort:  externalPort,
 		nonce2Session: sync.Map{},
 		addr2Session:  sync.Map{},
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Start 启动UDP服务器
@@ -107,7 +125,8 @@ func (s *UdpServer) processPacket(addr *net.UDPAddr, data []byte) {
 	var udpSession *UdpSession
 	//从addr
 	udpSession = s.getUdpSession(addr)
-	if udpSession == nil {
+	newAddr := udpSession == nil
+	if newAddr {
 		// 获取会话ID
 		fullNonce := data[:16]
 		connID := fullNonce[4:8] // 取5-8字节作为连接id
@@ -118,30 +137,24 @@ func (s *UdpServer) processPacket(addr *net.UDPAddr, data []byte) {
 			Warnf("session不存在 addr: %s", addr)
 			return
 		}
-		udpSession.RemoteAddr = addr
-		s.addUdpSession(addr, udpSession)
 	}
 
-	if udpSession == nil {
-		Warnf("udpSession不存在 addr: %s", addr)
+	decrypted, err := udpSession.Decrypt(data)
+	if err != nil {
+		Debugf("addr: %s 丢弃数据包: %v", addr, err)
 		return
 	}
+	// 通过序列号校验后再绑定地址, 避免重放的包改变下行地址
+	if newAddr {
+		udpSession.RemoteAddr = addr
+		s.addUdpSession(addr, udpSession)
+	}
 
 	// 更新最后活动时间
 	udpSession.LastActive = time.Now()
 
-	decrypted, err := udpSession.Decrypt(data)
-	if err != nil {
-		Errorf("addr: %s 解密失败: %v", addr, err)
-		return
-	}
 	Debugf("收到音频数据, addr: %s, 大小: %d 字节", addr, len(decrypted))
-	select {
-	case udpSession.RecvChannel <- decrypted:
-		return
-	default:
-		Warnf("udpSession.RecvChannel is full, addr: %s", addr)
-	}
+	udpSession.PushAudio(binary.BigEndian.Uint32(data[12:16]), decrypted)
 }
 
 // cleanupSessions 清理过期会话
@@ -209,6 +222,11 @@ func (s *UdpServer) CreateSession(deviceId, clientId string) *UdpSession {
 		Block:       block,
 		RecvChannel: make(chan []byte, 100),
 		SendChannel: make(chan []byte, 100),
+		done:        make(chan struct{}),
+	}
+	if s.jitterDelay > 0 {
+		session.jitter = newJitterBuffer(s.jitterDelay, s.jitterPackets, &session.stats)
+		go session.runJitterBuffer()
 	}
 	//通过channel发送音频数据, 当channel关闭的时候停止
 	go func() {
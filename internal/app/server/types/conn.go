@@ -2,12 +2,13 @@ package types
 
 import "context"
 
-// IConn 是协议无关的连接接口，由 websocket/mqtt_udp 等协议适配器实现
+// IConn 是协议无关的连接接口，由 websocket/mqtt_udp/webrtc 等协议适配器实现
 // 你可以根据实际需要扩展方法
 
 const (
 	TransportTypeWebsocket = "websocket"
 	TransportTypeMqttUdp   = "udp"
+	TransportTypeWebRTC    = "webrtc"
 )
 
 type IConn interface {
@@ -0,0 +1,48 @@
+package webrtc
+
+import (
+	"errors"
+	"time"
+)
+
+// opusFrameDurations TOC 中 config 对应的单帧时长, 见 RFC 6716 3.1
+var opusFrameDurations = [32]time.Duration{
+	// SILK NB/MB/WB
+	10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 60 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 60 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 60 * time.Millisecond,
+	// Hybrid SWB/FB
+	10 * time.Millisecond, 20 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond,
+	// CELT NB/WB/SWB/FB
+	2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond,
+	2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond,
+	2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond,
+	2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond,
+}
+
+// opusPacketDuration 根据 TOC 计算 Opus 包的时长, 用于推算 RTP 时间戳
+// 服务端下发的帧时长随设备协商的 frame_duration 变化, 不能固定为 20ms
+func opusPacketDuration(packet []byte) (time.Duration, error) {
+	if len(packet) < 1 {
+		return 0, errors.New("空的 Opus 包")
+	}
+	frameDuration := opusFrameDurations[packet[0]>>3]
+	var frames int
+	switch packet[0] & 0x03 {
+	case 0:
+		frames = 1
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, errors.New("Opus 包缺少帧数")
+		}
+		frames = int(packet[1] & 0x3f)
+	}
+	duration := frameDuration * time.Duration(frames)
+	if frames == 0 || duration > 120*time.Millisecond {
+		return 0, errors.New("无效的 Opus 帧数")
+	}
+	return duration, nil
+}
@@ -0,0 +1,351 @@
+package webrtc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+)
+
+const (
+	// 等待乱序 RTP 包的最大包数, 20ms 一包时约 200ms
+	maxLatePackets = 10
+	// 建连超时, 期间未打开数据通道则关闭
+	connectTimeout = 30 * time.Second
+)
+
+var opusCodec = webrtc.RTPCodecCapability{
+	MimeType:    webrtc.MimeTypeOpus,
+	ClockRate:   48000,
+	Channels:    2,
+	SDPFmtpLine: "minptime=10;useinbandfec=1",
+}
+
+// WebRTCConn 实现 types.IConn 接口, 音频走 Opus RTP, 命令走数据通道
+type WebRTCConn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	onCloseCbList []func(deviceId string)
+	closeCbOnce   sync.Once
+
+	pc          *webrtc.PeerConnection
+	audioTrack  *webrtc.TrackLocalStaticSample
+	dataChannel *webrtc.DataChannel
+	deviceID    string
+
+	recvCmdChan   chan []byte
+	recvAudioChan chan []byte
+
+	closed bool
+	sync.RWMutex
+}
+
+func newAPI(config Config) (*webrtc.API, error) {
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: opusCodec,
+		PayloadType:        111,
+	}, webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, err
+	}
+	// NACK、RTCP 报告等
+	registry := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, registry); err != nil {
+		return nil, err
+	}
+
+	settingEngine := webrtc.SettingEngine{}
+	if config.UDPPortMin > 0 && config.UDPPortMax >= config.UDPPortMin {
+		if err := settingEngine.SetEphemeralUDPPortRange(config.UDPPortMin, config.UDPPortMax); err != nil {
+			return nil, err
+		}
+	}
+	if config.PublicIP != "" {
+		settingEngine.SetNAT1To1IPs([]string{config.PublicIP}, webrtc.ICECandidateTypeHost)
+	}
+	return webrtc.NewAPI(
+		webrtc.WithMediaEngine(m),
+		webrtc.WithInterceptorRegistry(registry),
+		webrtc.WithSettingEngine(settingEngine),
+	), nil
+}
+
+// newPeerConn 根据 offer 创建 PeerConnection, 等待候选地址收集完成后返回 answer
+func newPeerConn(config Config, deviceID string, offerSDP string) (types.IConn, string, error) {
+	api, err := newAPI(config)
+	if err != nil {
+		return nil, "", fmt.Errorf("初始化 WebRTC 失败: %v", err)
+	}
+	var iceServers []webrtc.ICEServer
+	if len(config.ICEServers) > 0 {
+		iceServers = []webrtc.ICEServer{{URLs: config.ICEServers}}
+	}
+	pc, err := api.NewPeerConnection(webrtc.Configuration{ICEServers: iceServers})
+	if err != nil {
+		return nil, "", fmt.Errorf("创建 PeerConnection 失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &WebRTCConn{
+		ctx:           ctx,
+		cancel:        cancel,
+		pc:            pc,
+		deviceID:      deviceID,
+		recvCmdChan:   make(chan []byte, 100),
+		recvAudioChan: make(chan []byte, 100),
+	}
+	if err := c.setup(offerSDP); err != nil {
+		c.Close()
+		return nil, "", err
+	}
+	return c, pc.LocalDescription().SDP, nil
+}
+
+func (c *WebRTCConn) setup(offerSDP string) error {
+	track, err := webrtc.NewTrackLocalStaticSample(opusCodec, "audio", "xiaozhi")
+	if err != nil {
+		return fmt.Errorf("创建音频轨道失败: %v", err)
+	}
+	sender, err := c.pc.AddTrack(track)
+	if err != nil {
+		return fmt.Errorf("添加音频轨道失败: %v", err)
+	}
+	c.audioTrack = track
+	// 读取 RTCP, 驱动 NACK 等拦截器
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	c.pc.OnTrack(func(remote *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		if remote.Kind() != webrtc.RTPCodecTypeAudio {
+			return
+		}
+		log.Infof("设备 %s 上行音频轨道: %s", c.deviceID, remote.Codec().MimeType)
+		go c.readAudio(remote)
+	})
+
+	// 数据通道由浏览器创建, 承载 JSON 命令
+	dataChannelOpened := make(chan struct{})
+	c.pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		dc.OnOpen(func() {
+			c.Lock()
+			defer c.Unlock()
+			// 只使用第一个数据通道
+			if c.dataChannel != nil {
+				dc.Close()
+				return
+			}
+			c.dataChannel = dc
+			close(dataChannelOpened)
+			dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+				c.RLock()
+				defer c.RUnlock()
+				if c.closed {
+					return
+				}
+				select {
+				case c.recvCmdChan <- msg.Data:
+				default:
+					log.Errorf("recv cmd channel is full")
+				}
+			})
+			dc.OnClose(c.notifyClose)
+		})
+	})
+
+	c.pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Infof("设备 %s WebRTC 连接状态: %s", c.deviceID, state)
+		switch state {
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed, webrtc.PeerConnectionStateDisconnected:
+			c.notifyClose()
+		}
+	})
+
+	go func() {
+		select {
+		case <-dataChannelOpened:
+		case <-c.ctx.Done():
+		case <-time.After(connectTimeout):
+			log.Warnf("设备 %s WebRTC 数据通道未在 %v 内打开", c.deviceID, connectTimeout)
+			c.notifyClose()
+		}
+	}()
+
+	if err := c.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offerSDP}); err != nil {
+		return fmt.Errorf("设置 offer 失败: %v", err)
+	}
+	answer, err := c.pc.CreateAnswer(nil)
+	if err != nil {
+		return fmt.Errorf("创建 answer 失败: %v", err)
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(c.pc)
+	if err := c.pc.SetLocalDescription(answer); err != nil {
+		return fmt.Errorf("设置 answer 失败: %v", err)
+	}
+	select {
+	case <-gatherComplete:
+	case <-time.After(10 * time.Second):
+		return errors.New("收集候选地址超时")
+	}
+	return nil
+}
+
+// readAudio 按序号重排上行 RTP 包, 输出 Opus 包
+func (c *WebRTCConn) readAudio(remote *webrtc.TrackRemote) {
+	builder := samplebuilder.New(maxLatePackets, &codecs.OpusPacket{}, remote.Codec().ClockRate)
+	for {
+		packet, _, err := remote.ReadRTP()
+		if err != nil {
+			if c.ctx.Err() == nil {
+				log.Debugf("设备 %s 读取 RTP 结束: %v", c.deviceID, err)
+			}
+			return
+		}
+		builder.Push(packet)
+		for sample := builder.Pop(); sample != nil; sample = builder.Pop() {
+			if len(sample.Data) == 0 {
+				continue
+			}
+			c.RLock()
+			closed := c.closed
+			if !closed {
+				select {
+				case c.recvAudioChan <- sample.Data:
+				default:
+					log.Errorf("recv audio channel is full")
+				}
+			}
+			c.RUnlock()
+			if closed {
+				return
+			}
+		}
+	}
+}
+
+// notifyClose 连接断开时通知注册方退出, 只通知一次
+func (c *WebRTCConn) notifyClose() {
+	c.closeCbOnce.Do(func() {
+		for _, cb := range c.onCloseCbList {
+			cb(c.deviceID)
+		}
+	})
+}
+
+func (c *WebRTCConn) SendCmd(msg []byte) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.closed {
+		return errors.New("connection is closed")
+	}
+	if c.dataChannel == nil {
+		return errors.New("data channel is not open")
+	}
+	if err := c.dataChannel.SendText(string(msg)); err != nil {
+		log.Errorf("send cmd error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// SendAudio 发送一个 Opus 包, RTP 时间戳按包时长递增
+func (c *WebRTCConn) SendAudio(audio []byte) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.closed {
+		return errors.New("connection is closed")
+	}
+	duration, err := opusPacketDuration(audio)
+	if err != nil {
+		return err
+	}
+	if err := c.audioTrack.WriteSample(media.Sample{Data: audio, Duration: duration}); err != nil {
+		log.Errorf("send audio error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (c *WebRTCConn) RecvCmd(ctx context.Context, timeout int) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		log.Debugf("recv cmd context done")
+		return nil, ctx.Err()
+	case msg, ok := <-c.recvCmdChan:
+		if !ok {
+			return nil, errors.New("connection is closed")
+		}
+		return msg, nil
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return nil, errors.New("timeout")
+	}
+}
+
+func (c *WebRTCConn) RecvAudio(ctx context.Context, timeout int) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		log.Debugf("recv audio context done")
+		return nil, ctx.Err()
+	case audio, ok := <-c.recvAudioChan:
+		if !ok {
+			return nil, errors.New("connection is closed")
+		}
+		return audio, nil
+	case <-time.After(time.Duration(timeout) * time.Second):
+		return nil, errors.New("timeout")
+	}
+}
+
+func (c *WebRTCConn) Close() error {
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.cancel()
+	close(c.recvCmdChan)
+	close(c.recvAudioChan)
+	c.Unlock()
+
+	// PeerConnection 关闭时会回调状态变化, 不能持有锁
+	return c.pc.Close()
+}
+
+func (c *WebRTCConn) OnClose(cb func(deviceId string)) {
+	c.onCloseCbList = append(c.onCloseCbList, cb)
+}
+
+func (c *WebRTCConn) GetDeviceID() string {
+	return c.deviceID
+}
+
+func (c *WebRTCConn) GetTransportType() string {
+	return types.TransportTypeWebRTC
+}
+
+func (c *WebRTCConn) GetData(key string) (interface{}, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *WebRTCConn) CloseAudioChannel() error {
+	return nil
+}
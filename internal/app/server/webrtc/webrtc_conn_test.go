@@ -0,0 +1,88 @@
+package webrtc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebRTCConnDataChannel(t *testing.T) {
+	viper.Set("auth.enable", false)
+	conns := make(chan types.IConn, 1)
+	s := NewWebRTCServer(Config{}, WithOnNewConnection(func(conn types.IConn) {
+		conns <- conn
+	}))
+	server := httptest.NewServer(http.HandlerFunc(s.handleOffer))
+	defer server.Close()
+
+	// 模拟浏览器: 创建数据通道和音频收发器, 收集完候选地址后提交 offer
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	require.NoError(t, err)
+	defer pc.Close()
+	_, err = pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio)
+	require.NoError(t, err)
+	dc, err := pc.CreateDataChannel("cmd", nil)
+	require.NoError(t, err)
+	opened := make(chan struct{})
+	dc.OnOpen(func() { close(opened) })
+	received := make(chan []byte, 1)
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) { received <- msg.Data })
+
+	offer, err := pc.CreateOffer(nil)
+	require.NoError(t, err)
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	require.NoError(t, pc.SetLocalDescription(offer))
+	<-gatherComplete
+
+	body, _ := json.Marshal(OfferRequest{SDP: pc.LocalDescription().SDP, Type: "offer"})
+	req, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(body))
+	req.Header.Set("Device-Id", "ba:8f:17:de:94:94")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var answer AnswerResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&answer))
+	assert.Equal(t, "answer", answer.Type)
+	require.NoError(t, pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer.SDP}))
+
+	var conn types.IConn
+	select {
+	case conn = <-conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("未建立连接")
+	}
+	defer conn.Close()
+	assert.Equal(t, "ba:8f:17:de:94:94", conn.GetDeviceID())
+
+	select {
+	case <-opened:
+	case <-time.After(10 * time.Second):
+		t.Fatal("数据通道未打开")
+	}
+
+	// 命令经数据通道双向传递
+	require.NoError(t, dc.SendText(`{"type":"hello"}`))
+	cmd, err := conn.RecvCmd(context.Background(), 5)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"hello"}`, string(cmd))
+
+	require.NoError(t, conn.SendCmd([]byte(`{"type":"hello","transport":"webrtc"}`)))
+	select {
+	case msg := <-received:
+		assert.JSONEq(t, `{"type":"hello","transport":"webrtc"}`, string(msg))
+	case <-time.After(5 * time.Second):
+		t.Fatal("未收到服务端命令")
+	}
+}
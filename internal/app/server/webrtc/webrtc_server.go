@@ -0,0 +1,135 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/auth"
+	"xiaozhi-esp32-server-golang/internal/app/server/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// OfferRequest 浏览器提交的 SDP offer, 使用非 trickle 方式, offer 中已包含全部候选地址
+type OfferRequest struct {
+	SDP  string `json:"sdp"`
+	Type string `json:"type"`
+}
+
+// AnswerResponse 服务端返回的 SDP answer
+type AnswerResponse struct {
+	SDP  string `json:"sdp"`
+	Type string `json:"type"`
+}
+
+// Config WebRTC 配置
+type Config struct {
+	// ICEServers STUN/TURN 地址, 如 stun:stun.l.google.com:19302
+	ICEServers []string
+	// PublicIP 服务端在 NAT 后时对外的 IP, 作为 host 候选地址下发
+	PublicIP string
+	// UDPPortMin/UDPPortMax 媒体使用的 UDP 端口范围, 为 0 时随机
+	UDPPortMin uint16
+	UDPPortMax uint16
+}
+
+// WebRTCServer 通过 HTTP 交换 SDP, 建立的 PeerConnection 适配为 types.IConn
+type WebRTCServer struct {
+	config          Config
+	authManager     *auth.AuthManager
+	onNewConnection types.OnNewConnection
+}
+
+// WebRTCServerOption 用于配置 WebRTCServer 的可选参数
+type WebRTCServerOption func(*WebRTCServer)
+
+// WithAuthManager 设置认证管理器
+func WithAuthManager(authManager *auth.AuthManager) WebRTCServerOption {
+	return func(s *WebRTCServer) {
+		s.authManager = authManager
+	}
+}
+
+func WithOnNewConnection(onNewConnection types.OnNewConnection) WebRTCServerOption {
+	return func(s *WebRTCServer) {
+		s.onNewConnection = onNewConnection
+	}
+}
+
+// NewWebRTCServer 创建 WebRTC 服务, 信令接口挂在 websocket 服务的 HTTP 端口上
+func NewWebRTCServer(config Config, opts ...WebRTCServerOption) *WebRTCServer {
+	s := &WebRTCServer{
+		config:      config,
+		authManager: auth.A(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register 注册信令路由, 需在 websocket 服务启动前调用
+func (s *WebRTCServer) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/xiaozhi/webrtc/v1/offer", s.handleOffer)
+	log.Infof("WebRTC 信令端点: POST /xiaozhi/webrtc/v1/offer")
+}
+
+// handleOffer 校验设备身份, 创建 PeerConnection 并返回 answer
+func (s *WebRTCServer) handleOffer(w http.ResponseWriter, r *http.Request) {
+	// 网页 demo 可能与服务端不同源
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Device-Id, Client-Id")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持 POST 请求", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deviceID := r.Header.Get("Device-Id")
+	if deviceID == "" {
+		log.Warn("缺少 Device-Id 请求头")
+		http.Error(w, "缺少 Device-Id 请求头", http.StatusBadRequest)
+		return
+	}
+	if viper.GetBool("auth.enable") {
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			log.Warn("缺少 Authorization 请求头")
+			http.Error(w, "缺少 Authorization 请求头", http.StatusUnauthorized)
+			return
+		}
+		if err := s.authManager.ValidateToken(r.Context(), token, deviceID, r.Header.Get("Client-Id")); err != nil {
+			log.Warnf("设备 %s 令牌验证失败: %v", deviceID, err)
+			http.Error(w, "无效的令牌", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var offer OfferRequest
+	if err := json.NewDecoder(r.Body).Decode(&offer); err != nil || offer.SDP == "" {
+		http.Error(w, "无效的 offer", http.StatusBadRequest)
+		return
+	}
+	if offer.Type != "" && offer.Type != "offer" {
+		http.Error(w, "SDP 类型必须为 offer", http.StatusBadRequest)
+		return
+	}
+
+	conn, answer, err := newPeerConn(s.config, deviceID, offer.SDP)
+	if err != nil {
+		log.Errorf("设备 %s 建立 WebRTC 连接失败: %v", deviceID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.onNewConnection != nil {
+		s.onNewConnection(conn)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AnswerResponse{SDP: answer, Type: "answer"})
+}
@@ -0,0 +1,61 @@
+package webrtc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpusPacketDuration(t *testing.T) {
+	cases := []struct {
+		packet   []byte
+		duration time.Duration
+	}{
+		// config 3: SILK NB 60ms, 单帧
+		{[]byte{3 << 3}, 60 * time.Millisecond},
+		// config 9: SILK WB 20ms, 两帧
+		{[]byte{9<<3 | 1}, 40 * time.Millisecond},
+		// config 31: CELT FB 20ms, code 3 三帧
+		{[]byte{31<<3 | 3, 3}, 60 * time.Millisecond},
+		// config 16: CELT NB 2.5ms
+		{[]byte{16 << 3}, 2500 * time.Microsecond},
+	}
+	for _, c := range cases {
+		duration, err := opusPacketDuration(c.packet)
+		assert.NoError(t, err)
+		assert.Equal(t, c.duration, duration)
+	}
+
+	_, err := opusPacketDuration(nil)
+	assert.Error(t, err)
+	// 超过 120ms
+	_, err = opusPacketDuration([]byte{3<<3 | 3, 3})
+	assert.Error(t, err)
+}
+
+func TestHandleOfferValidation(t *testing.T) {
+	viper.Set("auth.enable", false)
+	s := NewWebRTCServer(Config{})
+
+	req := httptest.NewRequest(http.MethodOptions, "/xiaozhi/webrtc/v1/offer", nil)
+	w := httptest.NewRecorder()
+	s.handleOffer(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+
+	req = httptest.NewRequest(http.MethodPost, "/xiaozhi/webrtc/v1/offer", strings.NewReader(`{"sdp":"v=0"}`))
+	w = httptest.NewRecorder()
+	s.handleOffer(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/xiaozhi/webrtc/v1/offer", strings.NewReader(`{"sdp":"v=0","type":"answer"}`))
+	req.Header.Set("Device-Id", "ba:8f:17:de:94:94")
+	w = httptest.NewRecorder()
+	s.handleOffer(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
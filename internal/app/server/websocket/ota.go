@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -15,6 +16,9 @@ import (
 	"github.com/spf13/viper"
 )
 
+// 设备未上报版本时返回的固件版本
+const defaultFirmwareVersion = "0.9.9"
+
 type ActivationRequest struct {
 	Payload ctypes.ActivationPayload `json:"Payload"`
 }
@@ -50,11 +54,23 @@ func (s *WebSocketServer) handleOta(w http.ResponseWriter, r *http.Request) {
 		clientIp = r.RemoteAddr
 	}
 
+	//解析设备上报的信息, 用于固件升级判断
+	var otaReq OtaRequest
+	if err := json.NewDecoder(r.Body).Decode(&otaReq); err != nil {
+		log.Debugf("设备 %s OTA请求体解析失败: %v", deviceId, err)
+	}
+
+	configProvider, err := user_config.GetProvider(viper.GetString("config_provider.type"))
+	if err != nil {
+		log.Errorf("获取配置提供者失败: %v", err)
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+		return
+	}
+
 	var activationInfo *ActivationInfo
 	authEnable := viper.GetBool("auth.enable")
 	log.Debugf("authEnable: %v", authEnable)
 	if authEnable {
-		configProvider, err := user_config.GetProvider(viper.GetString("config_provider.type"))
 		//检查此deviceId是否已认证
 		isActivited, err := configProvider.IsDeviceActivated(r.Context(), deviceId, clientId)
 		if err != nil {
@@ -85,11 +101,22 @@ func (s *WebSocketServer) handleOta(w http.ResponseWriter, r *http.Request) {
 	}
 
 	mqttInfo := getMqttInfo(deviceId, clientId, otaConfigPrefix, ip)
+
+	//已激活的设备签发websocket令牌
+	wsToken := viper.GetString(otaConfigPrefix + "websocket.token")
+	if authEnable && activationInfo == nil {
+		wsToken, err = s.authManager.IssueToken(r.Context(), deviceId, clientId)
+		if err != nil {
+			log.Errorf("设备 %s 签发令牌失败: %v", deviceId, err)
+			http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+			return
+		}
+	}
 	//密码
 	respData := &OtaResponse{
 		Websocket: WebsocketInfo{
 			Url:   viper.GetString(otaConfigPrefix + "websocket.url"),
-			Token: viper.GetString(otaConfigPrefix + "websocket.token"),
+			Token: wsToken,
 		},
 		Mqtt: mqttInfo,
 		ServerTime: ServerTimeInfo{
@@ -97,10 +124,7 @@ func (s *WebSocketServer) handleOta(w http.ResponseWriter, r *http.Request) {
 			TimezoneOffset: 480,
 		},
 		Activation: activationInfo,
-		Firmware: FirmwareInfo{
-			Version: "0.9.9",
-			Url:     "",
-		},
+		Firmware:   getFirmwareInfo(r.Context(), configProvider, deviceId, clientId, &otaReq),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -112,6 +136,29 @@ func (s *WebSocketServer) handleOta(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// getFirmwareInfo 获取可升级的固件, 无可升级固件时返回设备当前版本
+func getFirmwareInfo(ctx context.Context, configProvider user_config.UserConfigProvider, deviceId, clientId string, otaReq *OtaRequest) FirmwareInfo {
+	firmware := FirmwareInfo{
+		Version: otaReq.Application.Version,
+		Url:     "",
+	}
+	if firmware.Version == "" {
+		firmware.Version = defaultFirmwareVersion
+	}
+
+	info, err := configProvider.GetFirmwareInfo(ctx, deviceId, clientId, otaReq.Board.Type, otaReq.Application.Version)
+	if err != nil {
+		log.Errorf("设备 %s 检查固件升级失败: %v", deviceId, err)
+		return firmware
+	}
+	if info != nil && info.Url != "" {
+		log.Infof("设备 %s(%s) 下发固件升级: %s -> %s", deviceId, otaReq.Board.Type, otaReq.Application.Version, info.Version)
+		firmware.Version = info.Version
+		firmware.Url = info.Url
+	}
+	return firmware
+}
+
 func getMqttInfo(deviceId, clientId, otaConfigPrefix, ip string) *MqttInfo {
 	if !viper.GetBool(otaConfigPrefix + "mqtt.enable") {
 		return nil
@@ -0,0 +1,70 @@
+package websocket
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"xiaozhi-esp32-server-golang/internal/app/server/chat"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/spf13/viper"
+)
+
+// OnSpeak 主动播报处理函数, 由 App 注入
+type OnSpeak func(req *chat.SpeakRequest) (*chat.SpeakResult, error)
+
+// handleSpeakAPI 服务端主动播报API
+func (s *WebSocketServer) handleSpeakAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "仅支持POST请求", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 未配置 speak.token 时拒绝所有请求, 避免任何人都能让设备播报
+	token := viper.GetString("speak.token")
+	if token == "" {
+		log.Warnf("主动播报未配置 speak.token, 拒绝请求")
+		http.Error(w, "主动播报未启用", http.StatusForbidden)
+		return
+	}
+	authToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(authToken), []byte(token)) != 1 {
+		log.Warnf("主动播报认证失败")
+		http.Error(w, "认证失败", http.StatusUnauthorized)
+		return
+	}
+
+	if s.onSpeak == nil {
+		http.Error(w, "主动播报未启用", http.StatusNotImplemented)
+		return
+	}
+
+	var req chat.SpeakRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorf("主动播报请求解析失败: %v", err)
+		http.Error(w, "请求体解析失败", http.StatusBadRequest)
+		return
+	}
+	if req.DeviceID == "" {
+		http.Error(w, "缺少device_id参数", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "缺少text参数", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.onSpeak(&req)
+	if err != nil {
+		log.Errorf("设备 %s 主动播报失败: %v", req.DeviceID, err)
+		http.Error(w, "主动播报失败", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Errorf("主动播报响应编码失败: %v", err)
+	}
+}
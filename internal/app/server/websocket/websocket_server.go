@@ -1,16 +1,20 @@
 package websocket
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
 
 	"xiaozhi-esp32-server-golang/internal/app/server/auth"
 	"xiaozhi-esp32-server-golang/internal/app/server/types"
 	"xiaozhi-esp32-server-golang/internal/domain/mcp"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
 	log "xiaozhi-esp32-server-golang/logger"
 )
 
@@ -28,6 +32,8 @@ type WebSocketServer struct {
 	globalMCPManager *mcp.GlobalMCPManager
 
 	onNewConnection types.OnNewConnection
+	// 主动播报
+	onSpeak OnSpeak
 }
 
 // Option 类型定义
@@ -54,6 +60,13 @@ func WithOnNewConnection(onNewConnection types.OnNewConnection) WebSocketServerO
 	}
 }
 
+// WithOnSpeak 设置主动播报处理函数
+func WithOnSpeak(onSpeak OnSpeak) WebSocketServerOption {
+	return func(s *WebSocketServer) {
+		s.onSpeak = onSpeak
+	}
+}
+
 // NewWebSocketServer 创建新的 WebSocket 服务器（WithOption 方式）
 func NewWebSocketServer(port int, opts ...WebSocketServerOption) *WebSocketServer {
 	s := &WebSocketServer{
@@ -93,12 +106,27 @@ func (s *WebSocketServer) Start() error {
 	http.HandleFunc("/xiaozhi/ota/activate", s.handleOtaActivate)
 	http.HandleFunc("/mcp", s.handleMCPWebSocket)
 	http.HandleFunc("/xiaozhi/api/mcp/tools/", s.handleMCPAPI)
-	http.HandleFunc("/xiaozhi/api/vision", s.handleVisionAPI) //图片识别API
+	http.HandleFunc("/xiaozhi/api/vision", s.handleVisionAPI)      //图片识别API
+	http.HandleFunc("/xiaozhi/api/device/speak", s.handleSpeakAPI) //主动播报API
 
 	listenAddr := fmt.Sprintf("0.0.0.0:%d", s.port)
 	log.Infof("WebSocket 服务器启动在 ws://%s/xiaozhi/v1/", listenAddr)
 	log.Infof("MCP WebSocket 端点: ws://%s/mcp?token=xxx", listenAddr)
 	log.Infof("MCP API 端点: http://%s/xiaozhi/api/mcp/tools/{deviceId}", listenAddr)
+	log.Infof("主动播报 API 端点: http://%s/xiaozhi/api/device/speak", listenAddr)
+
+	if viper.GetBool("metrics.enable") {
+		metricsAddr := viper.GetString("metrics.listen")
+		if metricsAddr == "" {
+			metricsAddr = "127.0.0.1:9100"
+		}
+		go func() {
+			if err := metrics.Serve(metricsAddr, viper.GetString("metrics.token")); err != nil {
+				log.Errorf("Prometheus 指标服务启动失败: %v", err)
+			}
+		}()
+		log.Infof("Prometheus 指标端点: http://%s/metrics", metricsAddr)
+	}
 
 	if err := http.ListenAndServe(listenAddr, nil); err != nil {
 		log.Log().Fatalf("WebSocket 服务器启动失败: %v", err)
@@ -130,6 +158,16 @@ func (s *WebSocketServer) handleMqttUdpChat(w http.ResponseWriter, r *http.Reque
 	s.internalHandleChat(w, r, true)
 }
 
+// isGatewayToken 校验 mqtt_udp 网关的共享令牌 auth.gateway_token, 未配置时网关需携带设备令牌
+func isGatewayToken(token string) bool {
+	gatewayToken := viper.GetString("auth.gateway_token")
+	if gatewayToken == "" {
+		return false
+	}
+	token = strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+	return subtle.ConstantTimeCompare([]byte(token), []byte(gatewayToken)) == 1
+}
+
 // handleWebSocket 处理 WebSocket 连接
 func (s *WebSocketServer) internalHandleChat(w http.ResponseWriter, r *http.Request, isMqttUdp bool) {
 	// 验证请求头
@@ -140,8 +178,7 @@ func (s *WebSocketServer) internalHandleChat(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	/*isAuth := viper.GetBool("auth.enable")
-	if isAuth {
+	if viper.GetBool("auth.enable") {
 		token := r.Header.Get("Authorization")
 		if token == "" {
 			log.Warn("缺少 Authorization 请求头")
@@ -149,14 +186,15 @@ func (s *WebSocketServer) internalHandleChat(w http.ResponseWriter, r *http.Requ
 			return
 		}
 
-		// 验证令牌
-		if !s.authManager.ValidateToken(token) {
-			log.Warnf("无效的令牌: %s", token)
-			http.Error(w, "无效的令牌", http.StatusUnauthorized)
-			return
+		// mqtt_udp 网关可使用共享的网关令牌代设备连接, 否则与设备直连一样校验设备令牌
+		if !(isMqttUdp && isGatewayToken(token)) {
+			if err := s.authManager.ValidateToken(r.Context(), token, deviceID, r.Header.Get("Client-Id")); err != nil {
+				log.Warnf("设备 %s 令牌验证失败: %v", deviceID, err)
+				http.Error(w, "无效的令牌", http.StatusUnauthorized)
+				return
+			}
 		}
-	}*/
-
+	}
 	// 升级 HTTP 连接为 WebSocket
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/constants"
+)
+
+// AsrSpeedProfile 语音识别速度对应的断句参数
+type AsrSpeedProfile struct {
+	SilenceDuration int64 // 由有声音转到静音的阈值时间（毫秒）, 即vad尾部静音保持时间
+	EndWindowSize   int   // 云端asr判停的结束窗口大小（毫秒）, 0 表示使用asr自身配置
+	// vad 判定语音结束前的最小静音时长（毫秒）, 即 silero_vad 的 min_silence_duration_ms, 0 表示使用vad自身配置
+	VadMinSilenceDuration int64
+}
+
+// 默认断句参数, normal 使用 chat.chat_max_silence_duration 及 asr 自身配置
+var defaultAsrSpeedProfiles = map[string]AsrSpeedProfile{
+	constants.AsrSpeedPatient: {SilenceDuration: 1000, EndWindowSize: 1600, VadMinSilenceDuration: 300},
+	constants.AsrSpeedFast:    {SilenceDuration: 120, EndWindowSize: 400, VadMinSilenceDuration: 60},
+}
+
+// GetAsrSpeedProfile 获取语音识别速度对应的断句参数, 可通过 chat.asr_speed.<speed> 覆盖默认值
+func GetAsrSpeedProfile(speed string) AsrSpeedProfile {
+	profile := AsrSpeedProfile{
+		SilenceDuration: viper.GetInt64("chat.chat_max_silence_duration"),
+	}
+	if profile.SilenceDuration == 0 {
+		profile.SilenceDuration = 200
+	}
+	if speed == "" {
+		speed = constants.AsrSpeedNormal
+	}
+	if defaultProfile, ok := defaultAsrSpeedProfiles[speed]; ok {
+		profile = defaultProfile
+	}
+
+	prefix := "chat.asr_speed." + speed
+	if silenceDuration := viper.GetInt64(prefix + ".silence_duration"); silenceDuration > 0 {
+		profile.SilenceDuration = silenceDuration
+	}
+	if endWindowSize := viper.GetInt(prefix + ".end_window_size"); endWindowSize > 0 {
+		profile.EndWindowSize = endWindowSize
+	}
+	if vadMinSilence := viper.GetInt64(prefix + ".vad_min_silence_duration"); vadMinSilence > 0 {
+		profile.VadMinSilenceDuration = vadMinSilence
+	}
+	return profile
+}
+
+// applyAsrEndWindow 将断句参数中的结束窗口写入asr配置, 返回新的配置
+func applyAsrEndWindow(asrConfig map[string]interface{}, profile AsrSpeedProfile) map[string]interface{} {
+	if profile.EndWindowSize <= 0 {
+		return asrConfig
+	}
+	newConfig := make(map[string]interface{}, len(asrConfig)+1)
+	for k, v := range asrConfig {
+		newConfig[k] = v
+	}
+	newConfig["end_window_size"] = profile.EndWindowSize
+	return newConfig
+}
+
+// applyVadMinSilence 将断句参数中的vad最小静音时长写入vad配置, 返回新的配置
+func applyVadMinSilence(vadConfig map[string]interface{}, profile AsrSpeedProfile) map[string]interface{} {
+	if profile.VadMinSilenceDuration <= 0 {
+		return vadConfig
+	}
+	newConfig := make(map[string]interface{}, len(vadConfig)+1)
+	for k, v := range vadConfig {
+		newConfig[k] = v
+	}
+	newConfig["min_silence_duration_ms"] = profile.VadMinSilenceDuration
+	return newConfig
+}
+
+// GetVadConfig 获取会话的vad配置, 已按智能体的语音识别速度调整最小静音时长
+func (s *ClientState) GetVadConfig() map[string]interface{} {
+	return applyVadMinSilence(s.DeviceConfig.Vad.Config, GetAsrSpeedProfile(s.DeviceConfig.AsrSpeed))
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"xiaozhi-esp32-server-golang/constants"
+)
+
+func TestGetAsrSpeedProfileNormal(t *testing.T) {
+	viper.Set("chat.chat_max_silence_duration", 250)
+	defer viper.Set("chat.chat_max_silence_duration", nil)
+
+	for _, speed := range []string{"", constants.AsrSpeedNormal, "unknown"} {
+		profile := GetAsrSpeedProfile(speed)
+		assert.Equal(t, int64(250), profile.SilenceDuration, speed)
+		assert.Zero(t, profile.EndWindowSize, speed)
+		assert.Zero(t, profile.VadMinSilenceDuration, speed)
+	}
+}
+
+func TestGetAsrSpeedProfileDefaults(t *testing.T) {
+	patient := GetAsrSpeedProfile(constants.AsrSpeedPatient)
+	assert.Equal(t, AsrSpeedProfile{SilenceDuration: 1000, EndWindowSize: 1600, VadMinSilenceDuration: 300}, patient)
+
+	fast := GetAsrSpeedProfile(constants.AsrSpeedFast)
+	assert.Equal(t, AsrSpeedProfile{SilenceDuration: 120, EndWindowSize: 400, VadMinSilenceDuration: 60}, fast)
+
+	assert.Greater(t, patient.SilenceDuration, GetAsrSpeedProfile(constants.AsrSpeedNormal).SilenceDuration)
+	assert.Greater(t, patient.VadMinSilenceDuration, fast.VadMinSilenceDuration)
+}
+
+func TestGetAsrSpeedProfileOverride(t *testing.T) {
+	viper.Set("chat.asr_speed.patient.silence_duration", 1500)
+	viper.Set("chat.asr_speed.patient.vad_min_silence_duration", 500)
+	defer func() {
+		viper.Set("chat.asr_speed.patient.silence_duration", nil)
+		viper.Set("chat.asr_speed.patient.vad_min_silence_duration", nil)
+	}()
+
+	profile := GetAsrSpeedProfile(constants.AsrSpeedPatient)
+	assert.Equal(t, int64(1500), profile.SilenceDuration)
+	assert.Equal(t, 1600, profile.EndWindowSize)
+	assert.Equal(t, int64(500), profile.VadMinSilenceDuration)
+}
+
+func TestApplyAsrEndWindow(t *testing.T) {
+	asrConfig := map[string]interface{}{"appid": "x"}
+
+	assert.Equal(t, asrConfig, applyAsrEndWindow(asrConfig, AsrSpeedProfile{}))
+
+	newConfig := applyAsrEndWindow(asrConfig, AsrSpeedProfile{EndWindowSize: 1600})
+	assert.Equal(t, 1600, newConfig["end_window_size"])
+	assert.Equal(t, "x", newConfig["appid"])
+	assert.NotContains(t, asrConfig, "end_window_size")
+}
+
+func TestApplyVadMinSilence(t *testing.T) {
+	vadConfig := map[string]interface{}{"threshold": 0.5, "min_silence_duration_ms": int64(100)}
+
+	assert.Equal(t, vadConfig, applyVadMinSilence(vadConfig, AsrSpeedProfile{}))
+
+	newConfig := applyVadMinSilence(vadConfig, AsrSpeedProfile{VadMinSilenceDuration: 300})
+	assert.Equal(t, int64(300), newConfig["min_silence_duration_ms"])
+	assert.Equal(t, 0.5, newConfig["threshold"])
+	assert.Equal(t, int64(100), vadConfig["min_silence_duration_ms"])
+}
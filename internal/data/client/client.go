@@ -11,8 +11,10 @@ import (
 
 	"xiaozhi-esp32-server-golang/internal/domain/asr"
 	utypes "xiaozhi-esp32-server-golang/internal/domain/config/types"
+	"xiaozhi-esp32-server-golang/internal/domain/history"
 	"xiaozhi-esp32-server-golang/internal/domain/llm"
 	llm_common "xiaozhi-esp32-server-golang/internal/domain/llm/common"
+	"xiaozhi-esp32-server-golang/internal/domain/recorder"
 	"xiaozhi-esp32-server-golang/internal/domain/tts"
 
 	. "xiaozhi-esp32-server-golang/internal/data/audio"
@@ -25,6 +27,8 @@ import (
 
 // Dialogue 表示对话历史
 type Dialogue struct {
+	// 管理接口会并发读取和清空对话
+	mu       sync.RWMutex
 	Messages []*schema.Message
 }
 
@@ -52,6 +56,8 @@ type ClientState struct {
 	AgentID  string
 	// 会话ID
 	SessionID string
+	// 会话级 logger, 日志带设备ID, 设备临时开启调试时输出调试日志
+	Logger *log.DeviceLogger
 
 	//设备配置
 	DeviceConfig utypes.UConfig
@@ -88,9 +94,16 @@ type ClientState struct {
 	VadLastActiveTs  int64         //vad最后活跃时间, 超过 60s && 没有在tts则断开连接
 
 	Status string //状态 listening, llmStart, ttsStart
+	// 保护 Status、ListenMode、SessionID, 管理接口会在其它协程读取
+	stateMu sync.RWMutex
 
 	IsTtsStart        bool //是否tts开始
 	IsWelcomeSpeaking bool //是否已经欢迎语
+	TextOnly          bool //纯文本对话, 不下发tts音频, 按句下发文本
+	DeviceAec         bool //设备端回声消除(hello features.aec), 服务端打断依赖它避免误触发
+
+	Recorder *recorder.SessionRecorder //会话录音, 未开启时为 nil
+	History  *history.SessionHistory   //对话记录, 未开启时为 nil
 }
 
 // 历史消息相关的方法开始
@@ -99,10 +112,14 @@ func (c *ClientState) AddMessage(msg *schema.Message) {
 		log.Warnf("尝试添加 nil 消息到对话历史")
 		return
 	}
+	c.Dialogue.mu.Lock()
+	defer c.Dialogue.mu.Unlock()
 	c.Dialogue.Messages = append(c.Dialogue.Messages, msg)
 }
 
 func (c *ClientState) GetMessages(count int) []*schema.Message {
+	c.Dialogue.mu.RLock()
+	defer c.Dialogue.mu.RUnlock()
 	// 添加边界检查，防止数组越界
 	if len(c.Dialogue.Messages) == 0 {
 		return []*schema.Message{}
@@ -200,10 +217,19 @@ func AlignToolMessages(messages []*schema.Message) []*schema.Message {
 }
 
 func (c *ClientState) InitMessages(messages []*schema.Message) error {
+	c.Dialogue.mu.Lock()
+	defer c.Dialogue.mu.Unlock()
 	c.Dialogue.Messages = AlignToolMessages(messages)
 	return nil
 }
 
+// ClearMessages 清空当前会话的对话历史
+func (c *ClientState) ClearMessages() {
+	c.Dialogue.mu.Lock()
+	defer c.Dialogue.mu.Unlock()
+	c.Dialogue.Messages = nil
+}
+
 //历史消息相关的方法结束
 
 func (c *ClientState) SetTtsStart(isStart bool) {
@@ -232,13 +258,41 @@ func (c *ClientState) IsActive() bool {
 }
 
 func (c *ClientState) SetStatus(status string) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
 	c.Status = status
 }
 
 func (c *ClientState) GetStatus() string {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
 	return c.Status
 }
 
+func (c *ClientState) SetListenMode(listenMode string) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.ListenMode = listenMode
+}
+
+func (c *ClientState) GetListenMode() string {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.ListenMode
+}
+
+func (c *ClientState) SetSessionID(sessionID string) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.SessionID = sessionID
+}
+
+func (c *ClientState) GetSessionID() string {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.SessionID
+}
+
 func (s *ClientState) ResetSessionCtx() {
 	s.SessionCtx.Lock()
 	defer s.SessionCtx.Unlock()
@@ -307,8 +361,11 @@ func (s *ClientState) InitAsr() error {
 
 	log.Infof("初始化asr, asrConfig: %+v", asrConfig)
 
+	//根据智能体的语音识别速度调整asr结束窗口
+	asrProviderConfig := applyAsrEndWindow(asrConfig.Config, GetAsrSpeedProfile(s.DeviceConfig.AsrSpeed))
+
 	//初始化asr
-	asrProvider, err := asr.NewAsrProvider(asrConfig.Provider, asrConfig.Config)
+	asrProvider, err := asr.NewAsrProvider(asrConfig.Provider, asrProviderConfig)
 	if err != nil {
 		log.Errorf("创建asr提供者失败: %v", err)
 		return fmt.Errorf("创建asr提供者失败: %v", err)
@@ -1,7 +1,11 @@
 package client
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
+// Statistic 耗时统计, 由 asr/llm/tts 不同协程读写, 需通过原子操作访问
 type Statistic struct {
 	AsrStartTs int64 //asr开始时间
 	LlmStartTs int64 //llm开始时间
@@ -9,35 +13,53 @@ type Statistic struct {
 }
 
 func (s *Statistic) Reset() {
-	s.AsrStartTs = 0
-	s.LlmStartTs = 0
-	s.TtsStartTs = 0
+	atomic.StoreInt64(&s.AsrStartTs, 0)
+	atomic.StoreInt64(&s.LlmStartTs, 0)
+	atomic.StoreInt64(&s.TtsStartTs, 0)
 }
 
 func (state *ClientState) SetStartAsrTs() {
-	state.Statistic.AsrStartTs = time.Now().UnixMilli()
+	atomic.StoreInt64(&state.Statistic.AsrStartTs, time.Now().UnixMilli())
 }
 
 func (state *ClientState) GetAsrDuration() int64 {
-	return time.Now().UnixMilli() - state.Statistic.AsrStartTs
+	return time.Now().UnixMilli() - atomic.LoadInt64(&state.Statistic.AsrStartTs)
 }
 
 func (state *ClientState) GetAsrLlmTtsDuration() int64 {
-	return time.Now().UnixMilli() - state.Statistic.AsrStartTs
+	return time.Now().UnixMilli() - atomic.LoadInt64(&state.Statistic.AsrStartTs)
 }
 
 func (state *ClientState) SetStartLlmTs() {
-	state.Statistic.LlmStartTs = time.Now().UnixMilli()
+	atomic.StoreInt64(&state.Statistic.LlmStartTs, time.Now().UnixMilli())
 }
 
 func (state *ClientState) GetLlmDuration() int64 {
-	return time.Now().UnixMilli() - state.Statistic.LlmStartTs
+	return time.Now().UnixMilli() - atomic.LoadInt64(&state.Statistic.LlmStartTs)
+}
+
+// TakeLlmDuration 取出 llm 开始至今的耗时并清零开始时间, 未开始或已被取出时返回 false
+func (state *ClientState) TakeLlmDuration() (int64, bool) {
+	return takeDuration(&state.Statistic.LlmStartTs)
 }
 
 func (state *ClientState) SetStartTtsTs() {
-	state.Statistic.TtsStartTs = time.Now().UnixMilli()
+	atomic.StoreInt64(&state.Statistic.TtsStartTs, time.Now().UnixMilli())
 }
 
 func (state *ClientState) GetTtsDuration() int64 {
-	return time.Now().UnixMilli() - state.Statistic.TtsStartTs
+	return time.Now().UnixMilli() - atomic.LoadInt64(&state.Statistic.TtsStartTs)
+}
+
+// TakeTtsDuration 取出 tts 开始至今的耗时并清零开始时间, 未开始或已被取出时返回 false
+func (state *ClientState) TakeTtsDuration() (int64, bool) {
+	return takeDuration(&state.Statistic.TtsStartTs)
+}
+
+func takeDuration(startTs *int64) (int64, bool) {
+	ts := atomic.SwapInt64(startTs, 0)
+	if ts <= 0 {
+		return 0, false
+	}
+	return time.Now().UnixMilli() - ts, true
 }
@@ -23,6 +23,7 @@ const (
 	MessageTypeIot     = "iot"     // 物联网消息
 	MessageTypeMcp     = "mcp"     // MCP消息
 	MessageTypeGoodBye = "goodbye" // 再见消息
+	MessageTypeChat    = "chat"    // 文本对话消息
 )
 
 // 服务器消息类型常量
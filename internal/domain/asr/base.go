@@ -6,6 +6,8 @@ import (
 
 	"xiaozhi-esp32-server-golang/constants"
 	"xiaozhi-esp32-server-golang/internal/domain/asr/doubao"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/mock"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/openai"
 	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
 	log "xiaozhi-esp32-server-golang/logger"
 )
@@ -38,6 +40,12 @@ func NewAsrProvider(asrType string, config map[string]interface{}) (AsrProvider,
 			log.Info("豆包ASR适配器创建成功")
 		}
 		return provider, err
+	case constants.AsrTypeOpenAI:
+		log.Info("使用 OpenAI 兼容 ASR 提供者")
+		return openai.NewOpenAIASR(config)
+	case constants.AsrTypeMock:
+		log.Info("使用 mock ASR 提供者")
+		return mock.NewMockAsr(config)
 	default:
 		return nil, fmt.Errorf("不支持的ASR引擎类型: %s，目前仅支持 'funasr'", asrType)
 	}
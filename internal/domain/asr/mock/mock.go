@@ -0,0 +1,126 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"xiaozhi-esp32-server-golang/internal/data/audio"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// Transcript 音频时长不小于 MinDuration(ms) 时返回 Text
+type Transcript struct {
+	MinDuration int    `json:"min_duration"`
+	Text        string `json:"text"`
+}
+
+// MockAsr 离线 ASR, 根据音频时长返回预设的识别结果, 用于测试
+type MockAsr struct {
+	sampleRate  int
+	defaultText string
+	transcripts []Transcript // 按 MinDuration 降序
+}
+
+// NewMockAsr 创建 mock ASR
+// 配置项: text 默认识别结果; transcripts 按时长匹配的结果列表; fixture 结果列表的 json 文件路径; sample_rate 采样率
+func NewMockAsr(config map[string]interface{}) (*MockAsr, error) {
+	m := &MockAsr{
+		sampleRate:  audio.SampleRate,
+		defaultText: "你好",
+	}
+	if text, ok := config["text"].(string); ok {
+		m.defaultText = text
+	}
+	if sampleRate := getInt(config["sample_rate"]); sampleRate > 0 {
+		m.sampleRate = sampleRate
+	}
+
+	var transcripts []Transcript
+	if fixture, ok := config["fixture"].(string); ok && fixture != "" {
+		data, err := os.ReadFile(fixture)
+		if err != nil {
+			return nil, fmt.Errorf("读取 mock asr fixture 失败: %v", err)
+		}
+		if err := json.Unmarshal(data, &transcripts); err != nil {
+			return nil, fmt.Errorf("解析 mock asr fixture 失败: %v", err)
+		}
+	}
+	if items, ok := config["transcripts"].([]interface{}); ok {
+		for _, item := range items {
+			itemMap, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			text, _ := itemMap["text"].(string)
+			transcripts = append(transcripts, Transcript{
+				MinDuration: getInt(itemMap["min_duration"]),
+				Text:        text,
+			})
+		}
+	}
+	sort.SliceStable(transcripts, func(i, j int) bool {
+		return transcripts[i].MinDuration > transcripts[j].MinDuration
+	})
+	m.transcripts = transcripts
+
+	return m, nil
+}
+
+// Process 根据整段音频的时长返回识别结果
+func (m *MockAsr) Process(pcmData []float32) (string, error) {
+	return m.Transcribe(len(pcmData)), nil
+}
+
+// Transcribe 根据采样点数对应的时长选择识别结果
+func (m *MockAsr) Transcribe(samples int) string {
+	durationMs := samples * 1000 / m.sampleRate
+	for _, transcript := range m.transcripts {
+		if durationMs >= transcript.MinDuration {
+			return transcript.Text
+		}
+	}
+	return m.defaultText
+}
+
+// StreamingRecognize 累计输入音频, 输入结束后返回最终结果
+func (m *MockAsr) StreamingRecognize(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	resultChan := make(chan types.StreamingResult, 1)
+	go func() {
+		defer close(resultChan)
+		samples := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case pcm, ok := <-audioStream:
+				if !ok {
+					text := m.Transcribe(samples)
+					log.Debugf("mock asr 识别结果: %s, 采样点数: %d", text, samples)
+					select {
+					case resultChan <- types.StreamingResult{Text: text, IsFinal: true}:
+					case <-ctx.Done():
+					}
+					return
+				}
+				samples += len(pcm)
+			}
+		}
+	}()
+	return resultChan, nil
+}
+
+func getInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,34 @@
+package mock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockAsrTranscripts(t *testing.T) {
+	asr, err := NewMockAsr(map[string]interface{}{
+		"text": "你好",
+		"transcripts": []interface{}{
+			map[string]interface{}{"min_duration": 500, "text": "短句"},
+			map[string]interface{}{"min_duration": 2000, "text": "长句"},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "你好", asr.Transcribe(16000*300/1000))
+	assert.Equal(t, "短句", asr.Transcribe(16000))
+	assert.Equal(t, "长句", asr.Transcribe(16000*3))
+
+	audioStream := make(chan []float32, 10)
+	resultChan, err := asr.StreamingRecognize(context.Background(), audioStream)
+	assert.NoError(t, err)
+	audioStream <- make([]float32, 16000)
+	audioStream <- make([]float32, 16000)
+	close(audioStream)
+
+	result := <-resultChan
+	assert.True(t, result.IsFinal)
+	assert.Equal(t, "长句", result.Text)
+}
@@ -0,0 +1,194 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/data/audio"
+	"xiaozhi-esp32-server-golang/internal/domain/asr/types"
+	"xiaozhi-esp32-server-golang/internal/util"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// Config OpenAI 兼容的语音识别配置, 适用于 Whisper、SenseVoice 等部署
+type Config struct {
+	BaseURL     string  // 如 http://127.0.0.1:8000/v1
+	APIKey      string  // 为空时不发送 Authorization
+	Model       string  // 如 whisper-1
+	Language    string  // 如 zh, 为空时由服务端自动识别
+	Prompt      string  // 提示词, 可用于专有名词纠正
+	Temperature float64 // 0 表示使用服务端默认值
+	Timeout     int     // 请求超时(秒)
+	MaxDuration int     // 单次识别的最长音频(秒), 超出部分丢弃
+}
+
+// OpenAIASR 调用 /audio/transcriptions 接口, 以 WAV 格式上传整段音频
+type OpenAIASR struct {
+	config Config
+	client *http.Client
+}
+
+// NewOpenAIASR 从配置创建, 配置项: base_url、api_key、model、language、prompt、temperature、timeout、max_duration
+func NewOpenAIASR(config map[string]interface{}) (*OpenAIASR, error) {
+	c := Config{
+		Timeout:     30,
+		MaxDuration: 60,
+	}
+	c.BaseURL, _ = config["base_url"].(string)
+	c.APIKey, _ = config["api_key"].(string)
+	c.Model, _ = config["model"].(string)
+	c.Language, _ = config["language"].(string)
+	c.Prompt, _ = config["prompt"].(string)
+	if temperature, ok := config["temperature"].(float64); ok {
+		c.Temperature = temperature
+	} else if temperatureInt, ok := config["temperature"].(int); ok {
+		c.Temperature = float64(temperatureInt)
+	}
+	if timeout := getInt(config["timeout"]); timeout > 0 {
+		c.Timeout = timeout
+	}
+	if maxDuration := getInt(config["max_duration"]); maxDuration > 0 {
+		c.MaxDuration = maxDuration
+	}
+	if c.BaseURL == "" || c.Model == "" {
+		return nil, fmt.Errorf("openai asr 缺少 base_url 或 model 配置")
+	}
+	c.BaseURL = strings.TrimRight(c.BaseURL, "/")
+
+	return &OpenAIASR{
+		config: c,
+		client: &http.Client{Timeout: time.Duration(c.Timeout) * time.Second},
+	}, nil
+}
+
+// Process 一次性识别整段音频
+func (a *OpenAIASR) Process(pcmData []float32) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.config.Timeout)*time.Second)
+	defer cancel()
+	return a.transcribe(ctx, pcmData)
+}
+
+// StreamingRecognize 接口不支持流式, 缓存音频直到输入结束后整段识别, 只返回一次最终结果
+// 识别失败时直接关闭结果通道
+func (a *OpenAIASR) StreamingRecognize(ctx context.Context, audioStream <-chan []float32) (chan types.StreamingResult, error) {
+	resultChan := make(chan types.StreamingResult, 1)
+	maxSamples := a.config.MaxDuration * audio.SampleRate
+	go func() {
+		defer close(resultChan)
+		var pcmData []float32
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case pcm, ok := <-audioStream:
+				if ok {
+					if len(pcmData) < maxSamples {
+						pcmData = append(pcmData, pcm...)
+					}
+					continue
+				}
+				if len(pcmData) == 0 {
+					return
+				}
+				startTs := time.Now()
+				text, err := a.transcribe(ctx, pcmData)
+				if err != nil {
+					log.Errorf("openai asr 识别失败: %v", err)
+					return
+				}
+				log.Debugf("openai asr 识别结果: %s, 音频时长: %dms, 耗时: %dms", text, len(pcmData)*1000/audio.SampleRate, time.Since(startTs).Milliseconds())
+				select {
+				case resultChan <- types.StreamingResult{Text: text, IsFinal: true}:
+				case <-ctx.Done():
+				}
+				return
+			}
+		}
+	}()
+	return resultChan, nil
+}
+
+func (a *OpenAIASR) transcribe(ctx context.Context, pcmData []float32) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(util.EncodeWav(pcmData, audio.SampleRate, 1)); err != nil {
+		return "", err
+	}
+	fields := map[string]string{
+		"model":           a.config.Model,
+		"language":        a.config.Language,
+		"prompt":          a.config.Prompt,
+		"response_format": "json",
+	}
+	if a.config.Temperature > 0 {
+		fields["temperature"] = strconv.FormatFloat(a.config.Temperature, 'f', -1, 64)
+	}
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(key, value); err != nil {
+			return "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.config.BaseURL+"/audio/transcriptions", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if a.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.config.APIKey)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求识别接口失败: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("识别接口返回错误, status: %d, body: %s", resp.StatusCode, data)
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("解析识别结果失败: %v", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+func getInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package openai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIASR(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/audio/transcriptions", r.URL.Path)
+		assert.Equal(t, "Bearer sk-test", r.Header.Get("Authorization"))
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "whisper-1", r.FormValue("model"))
+		assert.Equal(t, "zh", r.FormValue("language"))
+		assert.Equal(t, "0.2", r.FormValue("temperature"))
+		assert.Empty(t, r.FormValue("prompt"))
+
+		file, _, err := r.FormFile("file")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, "RIFF", string(data[:4]))
+		assert.Equal(t, "WAVEfmt ", string(data[8:16]))
+		// 1 秒 16k 单声道 16bit
+		assert.Len(t, data, 44+16000*2)
+		w.Write([]byte(`{"text":" 今天天气怎么样 "}`))
+	}))
+	defer server.Close()
+
+	asr, err := NewOpenAIASR(map[string]interface{}{
+		"base_url":     server.URL + "/v1/",
+		"api_key":      "sk-test",
+		"model":        "whisper-1",
+		"language":     "zh",
+		"temperature":  0.2,
+		"max_duration": 1,
+	})
+	require.NoError(t, err)
+
+	text, err := asr.Process(make([]float32, 16000))
+	require.NoError(t, err)
+	assert.Equal(t, "今天天气怎么样", text)
+
+	// 超过 max_duration 的音频被丢弃
+	audioStream := make(chan []float32, 10)
+	resultChan, err := asr.StreamingRecognize(context.Background(), audioStream)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		audioStream <- make([]float32, 16000)
+	}
+	close(audioStream)
+	result, ok := <-resultChan
+	require.True(t, ok)
+	assert.True(t, result.IsFinal)
+	assert.Equal(t, "今天天气怎么样", result.Text)
+	_, ok = <-resultChan
+	assert.False(t, ok)
+
+	_, err = NewOpenAIASR(map[string]interface{}{"model": "whisper-1"})
+	assert.Error(t, err)
+}
@@ -6,12 +6,16 @@ import (
 	"gopkg.in/hraban/opus.v2"
 )
 
+// MaxConcealFrames 连续丢包时最多补偿的帧数
+const MaxConcealFrames = 3
+
 type AudioProcesser struct {
 	sampleRate       int
 	channels         int
 	perFrameDuration int
 	decoder          *opus.Decoder
 	encoder          *opus.Encoder
+	lostFrames       int // 待补偿的丢失帧数
 }
 
 func GetAudioProcesser(sampleRate int, channels int, perFrameDuration int) (*AudioProcesser, error) {
@@ -40,11 +44,43 @@ func (a *AudioProcesser) Decoder(audio []byte, pcmData []int16) (int, error) {
 	return a.decoder.Decode(audio, pcmData)
 }
 
+// DecoderFloat32 解码一帧, 返回每个声道的采样点数
+// 空帧表示丢包, 此时返回 0; 收到下一帧时用其中的 FEC 数据恢复最后一个丢失帧, 更早的丢失帧使用 PLC,
+// 补偿的音频与本帧一起输出, pcmData 需预留 MaxConcealFrames 帧的空间
 func (a *AudioProcesser) DecoderFloat32(audio []byte, pcmData []float32) (int, error) {
 	if a.decoder == nil {
 		return 0, errors.New("decoder is nil")
 	}
-	return a.decoder.DecodeFloat32(audio, pcmData)
+	if len(audio) == 0 {
+		if a.lostFrames < MaxConcealFrames {
+			a.lostFrames++
+		}
+		return 0, nil
+	}
+
+	offset := 0
+	if lost := a.lostFrames; lost > 0 {
+		a.lostFrames = 0
+		frameSize := a.sampleRate * a.perFrameDuration / 1000 * a.channels
+		// 缓冲区不足时放弃补偿
+		if len(pcmData) >= (lost+1)*frameSize {
+			for i := 0; i < lost-1; i++ {
+				if err := a.decoder.DecodePLCFloat32(pcmData[offset : offset+frameSize]); err != nil {
+					return 0, err
+				}
+				offset += frameSize
+			}
+			if err := a.decoder.DecodeFECFloat32(audio, pcmData[offset:offset+frameSize]); err != nil {
+				return 0, err
+			}
+			offset += frameSize
+		}
+	}
+	n, err := a.decoder.DecodeFloat32(audio, pcmData[offset:])
+	if err != nil {
+		return 0, err
+	}
+	return offset/a.channels + n, nil
 }
 
 func (a *AudioProcesser) Encoder(pcmData []int16, audio []byte) (int, error) {
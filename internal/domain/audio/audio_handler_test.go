@@ -0,0 +1,46 @@
+package audio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoderFloat32Conceal(t *testing.T) {
+	processer, err := GetAudioProcesser(16000, 1, 60)
+	require.NoError(t, err)
+	frameSize := 960
+
+	packet := make([]byte, 4000)
+	n, err := processer.Encoder(make([]int16, frameSize), packet)
+	require.NoError(t, err)
+	packet = packet[:n]
+
+	pcm := make([]float32, frameSize*(1+MaxConcealFrames))
+	n, err = processer.DecoderFloat32(packet, pcm)
+	assert.NoError(t, err)
+	assert.Equal(t, frameSize, n)
+
+	// 丢包标记不输出音频, 下一帧时补偿
+	n, err = processer.DecoderFloat32([]byte{}, pcm)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = processer.DecoderFloat32(packet, pcm)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*frameSize, n)
+
+	// 连续丢包最多补偿 MaxConcealFrames 帧
+	for i := 0; i < 5; i++ {
+		processer.DecoderFloat32(nil, pcm)
+	}
+	n, err = processer.DecoderFloat32(packet, pcm)
+	assert.NoError(t, err)
+	assert.Equal(t, (1+MaxConcealFrames)*frameSize, n)
+
+	// 缓冲区不足时放弃补偿
+	processer.DecoderFloat32(nil, pcm)
+	n, err = processer.DecoderFloat32(packet, pcm[:frameSize])
+	assert.NoError(t, err)
+	assert.Equal(t, frameSize, n)
+}
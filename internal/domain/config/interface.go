@@ -14,6 +14,10 @@ type UserConfigProvider interface {
 	GetActivationInfo(ctx context.Context, deviceId string, clientId string) (int, string, string, int)
 	VerifyChallenge(ctx context.Context, deviceId string, clientId string, activationPayload types.ActivationPayload) (bool, error)
 
+	//ota
+	//根据设备上报的板型和版本获取可升级的固件, 无需升级时返回nil
+	GetFirmwareInfo(ctx context.Context, deviceId string, clientId string, boardType string, version string) (*types.FirmwareInfo, error)
+
 	//llm memory
 
 	// GetUserConfig 获取用户配置（兼容原有接口）
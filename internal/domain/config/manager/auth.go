@@ -80,9 +80,12 @@ func (am *ConfigManager) GetActivationInfo(ctx context.Context, deviceId string,
 		return 0, "", message, 0
 	}
 
-	// 检查Challenge是否为空
+	// 检查Challenge是否为空, 设备已绑定其它 Client-Id 时后端不下发激活码, 只返回提示
 	if challenge == "" {
-		log.Log().Errorf("设备 %s 的Challenge字段为空", deviceId)
+		log.Log().Errorf("设备 %s 的Challenge字段为空: %s", deviceId, message)
+		if message != "" {
+			return 0, "", message, 0
+		}
 		return 0, "", "Challenge字段为空，请联系管理员", 0
 	}
 
@@ -0,0 +1,63 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// GetFirmwareInfo 调用后端管理系统检查设备是否有可升级的固件
+func (c *ConfigManager) GetFirmwareInfo(ctx context.Context, deviceId string, clientId string, boardType string, version string) (*types.FirmwareInfo, error) {
+	if boardType == "" || version == "" {
+		return nil, nil
+	}
+
+	requestBody, err := json.Marshal(map[string]string{
+		"device_id": deviceId,
+		"client_id": clientId,
+		"board":     boardType,
+		"version":   version,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %v", err)
+	}
+	reqURL := fmt.Sprintf("%s/api/public/firmware/check", c.baseURL)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("检查固件失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Data *types.FirmwareInfo `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	if response.Data != nil {
+		log.Log().Infof("设备 %s 可升级固件: %s -> %s", deviceId, version, response.Data.Version)
+	}
+	return response.Data, nil
+}
@@ -88,8 +88,10 @@ func (c *ConfigManager) GetUserConfig(ctx context.Context, deviceID string) (typ
 				Provider string `json:"provider"`
 				JsonData string `json:"json_data"`
 			} `json:"tts"`
-			Prompt  string `json:"prompt"`
-			AgentId string `json:"agent_id"`
+			Prompt      string `json:"prompt"`
+			AgentId     string `json:"agent_id"`
+			AsrSpeed    string `json:"asr_speed"`
+			RecordAudio bool   `json:"record_audio"`
 		} `json:"data"`
 	}
 
@@ -129,7 +131,9 @@ func (c *ConfigManager) GetUserConfig(ctx context.Context, deviceID string) (typ
 			Provider: response.Data.VAD.Provider,
 			Config:   parseJsonData(response.Data.VAD.JsonData),
 		},
-		AgentId: response.Data.AgentId,
+		AgentId:     response.Data.AgentId,
+		AsrSpeed:    response.Data.AsrSpeed,
+		RecordAudio: response.Data.RecordAudio,
 	}
 
 	log.Log().Infof("成功获取设备配置: deviceId: %s, config: %+v", deviceID, config)
@@ -15,13 +15,14 @@ type activationInfo struct {
 	msg       string
 }
 
-var verfiyDeviceId = map[string]bool{}
+// 已激活的设备 -> 激活时的 clientId
+var verfiyDeviceId = map[string]string{}
 var preActivationInfo = map[string]activationInfo{}
 
-// 设备是否激活?
+// 设备是否激活? clientId 不为空时需与激活时的一致
 func (r *UserConfig) IsDeviceActivated(ctx context.Context, deviceId string, clientId string) (bool, error) {
-	if _, ok := verfiyDeviceId[deviceId]; ok {
-		return true, nil
+	if boundClientId, ok := verfiyDeviceId[deviceId]; ok {
+		return clientId == "" || clientId == boundClientId, nil
 	}
 	return false, nil
 }
@@ -42,13 +43,14 @@ func (r *UserConfig) GetActivationInfo(ctx context.Context, deviceId string, cli
 }
 
 // 验证 challenge和HMAC是否匹配, 设备是否已激活，此处可以省略hmac的校验, 只查询deviceId是否绑定
+// 已被其它 clientId 激活的设备不能再次激活
 func (r *UserConfig) VerifyChallenge(ctx context.Context, deviceId string, clientId string, activationPayload types.ActivationPayload) (bool, error) {
-	if _, ok := verfiyDeviceId[deviceId]; ok {
-		return true, nil
+	if boundClientId, ok := verfiyDeviceId[deviceId]; ok {
+		return clientId == boundClientId, nil
 	}
 	if info, ok := preActivationInfo[deviceId]; ok {
 		if info.challenge == activationPayload.Challenge {
-			verfiyDeviceId[deviceId] = true
+			verfiyDeviceId[deviceId] = clientId
 			delete(preActivationInfo, deviceId)
 			return true, nil
 		}
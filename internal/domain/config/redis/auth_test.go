@@ -0,0 +1,32 @@
+package redis_config
+
+import (
+	"context"
+	"testing"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivationBindsClientId(t *testing.T) {
+	ctx := context.Background()
+	r := &UserConfig{}
+
+	_, challenge, _, _ := r.GetActivationInfo(ctx, "device-bind", "client-1")
+	ok, err := r.VerifyChallenge(ctx, "device-bind", "client-1", types.ActivationPayload{Challenge: challenge})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	activated, _ := r.IsDeviceActivated(ctx, "device-bind", "client-1")
+	assert.True(t, activated)
+	// 只知道 Device-Id 的其它客户端视为未激活, 不会签发令牌
+	activated, _ = r.IsDeviceActivated(ctx, "device-bind", "client-2")
+	assert.False(t, activated)
+	ok, _ = r.VerifyChallenge(ctx, "device-bind", "client-2", types.ActivationPayload{Challenge: challenge})
+	assert.False(t, ok)
+	// 已校验过令牌的会话不检查 Client-Id
+	activated, _ = r.IsDeviceActivated(ctx, "device-bind", "")
+	assert.True(t, activated)
+}
@@ -0,0 +1,25 @@
+package redis_config
+
+import (
+	"context"
+
+	"xiaozhi-esp32-server-golang/internal/domain/config/types"
+
+	"github.com/spf13/viper"
+)
+
+// GetFirmwareInfo 使用配置文件中 ota.firmware 指定的固件, 仅对匹配的板型且版本更低的设备下发
+func (r *UserConfig) GetFirmwareInfo(ctx context.Context, deviceId string, clientId string, boardType string, version string) (*types.FirmwareInfo, error) {
+	firmwareVersion := viper.GetString("ota.firmware.version")
+	firmwareUrl := viper.GetString("ota.firmware.url")
+	if firmwareVersion == "" || firmwareUrl == "" || types.CompareVersion(firmwareVersion, version) <= 0 {
+		return nil, nil
+	}
+	if board := viper.GetString("ota.firmware.board_type"); board != "" && board != boardType {
+		return nil, nil
+	}
+	return &types.FirmwareInfo{
+		Version: firmwareVersion,
+		Url:     firmwareUrl,
+	}, nil
+}
@@ -94,6 +94,8 @@ func (u *UserConfig) GetUserConfig(ctx context.Context, userID string) (types.UC
 		}
 	}
 	ret.Vad = u.getVadConfig(ctx)
+	// 设备级录音开关, 存于 userconfig 的 record_audio 字段
+	ret.RecordAudio = redisConfig["record_audio"] == "true"
 
 	log.Log().Infof("userconfig: %+v", ret)
 	return ret, nil
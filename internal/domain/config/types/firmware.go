@@ -0,0 +1,49 @@
+package types
+
+import (
+	"strconv"
+	"strings"
+)
+
+// FirmwareInfo 可升级的固件信息
+type FirmwareInfo struct {
+	Version string `json:"version"`
+	Url     string `json:"url"`
+}
+
+// CompareVersion 按 . 和 - 分段比较版本号, 数字段按数值比较, 与管理后台的比较规则一致
+func CompareVersion(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(strings.TrimPrefix(v, "v"), func(r rune) bool {
+			return r == '.' || r == '-'
+		})
+	}
+	pa, pb := split(a), split(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var sa, sb string
+		if i < len(pa) {
+			sa = pa[i]
+		}
+		if i < len(pb) {
+			sb = pb[i]
+		}
+		na, errA := strconv.Atoi(sa)
+		nb, errB := strconv.Atoi(sb)
+		if errA == nil && errB == nil {
+			if na != nb {
+				if na > nb {
+					return 1
+				}
+				return -1
+			}
+			continue
+		}
+		if sa != sb {
+			if sa > sb {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,15 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersion(t *testing.T) {
+	assert.Equal(t, 0, CompareVersion("1.2.0", "v1.2.0"))
+	assert.Equal(t, 1, CompareVersion("1.10.0", "1.9.3"))
+	assert.Equal(t, -1, CompareVersion("1.2", "1.2.1"))
+	assert.Equal(t, 1, CompareVersion("1.2.0-rc2", "1.2.0-rc1"))
+	assert.Equal(t, -1, CompareVersion("0.9.9", "1.0.0"))
+}
@@ -31,5 +31,7 @@ type UConfig struct {
 	Tts          TtsConfig `json:"tts"`
 	Llm          LlmConfig `json:"llm"`
 	Vad          VadConfig `json:"vad"`
-	AgentId      string    `json:"agent_id"` //所属agent_id
+	AgentId      string    `json:"agent_id"`     //所属agent_id
+	AsrSpeed     string    `json:"asr_speed"`    //语音识别速度: normal/patient/fast
+	RecordAudio  bool      `json:"record_audio"` //是否录制会话音频, 需同时开启 recorder.enable
 }
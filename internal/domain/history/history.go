@@ -0,0 +1,177 @@
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/util/turn"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// ToolCall 一次工具调用
+type ToolCall struct {
+	Name       string `json:"name"`
+	Arguments  string `json:"arguments"`
+	Result     string `json:"result"`
+	Success    bool   `json:"success"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Turn 一轮对话的记录
+type Turn struct {
+	SessionID     string     `json:"session_id"`
+	DeviceID      string     `json:"device_id"`
+	AgentID       string     `json:"agent_id"`
+	TurnIndex     int        `json:"turn_index"`
+	StartTime     time.Time  `json:"start_time"`
+	UserText      string     `json:"user_text"`
+	AssistantText string     `json:"assistant_text"`
+	ToolCalls     []ToolCall `json:"tool_calls,omitempty"`
+	Interrupted   bool       `json:"interrupted"` // 回复过程中被打断
+	// 耗时, 单位毫秒, 0 表示未发生
+	AsrMs           int64 `json:"asr_ms"`             // 停止说话到识别结果
+	LlmFirstTokenMs int64 `json:"llm_first_token_ms"` // LLM 请求到首个响应
+	TtsFirstFrameMs int64 `json:"tts_first_frame_ms"` // TTS 请求到首帧音频
+	TotalMs         int64 `json:"total_ms"`           // 本轮开始到结束
+}
+
+// 工具调用结果较长(如网页内容)时只保留开头
+const maxToolResultLen = 2048
+
+// Sink 保存对话记录, 由 app 层注册
+type Sink func(ctx context.Context, turn *Turn) error
+
+var (
+	sink      Sink
+	queue     chan *Turn
+	queueOnce sync.Once
+)
+
+// SetSink 注册对话记录的保存方式并启动异步推送, 未注册时不记录
+func SetSink(s Sink) {
+	sink = s
+	queueOnce.Do(func() {
+		queue = make(chan *Turn, 1000)
+		go pushLoop()
+	})
+}
+
+func pushLoop() {
+	for turn := range queue {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := sink(ctx, turn); err != nil {
+			log.Warnf("保存对话记录失败, session: %s, turn: %d, err: %v", turn.SessionID, turn.TurnIndex, err)
+		}
+		cancel()
+	}
+}
+
+func push(turn *Turn) {
+	select {
+	case queue <- turn:
+	default:
+		log.Warnf("对话记录队列已满, 丢弃 session: %s, turn: %d", turn.SessionID, turn.TurnIndex)
+	}
+}
+
+// SessionHistory 收集一个会话每轮的文本、工具调用和耗时, 每轮结束后异步推送
+// 没有注册 Sink 时不创建, 调用方持有 nil 即可, 各方法会直接忽略
+type SessionHistory struct {
+	turns *turn.Collector[Turn]
+}
+
+// NewSessionHistory 未注册 Sink 时返回 nil
+func NewSessionHistory(deviceID string, sessionID string, agentID string) *SessionHistory {
+	if sink == nil {
+		return nil
+	}
+	return &SessionHistory{
+		turns: turn.NewCollector(
+			func() *Turn { return &Turn{StartTime: time.Now()} },
+			// 没有用户输入的轮次(如欢迎语)不保存
+			func(t *Turn) bool { return t.UserText != "" },
+			func(index int, t *Turn) {
+				t.SessionID = sessionID
+				t.DeviceID = deviceID
+				t.AgentID = agentID
+				t.TurnIndex = index
+				t.TotalMs = time.Since(t.StartTime).Milliseconds()
+				push(t)
+			},
+		),
+	}
+}
+
+func (h *SessionHistory) update(f func(t *Turn)) {
+	if h == nil {
+		return
+	}
+	h.turns.Update(f)
+}
+
+// BeginTurn 开始新的一轮, 上一轮有用户输入时保存, 否则丢弃
+func (h *SessionHistory) BeginTurn() {
+	h.EndTurn()
+}
+
+// EndTurn 结束当前轮
+func (h *SessionHistory) EndTurn() {
+	if h == nil {
+		return
+	}
+	h.turns.End()
+}
+
+// SetUserText 记录用户输入, asrMs 为识别耗时, 文本消息为 0
+func (h *SessionHistory) SetUserText(text string, asrMs int64) {
+	h.update(func(t *Turn) {
+		t.UserText = text
+		t.AsrMs = asrMs
+	})
+}
+
+// AddAssistantText 记录下发的回复文本
+func (h *SessionHistory) AddAssistantText(text string) {
+	h.update(func(t *Turn) {
+		t.AssistantText += text
+	})
+}
+
+// AddToolCall 记录一次工具调用
+func (h *SessionHistory) AddToolCall(toolCall ToolCall) {
+	if result := []rune(toolCall.Result); len(result) > maxToolResultLen {
+		toolCall.Result = string(result[:maxToolResultLen]) + "..."
+	}
+	h.update(func(t *Turn) {
+		t.ToolCalls = append(t.ToolCalls, toolCall)
+	})
+}
+
+// SetLlmFirstTokenMs 只记录本轮第一次 LLM 请求
+func (h *SessionHistory) SetLlmFirstTokenMs(ms int64) {
+	h.update(func(t *Turn) {
+		if t.LlmFirstTokenMs == 0 {
+			t.LlmFirstTokenMs = ms
+		}
+	})
+}
+
+// SetTtsFirstFrameMs 只记录本轮第一句
+func (h *SessionHistory) SetTtsFirstFrameMs(ms int64) {
+	h.update(func(t *Turn) {
+		if t.TtsFirstFrameMs == 0 {
+			t.TtsFirstFrameMs = ms
+		}
+	})
+}
+
+// SetInterrupted 标记当前轮的回复被打断
+func (h *SessionHistory) SetInterrupted() {
+	if h == nil {
+		return
+	}
+	h.turns.UpdateCurrent(func(t *Turn) {
+		t.Interrupted = true
+	})
+}
@@ -0,0 +1,69 @@
+package history
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionHistory(t *testing.T) {
+	turns := make(chan *Turn, 10)
+	SetSink(func(ctx context.Context, turn *Turn) error {
+		turns <- turn
+		return nil
+	})
+
+	h := NewSessionHistory("ba:8f:17:de:94:94", "session1", "3")
+	require.NotNil(t, h)
+
+	// 欢迎语没有用户输入, 不保存
+	h.BeginTurn()
+	h.AddAssistantText("你好呀")
+	h.BeginTurn()
+
+	h.SetUserText("今天天气怎么样", 320)
+	h.SetLlmFirstTokenMs(500)
+	h.AddToolCall(ToolCall{Name: "get_weather", Arguments: `{"city":"北京"}`, Result: strings.Repeat("晴", 3000), Success: true, DurationMs: 80})
+	h.SetLlmFirstTokenMs(600)
+	h.AddAssistantText("北京今天")
+	h.AddAssistantText("是晴天。")
+	h.SetTtsFirstFrameMs(200)
+	h.EndTurn()
+
+	h.SetUserText("讲个故事", 0)
+	h.SetInterrupted()
+	h.EndTurn()
+
+	var turn *Turn
+	select {
+	case turn = <-turns:
+	case <-time.After(time.Second):
+		t.Fatal("等待对话记录超时")
+	}
+	assert.Equal(t, "session1", turn.SessionID)
+	assert.Equal(t, "ba:8f:17:de:94:94", turn.DeviceID)
+	assert.Equal(t, "3", turn.AgentID)
+	assert.Equal(t, 1, turn.TurnIndex)
+	assert.Equal(t, "今天天气怎么样", turn.UserText)
+	assert.Equal(t, "北京今天是晴天。", turn.AssistantText)
+	assert.EqualValues(t, 320, turn.AsrMs)
+	assert.EqualValues(t, 500, turn.LlmFirstTokenMs)
+	assert.EqualValues(t, 200, turn.TtsFirstFrameMs)
+	assert.False(t, turn.Interrupted)
+	require.Len(t, turn.ToolCalls, 1)
+	assert.Equal(t, "get_weather", turn.ToolCalls[0].Name)
+	assert.Len(t, []rune(turn.ToolCalls[0].Result), maxToolResultLen+3)
+
+	select {
+	case turn = <-turns:
+	case <-time.After(time.Second):
+		t.Fatal("等待对话记录超时")
+	}
+	assert.Equal(t, 2, turn.TurnIndex)
+	assert.Equal(t, "", turn.AssistantText)
+	assert.True(t, turn.Interrupted)
+}
@@ -0,0 +1,190 @@
+package knowledge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Embedder 文本向量化
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedder 根据 provider 创建向量化实现
+// openai: OpenAI 兼容的 /embeddings 接口; local: 本地哈希向量, 无需外部服务
+func NewEmbedder(provider string, config map[string]interface{}) (Embedder, error) {
+	switch provider {
+	case "openai":
+		baseURL, _ := config["base_url"].(string)
+		model, _ := config["model"].(string)
+		if baseURL == "" || model == "" {
+			return nil, fmt.Errorf("openai embedding 缺少 base_url 或 model 配置")
+		}
+		apiKey, _ := config["api_key"].(string)
+		return NewOpenAIEmbedder(baseURL, apiKey, model, toInt(config["dimensions"])), nil
+	case "local", "":
+		return NewLocalEmbedder(toInt(config["dimensions"])), nil
+	default:
+		return nil, fmt.Errorf("不支持的 embedding provider: %s", provider)
+	}
+}
+
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// OpenAIEmbedder 调用 OpenAI 兼容的 /embeddings 接口
+type OpenAIEmbedder struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	dimensions int // 0 表示使用模型默认维度
+	client     *http.Client
+}
+
+func NewOpenAIEmbedder(baseURL string, apiKey string, model string, dimensions int) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		dimensions: dimensions,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type embeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(embeddingRequest{Model: e.model, Input: texts, Dimensions: e.dimensions})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 embedding 接口失败: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding 接口返回错误, status: %d, body: %s", resp.StatusCode, data)
+	}
+
+	var result embeddingResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("解析 embedding 响应失败: %v", err)
+	}
+	vectors := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding 响应 index 越界: %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("embedding 响应缺少第 %d 条结果", i)
+		}
+	}
+	return vectors, nil
+}
+
+// LocalEmbedder 按字和相邻两字做特征哈希的本地向量
+// 只能匹配字面相近的内容, 用于没有 embedding 服务时的测试和体验
+type LocalEmbedder struct {
+	dimensions int
+}
+
+func NewLocalEmbedder(dimensions int) *LocalEmbedder {
+	if dimensions <= 0 {
+		dimensions = 512
+	}
+	return &LocalEmbedder{dimensions: dimensions}
+}
+
+func (e *LocalEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *LocalEmbedder) embed(text string) []float32 {
+	vector := make([]float32, e.dimensions)
+	add := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		// 用最高位决定符号, 减小哈希冲突带来的偏差
+		if sum>>63 == 1 {
+			vector[sum%uint64(e.dimensions)] -= 1
+		} else {
+			vector[sum%uint64(e.dimensions)] += 1
+		}
+	}
+
+	var prev rune
+	for _, r := range strings.ToLower(text) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			prev = 0
+			continue
+		}
+		add(string(r))
+		if prev != 0 {
+			add(string([]rune{prev, r}))
+		}
+		prev = r
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] = float32(float64(vector[i]) / norm)
+		}
+	}
+	return vector
+}
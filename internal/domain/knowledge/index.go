@@ -0,0 +1,172 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Index 按智能体隔离的向量索引
+type Index interface {
+	// Load 返回智能体已索引的全部分块(含向量)
+	Load(ctx context.Context, agentID string) ([]Chunk, error)
+	// Replace 用 chunks 整体替换智能体的索引
+	Replace(ctx context.Context, agentID string, chunks []Chunk) error
+	Search(ctx context.Context, agentID string, vector []float32, topK int) ([]Result, error)
+}
+
+// cosine 余弦相似度, 维度不一致时返回 0
+func cosine(a []float32, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// topResults 暴力计算相似度并取前 topK 个
+func topResults(chunks []Chunk, vector []float32, topK int) []Result {
+	results := make([]Result, 0, len(chunks))
+	for _, chunk := range chunks {
+		results = append(results, Result{Chunk: chunk, Score: cosine(chunk.Vector, vector)})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if topK > 0 && len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
+
+// MemoryIndex 进程内索引, 重启后需重新向量化
+type MemoryIndex struct {
+	mu     sync.RWMutex
+	agents map[string][]Chunk
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{agents: make(map[string][]Chunk)}
+}
+
+func (i *MemoryIndex) Load(ctx context.Context, agentID string) ([]Chunk, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.agents[agentID], nil
+}
+
+func (i *MemoryIndex) Replace(ctx context.Context, agentID string, chunks []Chunk) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(chunks) == 0 {
+		delete(i.agents, agentID)
+		return nil
+	}
+	i.agents[agentID] = chunks
+	return nil
+}
+
+func (i *MemoryIndex) Search(ctx context.Context, agentID string, vector []float32, topK int) ([]Result, error) {
+	i.mu.RLock()
+	chunks := i.agents[agentID]
+	i.mu.RUnlock()
+	return topResults(chunks, vector, topK), nil
+}
+
+// RedisIndex 向量保存在 redis hash 中, 多实例共享且重启后无需重新向量化
+// 检索时取回全部分块在本地计算相似度, 适用于单个智能体几千个分块以内的知识库
+type RedisIndex struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+func NewRedisIndex(client *redis.Client, keyPrefix string) *RedisIndex {
+	return &RedisIndex{
+		client:    client,
+		keyPrefix: keyPrefix,
+	}
+}
+
+func (i *RedisIndex) redisKey(agentID string) string {
+	return fmt.Sprintf("%s:knowledge:%s", i.keyPrefix, agentID)
+}
+
+// redisChunk 向量按 float32 小端序编码, 比 json 数组更紧凑
+type redisChunk struct {
+	Chunk
+	Vector []byte `json:"vector"`
+}
+
+func encodeVector(vector []float32) []byte {
+	data := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	return data
+}
+
+func decodeVector(data []byte) []float32 {
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vector
+}
+
+func (i *RedisIndex) Load(ctx context.Context, agentID string) ([]Chunk, error) {
+	values, err := i.client.HGetAll(ctx, i.redisKey(agentID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]Chunk, 0, len(values))
+	for _, value := range values {
+		var item redisChunk
+		if err := json.Unmarshal([]byte(value), &item); err != nil {
+			return nil, fmt.Errorf("解析知识库分块失败: %v", err)
+		}
+		item.Chunk.Vector = decodeVector(item.Vector)
+		chunks = append(chunks, item.Chunk)
+	}
+	return chunks, nil
+}
+
+func (i *RedisIndex) Replace(ctx context.Context, agentID string, chunks []Chunk) error {
+	key := i.redisKey(agentID)
+	pipe := i.client.TxPipeline()
+	pipe.Del(ctx, key)
+	if len(chunks) > 0 {
+		values := make(map[string]interface{}, len(chunks))
+		for _, chunk := range chunks {
+			data, err := json.Marshal(redisChunk{Chunk: chunk, Vector: encodeVector(chunk.Vector)})
+			if err != nil {
+				return err
+			}
+			values[chunk.ID] = data
+		}
+		pipe.HSet(ctx, key, values)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (i *RedisIndex) Search(ctx context.Context, agentID string, vector []float32, topK int) ([]Result, error) {
+	chunks, err := i.Load(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	return topResults(chunks, vector, topK), nil
+}
@@ -0,0 +1,335 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	i_redis "xiaozhi-esp32-server-golang/internal/db/redis"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// Chunk 知识库文档的一个分块, 分块在 manager 中完成
+type Chunk struct {
+	ID           string    `json:"id"`
+	DocumentID   string    `json:"document_id"`
+	DocumentName string    `json:"document_name"`
+	Content      string    `json:"content"`
+	Vector       []float32 `json:"vector,omitempty"`
+}
+
+// Result 检索结果
+type Result struct {
+	Chunk
+	Score float64 `json:"score"`
+}
+
+// Source 获取智能体知识库的全部分块, 由 app 层注册
+type Source func(ctx context.Context, agentID string) ([]Chunk, error)
+
+// AgentLister 列出有知识库的智能体, 用于启动时预先构建索引
+type AgentLister func(ctx context.Context) ([]string, error)
+
+const (
+	// buildTimeout 单个智能体一次同步(拉取分块+向量化+写索引)的超时
+	buildTimeout = 10 * time.Minute
+	// buildRetryInterval 同步失败后, 检索触发的重试间隔
+	buildRetryInterval = time.Minute
+)
+
+// Retriever 按智能体检索知识库
+// 索引在后台构建: 启动时构建全部智能体, Invalidate 或超过 refreshInterval 后重新同步
+// 检索只查询已有索引, 不等待构建
+type Retriever struct {
+	source          Source
+	embedder        Embedder
+	index           Index
+	topK            int
+	minScore        float64
+	batchSize       int
+	refreshInterval time.Duration
+
+	mu     sync.Mutex
+	agents map[string]*agentState
+}
+
+type agentState struct {
+	mu       sync.Mutex
+	syncedAt time.Time
+	failedAt time.Time
+	count    int
+	building bool // 同一智能体同时只有一个同步
+	pending  bool // 同步期间又有变更, 结束后再同步一次
+}
+
+// Option Retriever 的可选配置
+type Option func(*Retriever)
+
+func WithTopK(topK int) Option {
+	return func(r *Retriever) {
+		r.topK = topK
+	}
+}
+
+// WithMinScore 相似度低于该值的分块不返回
+func WithMinScore(minScore float64) Option {
+	return func(r *Retriever) {
+		r.minScore = minScore
+	}
+}
+
+// WithBatchSize 单次 embedding 请求的最大分块数
+func WithBatchSize(batchSize int) Option {
+	return func(r *Retriever) {
+		r.batchSize = batchSize
+	}
+}
+
+// WithRefreshInterval 定期重新同步, 0 表示只在 Invalidate 后同步
+func WithRefreshInterval(interval time.Duration) Option {
+	return func(r *Retriever) {
+		r.refreshInterval = interval
+	}
+}
+
+func NewRetriever(source Source, embedder Embedder, index Index, opts ...Option) *Retriever {
+	r := &Retriever{
+		source:    source,
+		embedder:  embedder,
+		index:     index,
+		topK:      3,
+		batchSize: 16,
+		agents:    make(map[string]*agentState),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+var (
+	globalSource    Source
+	globalAgents    AgentLister
+	globalRetriever *Retriever
+	retrieverOnce   sync.Once
+)
+
+// SetSource 注册知识库来源, 需在首次调用 Get 前注册, agents 可为 nil
+func SetSource(source Source, agents AgentLister) {
+	globalSource = source
+	globalAgents = agents
+}
+
+// Get 按 knowledge 配置初始化全局检索器, 未开启或未注册来源时返回 nil
+func Get() *Retriever {
+	retrieverOnce.Do(func() {
+		if !viper.GetBool("knowledge.enable") || globalSource == nil {
+			return
+		}
+		provider := viper.GetString("knowledge.embedding.provider")
+		embedder, err := NewEmbedder(provider, viper.GetStringMap("knowledge.embedding"))
+		if err != nil {
+			log.Errorf("初始化知识库 embedding 失败: %v", err)
+			return
+		}
+
+		var index Index = NewMemoryIndex()
+		if viper.GetString("knowledge.index") == "redis" {
+			client := i_redis.GetClient()
+			if client == nil {
+				log.Warnf("知识库使用 redis 索引, 但 redis 未初始化, 改用进程内索引")
+			} else {
+				index = NewRedisIndex(client, viper.GetString("redis.key_prefix"))
+			}
+		}
+
+		opts := []Option{
+			WithMinScore(viper.GetFloat64("knowledge.min_score")),
+			WithRefreshInterval(time.Duration(viper.GetInt("knowledge.refresh_interval")) * time.Second),
+		}
+		if topK := viper.GetInt("knowledge.top_k"); topK > 0 {
+			opts = append(opts, WithTopK(topK))
+		}
+		if batchSize := viper.GetInt("knowledge.embedding.batch_size"); batchSize > 0 {
+			opts = append(opts, WithBatchSize(batchSize))
+		}
+		globalRetriever = NewRetriever(globalSource, embedder, index, opts...)
+		log.Infof("知识库检索已开启, embedding: %s, 索引: %s", provider, viper.GetString("knowledge.index"))
+		if globalAgents != nil {
+			go globalRetriever.BuildAll(globalAgents)
+		}
+	})
+	return globalRetriever
+}
+
+func (r *Retriever) state(agentID string) *agentState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.agents[agentID]
+	if !ok {
+		state = &agentState{}
+		r.agents[agentID] = state
+	}
+	return state
+}
+
+// BuildAll 在后台构建 agents 列出的全部智能体的索引
+func (r *Retriever) BuildAll(agents AgentLister) {
+	ctx, cancel := context.WithTimeout(context.Background(), buildTimeout)
+	agentIDs, err := agents(ctx)
+	cancel()
+	if err != nil {
+		log.Warnf("获取有知识库的智能体失败, 改为检索时构建: %v", err)
+		return
+	}
+	for _, agentID := range agentIDs {
+		r.Build(agentID)
+	}
+}
+
+// Invalidate 知识库变更后调用, 在后台重新同步
+func (r *Retriever) Invalidate(agentID string) {
+	r.Build(agentID)
+}
+
+// Build 在后台同步智能体的知识库, 正在同步时等本次结束后再同步一次
+func (r *Retriever) Build(agentID string) {
+	state := r.state(agentID)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.building {
+		state.pending = true
+		return
+	}
+	state.building = true
+	go r.build(agentID, state)
+}
+
+// build 使用独立的 context 同步, 失败时继续使用已有索引
+func (r *Retriever) build(agentID string, state *agentState) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), buildTimeout)
+		count, err := r.rebuild(ctx, agentID)
+		cancel()
+
+		state.mu.Lock()
+		if err != nil {
+			state.failedAt = time.Now()
+			log.Warnf("同步智能体 %s 知识库失败, 继续使用已有索引: %v", agentID, err)
+		} else {
+			state.syncedAt = time.Now()
+			state.count = count
+		}
+		if !state.pending {
+			state.building = false
+			state.mu.Unlock()
+			return
+		}
+		state.pending = false
+		state.mu.Unlock()
+	}
+}
+
+// Retrieve 检索与 query 最相关的分块, 智能体没有知识库或索引尚未构建完成时返回空
+func (r *Retriever) Retrieve(ctx context.Context, agentID string, query string) ([]Result, error) {
+	if r == nil || agentID == "" || strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+	synced, count := r.checkIndex(agentID)
+	if !synced || count == 0 {
+		return nil, nil
+	}
+
+	vectors, err := r.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("向量化问题失败: %v", err)
+	}
+	results, err := r.index.Search(ctx, agentID, vectors[0], r.topK)
+	if err != nil {
+		return nil, fmt.Errorf("检索知识库失败: %v", err)
+	}
+	filtered := results[:0]
+	for _, result := range results {
+		if result.Score >= r.minScore {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered, nil
+}
+
+// checkIndex 返回索引是否已构建及分块数, 未构建或需要刷新时在后台同步
+func (r *Retriever) checkIndex(agentID string) (bool, int) {
+	state := r.state(agentID)
+	state.mu.Lock()
+	synced, count := !state.syncedAt.IsZero(), state.count
+	due := !state.building && time.Since(state.failedAt) >= buildRetryInterval &&
+		(!synced || (r.refreshInterval > 0 && time.Since(state.syncedAt) >= r.refreshInterval))
+	state.mu.Unlock()
+	if due {
+		r.Build(agentID)
+	}
+	return synced, count
+}
+
+// rebuild 拉取分块并重建索引, 内容未变的分块复用已有向量
+func (r *Retriever) rebuild(ctx context.Context, agentID string) (int, error) {
+	chunks, err := r.source(ctx, agentID)
+	if err != nil {
+		return 0, fmt.Errorf("获取知识库分块失败: %v", err)
+	}
+
+	existing, err := r.index.Load(ctx, agentID)
+	if err != nil {
+		log.Warnf("读取智能体 %s 已有索引失败, 将全部重新向量化: %v", agentID, err)
+	}
+	vectors := make(map[string][]float32, len(existing))
+	for _, chunk := range existing {
+		vectors[chunk.ID+"\x00"+chunk.Content] = chunk.Vector
+	}
+
+	var pending []int
+	for i := range chunks {
+		if vector, ok := vectors[chunks[i].ID+"\x00"+chunks[i].Content]; ok {
+			chunks[i].Vector = vector
+		} else {
+			pending = append(pending, i)
+		}
+	}
+	for start := 0; start < len(pending); start += r.batchSize {
+		end := min(start+r.batchSize, len(pending))
+		texts := make([]string, 0, end-start)
+		for _, i := range pending[start:end] {
+			texts = append(texts, chunks[i].Content)
+		}
+		embedded, err := r.embedder.Embed(ctx, texts)
+		if err != nil {
+			return 0, fmt.Errorf("向量化知识库分块失败: %v", err)
+		}
+		for j, i := range pending[start:end] {
+			chunks[i].Vector = embedded[j]
+		}
+	}
+
+	if err := r.index.Replace(ctx, agentID, chunks); err != nil {
+		return 0, fmt.Errorf("写入知识库索引失败: %v", err)
+	}
+	log.Infof("智能体 %s 知识库已同步, 分块: %d, 新向量化: %d", agentID, len(chunks), len(pending))
+	return len(chunks), nil
+}
+
+// FormatResults 将检索结果整理为注入系统提示词的资料
+func FormatResults(results []Result) string {
+	if len(results) == 0 {
+		return ""
+	}
+	var builder strings.Builder
+	builder.WriteString("# 知识库资料\n以下是从知识库中检索到的与用户问题相关的资料, 回答时请优先依据这些资料, 资料中没有的内容不要编造:\n")
+	for i, result := range results {
+		builder.WriteString(fmt.Sprintf("\n[%d] 《%s》\n%s\n", i+1, result.DocumentName, result.Content))
+	}
+	return builder.String()
+}
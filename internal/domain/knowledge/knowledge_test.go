@@ -0,0 +1,120 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingEmbedder 统计被向量化的文本数
+type countingEmbedder struct {
+	Embedder
+	count int
+}
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.count += len(texts)
+	return e.Embedder.Embed(ctx, texts)
+}
+
+func TestRetriever(t *testing.T) {
+	chunks := map[string][]Chunk{
+		"1": {
+			{ID: "1", DocumentID: "10", DocumentName: "说明书", Content: "长按电源键三秒开机, 指示灯变为蓝色"},
+			{ID: "2", DocumentID: "10", DocumentName: "说明书", Content: "充电时指示灯为红色, 充满后熄灭"},
+			{ID: "3", DocumentID: "11", DocumentName: "售后", Content: "产品保修期为一年, 人为损坏不在保修范围"},
+		},
+	}
+	var sourceErr error
+	source := func(ctx context.Context, agentID string) ([]Chunk, error) {
+		if sourceErr != nil {
+			return nil, sourceErr
+		}
+		return append([]Chunk(nil), chunks[agentID]...), nil
+	}
+	embedder := &countingEmbedder{Embedder: NewLocalEmbedder(0)}
+	r := NewRetriever(source, embedder, NewMemoryIndex(), WithTopK(2), WithMinScore(0.1), WithBatchSize(2))
+	ctx := context.Background()
+
+	// 索引未构建时不等待, 直接返回空
+	results, err := r.Retrieve(ctx, "1", "怎么开机")
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	waitBuilt(t, r, "1")
+
+	r.BuildAll(func(ctx context.Context) ([]string, error) {
+		return []string{"1"}, nil
+	})
+	waitBuilt(t, r, "1")
+	assert.Equal(t, 3, embedder.count)
+
+	results, err = r.Retrieve(ctx, "1", "怎么开机")
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	assert.Equal(t, "1", results[0].ID)
+	assert.LessOrEqual(t, len(results), 2)
+	assert.Equal(t, 4, embedder.count)
+
+	results, err = r.Retrieve(ctx, "1", "保修多久")
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	assert.Equal(t, "售后", results[0].DocumentName)
+	assert.Equal(t, 5, embedder.count)
+
+	// 没有知识库的智能体不请求 embedding
+	r.Build("2")
+	waitBuilt(t, r, "2")
+	results, err = r.Retrieve(ctx, "2", "怎么开机")
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	assert.Equal(t, 5, embedder.count)
+
+	// 变更后只向量化新增和修改的分块
+	chunks["1"][1].Content = "充电时指示灯为红色, 充满后变为绿色"
+	chunks["1"] = append(chunks["1"], Chunk{ID: "4", DocumentID: "12", DocumentName: "网络", Content: "首次使用需在手机上配置无线网络"})
+	r.Invalidate("1")
+	waitBuilt(t, r, "1")
+	results, err = r.Retrieve(ctx, "1", "指示灯绿色")
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	assert.Equal(t, "2", results[0].ID)
+	assert.Equal(t, 8, embedder.count)
+
+	// 同步失败时继续使用已有索引
+	sourceErr = errors.New("manager 未连接")
+	r.Invalidate("1")
+	waitBuilt(t, r, "1")
+	results, err = r.Retrieve(ctx, "1", "配置无线网络")
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	assert.Equal(t, "4", results[0].ID)
+
+	// 首次同步失败时检索返回空, 重试间隔内不再触发同步
+	r.Build("3")
+	waitBuilt(t, r, "3")
+	_, err = r.Retrieve(ctx, "3", "怎么开机")
+	assert.NoError(t, err)
+
+	text := FormatResults(results[:1])
+	assert.Contains(t, text, "[1] 《网络》")
+	assert.Empty(t, FormatResults(nil))
+}
+
+// waitBuilt 等待智能体的后台同步结束
+func waitBuilt(t *testing.T, r *Retriever, agentID string) {
+	require.Eventually(t, func() bool {
+		state := r.state(agentID)
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		return !state.building
+	}, 2*time.Second, time.Millisecond)
+}
+
+func TestVectorEncoding(t *testing.T) {
+	vector := []float32{0.5, -1.25, 3e-8, 0}
+	assert.Equal(t, vector, decodeVector(encodeVector(vector)))
+}
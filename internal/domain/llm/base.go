@@ -7,7 +7,9 @@ import (
 	"github.com/cloudwego/eino/schema"
 
 	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/chain"
 	"xiaozhi-esp32-server-golang/internal/domain/llm/eino_llm"
+	"xiaozhi-esp32-server-golang/internal/domain/llm/mock"
 )
 
 // LLMProvider 大语言模型提供者接口
@@ -36,7 +38,7 @@ type LLMFactory interface {
 // GetLLMProvider 创建LLM提供者
 // 统一使用EinoLLMProvider处理所有类型
 func GetLLMProvider(providerName string, config map[string]interface{}) (LLMProvider, error) {
-	llmType := config["type"].(string)
+	llmType, _ := config["type"].(string)
 	switch llmType {
 	case constants.LlmTypeOpenai, constants.LlmTypeOllama, constants.LlmTypeEinoLLM, constants.LlmTypeEino:
 		// 统一使用 EinoLLMProvider 处理所有类型
@@ -45,6 +47,17 @@ func GetLLMProvider(providerName string, config map[string]interface{}) (LLMProv
 			return nil, fmt.Errorf("创建Eino LLM提供者失败: %v", err)
 		}
 		return provider, nil
+	case constants.LlmTypeMock:
+		return mock.NewMockLLM(config)
+	case constants.LlmTypeChain:
+		// 故障转移链, 成员同样通过 GetLLMProvider 创建
+		provider, err := chain.NewChainProvider(config, func(name string, memberConfig map[string]interface{}) (chain.Provider, error) {
+			return GetLLMProvider(name, memberConfig)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("创建LLM链失败: %v", err)
+		}
+		return provider, nil
 	}
 	return nil, fmt.Errorf("不支持的LLM提供者: %s", llmType)
 }
@@ -0,0 +1,264 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/util/breaker"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const typeChain = "chain"
+
+// Provider 与 llm.LLMProvider 一致, 单独定义以避免循环引用
+type Provider interface {
+	ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message
+	ResponseWithVllm(ctx context.Context, file []byte, text string, mimeType string) (string, error)
+	GetModelInfo() map[string]interface{}
+}
+
+// Factory 根据名称和配置创建成员提供者
+type Factory func(name string, config map[string]interface{}) (Provider, error)
+
+type member struct {
+	name     string
+	provider Provider
+	tools    bool // 是否支持工具调用
+	vision   bool // 是否支持图片识别
+	breaker  *breaker.Breaker
+}
+
+// ChainProvider 按顺序尝试多个 LLM, 首个 token 超时或出错时切换到下一个
+type ChainProvider struct {
+	members           []*member
+	firstTokenTimeout time.Duration
+}
+
+// NewChainProvider 创建故障转移链
+// 配置项: providers 成员列表; first_token_timeout_ms 首 token 超时; failure_threshold 熔断阈值; cooldown_seconds 熔断冷却时间
+func NewChainProvider(config map[string]interface{}, factory Factory) (*ChainProvider, error) {
+	c := &ChainProvider{
+		firstTokenTimeout: 8 * time.Second,
+	}
+	if ms := getInt(config["first_token_timeout_ms"]); ms > 0 {
+		c.firstTokenTimeout = time.Duration(ms) * time.Millisecond
+	}
+	threshold := 3
+	if n := getInt(config["failure_threshold"]); n > 0 {
+		threshold = n
+	}
+	cooldown := 30 * time.Second
+	if n := getInt(config["cooldown_seconds"]); n > 0 {
+		cooldown = time.Duration(n) * time.Second
+	}
+
+	items, _ := config["providers"].([]interface{})
+	for _, item := range items {
+		m := &member{tools: true, vision: true}
+		var memberConfig map[string]interface{}
+		switch v := item.(type) {
+		case string:
+			m.name = v
+		case map[string]interface{}:
+			m.name, _ = v["name"].(string)
+			if tools, ok := v["tools"].(bool); ok {
+				m.tools = tools
+			}
+			if vision, ok := v["vision"].(bool); ok {
+				m.vision = vision
+			}
+			memberConfig, _ = v["config"].(map[string]interface{})
+		}
+		if m.name == "" {
+			continue
+		}
+		if memberConfig == nil {
+			memberConfig = lookupConfig(m.name)
+		}
+		if memberConfig == nil {
+			return nil, fmt.Errorf("LLM链成员 %s 未找到配置", m.name)
+		}
+		if memberType, _ := memberConfig["type"].(string); memberType == typeChain {
+			return nil, fmt.Errorf("LLM链成员 %s 不能是 chain 类型", m.name)
+		}
+
+		provider, err := factory(m.name, memberConfig)
+		if err != nil {
+			return nil, fmt.Errorf("创建LLM链成员 %s 失败: %v", m.name, err)
+		}
+		m.provider = provider
+		m.breaker = breaker.Get("llm:"+m.name, threshold, cooldown)
+		c.members = append(c.members, m)
+	}
+	if len(c.members) == 0 {
+		return nil, errors.New("LLM链未配置可用的成员")
+	}
+	return c, nil
+}
+
+// lookupConfig 从配置文件的 llm.<name> 或 vision.vllm.<name> 中查找成员配置
+func lookupConfig(name string) map[string]interface{} {
+	for _, prefix := range []string{"llm.", "vision.vllm."} {
+		if config := viper.GetStringMap(prefix + name); len(config) > 0 {
+			return config
+		}
+	}
+	return nil
+}
+
+// candidates 按需要的能力筛选成员, 熔断中的成员排在最后作为兜底
+func (c *ChainProvider) candidates(needTools bool, needVision bool) []*member {
+	var healthy, broken []*member
+	for _, m := range c.members {
+		if (needTools && !m.tools) || (needVision && !m.vision) {
+			continue
+		}
+		if m.breaker.Allow() {
+			healthy = append(healthy, m)
+		} else {
+			broken = append(broken, m)
+		}
+	}
+	return append(healthy, broken...)
+}
+
+func (c *ChainProvider) onFailure(m *member, reason string) {
+	metrics.IncProviderError("llm", m.name)
+	if m.breaker.Failure() {
+		log.Warnf("LLM链成员 %s %s, 已熔断", m.name, reason)
+		return
+	}
+	log.Warnf("LLM链成员 %s %s", m.name, reason)
+}
+
+// ResponseWithContext 依次尝试各成员, 只有在尚未输出任何内容时才会切换
+func (c *ChainProvider) ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message {
+	outputChan := make(chan *schema.Message, 10)
+	go func() {
+		defer close(outputChan)
+
+		candidates := c.candidates(len(functions) > 0, false)
+		if len(candidates) == 0 {
+			// 没有支持工具调用的成员时, 不带工具请求
+			candidates = c.candidates(false, false)
+			functions = nil
+		}
+		for _, m := range candidates {
+			streamed, err := c.stream(ctx, m, sessionID, dialogue, functions, outputChan)
+			if err == nil {
+				m.breaker.Success()
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			c.onFailure(m, err.Error())
+			if streamed {
+				return
+			}
+		}
+		log.Errorf("LLM链所有成员均请求失败, sessionID: %s", sessionID)
+	}()
+	return outputChan
+}
+
+// stream 转发单个成员的响应, 返回是否已输出内容
+func (c *ChainProvider) stream(ctx context.Context, m *member, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo, outputChan chan *schema.Message) (bool, error) {
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	responseChan := m.provider.ResponseWithContext(subCtx, sessionID, dialogue, functions)
+	// 放弃该成员后继续读空通道, 避免其协程阻塞
+	defer func() {
+		go func() {
+			for range responseChan {
+			}
+		}()
+	}()
+
+	timer := time.NewTimer(c.firstTokenTimeout)
+	defer timer.Stop()
+
+	var first *schema.Message
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-timer.C:
+		return false, fmt.Errorf("首个token超时(%v)", c.firstTokenTimeout)
+	case msg, ok := <-responseChan:
+		if !ok {
+			return false, errors.New("未返回任何内容")
+		}
+		first = msg
+	}
+
+	msg := first
+	for {
+		select {
+		case outputChan <- msg:
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+		var ok bool
+		select {
+		case msg, ok = <-responseChan:
+			if !ok {
+				return true, nil
+			}
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+}
+
+// ResponseWithVllm 依次尝试支持图片识别的成员
+func (c *ChainProvider) ResponseWithVllm(ctx context.Context, file []byte, text string, mimeType string) (string, error) {
+	candidates := c.candidates(false, true)
+	if len(candidates) == 0 {
+		return "", errors.New("LLM链中没有支持图片识别的成员")
+	}
+	var lastErr error
+	for _, m := range candidates {
+		result, err := m.provider.ResponseWithVllm(ctx, file, text, mimeType)
+		if err == nil {
+			m.breaker.Success()
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		c.onFailure(m, err.Error())
+		lastErr = err
+	}
+	return "", fmt.Errorf("LLM链所有成员均请求失败: %v", lastErr)
+}
+
+func (c *ChainProvider) GetModelInfo() map[string]interface{} {
+	members := make([]string, 0, len(c.members))
+	for _, m := range c.members {
+		members = append(members, m.name)
+	}
+	return map[string]interface{}{
+		"type":                   typeChain,
+		"providers":              members,
+		"first_token_timeout_ms": c.firstTokenTimeout.Milliseconds(),
+	}
+}
+
+func getInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider mode: ok 正常返回; fail 直接关闭通道; hang 不返回直到取消
+type fakeProvider struct {
+	mode  string
+	reply string
+	calls int32
+}
+
+func (f *fakeProvider) ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message {
+	atomic.AddInt32(&f.calls, 1)
+	ch := make(chan *schema.Message, 10)
+	go func() {
+		defer close(ch)
+		switch f.mode {
+		case "ok":
+			ch <- schema.AssistantMessage(f.reply, nil)
+		case "hang":
+			<-ctx.Done()
+		}
+	}()
+	return ch
+}
+
+func (f *fakeProvider) ResponseWithVllm(ctx context.Context, file []byte, text string, mimeType string) (string, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if f.mode != "ok" {
+		return "", errors.New("fail")
+	}
+	return f.reply, nil
+}
+
+func (f *fakeProvider) GetModelInfo() map[string]interface{} {
+	return map[string]interface{}{"type": "fake"}
+}
+
+func newTestChain(t *testing.T, fakes map[string]*fakeProvider, providers []interface{}) *ChainProvider {
+	c, err := NewChainProvider(map[string]interface{}{
+		"first_token_timeout_ms": 100,
+		"failure_threshold":      2,
+		"cooldown_seconds":       60,
+		"providers":              providers,
+	}, func(name string, config map[string]interface{}) (Provider, error) {
+		return fakes[name], nil
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func inline(name string, extra map[string]interface{}) map[string]interface{} {
+	m := map[string]interface{}{"name": name, "config": map[string]interface{}{"type": "fake"}}
+	for k, v := range extra {
+		m[k] = v
+	}
+	return m
+}
+
+func collect(c *ChainProvider, functions []*schema.ToolInfo) string {
+	var text string
+	for msg := range c.ResponseWithContext(context.Background(), "s", nil, functions) {
+		text += msg.Content
+	}
+	return text
+}
+
+func TestChainFailover(t *testing.T) {
+	fakes := map[string]*fakeProvider{
+		"failover_hang": {mode: "hang"},
+		"failover_fail": {mode: "fail"},
+		"failover_ok":   {mode: "ok", reply: "备用回复"},
+	}
+	c := newTestChain(t, fakes, []interface{}{
+		inline("failover_hang", nil),
+		inline("failover_fail", nil),
+		inline("failover_ok", nil),
+	})
+
+	start := time.Now()
+	assert.Equal(t, "备用回复", collect(c, nil))
+	assert.Less(t, time.Since(start), time.Second)
+
+	// 连续失败达到阈值后熔断, 后续请求直接使用健康成员
+	assert.Equal(t, "备用回复", collect(c, nil))
+	assert.Equal(t, "备用回复", collect(c, nil))
+	assert.EqualValues(t, 2, fakes["failover_hang"].calls)
+	assert.EqualValues(t, 2, fakes["failover_fail"].calls)
+	assert.EqualValues(t, 3, fakes["failover_ok"].calls)
+}
+
+func TestChainRouting(t *testing.T) {
+	fakes := map[string]*fakeProvider{
+		"route_fast":   {mode: "ok", reply: "快速模型"},
+		"route_tools":  {mode: "ok", reply: "工具模型"},
+		"route_vision": {mode: "ok", reply: "视觉模型"},
+	}
+	c := newTestChain(t, fakes, []interface{}{
+		inline("route_fast", map[string]interface{}{"tools": false, "vision": false}),
+		inline("route_tools", map[string]interface{}{"vision": false}),
+		inline("route_vision", nil),
+	})
+
+	assert.Equal(t, "快速模型", collect(c, nil))
+	assert.Equal(t, "工具模型", collect(c, []*schema.ToolInfo{{Name: "get_weather"}}))
+
+	result, err := c.ResponseWithVllm(context.Background(), nil, "图里有什么", "image/jpeg")
+	assert.NoError(t, err)
+	assert.Equal(t, "视觉模型", result)
+}
+
+func TestChainConfigError(t *testing.T) {
+	_, err := NewChainProvider(map[string]interface{}{
+		"providers": []interface{}{inline("nested", nil)},
+	}, func(name string, config map[string]interface{}) (Provider, error) {
+		return nil, errors.New("boom")
+	})
+	assert.Error(t, err)
+
+	_, err = NewChainProvider(map[string]interface{}{
+		"providers": []interface{}{map[string]interface{}{"name": "self", "config": map[string]interface{}{"type": "chain"}}},
+	}, nil)
+	assert.Error(t, err)
+}
@@ -18,4 +18,6 @@ type LLMResponseStruct struct {
 	IsStart   bool              `json:"is_start"`
 	IsEnd     bool              `json:"is_end"`
 	ToolCalls []schema.ToolCall `json:"tool_calls,omitempty"`
+	Emotion   string            `json:"emotion,omitempty"` //句子对应的表情, 由开头的表情标记提取
+	Delta     string            `json:"delta,omitempty"`   //增量文本, 仅在 WithDelta 时输出, 已去除开头的表情标记
 }
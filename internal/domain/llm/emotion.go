@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// 设备端支持的表情
+var emotionList = []struct {
+	emoji   string
+	emotion string
+}{
+	{"😶", "neutral"},
+	{"🙂", "happy"},
+	{"😆", "laughing"},
+	{"😂", "funny"},
+	{"😔", "sad"},
+	{"😠", "angry"},
+	{"😭", "crying"},
+	{"😍", "loving"},
+	{"😳", "embarrassed"},
+	{"😲", "surprised"},
+	{"😱", "shocked"},
+	{"🤔", "thinking"},
+	{"😉", "winking"},
+	{"😎", "cool"},
+	{"😌", "relaxed"},
+	{"🤤", "delicious"},
+	{"😘", "kissy"},
+	{"😏", "confident"},
+	{"😴", "sleepy"},
+	{"😜", "silly"},
+	{"🙄", "confused"},
+}
+
+var (
+	emojiEmotionMap = make(map[string]string, len(emotionList)) // emoji => emotion
+	emotionEmojiMap = make(map[string]string, len(emotionList)) // emotion => emoji
+)
+
+func init() {
+	for _, item := range emotionList {
+		emojiEmotionMap[item.emoji] = item.emotion
+		emotionEmojiMap[item.emotion] = item.emoji
+	}
+}
+
+// 简单关键词分类, 按顺序匹配
+var emotionKeywords = []struct {
+	emotion  string
+	keywords []string
+}{
+	{"laughing", []string{"哈哈", "嘻嘻", "笑死"}},
+	{"crying", []string{"呜呜", "哭"}},
+	{"sad", []string{"难过", "伤心", "遗憾", "抱歉", "对不起"}},
+	{"angry", []string{"生气", "气死", "讨厌"}},
+	{"loving", []string{"喜欢你", "爱你", "么么"}},
+	{"surprised", []string{"哇", "天哪", "居然", "竟然"}},
+	{"thinking", []string{"让我想想", "嗯…", "思考"}},
+	{"happy", []string{"开心", "高兴", "太好了", "真棒"}},
+}
+
+// EmotionPrompt 引导 LLM 以 [emotion] 标签开头回复, 标签由服务端去除并转为设备表情,
+// 使用文字标签而非表情符号, 不与系统提示词中"不要回复表情符号"的要求冲突
+var EmotionPrompt = func() string {
+	var sb strings.Builder
+	sb.WriteString("每次回复请以一个表示当前情绪的标签开头, 格式如 [happy], 只能从以下标签中选择: ")
+	for i, item := range emotionList {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(item.emotion)
+	}
+	sb.WriteString("。该标签仅用于设备显示表情, 不会被朗读; 标签之后的正文仍遵守其他要求, 不要使用表情符号。")
+	return sb.String()
+}()
+
+// GetEmotionEmoji 获取 emotion 对应的 emoji
+func GetEmotionEmoji(emotion string) string {
+	return emotionEmojiMap[emotion]
+}
+
+// ExtractEmotion 提取文本开头的表情标记（emoji 或 [emotion]）, 返回 emotion 及去除标记后的文本
+func ExtractEmotion(text string) (string, string) {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return "", text
+	}
+
+	// [happy] 形式的标签
+	if strings.HasPrefix(trimmed, "[") {
+		if end := strings.Index(trimmed, "]"); end > 1 {
+			tag := strings.ToLower(strings.TrimSpace(trimmed[1:end]))
+			if _, ok := emotionEmojiMap[tag]; ok {
+				return tag, strings.TrimSpace(trimmed[end+1:])
+			}
+		}
+		return "", text
+	}
+
+	// emoji 形式, 可能带变体选择符 U+FE0F
+	r, size := utf8.DecodeRuneInString(trimmed)
+	if r == utf8.RuneError {
+		return "", text
+	}
+	emotion, ok := emojiEmotionMap[trimmed[:size]]
+	if !ok {
+		return "", text
+	}
+	rest := strings.TrimPrefix(trimmed[size:], "️")
+	return emotion, strings.TrimSpace(rest)
+}
+
+// RemoveEmotionMarks 去除文本开头的表情标记及正文中的表情符号, 用于保存对话历史, 避免表情再次进入上下文
+func RemoveEmotionMarks(text string) string {
+	_, text = ExtractEmotion(text)
+	for _, item := range emotionList {
+		text = strings.ReplaceAll(text, item.emoji, "")
+	}
+	return strings.ReplaceAll(text, "\ufe0f", "")
+}
+
+// ClassifyEmotion 根据关键词粗略推断文本情绪, 无法判断时返回空
+func ClassifyEmotion(text string) string {
+	for _, item := range emotionKeywords {
+		for _, keyword := range item.keywords {
+			if strings.Contains(text, keyword) {
+				return item.emotion
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractEmotion(t *testing.T) {
+	cases := []struct {
+		input   string
+		emotion string
+		text    string
+	}{
+		{"😆 哈哈，你太逗了", "laughing", "哈哈，你太逗了"},
+		{"🙂️今天天气不错", "happy", "今天天气不错"},
+		{"[sad] 我有点难过", "sad", "我有点难过"},
+		{"[unknown] 你好", "", "[unknown] 你好"},
+		{"你好呀", "", "你好呀"},
+		{"😆", "laughing", ""},
+	}
+	for _, c := range cases {
+		emotion, text := ExtractEmotion(c.input)
+		assert.Equal(t, c.emotion, emotion, c.input)
+		assert.Equal(t, c.text, text, c.input)
+	}
+}
+
+func TestClassifyEmotion(t *testing.T) {
+	assert.Equal(t, "laughing", ClassifyEmotion("哈哈哈, 笑死我了"))
+	assert.Equal(t, "sad", ClassifyEmotion("对不起, 我没听清"))
+	assert.Equal(t, "", ClassifyEmotion("今天是星期三"))
+}
+
+func TestRemoveEmotionMarks(t *testing.T) {
+	assert.Equal(t, "你好呀", RemoveEmotionMarks("[happy] 你好呀"))
+	assert.Equal(t, "哈哈，你太逗了", RemoveEmotionMarks("😆 哈哈，你太逗了😂"))
+	assert.Equal(t, "今天天气不错", RemoveEmotionMarks("今天🙂️天气不错"))
+	assert.Equal(t, "[注意]前方", RemoveEmotionMarks("[注意]前方"))
+}
+
+func TestEmotionPromptWithoutEmoji(t *testing.T) {
+	for _, item := range emotionList {
+		assert.NotContains(t, EmotionPrompt, item.emoji)
+		assert.Contains(t, EmotionPrompt, item.emotion)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 	"xiaozhi-esp32-server-golang/internal/domain/llm/common"
 
 	log "xiaozhi-esp32-server-golang/logger"
@@ -40,11 +41,79 @@ func isSentencePausePunctuation(r rune) bool {
 	return false
 }
 
+type handleOptions struct {
+	withDelta   bool
+	withEmotion bool
+}
+
+// HandleOption 处理LLM响应的选项
+type HandleOption func(*handleOptions)
+
+// WithDelta 在句子之外额外输出增量文本, 供流式输入的TTS使用
+func WithDelta() HandleOption {
+	return func(o *handleOptions) {
+		o.withDelta = true
+	}
+}
+
+// WithEmotion 提取回复开头的表情标记, 未开启时文本原样输出
+func WithEmotion() HandleOption {
+	return func(o *handleOptions) {
+		o.withEmotion = true
+	}
+}
+
+// deltaFilter 去除回复开头的表情标记, 之后的增量文本原样输出
+type deltaFilter struct {
+	withEmotion bool
+	prefix      strings.Builder
+	started     bool
+}
+
+func (f *deltaFilter) Push(content string) string {
+	if f.started || !f.withEmotion {
+		return content
+	}
+	f.prefix.WriteString(content)
+	text := strings.TrimLeft(f.prefix.String(), " \t\n")
+	if text == "" {
+		return ""
+	}
+	// 等待 [happy] 形式的标签结束
+	if strings.HasPrefix(text, "[") && !strings.Contains(text, "]") && utf8.RuneCountInString(text) < 16 {
+		return ""
+	}
+	emotion, rest := ExtractEmotion(text)
+	if emotion == "" {
+		f.started = true
+		return text
+	}
+	// 只有表情时继续等待正文
+	f.prefix.Reset()
+	if rest == "" {
+		return ""
+	}
+	f.started = true
+	// 保留末尾空白, 避免与下一个 token 粘连
+	return rest + text[len(strings.TrimRight(text, " \t\n")):]
+}
+
 // HandleLLMWithContextAndTools 使用上下文控制来处理LLM响应（兼容带工具和不带工具）
-func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider, dialogue []*schema.Message, tools []*schema.ToolInfo, sessionID string) (chan common.LLMResponseStruct, error) {
+func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider, dialogue []*schema.Message, tools []*schema.ToolInfo, sessionID string, opts ...HandleOption) (chan common.LLMResponseStruct, error) {
 	var (
 		llmResponse interface{}
 	)
+	var options handleOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	filter := deltaFilter{withEmotion: options.withEmotion}
+	extractEmotion := func(text string) (string, string) {
+		if !options.withEmotion {
+			return "", text
+		}
+		return ExtractEmotion(text)
+	}
 	llmResponse = llmProvider.ResponseWithContext(ctx, sessionID, dialogue, tools)
 
 	sentenceChannel := make(chan common.LLMResponseStruct, 2)
@@ -53,6 +122,8 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 	fullText := ""
 	var buffer bytes.Buffer // 用于累积接收到的内容
 	isFirst := true
+	// 仅包含表情的句子, 表情留给下一句
+	var pendingEmotion string
 
 	go func() {
 		defer func() {
@@ -75,13 +146,19 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 					if remaining != "" {
 						log.Infof("处理剩余内容: %s", remaining)
 						fullText += remaining
+						emotion, text := extractEmotion(remaining)
+						if emotion == "" {
+							emotion = pendingEmotion
+						}
 						select {
 						case <-ctx.Done():
 							log.Infof("上下文已取消，停止LLM响应处理: %v, context done, exit", ctx.Err())
 							return
 						case sentenceChannel <- common.LLMResponseStruct{
-							Text:  remaining,
-							IsEnd: true,
+							Text:    text,
+							IsStart: isFirst,
+							IsEnd:   true,
+							Emotion: emotion,
 						}:
 						}
 
@@ -103,6 +180,16 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 				}
 				byteMessage, _ := json.Marshal(message)
 				log.Infof("收到message: %s", string(byteMessage))
+				if message.Content != "" && options.withDelta {
+					if delta := filter.Push(message.Content); delta != "" {
+						select {
+						case <-ctx.Done():
+							log.Infof("上下文已取消，停止LLM响应处理: %v, context done, exit", ctx.Err())
+							return
+						case sentenceChannel <- common.LLMResponseStruct{Delta: delta}:
+						}
+					}
+				}
 				if message.Content != "" {
 					fullText += message.Content
 					buffer.WriteString(message.Content)
@@ -110,6 +197,18 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 						sentences, remaining := extractSmartSentences(buffer.String(), 2, 100, isFirst)
 						if len(sentences) > 0 {
 							for _, sentence := range sentences {
+								emotion, text := extractEmotion(sentence)
+								if text == "" {
+									if emotion != "" {
+										pendingEmotion = emotion
+									}
+									continue
+								}
+								if emotion == "" {
+									emotion = pendingEmotion
+								}
+								pendingEmotion = ""
+								sentence = text
 								if sentence != "" {
 									if !firstFrame {
 										firstFrame = true
@@ -124,6 +223,7 @@ func HandleLLMWithContextAndTools(ctx context.Context, llmProvider LLMProvider,
 										Text:    sentence,
 										IsStart: isFirst,
 										IsEnd:   false,
+										Emotion: emotion,
 									}:
 									}
 
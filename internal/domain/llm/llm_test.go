@@ -0,0 +1,85 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"xiaozhi-esp32-server-golang/internal/domain/llm/mock"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleLLMWithDelta(t *testing.T) {
+	provider, err := mock.NewMockLLM(map[string]interface{}{
+		"reply":      "😆 哈哈，你好呀。今天天气不错！",
+		"chunk_size": 3,
+	})
+	require.NoError(t, err)
+
+	dialogue := []*schema.Message{schema.UserMessage("你好")}
+	responses, err := HandleLLMWithContextAndTools(context.Background(), provider, dialogue, nil, "session", WithDelta(), WithEmotion())
+	require.NoError(t, err)
+
+	var deltas strings.Builder
+	var sentences []string
+	var emotion string
+	for response := range responses {
+		deltas.WriteString(response.Delta)
+		if response.Text != "" {
+			sentences = append(sentences, response.Text)
+			if emotion == "" {
+				emotion = response.Emotion
+			}
+		}
+	}
+	// 增量文本去除了开头的表情, 句子照常输出
+	assert.Equal(t, "哈哈，你好呀。今天天气不错！", deltas.String())
+	assert.Equal(t, "哈哈，你好呀。今天天气不错！", strings.Join(sentences, ""))
+	assert.Equal(t, "laughing", emotion)
+
+	// 未开启时不输出增量文本
+	responses, err = HandleLLMWithContextAndTools(context.Background(), provider, dialogue, nil, "session")
+	require.NoError(t, err)
+	for response := range responses {
+		assert.Empty(t, response.Delta)
+	}
+}
+
+func TestDeltaFilter(t *testing.T) {
+	filter := deltaFilter{withEmotion: true}
+	assert.Equal(t, "", filter.Push(" [hap"))
+	assert.Equal(t, "", filter.Push("py]"))
+	assert.Equal(t, "Hello ", filter.Push(" Hello "))
+	assert.Equal(t, "world", filter.Push("world"))
+
+	filter = deltaFilter{withEmotion: true}
+	assert.Equal(t, "[注意]前方", filter.Push("[注意]前方"))
+
+	// 未开启表情时原样输出
+	filter = deltaFilter{}
+	assert.Equal(t, "[happy]你好", filter.Push("[happy]你好"))
+}
+
+func TestHandleLLMWithoutEmotion(t *testing.T) {
+	provider, err := mock.NewMockLLM(map[string]interface{}{
+		"reply":      "[happy] 你好呀。",
+		"chunk_size": 3,
+	})
+	require.NoError(t, err)
+
+	responses, err := HandleLLMWithContextAndTools(context.Background(), provider, []*schema.Message{schema.UserMessage("你好")}, nil, "session")
+	require.NoError(t, err)
+
+	var sentences []string
+	for response := range responses {
+		assert.Empty(t, response.Emotion)
+		if response.Text != "" {
+			sentences = append(sentences, response.Text)
+		}
+	}
+	// 未开启表情时不提取表情标记
+	assert.Equal(t, "[happy] 你好呀。", strings.Join(sentences, ""))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -67,13 +68,20 @@ func (m *Memory) getSystemPromptKey(deviceID string) string {
 	return fmt.Sprintf("%s:llm:system:%s", m.keyPrefix, deviceID)
 }
 
-// AddMessage 添加一条新的对话消息到记忆体
-func (m *Memory) AddMessage(ctx context.Context, deviceID string, msg schema.Message) error {
+// AddMessage 添加一条新的对话消息到记忆体, 消息标记所属智能体, 记忆总结只处理本智能体的消息
+func (m *Memory) AddMessage(ctx context.Context, deviceID string, agentID string, msg schema.Message) error {
 	if m.redisClient == nil {
 		log.Log().Warn("redis client is nil")
 		return nil
 	}
 
+	extra := make(map[string]any, len(msg.Extra)+1)
+	for k, v := range msg.Extra {
+		extra[k] = v
+	}
+	extra[messageExtraAgentID] = agentID
+	msg.Extra = extra
+
 	msgBytes, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("marshal message failed: %w", err)
@@ -178,22 +186,64 @@ func (m *Memory) GetSystemPrompt(ctx context.Context, deviceID string) (schema.M
 	}, nil
 }
 
-// ResetMemory 重置设备的对话记忆（包括系统 prompt）
-func (m *Memory) ResetMemory(ctx context.Context, deviceID string) error {
+// ResetMemory 重置设备的对话记忆, 包括智能体下的记忆摘要, agentID 为空时删除各智能体下的摘要
+func (m *Memory) ResetMemory(ctx context.Context, deviceID string, agentID string) error {
 	if m.redisClient == nil {
 		log.Log().Warn("redis client is nil")
 		return nil
 	}
 
-	// 删除对话历史
-	historyKey := m.getMemoryKey(deviceID)
-	if err := m.redisClient.Del(ctx, historyKey).Err(); err != nil {
+	keys := []string{m.getMemoryKey(deviceID)}
+	if agentID != "" {
+		keys = append(keys, m.getSummaryKey(deviceID, agentID))
+	} else {
+		summaryKeys, err := m.summaryKeys(ctx, deviceID)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, summaryKeys...)
+	}
+	if err := m.redisClient.Del(ctx, keys...).Err(); err != nil {
 		return fmt.Errorf("delete history failed: %w", err)
 	}
+	return nil
+}
 
+// DeleteDeviceMemory 删除设备的对话历史、系统 prompt 及各智能体下的记忆摘要, 用于隐私删除
+func (m *Memory) DeleteDeviceMemory(ctx context.Context, deviceID string) error {
+	if m.redisClient == nil {
+		log.Log().Warn("redis client is nil")
+		return nil
+	}
+
+	summaryKeys, err := m.summaryKeys(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	keys := append([]string{m.getMemoryKey(deviceID), m.getSystemPromptKey(deviceID)}, summaryKeys...)
+	if err := m.redisClient.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("delete device memory failed: %w", err)
+	}
 	return nil
 }
 
+// summaryKeys 设备在各智能体下的记忆摘要 key
+func (m *Memory) summaryKeys(ctx context.Context, deviceID string) ([]string, error) {
+	// 设备 ID 中的通配符需转义, 避免匹配到其它设备
+	pattern := m.getSummaryKey(redisGlobEscaper.Replace(deviceID), "*")
+	var keys []string
+	iter := m.redisClient.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("scan summary keys failed: %w", err)
+	}
+	return keys, nil
+}
+
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
 // GetLastNMessages 获取最近的 N 条消息
 func (m *Memory) GetLastNMessages(ctx context.Context, deviceID string, n int64) ([]schema.Message, error) {
 	if m.redisClient == nil {
@@ -233,18 +283,3 @@ func (m *Memory) RemoveOldMessages(ctx context.Context, deviceID string, before
 
 	return m.redisClient.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("%f", score)).Err()
 }
-
-// Summary 获取对话的摘要
-func (m *Memory) GetSummary(ctx context.Context, deviceID string) (string, error) {
-	return "", nil
-}
-
-// SetSummary 设置对话的摘要
-func (m *Memory) SetSummary(ctx context.Context, deviceID string, summary string) error {
-	return nil
-}
-
-// 进行总结
-func (m *Memory) Summary(ctx context.Context, deviceID string, msgList []schema.Message) (string, error) {
-	return "", nil
-}
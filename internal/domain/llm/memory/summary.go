@@ -0,0 +1,199 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/domain/llm"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	summaryFieldContent   = "summary"
+	summaryFieldLastTs    = "last_ts" //已总结的最后一条消息的分数
+	summaryFieldUpdatedAt = "updated_at"
+
+	messageExtraAgentID = "agent_id" //消息所属智能体, 存于 schema.Message.Extra
+)
+
+// 正在进行总结的 key, 避免同一设备并发总结
+var summaryRunning sync.Map
+
+// getSummaryKey 生成设备在指定智能体下的记忆摘要 Redis key
+func (m *Memory) getSummaryKey(deviceID string, agentID string) string {
+	return fmt.Sprintf("%s:llm:summary:%s:%s", m.keyPrefix, deviceID, agentID)
+}
+
+// GetSummary 获取对话的摘要
+func (m *Memory) GetSummary(ctx context.Context, deviceID string, agentID string) (string, error) {
+	if m.redisClient == nil {
+		log.Log().Warn("redis client is nil")
+		return "", nil
+	}
+
+	key := m.getSummaryKey(deviceID, agentID)
+	summary, err := m.redisClient.HGet(ctx, key, summaryFieldContent).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get summary failed: %w", err)
+	}
+	return summary, nil
+}
+
+// SetSummary 设置对话的摘要, lastTs 为本次已总结的最后一条消息的分数
+func (m *Memory) SetSummary(ctx context.Context, deviceID string, agentID string, summary string, lastTs float64) error {
+	if m.redisClient == nil {
+		log.Log().Warn("redis client is nil")
+		return nil
+	}
+
+	key := m.getSummaryKey(deviceID, agentID)
+	return m.redisClient.HSet(ctx, key, map[string]interface{}{
+		summaryFieldContent:   summary,
+		summaryFieldLastTs:    fmt.Sprintf("%f", lastTs),
+		summaryFieldUpdatedAt: time.Now().Unix(),
+	}).Err()
+}
+
+// getUnsummarizedMessages 获取上次总结之后属于该智能体的消息（旧->新）, 返回消息列表及最后一条扫描到的消息的分数
+// 其他智能体的消息同样推进分数, 避免下次重复扫描
+func (m *Memory) getUnsummarizedMessages(ctx context.Context, deviceID string, agentID string, count int64) ([]schema.Message, float64, error) {
+	lastTs, err := m.redisClient.HGet(ctx, m.getSummaryKey(deviceID, agentID), summaryFieldLastTs).Float64()
+	if err != nil && err != redis.Nil {
+		return nil, 0, fmt.Errorf("get summary last_ts failed: %w", err)
+	}
+
+	// 按页扫描, 直到取满 count 条本智能体的消息或扫描到末尾
+	messages := make([]schema.Message, 0, count)
+	for int64(len(messages)) < count {
+		results, err := m.redisClient.ZRangeByScoreWithScores(ctx, m.getMemoryKey(deviceID), &redis.ZRangeBy{
+			Min:   fmt.Sprintf("(%f", lastTs),
+			Max:   "+inf",
+			Count: count,
+		}).Result()
+		if err != nil {
+			return nil, 0, fmt.Errorf("get unsummarized messages failed: %w", err)
+		}
+
+		for _, z := range results {
+			var msg schema.Message
+			if err := json.Unmarshal([]byte(z.Member.(string)), &msg); err != nil {
+				return nil, 0, fmt.Errorf("unmarshal message failed: %w", err)
+			}
+			lastTs = z.Score
+			if msgAgentID, _ := msg.Extra[messageExtraAgentID].(string); msgAgentID != agentID {
+				continue
+			}
+			messages = append(messages, msg)
+			if int64(len(messages)) == count {
+				break
+			}
+		}
+		if int64(len(results)) < count {
+			break
+		}
+	}
+	return messages, lastTs, nil
+}
+
+// Summarize 未总结的消息数达到 minCount 时, 调用 LLM 将其合并到记忆摘要中, 单次最多处理 maxCount 条
+// newProvider 仅在确定需要总结时调用, 未达到阈值的轮次不创建 LLM 实例
+func (m *Memory) Summarize(ctx context.Context, newProvider func() (llm.LLMProvider, error), deviceID string, agentID string, minCount int, maxCount int) error {
+	if m.redisClient == nil {
+		log.Log().Warn("redis client is nil")
+		return nil
+	}
+
+	key := m.getSummaryKey(deviceID, agentID)
+	if _, running := summaryRunning.LoadOrStore(key, struct{}{}); running {
+		log.Debugf("设备 %s 记忆总结进行中, 跳过", deviceID)
+		return nil
+	}
+	defer summaryRunning.Delete(key)
+
+	msgList, lastTs, err := m.getUnsummarizedMessages(ctx, deviceID, agentID, int64(maxCount))
+	if err != nil {
+		return err
+	}
+	if len(msgList) == 0 || len(msgList) < minCount {
+		return nil
+	}
+
+	oldSummary, err := m.GetSummary(ctx, deviceID, agentID)
+	if err != nil {
+		return err
+	}
+
+	llmProvider, err := newProvider()
+	if err != nil {
+		return fmt.Errorf("create llm provider failed: %w", err)
+	}
+
+	startTs := time.Now().UnixMilli()
+	summary, err := m.Summary(ctx, llmProvider, oldSummary, msgList)
+	if err != nil {
+		return err
+	}
+	log.Infof("设备 %s 记忆总结完成, 消息数: %d, 耗时: %dms", deviceID, len(msgList), time.Now().UnixMilli()-startTs)
+
+	return m.SetSummary(ctx, deviceID, agentID, summary, lastTs)
+}
+
+// Summary 将新增的对话合并到已有记忆中, 返回新的记忆 json
+func (m *Memory) Summary(ctx context.Context, llmProvider llm.LLMProvider, oldSummary string, msgList []schema.Message) (string, error) {
+	var dialogue strings.Builder
+	for _, msg := range msgList {
+		if msg.Content == "" {
+			continue
+		}
+		if msg.Role == schema.User || msg.Role == schema.Assistant {
+			dialogue.WriteString(fmt.Sprintf("%s: %s\n", msg.Role, msg.Content))
+		}
+	}
+	if dialogue.Len() == 0 {
+		return oldSummary, nil
+	}
+
+	if oldSummary == "" {
+		oldSummary = "无"
+	}
+	requestMessages := []*schema.Message{
+		schema.SystemMessage(MemorySummaryPrompt),
+		schema.UserMessage(fmt.Sprintf("## 已有记忆\n%s\n\n## 新增对话\n%s", oldSummary, dialogue.String())),
+	}
+
+	var fullText strings.Builder
+	for msg := range llmProvider.ResponseWithContext(ctx, "memory_summary", requestMessages, nil) {
+		if msg != nil {
+			fullText.WriteString(msg.Content)
+		}
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("summary canceled: %w", ctx.Err())
+	}
+
+	summary := extractJson(fullText.String())
+	if !json.Valid([]byte(summary)) {
+		return "", fmt.Errorf("summary is not valid json: %s", fullText.String())
+	}
+	return summary, nil
+}
+
+// extractJson 去掉 markdown 代码块等多余内容, 提取 json 对象
+func extractJson(text string) string {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return strings.TrimSpace(text)
+	}
+	return text[start : end+1]
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeLLMProvider struct {
+	chunks   []string
+	dialogue []*schema.Message
+}
+
+func (f *fakeLLMProvider) ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message {
+	f.dialogue = dialogue
+	ch := make(chan *schema.Message, len(f.chunks))
+	for _, chunk := range f.chunks {
+		ch <- schema.AssistantMessage(chunk, nil)
+	}
+	close(ch)
+	return ch
+}
+
+func (f *fakeLLMProvider) ResponseWithVllm(ctx context.Context, file []byte, text string, mimeType string) (string, error) {
+	return "", nil
+}
+
+func (f *fakeLLMProvider) GetModelInfo() map[string]interface{} {
+	return nil
+}
+
+func TestSummary(t *testing.T) {
+	provider := &fakeLLMProvider{chunks: []string{"```json\n{\"时空档案\":", " {\"身份图谱\": {\"现用名\": \"张三\"}}}\n```"}}
+	m := NewMemory(nil)
+
+	summary, err := m.Summary(context.Background(), provider, "", []schema.Message{
+		*schema.UserMessage("我叫张三"),
+		*schema.AssistantMessage("你好张三", nil),
+		{Role: schema.Tool, Content: "tool result"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"时空档案\": {\"身份图谱\": {\"现用名\": \"张三\"}}}", summary)
+
+	assert.Len(t, provider.dialogue, 2)
+	assert.Contains(t, provider.dialogue[1].Content, "user: 我叫张三")
+	assert.Contains(t, provider.dialogue[1].Content, "assistant: 你好张三")
+	assert.NotContains(t, provider.dialogue[1].Content, "tool result")
+}
+
+func TestSummaryInvalidJson(t *testing.T) {
+	provider := &fakeLLMProvider{chunks: []string{"好的, 我记住了"}}
+	m := NewMemory(nil)
+
+	_, err := m.Summary(context.Background(), provider, "{}", []schema.Message{*schema.UserMessage("你好")})
+	assert.Error(t, err)
+}
+
+func TestSummaryNoDialogue(t *testing.T) {
+	provider := &fakeLLMProvider{}
+	m := NewMemory(nil)
+
+	summary, err := m.Summary(context.Background(), provider, "{\"a\":1}", []schema.Message{{Role: schema.Tool, Content: "x"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"a\":1}", summary)
+	assert.Nil(t, provider.dialogue)
+}
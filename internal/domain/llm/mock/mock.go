@@ -0,0 +1,156 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+)
+
+// Rule 用户消息包含 Match 时的预设回复, 配置了 ToolName 时先返回工具调用
+type Rule struct {
+	Match         string
+	Reply         string
+	ToolName      string
+	ToolArguments string
+}
+
+// MockLLM 离线 LLM, 按规则返回预设回复, 用于测试
+type MockLLM struct {
+	reply           string
+	toolResultReply string
+	rules           []Rule
+	chunkSize       int
+	chunkDelay      time.Duration
+}
+
+// NewMockLLM 创建 mock LLM
+// 配置项: reply 默认回复; rules 匹配规则; tool_result_reply 收到工具结果后的回复; chunk_size 流式分片字数; chunk_delay_ms 分片间隔
+func NewMockLLM(config map[string]interface{}) (*MockLLM, error) {
+	m := &MockLLM{
+		reply:           "你好，我是小智。",
+		toolResultReply: "好的，已经完成了。",
+		chunkSize:       4,
+	}
+	if reply, ok := config["reply"].(string); ok && reply != "" {
+		m.reply = reply
+	}
+	if reply, ok := config["tool_result_reply"].(string); ok && reply != "" {
+		m.toolResultReply = reply
+	}
+	if chunkSize := getInt(config["chunk_size"]); chunkSize > 0 {
+		m.chunkSize = chunkSize
+	}
+	m.chunkDelay = time.Duration(getInt(config["chunk_delay_ms"])) * time.Millisecond
+
+	if items, ok := config["rules"].([]interface{}); ok {
+		for _, item := range items {
+			itemMap, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			rule := Rule{}
+			rule.Match, _ = itemMap["match"].(string)
+			rule.Reply, _ = itemMap["reply"].(string)
+			rule.ToolName, _ = itemMap["tool_name"].(string)
+			rule.ToolArguments, _ = itemMap["tool_arguments"].(string)
+			if rule.ToolArguments == "" {
+				rule.ToolArguments = "{}"
+			}
+			m.rules = append(m.rules, rule)
+		}
+	}
+	return m, nil
+}
+
+// ResponseWithContext 根据最后一条消息选择回复, 按 chunk_size 分片流式返回
+func (m *MockLLM) ResponseWithContext(ctx context.Context, sessionID string, dialogue []*schema.Message, functions []*schema.ToolInfo) chan *schema.Message {
+	msgChan := make(chan *schema.Message, 10)
+	go func() {
+		defer close(msgChan)
+
+		reply, toolCall := m.match(dialogue)
+		if toolCall != nil {
+			select {
+			case msgChan <- schema.AssistantMessage("", []schema.ToolCall{*toolCall}):
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		runes := []rune(reply)
+		for start := 0; start < len(runes); start += m.chunkSize {
+			end := start + m.chunkSize
+			if end > len(runes) {
+				end = len(runes)
+			}
+			if m.chunkDelay > 0 {
+				time.Sleep(m.chunkDelay)
+			}
+			select {
+			case msgChan <- schema.AssistantMessage(string(runes[start:end]), nil):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return msgChan
+}
+
+// match 返回回复文本, 命中需要调用工具的规则时返回工具调用
+func (m *MockLLM) match(dialogue []*schema.Message) (string, *schema.ToolCall) {
+	if len(dialogue) == 0 {
+		return m.reply, nil
+	}
+	last := dialogue[len(dialogue)-1]
+	if last.Role == schema.Tool {
+		return m.toolResultReply, nil
+	}
+	if last.Role != schema.User {
+		return m.reply, nil
+	}
+
+	for i, rule := range m.rules {
+		if rule.Match == "" || !strings.Contains(last.Content, rule.Match) {
+			continue
+		}
+		if rule.ToolName != "" {
+			return "", &schema.ToolCall{
+				ID:   fmt.Sprintf("mock_call_%d", i),
+				Type: "function",
+				Function: schema.FunctionCall{
+					Name:      rule.ToolName,
+					Arguments: rule.ToolArguments,
+				},
+			}
+		}
+		return rule.Reply, nil
+	}
+	return m.reply, nil
+}
+
+// ResponseWithVllm 返回默认回复
+func (m *MockLLM) ResponseWithVllm(ctx context.Context, file []byte, text string, mimeType string) (string, error) {
+	return m.reply, nil
+}
+
+func (m *MockLLM) GetModelInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "mock",
+		"model_name": "mock",
+	}
+}
+
+func getInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package mock
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockLLMRules(t *testing.T) {
+	llm, err := NewMockLLM(map[string]interface{}{
+		"reply":             "默认回复",
+		"tool_result_reply": "音量已调整",
+		"chunk_size":        2,
+		"rules": []interface{}{
+			map[string]interface{}{"match": "天气", "reply": "今天是晴天。"},
+			map[string]interface{}{"match": "音量", "tool_name": "self_audio_speaker_set_volume", "tool_arguments": `{"volume":50}`},
+		},
+	})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	collect := func(dialogue []*schema.Message) []*schema.Message {
+		var msgs []*schema.Message
+		for msg := range llm.ResponseWithContext(ctx, "session", dialogue, nil) {
+			msgs = append(msgs, msg)
+		}
+		return msgs
+	}
+	join := func(msgs []*schema.Message) string {
+		var sb strings.Builder
+		for _, msg := range msgs {
+			sb.WriteString(msg.Content)
+		}
+		return sb.String()
+	}
+
+	msgs := collect([]*schema.Message{schema.UserMessage("今天天气怎么样")})
+	assert.Len(t, msgs, 3)
+	assert.Equal(t, "今天是晴天。", join(msgs))
+
+	assert.Equal(t, "默认回复", join(collect([]*schema.Message{schema.UserMessage("你好")})))
+
+	msgs = collect([]*schema.Message{schema.UserMessage("把音量调到50")})
+	assert.Len(t, msgs, 1)
+	assert.Len(t, msgs[0].ToolCalls, 1)
+	assert.Equal(t, "self_audio_speaker_set_volume", msgs[0].ToolCalls[0].Function.Name)
+	assert.Equal(t, `{"volume":50}`, msgs[0].ToolCalls[0].Function.Arguments)
+
+	dialogue := []*schema.Message{
+		schema.UserMessage("把音量调到50"),
+		schema.AssistantMessage("", msgs[0].ToolCalls),
+		schema.ToolMessage("ok", msgs[0].ToolCalls[0].ID),
+	}
+	assert.Equal(t, "音量已调整", join(collect(dialogue)))
+}
@@ -55,16 +55,28 @@ func CheckMCPConfig() {
 			problemCount++
 		}
 
-		// 检查SSE URL
-		if config.SSEUrl == "" {
-			status = "❌"
-			issues = append(issues, "SSE URL为空")
-			problemCount++
-		} else {
-			// 检查URL格式
-			if !strings.HasPrefix(config.SSEUrl, "http://") && !strings.HasPrefix(config.SSEUrl, "https://") {
+		// 检查连接参数
+		endpoint := config.SSEUrl
+		switch config.Type {
+		case "stdio":
+			endpoint = strings.TrimSpace(config.Command + " " + strings.Join(config.Args, " "))
+			if config.Command == "" {
+				status = "❌"
+				issues = append(issues, "command为空")
+				problemCount++
+			}
+		default:
+			if config.Url != "" {
+				endpoint = config.Url
+			}
+			if endpoint == "" {
+				status = "❌"
+				issues = append(issues, "URL为空")
+				problemCount++
+			} else if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+				// 检查URL格式
 				status = "⚠️"
-				issues = append(issues, "SSE URL格式可能不正确")
+				issues = append(issues, "URL格式可能不正确")
 			}
 		}
 
@@ -79,8 +91,8 @@ func CheckMCPConfig() {
 			issueStr = fmt.Sprintf(" - 问题: %s", strings.Join(issues, ", "))
 		}
 
-		log.Infof("  [%d] %s %s (URL: %s, 启用: %v)%s",
-			i+1, status, config.Name, config.SSEUrl, config.Enabled, issueStr)
+		log.Infof("  [%d] %s %s (%s, 启用: %v)%s",
+			i+1, status, config.Name, endpoint, config.Enabled, issueStr)
 	}
 
 	// 总结
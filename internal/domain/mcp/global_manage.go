@@ -27,6 +27,12 @@ type MCPServerConfig struct {
 	Url     string `json:"url" mapstructure:"url"`
 	SSEUrl  string `json:"sse_url" mapstructure:"sse_url"` //向后兼容sse_url字段
 	Enabled bool   `json:"enabled" mapstructure:"enabled"`
+
+	// stdio 类型: 启动子进程, 通过标准输入输出通信
+	Command string   `json:"command" mapstructure:"command"`
+	Args    []string `json:"args" mapstructure:"args"`
+	Env     []string `json:"env" mapstructure:"env"` // KEY=VALUE, 追加到当前进程的环境变量
+	Cwd     string   `json:"cwd" mapstructure:"cwd"` // 子进程工作目录, 为空时使用当前目录
 }
 
 // GlobalMCPManager 全局MCP管理器
@@ -55,9 +61,14 @@ type MCPServerConnection struct {
 	mu         sync.RWMutex
 	lastError  error
 	retryCount int
+	nextRetry  time.Time // 重连退避, 未到时间不重连
 	lastPing   time.Time
+	process    *stdioProcess // stdio 类型的子进程
 }
 
+// 重连退避的最大间隔
+const maxReconnectBackoff = 10 * time.Minute
+
 var (
 	globalManager *GlobalMCPManager
 	once          sync.Once
@@ -104,8 +115,8 @@ func (g *GlobalMCPManager) Start() error {
 
 	// 详细记录每个服务器配置
 	for i, config := range serverConfigs {
-		log.Infof("MCP服务器[%d]: Type=%s, Name=%s, Url=%s, SSEUrl=%s, Enabled=%v",
-			i+1, config.Type, config.Name, config.Url, config.SSEUrl, config.Enabled)
+		log.Infof("MCP服务器[%d]: Type=%s, Name=%s, Url=%s, SSEUrl=%s, Command=%s, Enabled=%v",
+			i+1, config.Type, config.Name, config.Url, config.SSEUrl, config.Command, config.Enabled)
 	}
 
 	// 连接启用的服务器
@@ -164,52 +175,59 @@ func (g *GlobalMCPManager) connectToServer(config MCPServerConfig) error {
 		return nil
 	}
 
-	log.Infof("正在连接MCP服务器: %s (URL: %s)", config.Name, config.SSEUrl)
+	log.Infof("正在连接MCP服务器: %s (类型: %s)", config.Name, config.Type)
 
 	conn := &MCPServerConnection{
 		config: config,
 		tools:  make(map[string]tool.InvokableTool),
 	}
 
-	var transportInstance transport.Interface
-	var err error
+	// 启动失败也加入列表, 由重连循环按退避重试
+	g.mu.Lock()
+	g.servers[config.Name] = conn
+	g.mu.Unlock()
+
+	// 连接到服务器
+	if err := conn.connect(); err != nil {
+		conn.mu.Lock()
+		conn.lastError = err
+		conn.mu.Unlock()
+		return fmt.Errorf("连接MCP服务器失败: %v", err)
+	}
+
+	log.Infof("已连接到MCP服务器: %s", config.Name)
+	return nil
+}
 
-	if config.SSEUrl != "" || config.Type == "sse" {
-		var endpoint string
-		if config.SSEUrl != "" {
-			endpoint = config.SSEUrl
+// newClient 按服务器类型创建 MCP 客户端
+func (conn *MCPServerConnection) newClient() (*client.Client, error) {
+	config := conn.config
+	switch {
+	case config.Type == "stdio":
+		mcpClient, process, err := newStdioClient(config)
+		if err != nil {
+			return nil, err
+		}
+		conn.process = process
+		return mcpClient, nil
+	case config.Type == "streamablehttp":
+		streamableTransport, err := transport.NewStreamableHTTP(config.Url)
+		if err != nil {
+			return nil, fmt.Errorf("创建StreamableHTTP传输层失败: %v", err)
 		}
+		return client.NewClient(streamableTransport), nil
+	default:
+		// sse, 兼容只配置 sse_url 的旧配置
+		endpoint := config.SSEUrl
 		if config.Type == "sse" && config.Url != "" {
 			endpoint = config.Url
 		}
 		sseTransport, err := transport.NewSSE(endpoint)
 		if err != nil {
-			return fmt.Errorf("创建SSE传输层失败: %v", err)
-		}
-		transportInstance = sseTransport
-	} else if config.Type == "streamablehttp" {
-		transportInstance, err = transport.NewStreamableHTTP(config.Url)
-		if err != nil {
-			return fmt.Errorf("创建StreamableHTTP传输层失败: %v", err)
+			return nil, fmt.Errorf("创建SSE传输层失败: %v", err)
 		}
+		return client.NewClient(sseTransport), nil
 	}
-
-	// 使用 client.NewClient 创建 MCP 客户端
-	mcpClient := client.NewClient(transportInstance)
-
-	conn.client = mcpClient
-
-	// 连接到服务器
-	if err := conn.connect(); err != nil {
-		return fmt.Errorf("连接MCP服务器失败: %v", err)
-	}
-
-	g.mu.Lock()
-	g.servers[config.Name] = conn
-	g.mu.Unlock()
-
-	log.Infof("已连接到MCP服务器: %s", config.Name)
-	return nil
 }
 
 // connect 连接到MCP服务器
@@ -219,23 +237,34 @@ func (conn *MCPServerConnection) connect() error {
 
 	// 如果client为空，重新创建client
 	if conn.client == nil {
-		sseTransport, err := transport.NewSSE(conn.config.SSEUrl)
+		mcpClient, err := conn.newClient()
 		if err != nil {
-			return fmt.Errorf("创建SSE传输层失败: %v", err)
+			return err
 		}
-		conn.client = client.NewClient(sseTransport)
+		conn.client = mcpClient
 	}
 
-	log.Infof("开始连接MCP服务器: %s, SSE URL: %s", conn.config.Name, conn.config.SSEUrl)
+	log.Infof("开始连接MCP服务器: %s, 类型: %s", conn.config.Name, conn.config.Type)
 
 	// 启动客户端
 	if err := conn.client.Start(ctx); err != nil {
 		log.Errorf("启动MCP客户端失败，服务器: %s, 错误: %v", conn.config.Name, err)
 		return fmt.Errorf("启动客户端失败: %v", err)
 	}
+	if conn.process != nil {
+		go conn.pipeStderr(conn.client)
+	}
 
 	log.Infof("MCP客户端启动成功: %s", conn.config.Name)
 
+	// stdio 子进程可能不响应初始化, 避免一直阻塞
+	initCtx := ctx
+	if conn.process != nil {
+		var cancel context.CancelFunc
+		initCtx, cancel = context.WithTimeout(ctx, stdioInitTimeout)
+		defer cancel()
+	}
+
 	// 初始化客户端
 	initRequest := mcp.InitializeRequest{
 		Params: mcp.InitializeParams{
@@ -251,7 +280,7 @@ func (conn *MCPServerConnection) connect() error {
 	}
 
 	log.Infof("正在初始化MCP服务器: %s", conn.config.Name)
-	initResult, err := conn.client.Initialize(ctx, initRequest)
+	initResult, err := conn.client.Initialize(initCtx, initRequest)
 	if err != nil {
 		log.Errorf("初始化MCP服务器失败，服务器: %s, 错误: %v", conn.config.Name, err)
 		return fmt.Errorf("初始化失败: %v", err)
@@ -269,6 +298,7 @@ func (conn *MCPServerConnection) connect() error {
 	conn.connected = true
 	conn.lastError = nil
 	conn.retryCount = 0
+	conn.nextRetry = time.Time{}
 	conn.mu.Unlock()
 
 	log.Infof("MCP服务器连接建立完成: %s", conn.config.Name)
@@ -332,8 +362,15 @@ func (conn *MCPServerConnection) disconnect() error {
 	defer conn.mu.Unlock()
 
 	if conn.client != nil {
-		// 关闭客户端
-		if err := conn.client.Close(); err != nil {
+		// 关闭客户端, stdio 类型等待子进程退出
+		var err error
+		if conn.process != nil {
+			err = conn.process.stop(conn.client)
+			conn.process = nil
+		} else {
+			err = conn.client.Close()
+		}
+		if err != nil {
 			log.Errorf("关闭MCP客户端失败: %v", err)
 		}
 		conn.client = nil
@@ -472,13 +509,15 @@ func (g *GlobalMCPManager) checkAndReconnect() {
 		conn.mu.RLock()
 		connected := conn.connected
 		retryCount := conn.retryCount
+		nextRetry := conn.nextRetry
 		conn.mu.RUnlock()
 
-		if !connected && retryCount < g.reconnectConf.MaxAttempts {
+		if !connected && retryCount < g.reconnectConf.MaxAttempts && !time.Now().Before(nextRetry) {
 			log.Infof("尝试重连MCP服务器: %s (第%d次)", name, retryCount+1)
 
 			conn.mu.Lock()
 			conn.retryCount++
+			conn.nextRetry = time.Now().Add(g.reconnectBackoff(conn.retryCount))
 			conn.mu.Unlock()
 
 			if _, err := g.reconnectServer(name); err != nil {
@@ -491,6 +530,18 @@ func (g *GlobalMCPManager) checkAndReconnect() {
 	}
 }
 
+// reconnectBackoff 第 n 次重连失败后的等待时间, 从重连间隔开始翻倍
+func (g *GlobalMCPManager) reconnectBackoff(retryCount int) time.Duration {
+	backoff := g.reconnectConf.Interval
+	for i := 1; i < retryCount && backoff < maxReconnectBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxReconnectBackoff {
+		backoff = maxReconnectBackoff
+	}
+	return backoff
+}
+
 // reconnectServer 重连服务器并返回新的client
 func (g *GlobalMCPManager) reconnectServer(serverName string) (*client.Client, error) {
 	g.mu.RLock()
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
+
 	log "xiaozhi-esp32-server-golang/logger"
 
 	"github.com/cloudwego/eino/components/tool"
@@ -12,6 +14,9 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
+// mcpToolCallTimeout 调用方未设置超时时的工具调用超时, 避免服务器无响应(如 stdio 子进程退出)时一直阻塞
+const mcpToolCallTimeout = 2 * time.Minute
+
 // LocalToolHandler 本地工具处理函数类型
 type LocalToolHandler func(ctx context.Context, argumentsInJSON string) (string, error)
 
@@ -84,6 +89,12 @@ func (t *McpTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts
 		},
 	}
 
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, mcpToolCallTimeout)
+		defer cancel()
+	}
+
 	// 第一次尝试调用
 	result, err := t.client.CallTool(ctx, callRequest)
 	if err != nil && isSessionClosedError(err) {
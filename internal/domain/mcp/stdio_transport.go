@@ -0,0 +1,104 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const (
+	// 关闭 stdin 后等待子进程退出的时长, 超时发送 SIGTERM
+	stdioStopTimeout = 3 * time.Second
+	// 发送 SIGTERM 后等待子进程退出的时长, 超时强制结束
+	stdioKillTimeout = 5 * time.Second
+	// stdio 服务器初始化超时, npx/uvx 首次启动需要下载依赖
+	stdioInitTimeout = 60 * time.Second
+)
+
+// stdioProcess stdio 类型 MCP 服务器的子进程
+type stdioProcess struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+}
+
+// newStdioClient 创建启动子进程的 MCP 客户端, 子进程在 client.Start 时启动
+func newStdioClient(config MCPServerConfig) (*client.Client, *stdioProcess, error) {
+	if config.Command == "" {
+		return nil, nil, fmt.Errorf("stdio 类型的MCP服务器 %s 未配置 command", config.Name)
+	}
+
+	process := &stdioProcess{}
+	cmdFunc := func(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+		// 子进程生命周期由 disconnect 控制, 不随 Start 的 ctx 结束
+		procCtx, cancel := context.WithCancel(context.Background())
+		cmd := exec.CommandContext(procCtx, command, args...)
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Dir = config.Cwd
+		cmd.Cancel = func() error {
+			return cmd.Process.Signal(syscall.SIGTERM)
+		}
+		cmd.WaitDelay = stdioKillTimeout
+		process.cmd = cmd
+		process.cancel = cancel
+		return cmd, nil
+	}
+
+	stdioTransport := transport.NewStdioWithOptions(config.Command, config.Env, config.Args, transport.WithCommandFunc(cmdFunc))
+	return client.NewClient(stdioTransport), process, nil
+}
+
+// pipeStderr 将子进程的 stderr 输出到日志, 读取结束说明子进程已退出, 标记连接断开交给重连循环重启
+func (conn *MCPServerConnection) pipeStderr(mcpClient *client.Client) {
+	stdioTransport, ok := mcpClient.GetTransport().(*transport.Stdio)
+	if !ok || stdioTransport.Stderr() == nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(stdioTransport.Stderr())
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		log.Infof("MCP服务器 %s stderr: %s", conn.config.Name, scanner.Text())
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.client != mcpClient {
+		// 已主动断开或重连
+		return
+	}
+	log.Warnf("MCP服务器 %s 子进程已退出", conn.config.Name)
+	conn.connected = false
+	conn.lastError = fmt.Errorf("子进程已退出")
+}
+
+// stop 先关闭 stdin 等待子进程自行退出, 超时后依次发送 SIGTERM 和强制结束
+func (p *stdioProcess) stop(mcpClient *client.Client) error {
+	if p.cancel == nil {
+		// 子进程未启动
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- mcpClient.Close()
+	}()
+
+	select {
+	case err := <-done:
+		p.cancel()
+		return err
+	case <-time.After(stdioStopTimeout):
+	}
+
+	// 触发 cmd.Cancel 发送 SIGTERM, WaitDelay 后强制结束
+	p.cancel()
+	return <-done
+}
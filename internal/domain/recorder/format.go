@@ -0,0 +1,88 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// oggCrcTable Ogg 使用的 CRC32, 多项式 0x04c11db7, 不反转
+var oggCrcTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func oggCrc(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ oggCrcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+const (
+	oggHeaderBOS = 0x02
+	oggHeaderEOS = 0x04
+	oggSerial    = 0x5869616f // "Xiao"
+)
+
+// writeOggPage 每页只放一个数据包
+func writeOggPage(buf *bytes.Buffer, packet []byte, headerType byte, granule uint64, sequence uint32) {
+	segments := len(packet)/255 + 1
+	page := make([]byte, 27+segments, 27+segments+len(packet))
+	copy(page, "OggS")
+	page[5] = headerType
+	binary.LittleEndian.PutUint64(page[6:], granule)
+	binary.LittleEndian.PutUint32(page[14:], oggSerial)
+	binary.LittleEndian.PutUint32(page[18:], sequence)
+	page[26] = byte(segments)
+	for i := 0; i < segments-1; i++ {
+		page[27+i] = 255
+	}
+	page[27+segments-1] = byte(len(packet) % 255)
+	page = append(page, packet...)
+	binary.LittleEndian.PutUint32(page[22:], oggCrc(page))
+	buf.Write(page)
+}
+
+// encodeOggOpus 将 Opus 帧封装为 Ogg-Opus 文件, 帧原样保存不重新编码
+func encodeOggOpus(frames [][]byte, sampleRate int, channels int, frameDuration int) []byte {
+	buf := &bytes.Buffer{}
+
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1 // version
+	head[9] = byte(channels)
+	binary.LittleEndian.PutUint32(head[12:], uint32(sampleRate))
+	writeOggPage(buf, head, oggHeaderBOS, 0, 0)
+
+	vendor := "xiaozhi-esp32-server-golang"
+	tags := make([]byte, 0, 16+len(vendor))
+	tags = append(tags, "OpusTags"...)
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(vendor)))
+	tags = append(tags, vendor...)
+	tags = binary.LittleEndian.AppendUint32(tags, 0)
+	writeOggPage(buf, tags, 0, 0, 1)
+
+	// granule 固定按 48kHz 计数
+	var granule uint64
+	for i, frame := range frames {
+		granule += uint64(48 * frameDuration)
+		var headerType byte
+		if i == len(frames)-1 {
+			headerType = oggHeaderEOS
+		}
+		writeOggPage(buf, frame, headerType, granule, uint32(i+2))
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,264 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/data/audio"
+	"xiaozhi-esp32-server-golang/internal/util"
+	"xiaozhi-esp32-server-golang/internal/util/turn"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+var (
+	globalStorage Storage
+	storageOnce   sync.Once
+)
+
+// getStorage 按 recorder 配置初始化全局存储并启动过期清理, 未开启时返回 nil
+func getStorage() Storage {
+	storageOnce.Do(func() {
+		if !viper.GetBool("recorder.enable") {
+			return
+		}
+		switch viper.GetString("recorder.storage") {
+		case "s3":
+			var config S3Config
+			if err := viper.UnmarshalKey("recorder.s3", &config); err != nil {
+				log.Errorf("解析录音 S3 配置失败: %v", err)
+				return
+			}
+			storage, err := NewS3Storage(config)
+			if err != nil {
+				log.Errorf("初始化录音 S3 存储失败: %v", err)
+				return
+			}
+			globalStorage = storage
+		default:
+			dir := viper.GetString("recorder.local.dir")
+			if dir == "" {
+				dir = "./recordings"
+			}
+			globalStorage = NewLocalStorage(dir)
+		}
+
+		if days := viper.GetInt("recorder.retention_days"); days > 0 {
+			go runRetention(globalStorage, time.Duration(days)*24*time.Hour)
+		}
+		log.Infof("会话录音已开启, 存储: %s", viper.GetString("recorder.storage"))
+	})
+	return globalStorage
+}
+
+// runRetention 每小时删除一次超出保留期的录音
+func runRetention(storage Storage, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		if err := storage.DeleteBefore(ctx, time.Now().Add(-retention)); err != nil {
+			log.Warnf("清理过期录音失败: %v", err)
+		}
+		cancel()
+		<-ticker.C
+	}
+}
+
+// Enabled 是否开启了会话录音
+func Enabled() bool {
+	return getStorage() != nil
+}
+
+// DeleteDevice 删除设备的全部录音, 用于隐私删除, 未开启录音时不做任何事
+func DeleteDevice(ctx context.Context, deviceID string) error {
+	storage := getStorage()
+	if storage == nil {
+		return nil
+	}
+	if deviceID == "" {
+		return fmt.Errorf("设备ID为空")
+	}
+	return storage.DeletePrefix(ctx, sanitize(deviceID))
+}
+
+// SessionRecorder 按轮次录制一个会话的上行 PCM 和下行 Opus, 每轮保存为 WAV + Ogg-Opus + JSON
+// 未开启录音时会话持有的是 nil, 此时各方法直接返回
+type SessionRecorder struct {
+	storage      Storage
+	deviceID     string
+	sessionID    string
+	inputFormat  audio.AudioFormat
+	outputFormat audio.AudioFormat
+
+	turns *turn.Collector[recording]
+}
+
+// recording 一轮的录音内容
+type recording struct {
+	startTime     time.Time
+	input         []float32
+	output        [][]byte
+	asrText       string
+	replyText     strings.Builder
+	asrResultTime time.Time
+	firstAudio    time.Time
+}
+
+// Metadata 每轮录音的 JSON 说明文件
+type Metadata struct {
+	DeviceID         string    `json:"device_id"`
+	SessionID        string    `json:"session_id"`
+	Turn             int       `json:"turn"`
+	StartTime        time.Time `json:"start_time"`
+	AsrText          string    `json:"asr_text"`
+	LlmText          string    `json:"llm_text"`
+	InputFile        string    `json:"input_file,omitempty"`
+	OutputFile       string    `json:"output_file,omitempty"`
+	InputDurationMs  int64     `json:"input_duration_ms"`
+	OutputDurationMs int64     `json:"output_duration_ms"`
+	// 以下时间均相对于本轮开始, 单位毫秒, 0 表示未发生
+	AsrResultMs  int64 `json:"asr_result_ms"`
+	FirstAudioMs int64 `json:"first_audio_ms"`
+	EndMs        int64 `json:"end_ms"`
+}
+
+// NewSessionRecorder 创建会话录音, 未开启录音时返回 nil
+func NewSessionRecorder(deviceID string, sessionID string, inputFormat audio.AudioFormat, outputFormat audio.AudioFormat) *SessionRecorder {
+	storage := getStorage()
+	if storage == nil {
+		return nil
+	}
+	return newSessionRecorder(storage, deviceID, sessionID, inputFormat, outputFormat)
+}
+
+func newSessionRecorder(storage Storage, deviceID string, sessionID string, inputFormat audio.AudioFormat, outputFormat audio.AudioFormat) *SessionRecorder {
+	r := &SessionRecorder{
+		storage:      storage,
+		deviceID:     deviceID,
+		sessionID:    sessionID,
+		inputFormat:  inputFormat,
+		outputFormat: outputFormat,
+	}
+	r.turns = turn.NewCollector(
+		func() *recording { return &recording{startTime: time.Now()} },
+		// 只有上行音频的轮次是未识别出内容的噪音, 不保存
+		func(t *recording) bool { return t.asrText != "" || len(t.output) > 0 },
+		r.save,
+	)
+	return r
+}
+
+func (r *SessionRecorder) update(f func(t *recording)) {
+	if r == nil {
+		return
+	}
+	r.turns.Update(f)
+}
+
+// BeginTurn 开始新的一轮, 上一轮有内容时保存, 否则丢弃
+func (r *SessionRecorder) BeginTurn() {
+	r.EndTurn()
+}
+
+// EndTurn 结束并保存当前轮
+func (r *SessionRecorder) EndTurn() {
+	if r == nil {
+		return
+	}
+	r.turns.End()
+}
+
+// WriteInput 记录送入 ASR 的 PCM
+func (r *SessionRecorder) WriteInput(pcm []float32) {
+	r.update(func(t *recording) {
+		t.input = append(t.input, pcm...)
+	})
+}
+
+// WriteOutput 记录下发给设备的 Opus 帧
+func (r *SessionRecorder) WriteOutput(frame []byte) {
+	r.update(func(t *recording) {
+		if len(t.output) == 0 {
+			t.firstAudio = time.Now()
+		}
+		t.output = append(t.output, frame)
+	})
+}
+
+// SetAsrText 记录用户说的话(ASR 结果或文本消息)
+func (r *SessionRecorder) SetAsrText(text string) {
+	r.update(func(t *recording) {
+		t.asrText = text
+		t.asrResultTime = time.Now()
+	})
+}
+
+// AddReplyText 记录下发的回复文本
+func (r *SessionRecorder) AddReplyText(text string) {
+	r.update(func(t *recording) {
+		t.replyText.WriteString(text)
+	})
+}
+
+// save 异步编码并上传一轮录音
+func (r *SessionRecorder) save(index int, t *recording) {
+	go func() {
+		endTime := time.Now()
+		// 路径: 设备/日期/会话_轮次_文件
+		base := fmt.Sprintf("%s/%s/%s_%03d", sanitize(r.deviceID), t.startTime.Format("20060102"), sanitize(r.sessionID), index)
+		meta := Metadata{
+			DeviceID:     r.deviceID,
+			SessionID:    r.sessionID,
+			Turn:         index,
+			StartTime:    t.startTime,
+			AsrText:      t.asrText,
+			LlmText:      t.replyText.String(),
+			AsrResultMs:  sinceStart(t.startTime, t.asrResultTime),
+			FirstAudioMs: sinceStart(t.startTime, t.firstAudio),
+			EndMs:        endTime.Sub(t.startTime).Milliseconds(),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if len(t.input) > 0 && r.inputFormat.SampleRate > 0 {
+			meta.InputFile = base + "_input.wav"
+			channels := max(r.inputFormat.Channels, 1)
+			meta.InputDurationMs = int64(len(t.input)/channels) * 1000 / int64(r.inputFormat.SampleRate)
+			if err := r.storage.Put(ctx, meta.InputFile, util.EncodeWav(t.input, r.inputFormat.SampleRate, channels)); err != nil {
+				log.Warnf("保存录音失败: %s, %v", meta.InputFile, err)
+			}
+		}
+		if len(t.output) > 0 {
+			meta.OutputFile = base + "_output.ogg"
+			meta.OutputDurationMs = int64(len(t.output) * r.outputFormat.FrameDuration)
+			data := encodeOggOpus(t.output, r.outputFormat.SampleRate, max(r.outputFormat.Channels, 1), r.outputFormat.FrameDuration)
+			if err := r.storage.Put(ctx, meta.OutputFile, data); err != nil {
+				log.Warnf("保存录音失败: %s, %v", meta.OutputFile, err)
+			}
+		}
+
+		data, _ := json.MarshalIndent(meta, "", "  ")
+		if err := r.storage.Put(ctx, base+".json", data); err != nil {
+			log.Warnf("保存录音说明失败: %s.json, %v", base, err)
+		}
+	}()
+}
+
+func sinceStart(start time.Time, t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Sub(start).Milliseconds()
+}
+
+// sanitize 替换路径中不安全的字符, 设备ID通常为 MAC 地址
+func sanitize(s string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "-", "..", "_").Replace(s)
+}
@@ -0,0 +1,103 @@
+package recorder
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xiaozhi-esp32-server-golang/internal/data/audio"
+)
+
+func TestSessionRecorder(t *testing.T) {
+	dir := t.TempDir()
+	r := newSessionRecorder(NewLocalStorage(dir), "ba:8f:17:de:94:94", "session1",
+		audio.AudioFormat{SampleRate: 16000, Channels: 1, FrameDuration: 60},
+		audio.AudioFormat{SampleRate: 24000, Channels: 1, FrameDuration: 20})
+
+	// 没有内容的轮次不保存
+	r.BeginTurn()
+	r.WriteInput(make([]float32, 1600))
+	r.BeginTurn()
+
+	r.WriteInput(make([]float32, 16000))
+	r.SetAsrText("今天天气怎么样")
+	r.AddReplyText("今天是晴天。")
+	for i := 0; i < 50; i++ {
+		r.WriteOutput([]byte{0xf8, byte(i)})
+	}
+	r.EndTurn()
+
+	base := filepath.Join(dir, "ba-8f-17-de-94-94", time.Now().Format("20060102"), "session1_001")
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(base + ".json")
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	var meta Metadata
+	data, err := os.ReadFile(base + ".json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &meta))
+	assert.Equal(t, 1, meta.Turn)
+	assert.Equal(t, "今天天气怎么样", meta.AsrText)
+	assert.Equal(t, "今天是晴天。", meta.LlmText)
+	assert.EqualValues(t, 1000, meta.InputDurationMs)
+	assert.EqualValues(t, 1000, meta.OutputDurationMs)
+
+	wav, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(meta.InputFile)))
+	require.NoError(t, err)
+	assert.Equal(t, "RIFF", string(wav[:4]))
+	assert.Equal(t, 44+16000*2, len(wav))
+
+	ogg, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(meta.OutputFile)))
+	require.NoError(t, err)
+	pages := readOggPages(t, ogg)
+	require.Len(t, pages, 52)
+	assert.Equal(t, "OpusHead", string(pages[0][:8]))
+	assert.Equal(t, "OpusTags", string(pages[1][:8]))
+	assert.Equal(t, []byte{0xf8, 49}, pages[51])
+}
+
+// readOggPages 解析并校验每一页, 返回各页的数据
+func readOggPages(t *testing.T, data []byte) [][]byte {
+	var pages [][]byte
+	for len(data) > 0 {
+		require.Equal(t, "OggS", string(data[:4]))
+		segments := int(data[26])
+		size := 0
+		for _, n := range data[27 : 27+segments] {
+			size += int(n)
+		}
+		pageLen := 27 + segments + size
+		page := append([]byte{}, data[:pageLen]...)
+		crc := binary.LittleEndian.Uint32(page[22:])
+		binary.LittleEndian.PutUint32(page[22:], 0)
+		require.Equal(t, crc, oggCrc(page))
+		pages = append(pages, data[27+segments:pageLen])
+		data = data[pageLen:]
+	}
+	return pages
+}
+
+func TestLocalStorageRetention(t *testing.T) {
+	dir := t.TempDir()
+	storage := NewLocalStorage(dir)
+	ctx := context.Background()
+	require.NoError(t, storage.Put(ctx, "a/20240101/old.json", []byte("{}")))
+	require.NoError(t, storage.Put(ctx, "a/20240102/new.json", []byte("{}")))
+
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "a/20240101/old.json"), old, old))
+
+	require.NoError(t, storage.DeleteBefore(ctx, time.Now().Add(-24*time.Hour)))
+	_, err := os.Stat(filepath.Join(dir, "a/20240101"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "a/20240102/new.json"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,239 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config S3 兼容存储(AWS S3/MinIO/OSS/COS 等)的配置
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"` // 如 https://s3.amazonaws.com, http://127.0.0.1:9000
+	Region    string `mapstructure:"region"`
+	Bucket    string `mapstructure:"bucket"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	Prefix    string `mapstructure:"prefix"`     // 对象键前缀
+	PathStyle bool   `mapstructure:"path_style"` // true: endpoint/bucket/key, false: bucket.endpoint/key
+}
+
+// S3Storage 通过 S3 API 保存录音, 使用 AWS Signature V4 签名
+type S3Storage struct {
+	config     S3Config
+	endpoint   *url.URL
+	httpClient *http.Client
+}
+
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("S3 endpoint 无效: %s", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket 不能为空")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+	return &S3Storage{
+		config:     config,
+		endpoint:   endpoint,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *S3Storage) objectKey(name string) string {
+	if s.config.Prefix == "" {
+		return name
+	}
+	return s.config.Prefix + "/" + name
+}
+
+// request 构造请求, key 为空时请求桶本身
+func (s *S3Storage) request(ctx context.Context, method string, key string, query url.Values, body []byte) (*http.Response, error) {
+	host := s.endpoint.Host
+	path := "/"
+	if s.config.PathStyle {
+		path += s.config.Bucket + "/"
+	} else {
+		host = s.config.Bucket + "." + host
+	}
+	path += key
+
+	u := url.URL{Scheme: s.endpoint.Scheme, Host: host, Path: path, RawPath: uriEncode(path, false)}
+	if len(query) > 0 {
+		u.RawQuery = canonicalQuery(query)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, uriEncode(path, false), query, body, time.Now().UTC())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("S3 %s %s 失败, status: %d, %s", method, key, resp.StatusCode, msg)
+	}
+	return resp, nil
+}
+
+// sign 按 AWS Signature V4 为请求签名
+func (s *S3Storage) sign(req *http.Request, canonicalURI string, query url.Values, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.config.Region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signedHeaders, signature))
+}
+
+func (s *S3Storage) Put(ctx context.Context, name string, data []byte) error {
+	resp, err := s.request(ctx, http.MethodPut, s.objectKey(name), nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// DeleteBefore 列出前缀下的对象并逐个删除过期对象, 也可以改用桶的生命周期规则
+func (s *S3Storage) DeleteBefore(ctx context.Context, t time.Time) error {
+	return s.deleteObjects(ctx, s.objectKey(""), func(lastModified time.Time) bool {
+		return lastModified.Before(t)
+	})
+}
+
+// DeletePrefix 删除 prefix 下的全部对象
+func (s *S3Storage) DeletePrefix(ctx context.Context, prefix string) error {
+	return s.deleteObjects(ctx, s.objectKey(strings.TrimSuffix(prefix, "/")+"/"), func(time.Time) bool {
+		return true
+	})
+}
+
+// deleteObjects 分页列出 keyPrefix 下的对象, 删除 match 返回 true 的对象
+func (s *S3Storage) deleteObjects(ctx context.Context, keyPrefix string, match func(lastModified time.Time) bool) error {
+	var token string
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if keyPrefix != "" {
+			query.Set("prefix", keyPrefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.request(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("解析S3对象列表失败: %v", err)
+		}
+
+		for _, object := range result.Contents {
+			if !match(object.LastModified) {
+				continue
+			}
+			resp, err := s.request(ctx, http.MethodDelete, object.Key, nil, nil)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// uriEncode 按 S3 签名规则编码, 仅保留非保留字符
+func uriEncode(s string, encodeSlash bool) string {
+	var buf strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			buf.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			buf.WriteByte(b)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", b)
+		}
+	}
+	return buf.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, uriEncode(k, true)+"="+uriEncode(query.Get(k), true))
+	}
+	return strings.Join(parts, "&")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
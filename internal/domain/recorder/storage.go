@@ -0,0 +1,72 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Storage 录音存储
+type Storage interface {
+	// Put 保存文件, name 为以 / 分隔的相对路径
+	Put(ctx context.Context, name string, data []byte) error
+	// DeleteBefore 删除修改时间早于 t 的文件, 用于保留策略
+	DeleteBefore(ctx context.Context, t time.Time) error
+	// DeletePrefix 删除 prefix 目录下的全部文件, 用于按设备删除录音
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// LocalStorage 保存到本地目录
+type LocalStorage struct {
+	dir string
+}
+
+func NewLocalStorage(dir string) *LocalStorage {
+	return &LocalStorage{dir: dir}
+}
+
+func (s *LocalStorage) Put(ctx context.Context, name string, data []byte) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建录音目录失败: %v", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (s *LocalStorage) DeleteBefore(ctx context.Context, t time.Time) error {
+	var dirs []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != s.dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().Before(t) {
+			os.Remove(path)
+		}
+		return ctx.Err()
+	})
+	// 从最深的目录开始删除空目录, 非空目录删除会失败
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return err
+}
+
+func (s *LocalStorage) DeletePrefix(ctx context.Context, prefix string) error {
+	return os.RemoveAll(filepath.Join(s.dir, filepath.FromSlash(prefix)))
+}
@@ -5,10 +5,15 @@ import (
 	"fmt"
 
 	"xiaozhi-esp32-server-golang/constants"
+	"xiaozhi-esp32-server-golang/internal/domain/tts/cache"
+	tts_common "xiaozhi-esp32-server-golang/internal/domain/tts/common"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/cosyvoice"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/doubao"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/edge"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/edge_offline"
+	"xiaozhi-esp32-server-golang/internal/domain/tts/failover"
+	"xiaozhi-esp32-server-golang/internal/domain/tts/mock"
+	"xiaozhi-esp32-server-golang/internal/domain/tts/openai"
 	"xiaozhi-esp32-server-golang/internal/domain/tts/xiaozhi"
 )
 
@@ -23,8 +28,27 @@ type TTSProvider interface {
 	BaseTTSProvider
 }
 
-// GetTTSProvider 获取一个完整的TTS提供者（支持Context）
+// StreamingInputProvider 支持流式输入文本的TTS提供者, LLM 输出的 token 可直接送入合成
+type StreamingInputProvider interface {
+	SupportStreamingInput() bool
+	StartSession(ctx context.Context, sampleRate int, channels int, frameDuration int) (tts_common.StreamingSession, error)
+}
+
+// GetStreamingInputProvider 获取提供者的流式输入能力, 未开启或不支持时返回 false
+func GetStreamingInputProvider(provider TTSProvider) (StreamingInputProvider, bool) {
+	adapter, ok := provider.(*ContextTTSAdapter)
+	if !ok || adapter.streaming == nil {
+		return nil, false
+	}
+	return adapter.streaming, true
+}
+
+// GetTTSProvider 获取一个完整的TTS提供者（支持Context）, 开启 tts_cache 时带缓存
 func GetTTSProvider(providerName string, config map[string]interface{}) (TTSProvider, error) {
+	return newTTSProvider(providerName, config, true)
+}
+
+func newTTSProvider(providerName string, config map[string]interface{}, withCache bool) (TTSProvider, error) {
 	var baseProvider BaseTTSProvider
 
 	switch providerName {
@@ -40,18 +64,42 @@ func GetTTSProvider(providerName string, config map[string]interface{}) (TTSProv
 		baseProvider = edge_offline.NewEdgeOfflineTTSProvider(config)
 	case constants.TtsTypeXiaozhi:
 		baseProvider = xiaozhi.NewXiaozhiProvider(config)
+	case constants.TtsTypeOpenAI:
+		baseProvider = openai.NewOpenAITTSProvider(config)
+	case constants.TtsTypeMock:
+		baseProvider = mock.NewMockTTSProvider(config)
+	case constants.TtsTypeFailover:
+		// 故障转移链, 成员不单独缓存, 由链整体缓存
+		provider, err := failover.NewFailoverTTSProvider(config, func(provider string, memberConfig map[string]interface{}) (failover.Provider, error) {
+			return newTTSProvider(provider, memberConfig, false)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("创建TTS链失败: %v", err)
+		}
+		baseProvider = provider
 	default:
 		return nil, fmt.Errorf("不支持的TTS提供者: %s", providerName)
 	}
 
+	// 流式输入不经过缓存
+	var streaming StreamingInputProvider
+	if p, ok := baseProvider.(StreamingInputProvider); ok && p.SupportStreamingInput() {
+		streaming = p
+	}
+
+	if withCache {
+		baseProvider = cache.Wrap(providerName, config, baseProvider)
+	}
+
 	// 使用适配器包装基础提供者，转换为完整的TTSProvider
-	provider := &ContextTTSAdapter{baseProvider}
+	provider := &ContextTTSAdapter{Provider: baseProvider, streaming: streaming}
 	return provider, nil
 }
 
 // ContextTTSAdapter 是一个适配器，为基础TTS提供者添加Context支持
 type ContextTTSAdapter struct {
-	Provider BaseTTSProvider
+	Provider  BaseTTSProvider
+	streaming StreamingInputProvider
 }
 
 // TextToSpeech 代理到原始提供者
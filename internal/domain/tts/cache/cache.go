@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	i_redis "xiaozhi-esp32-server-golang/internal/db/redis"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+// Provider 与 tts.BaseTTSProvider 一致, 单独定义以避免循环引用
+type Provider interface {
+	TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error)
+	TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (outputChan chan []byte, err error)
+}
+
+// Store 缓存存储, 保存一句话的 Opus 帧序列
+type Store interface {
+	Get(ctx context.Context, key string) ([][]byte, bool)
+	Set(ctx context.Context, key string, frames [][]byte) error
+}
+
+var (
+	globalStore Store
+	storeOnce   sync.Once
+)
+
+// getStore 按 tts_cache 配置初始化全局存储, 未开启时返回 nil
+func getStore() Store {
+	storeOnce.Do(func() {
+		if !viper.GetBool("tts_cache.enable") {
+			return
+		}
+		ttl := time.Duration(viper.GetInt("tts_cache.ttl_hours")) * time.Hour
+		switch viper.GetString("tts_cache.store") {
+		case "redis":
+			client := i_redis.GetClient()
+			if client == nil {
+				log.Warnf("TTS缓存使用 redis 存储, 但 redis 未初始化, 缓存不生效")
+				return
+			}
+			globalStore = NewRedisStore(client, viper.GetString("redis.key_prefix"), ttl)
+		default:
+			dir := viper.GetString("tts_cache.dir")
+			if dir == "" {
+				dir = "./cache/tts"
+			}
+			maxEntries := viper.GetInt("tts_cache.max_entries")
+			if maxEntries <= 0 {
+				maxEntries = 1000
+			}
+			store, err := NewDiskStore(dir, maxEntries, ttl)
+			if err != nil {
+				log.Errorf("初始化TTS磁盘缓存失败: %v", err)
+				return
+			}
+			globalStore = store
+		}
+		log.Infof("TTS缓存已开启, 存储: %s", viper.GetString("tts_cache.store"))
+	})
+	return globalStore
+}
+
+// Wrap 开启 tts_cache 时为提供者包装缓存层, 否则原样返回
+func Wrap(name string, config map[string]interface{}, provider Provider) Provider {
+	store := getStore()
+	if store == nil {
+		return provider
+	}
+	maxTextLength := viper.GetInt("tts_cache.max_text_length")
+	if maxTextLength <= 0 {
+		maxTextLength = 50
+	}
+	return NewCachedTTSProvider(name, config, provider, store, maxTextLength)
+}
+
+// CachedTTSProvider 缓存短文本的合成结果, 命中时按实时节奏回放
+type CachedTTSProvider struct {
+	provider      Provider
+	store         Store
+	name          string
+	configDigest  string // 提供者配置(音色/语速等)的摘要
+	maxTextLength int
+}
+
+// NewCachedTTSProvider 创建缓存层, 只缓存不超过 maxTextLength 个字的文本
+func NewCachedTTSProvider(name string, config map[string]interface{}, provider Provider, store Store, maxTextLength int) *CachedTTSProvider {
+	// fmt 输出 map 时按键排序, 结果稳定
+	digest := sha256.Sum256([]byte(fmt.Sprintf("%v", config)))
+	return &CachedTTSProvider{
+		provider:      provider,
+		store:         store,
+		name:          name,
+		configDigest:  hex.EncodeToString(digest[:]),
+		maxTextLength: maxTextLength,
+	}
+}
+
+func (p *CachedTTSProvider) key(text string, sampleRate int, channels int, frameDuration int) string {
+	digest := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%d|%d|%s", p.name, p.configDigest, sampleRate, channels, frameDuration, text)))
+	return hex.EncodeToString(digest[:])
+}
+
+func (p *CachedTTSProvider) cacheable(text string) bool {
+	length := len([]rune(text))
+	return length > 0 && length <= p.maxTextLength
+}
+
+// lookup 查询缓存并记录命中统计
+func (p *CachedTTSProvider) lookup(ctx context.Context, key string, text string) ([][]byte, bool) {
+	frames, ok := p.store.Get(ctx, key)
+	if !ok || len(frames) == 0 {
+		metrics.TtsCacheRequests.WithLabelValues(p.name, "miss").Inc()
+		return nil, false
+	}
+	metrics.TtsCacheRequests.WithLabelValues(p.name, "hit").Inc()
+	metrics.TtsCacheSavedChars.WithLabelValues(p.name).Add(float64(len([]rune(text))))
+	log.Debugf("TTS缓存命中: %s", text)
+	return frames, true
+}
+
+func (p *CachedTTSProvider) save(key string, text string, frames [][]byte) {
+	// 会话结束后 ctx 会被取消, 写入使用独立的 ctx
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.store.Set(ctx, key, frames); err != nil {
+		log.Warnf("写入TTS缓存失败: %s, %v", text, err)
+	}
+}
+
+// TextToSpeech 命中缓存时直接返回全部帧
+func (p *CachedTTSProvider) TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
+	if !p.cacheable(text) {
+		return p.provider.TextToSpeech(ctx, text, sampleRate, channels, frameDuration)
+	}
+	key := p.key(text, sampleRate, channels, frameDuration)
+	if frames, ok := p.lookup(ctx, key, text); ok {
+		return frames, nil
+	}
+	frames, err := p.provider.TextToSpeech(ctx, text, sampleRate, channels, frameDuration)
+	if err == nil && len(frames) > 0 {
+		p.save(key, text, frames)
+	}
+	return frames, err
+}
+
+// TextToSpeechStream 命中缓存时按帧时长回放, 未命中时边转发边收集, 完整合成后写入缓存
+func (p *CachedTTSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	if !p.cacheable(text) {
+		return p.provider.TextToSpeechStream(ctx, text, sampleRate, channels, frameDuration)
+	}
+	key := p.key(text, sampleRate, channels, frameDuration)
+	if frames, ok := p.lookup(ctx, key, text); ok {
+		return replay(ctx, frames, frameDuration), nil
+	}
+
+	stream, err := p.provider.TextToSpeechStream(ctx, text, sampleRate, channels, frameDuration)
+	if err != nil {
+		return nil, err
+	}
+	outputChan := make(chan []byte, 10)
+	go func() {
+		defer close(outputChan)
+		var frames [][]byte
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case frame, ok := <-stream:
+				if !ok {
+					// 被取消的合成结果不完整, 不写入缓存
+					if ctx.Err() == nil && len(frames) > 0 {
+						p.save(key, text, frames)
+					}
+					return
+				}
+				frames = append(frames, frame)
+				select {
+				case outputChan <- frame:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return outputChan, nil
+}
+
+// replay 首帧立即输出, 之后每隔一个帧时长输出一帧, 与实时合成的节奏一致
+func replay(ctx context.Context, frames [][]byte, frameDuration int) chan []byte {
+	outputChan := make(chan []byte, 10)
+	go func() {
+		defer close(outputChan)
+		ticker := time.NewTicker(time.Duration(frameDuration) * time.Millisecond)
+		defer ticker.Stop()
+		for i, frame := range frames {
+			if i > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+			select {
+			case outputChan <- frame:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return outputChan
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xiaozhi-esp32-server-golang/internal/domain/tts/mock"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
+)
+
+// countingProvider 记录实际合成次数
+type countingProvider struct {
+	*mock.MockTTSProvider
+	calls int32
+}
+
+func (p *countingProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	atomic.AddInt32(&p.calls, 1)
+	return p.MockTTSProvider.TextToSpeechStream(ctx, text, sampleRate, channels, frameDuration)
+}
+
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	var m dto.Metric
+	require.NoError(t, counter.Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+func collect(t *testing.T, p *CachedTTSProvider, text string) [][]byte {
+	ch, err := p.TextToSpeechStream(context.Background(), text, 16000, 1, 20)
+	require.NoError(t, err)
+	var frames [][]byte
+	for frame := range ch {
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func TestCachedTTSProvider(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), 10, time.Hour)
+	require.NoError(t, err)
+	provider := &countingProvider{MockTTSProvider: mock.NewMockTTSProvider(map[string]interface{}{"ms_per_char": 100})}
+	p := NewCachedTTSProvider("cache_test", map[string]interface{}{"voice": "a"}, provider, store, 5)
+
+	first := collect(t, p, "你好")
+	require.Len(t, first, 10)
+
+	// 命中缓存时不再合成, 并按 20ms 一帧回放
+	start := time.Now()
+	second := collect(t, p, "你好")
+	assert.Equal(t, first, second)
+	assert.GreaterOrEqual(t, time.Since(start), 9*20*time.Millisecond)
+	assert.EqualValues(t, 1, provider.calls)
+
+	// 超过长度上限的文本不缓存
+	collect(t, p, "一二三四五六")
+	collect(t, p, "一二三四五六")
+	assert.EqualValues(t, 3, provider.calls)
+
+	assert.Equal(t, 1.0, counterValue(t, metrics.TtsCacheRequests.WithLabelValues("cache_test", "hit")))
+	assert.Equal(t, 1.0, counterValue(t, metrics.TtsCacheRequests.WithLabelValues("cache_test", "miss")))
+	assert.Equal(t, 2.0, counterValue(t, metrics.TtsCacheSavedChars.WithLabelValues("cache_test")))
+
+	// 音色不同的配置不共享缓存
+	other := NewCachedTTSProvider("cache_test", map[string]interface{}{"voice": "b"}, provider, store, 5)
+	collect(t, other, "你好")
+	assert.EqualValues(t, 4, provider.calls)
+}
+
+func TestDiskStoreLRU(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store, err := NewDiskStore(dir, 2, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Set(ctx, "a", [][]byte{{1}, {2, 3}}))
+	require.NoError(t, store.Set(ctx, "b", [][]byte{{4}}))
+	_, ok := store.Get(ctx, "a")
+	require.True(t, ok)
+	require.NoError(t, store.Set(ctx, "c", [][]byte{{5}}))
+
+	// b 最久未使用, 被淘汰
+	_, ok = store.Get(ctx, "b")
+	assert.False(t, ok)
+
+	// 重新加载目录后缓存仍然可用
+	reloaded, err := NewDiskStore(dir, 2, 0)
+	require.NoError(t, err)
+	frames, ok := reloaded.Get(ctx, "a")
+	require.True(t, ok)
+	assert.Equal(t, [][]byte{{1}, {2, 3}}, frames)
+	_, ok = reloaded.Get(ctx, "c")
+	assert.True(t, ok)
+}
+
+func TestDiskStoreTTLRefreshedOnGet(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	store, err := NewDiskStore(dir, 0, time.Hour)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Set(ctx, "a", [][]byte{{1}}))
+	old := time.Now().Add(-50 * time.Minute)
+	require.NoError(t, os.Chtimes(store.path("a"), old, old))
+
+	// 命中后修改时间被刷新, 不会在写入一小时后过期
+	_, ok := store.Get(ctx, "a")
+	require.True(t, ok)
+	info, err := os.Stat(store.path("a"))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), info.ModTime(), time.Minute)
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const fileSuffix = ".opus"
+
+// encodeFrames 按 长度(4字节)+数据 依次拼接各帧
+func encodeFrames(frames [][]byte) []byte {
+	size := 0
+	for _, frame := range frames {
+		size += 4 + len(frame)
+	}
+	data := make([]byte, 0, size)
+	for _, frame := range frames {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(frame)))
+		data = append(data, frame...)
+	}
+	return data
+}
+
+func decodeFrames(data []byte) ([][]byte, error) {
+	var frames [][]byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("缓存数据不完整")
+		}
+		n := int(binary.BigEndian.Uint32(data))
+		data = data[4:]
+		if len(data) < n {
+			return nil, errors.New("缓存数据不完整")
+		}
+		frames = append(frames, data[:n])
+		data = data[n:]
+	}
+	return frames, nil
+}
+
+// DiskStore 磁盘缓存, 每句话一个文件, 超过 maxEntries 时淘汰最久未使用的
+type DiskStore struct {
+	dir        string
+	maxEntries int
+	ttl        time.Duration
+
+	mu      sync.Mutex
+	lru     *list.List // 队首为最近使用
+	entries map[string]*list.Element
+}
+
+// NewDiskStore 创建磁盘缓存并加载目录中已有的缓存文件, ttl 为 0 表示不过期
+func NewDiskStore(dir string, maxEntries int, ttl time.Duration) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %v", err)
+	}
+	s := &DiskStore{
+		dir:        dir,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取缓存目录失败: %v", err)
+	}
+	type cached struct {
+		key     string
+		modTime time.Time
+	}
+	var existing []cached
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), fileSuffix) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		existing = append(existing, cached{strings.TrimSuffix(file.Name(), fileSuffix), info.ModTime()})
+	}
+	// 按修改时间从旧到新放入队首, 最新的排在最前
+	sort.Slice(existing, func(i, j int) bool { return existing[i].modTime.Before(existing[j].modTime) })
+	for _, c := range existing {
+		s.entries[c.key] = s.lru.PushFront(c.key)
+	}
+	s.evict()
+	return s, nil
+}
+
+func (s *DiskStore) path(key string) string {
+	return filepath.Join(s.dir, key+fileSuffix)
+}
+
+func (s *DiskStore) Get(ctx context.Context, key string) ([][]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	path := s.path(key)
+	if s.ttl > 0 {
+		if info, err := os.Stat(path); err != nil || time.Since(info.ModTime()) > s.ttl {
+			s.remove(elem)
+			return nil, false
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.remove(elem)
+		return nil, false
+	}
+	frames, err := decodeFrames(data)
+	if err != nil {
+		s.remove(elem)
+		return nil, false
+	}
+	// 命中时刷新修改时间, 使 ttl 与重启后的 lru 顺序按最近使用计算
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	s.lru.MoveToFront(elem)
+	return frames, true
+}
+
+func (s *DiskStore) Set(ctx context.Context, key string, frames [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 先写临时文件再重命名, 避免读到写了一半的文件
+	tmp := s.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, encodeFrames(frames), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path(key)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if elem, ok := s.entries[key]; ok {
+		s.lru.MoveToFront(elem)
+	} else {
+		s.entries[key] = s.lru.PushFront(key)
+	}
+	s.evict()
+	return nil
+}
+
+// evict 淘汰超出数量上限的缓存, 调用方需持有锁
+func (s *DiskStore) evict() {
+	for s.maxEntries > 0 && s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *DiskStore) remove(elem *list.Element) {
+	key := elem.Value.(string)
+	s.lru.Remove(elem)
+	delete(s.entries, key)
+	os.Remove(s.path(key))
+}
+
+// RedisStore redis 缓存, 过期由 ttl 控制, 容量淘汰依赖 redis 的 maxmemory-policy(如 allkeys-lru)
+type RedisStore struct {
+	client    *redis.Client
+	keyPrefix string
+	ttl       time.Duration
+}
+
+// NewRedisStore 创建 redis 缓存, ttl 为 0 表示不过期
+func NewRedisStore(client *redis.Client, keyPrefix string, ttl time.Duration) *RedisStore {
+	return &RedisStore{
+		client:    client,
+		keyPrefix: keyPrefix,
+		ttl:       ttl,
+	}
+}
+
+func (s *RedisStore) redisKey(key string) string {
+	return fmt.Sprintf("%s:tts_cache:%s", s.keyPrefix, key)
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([][]byte, bool) {
+	data, err := s.client.Get(ctx, s.redisKey(key)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	frames, err := decodeFrames(data)
+	if err != nil {
+		return nil, false
+	}
+	return frames, true
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, frames [][]byte) error {
+	return s.client.Set(ctx, s.redisKey(key), encodeFrames(frames), s.ttl).Err()
+}
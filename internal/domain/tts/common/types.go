@@ -0,0 +1,64 @@
+package common
+
+import (
+	"sync"
+	"unicode"
+)
+
+// StreamingSession 流式输入的合成会话, 文本可在生成过程中逐段追加
+type StreamingSession interface {
+	// AppendText 追加文本, 可以是 LLM 输出的单个 token
+	AppendText(text string) error
+	// Finish 结束文本输入, 剩余文本合成完成后关闭音频通道
+	Finish() error
+	// OpusChan 合成的 Opus 帧, 会话结束或出错时关闭
+	OpusChan() chan []byte
+	// TextOffset 第 frame 帧(从 0 开始)音频所在的文本位置, 即之前已合成的字数(按 CountChars 计)
+	// 用于字幕按帧与音频对齐
+	TextOffset(frame int) int
+	// Close 立即结束会话并释放连接
+	Close()
+}
+
+// CountChars 只计文字和数字, 标点、空白由各家 TTS 处理方式不同, 不参与对齐
+func CountChars(text string) int {
+	count := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// TextOffsets 记录每段文本的音频起始帧, 供 StreamingSession 实现 TextOffset
+type TextOffsets struct {
+	mu    sync.Mutex
+	marks []textMark
+}
+
+type textMark struct {
+	frame  int
+	offset int
+}
+
+// Mark 从第 frame 帧开始是 offset 字之后的文本的音频, frame 需按调用顺序递增
+func (t *TextOffsets) Mark(frame int, offset int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.marks = append(t.marks, textMark{frame: frame, offset: offset})
+}
+
+// TextOffset 第 frame 帧所在的文本位置, 没有标记时为 0
+func (t *TextOffsets) TextOffset(frame int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	offset := 0
+	for _, mark := range t.marks {
+		if mark.frame > frame {
+			break
+		}
+		offset = mark.offset
+	}
+	return offset
+}
@@ -0,0 +1,393 @@
+package doubao
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	tts_common "xiaozhi-esp32-server-golang/internal/domain/tts/common"
+	"xiaozhi-esp32-server-golang/internal/util"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/gopxl/beep"
+	"github.com/gorilla/websocket"
+)
+
+// 双向流式接口 (v3) 的事件
+const (
+	eventStartConnection    int32 = 1
+	eventFinishConnection   int32 = 2
+	eventConnectionStarted  int32 = 50
+	eventConnectionFailed   int32 = 51
+	eventConnectionFinished int32 = 52
+	eventStartSession       int32 = 100
+	eventFinishSession      int32 = 102
+	eventSessionStarted     int32 = 150
+	eventSessionCanceled    int32 = 151
+	eventSessionFinished    int32 = 152
+	eventSessionFailed      int32 = 153
+	eventTaskRequest        int32 = 200
+	eventTTSSentenceStart   int32 = 350
+	eventTTSSentenceEnd     int32 = 351
+	eventTTSResponse        int32 = 352
+)
+
+const (
+	bidirectionPath   = "/api/v3/tts/bidirection"
+	defaultResourceID = "volc.service_type.10029"
+	msgTypeFullClient = 0x1
+	msgTypeError      = 0xf
+	msgFlagWithEvent  = 0x4
+)
+
+// bidirectionMessage 双向流式接口的二进制帧
+type bidirectionMessage struct {
+	msgType   byte
+	event     int32
+	sessionID string
+	errorCode uint32
+	payload   []byte
+}
+
+// 连接级别的事件不携带 session id
+func isConnectionEvent(event int32) bool {
+	switch event {
+	case eventStartConnection, eventFinishConnection, eventConnectionStarted, eventConnectionFailed, eventConnectionFinished:
+		return true
+	}
+	return false
+}
+
+// encodeBidirectionMessage 编码客户端请求: 头部 + 事件 + session id + payload, JSON 不压缩
+func encodeBidirectionMessage(event int32, sessionID string, payload []byte) []byte {
+	buf := bytes.NewBuffer([]byte{0x11, msgTypeFullClient<<4 | msgFlagWithEvent, 0x10, 0x00})
+	binary.Write(buf, binary.BigEndian, event)
+	if !isConnectionEvent(event) {
+		binary.Write(buf, binary.BigEndian, uint32(len(sessionID)))
+		buf.WriteString(sessionID)
+	}
+	binary.Write(buf, binary.BigEndian, uint32(len(payload)))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// decodeBidirectionMessage 解析服务端消息
+func decodeBidirectionMessage(data []byte) (*bidirectionMessage, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("消息长度不足: %d", len(data))
+	}
+	msg := &bidirectionMessage{msgType: data[1] >> 4}
+	flags := data[1] & 0x0f
+	compression := data[2] & 0x0f
+	r := bytes.NewReader(data[int(data[0]&0x0f)*4:])
+
+	readString := func() (string, error) {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return "", err
+		}
+		if int(size) > r.Len() {
+			return "", fmt.Errorf("字段长度超出消息: %d", size)
+		}
+		b := make([]byte, size)
+		_, err := io.ReadFull(r, b)
+		return string(b), err
+	}
+
+	var err error
+	if msg.msgType == msgTypeError {
+		if err = binary.Read(r, binary.BigEndian, &msg.errorCode); err != nil {
+			return nil, fmt.Errorf("解析错误码失败: %v", err)
+		}
+	}
+	// 带序号的消息
+	if flags == 0x1 || flags == 0x3 {
+		var sequence int32
+		if err = binary.Read(r, binary.BigEndian, &sequence); err != nil {
+			return nil, fmt.Errorf("解析序号失败: %v", err)
+		}
+	}
+	if flags == msgFlagWithEvent {
+		if err = binary.Read(r, binary.BigEndian, &msg.event); err != nil {
+			return nil, fmt.Errorf("解析事件失败: %v", err)
+		}
+		if !isConnectionEvent(msg.event) {
+			if msg.sessionID, err = readString(); err != nil {
+				return nil, fmt.Errorf("解析session id失败: %v", err)
+			}
+		} else if msg.event != eventStartConnection && msg.event != eventFinishConnection {
+			// ConnectionStarted 等事件携带 connect id
+			if _, err = readString(); err != nil {
+				return nil, fmt.Errorf("解析connect id失败: %v", err)
+			}
+		}
+	}
+	payload, err := readString()
+	if err != nil {
+		return nil, fmt.Errorf("解析payload失败: %v", err)
+	}
+	msg.payload = []byte(payload)
+	if compression == 1 {
+		msg.payload = gzipDecompress(msg.payload)
+	}
+	return msg, nil
+}
+
+// SupportStreamingInput 开启 bidirectional 时支持流式输入文本
+func (p *DoubaoWSProvider) SupportStreamingInput() bool {
+	return p.Bidirectional
+}
+
+// StartSession 建立双向流式合成会话, 返回时服务端已就绪可以接收文本
+func (p *DoubaoWSProvider) StartSession(ctx context.Context, sampleRate int, channels int, frameDuration int) (tts_common.StreamingSession, error) {
+	wsURL := url.URL{Scheme: wsScheme, Host: p.WSHost, Path: bidirectionPath}
+	header := http.Header{}
+	header.Set("X-Api-App-Key", p.AppID)
+	header.Set("X-Api-Access-Key", p.AccessToken)
+	header.Set("X-Api-Resource-Id", p.ResourceID)
+	header.Set("X-Api-Connect-Id", generateUUID())
+
+	conn, _, err := wsDialer.DialContext(ctx, wsURL.String(), header)
+	if err != nil {
+		return nil, fmt.Errorf("连接双向流式接口失败: %v", err)
+	}
+	conn.SetReadLimit(1024 * 1024)
+
+	s := &bidirectionSession{
+		ctx:        ctx,
+		conn:       conn,
+		sessionID:  generateUUID(),
+		speaker:    p.Voice,
+		sampleRate: sampleRate,
+		frameBytes: max(sampleRate*frameDuration/1000*2, 1),
+		outputChan: make(chan []byte, 1000),
+		doneChan:   make(chan struct{}),
+	}
+	// ctx 取消时关闭连接, 结束握手或读取
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.doneChan:
+		}
+	}()
+	if err := s.handshake(); err != nil {
+		s.Close()
+		close(s.doneChan)
+		return nil, err
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	decoder, err := util.CreateAudioDecoderWithSampleRate(ctx, pipeReader, s.outputChan, frameDuration, "pcm", sampleRate)
+	if err != nil {
+		s.Close()
+		close(s.doneChan)
+		return nil, fmt.Errorf("创建音频解码器失败: %v", err)
+	}
+	decoder.WithFormat(beep.Format{
+		SampleRate:  beep.SampleRate(sampleRate),
+		NumChannels: 1,
+		Precision:   2,
+	})
+	startTs := time.Now().UnixMilli()
+	go func() {
+		if err := decoder.Run(startTs); err != nil {
+			log.Errorf("双向流式合成音频解码失败: %v", err)
+		}
+		// 解码器提前退出时, 避免写入方阻塞
+		pipeReader.Close()
+	}()
+	go s.readLoop(pipeWriter)
+	return s, nil
+}
+
+// bidirectionSession 双向流式合成会话, 每个会话独占一个连接
+type bidirectionSession struct {
+	ctx        context.Context
+	conn       *websocket.Conn
+	sessionID  string
+	speaker    string
+	sampleRate int
+	frameBytes int // 单声道 16 位 PCM 一帧的字节数
+	outputChan chan []byte
+	offsets    tts_common.TextOffsets
+
+	writeLock sync.Mutex
+	closeOnce sync.Once
+	doneChan  chan struct{} // 读取结束后关闭
+}
+
+func (s *bidirectionSession) reqParams(text string) map[string]interface{} {
+	params := map[string]interface{}{
+		"speaker": s.speaker,
+		"audio_params": map[string]interface{}{
+			"format":      "pcm",
+			"sample_rate": s.sampleRate,
+		},
+	}
+	if text != "" {
+		params["text"] = text
+	}
+	return params
+}
+
+func (s *bidirectionSession) send(event int32, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return s.conn.WriteMessage(websocket.BinaryMessage, encodeBidirectionMessage(event, s.sessionID, data))
+}
+
+// expect 读取消息直到收到期望的事件
+func (s *bidirectionSession) expect(event int32) error {
+	s.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("读取消息失败: %v", err)
+		}
+		msg, err := decodeBidirectionMessage(data)
+		if err != nil {
+			return err
+		}
+		switch {
+		case msg.event == event:
+			return nil
+		case msg.msgType == msgTypeError, msg.event == eventConnectionFailed, msg.event == eventSessionFailed:
+			return fmt.Errorf("服务端错误 (代码: %d): %s", msg.errorCode, msg.payload)
+		}
+	}
+}
+
+// handshake 建立连接和会话
+func (s *bidirectionSession) handshake() error {
+	if err := s.send(eventStartConnection, map[string]interface{}{}); err != nil {
+		return fmt.Errorf("发送StartConnection失败: %v", err)
+	}
+	if err := s.expect(eventConnectionStarted); err != nil {
+		return fmt.Errorf("建立连接失败: %v", err)
+	}
+	err := s.send(eventStartSession, map[string]interface{}{
+		"user":       map[string]interface{}{"uid": s.sessionID},
+		"event":      eventStartSession,
+		"namespace":  "BidirectionalTTS",
+		"req_params": s.reqParams(""),
+	})
+	if err != nil {
+		return fmt.Errorf("发送StartSession失败: %v", err)
+	}
+	if err := s.expect(eventSessionStarted); err != nil {
+		return fmt.Errorf("建立会话失败: %v", err)
+	}
+	return nil
+}
+
+// readLoop 接收音频写入解码器, 会话结束后关闭连接
+func (s *bidirectionSession) readLoop(pipeWriter *io.PipeWriter) {
+	defer close(s.doneChan)
+	defer s.Close()
+
+	chunkCount := 0
+	// 已写入解码器的 PCM 字节数和已开始合成的字数, 用于记录每句音频的起始帧
+	pcmBytes, chars := 0, 0
+	for {
+		// 文本由 LLM 逐步生成, 两次音频之间可能间隔较久
+		s.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if s.ctx.Err() == nil {
+				log.Errorf("双向流式合成读取消息失败: %v", err)
+			}
+			pipeWriter.CloseWithError(err)
+			return
+		}
+		msg, err := decodeBidirectionMessage(data)
+		if err != nil {
+			log.Errorf("双向流式合成解析消息失败: %v", err)
+			pipeWriter.CloseWithError(err)
+			return
+		}
+
+		switch {
+		case msg.msgType == msgTypeError || msg.event == eventSessionFailed:
+			err := fmt.Errorf("服务端错误 (代码: %d): %s", msg.errorCode, msg.payload)
+			log.Errorf("双向流式合成失败: %v", err)
+			pipeWriter.CloseWithError(err)
+			return
+		case msg.event == eventTTSSentenceStart:
+			s.offsets.Mark(pcmBytes/s.frameBytes, chars)
+			chars += tts_common.CountChars(sentenceText(msg.payload))
+		case msg.event == eventTTSResponse && len(msg.payload) > 0:
+			chunkCount++
+			if _, err := pipeWriter.Write(msg.payload); err != nil {
+				return
+			}
+			pcmBytes += len(msg.payload)
+		case msg.event == eventSessionFinished || msg.event == eventSessionCanceled:
+			log.Debugf("双向流式合成会话结束，共%d个音频片段", chunkCount)
+			pipeWriter.Close()
+			s.send(eventFinishConnection, map[string]interface{}{})
+			return
+		}
+	}
+}
+
+// sentenceText 解析 TTSSentenceStart 中服务端分句后的文本
+func sentenceText(payload []byte) string {
+	var sentence struct {
+		Text      string `json:"text"`
+		ResParams struct {
+			Text string `json:"text"`
+		} `json:"res_params"`
+	}
+	if err := json.Unmarshal(payload, &sentence); err != nil {
+		return ""
+	}
+	if sentence.Text != "" {
+		return sentence.Text
+	}
+	return sentence.ResParams.Text
+}
+
+// AppendText 发送一段文本
+func (s *bidirectionSession) AppendText(text string) error {
+	if text == "" {
+		return nil
+	}
+	return s.send(eventTaskRequest, map[string]interface{}{
+		"user":       map[string]interface{}{"uid": s.sessionID},
+		"event":      eventTaskRequest,
+		"namespace":  "BidirectionalTTS",
+		"req_params": s.reqParams(text),
+	})
+}
+
+// Finish 结束文本输入, 服务端合成完剩余文本后返回 SessionFinished
+func (s *bidirectionSession) Finish() error {
+	return s.send(eventFinishSession, map[string]interface{}{})
+}
+
+func (s *bidirectionSession) OpusChan() chan []byte {
+	return s.outputChan
+}
+
+func (s *bidirectionSession) TextOffset(frame int) int {
+	return s.offsets.TextOffset(frame)
+}
+
+func (s *bidirectionSession) Close() {
+	s.closeOnce.Do(func() {
+		s.conn.Close()
+	})
+}
@@ -253,6 +253,9 @@ type DoubaoWSProvider struct {
 	WSURL       *url.URL
 	Header      http.Header
 	UseStream   bool // 是否使用流式合成
+	// 使用双向流式接口, 文本可边生成边合成
+	Bidirectional bool
+	ResourceID    string
 	// 音频片段处理回调函数，仅在流式模式下使用
 	OnAudioChunk func(chunkData []byte, isLast bool) error
 }
@@ -265,6 +268,11 @@ func NewDoubaoWSProvider(config map[string]interface{}) *DoubaoWSProvider {
 	voice, _ := config["voice"].(string)
 	wsHost, _ := config["ws_host"].(string)
 	useStream, _ := config["use_stream"].(bool)
+	bidirectional, _ := config["bidirectional"].(bool)
+	resourceID, _ := config["resource_id"].(string)
+	if resourceID == "" {
+		resourceID = defaultResourceID
+	}
 
 	// 如果没有指定WebSocket主机，使用默认值
 	if wsHost == "" {
@@ -292,6 +300,9 @@ func NewDoubaoWSProvider(config map[string]interface{}) *DoubaoWSProvider {
 		WSURL:       &wsURL,
 		Header:      header,
 		UseStream:   useStream,
+
+		Bidirectional: bidirectional,
+		ResourceID:    resourceID,
 	}
 }
 
@@ -0,0 +1,290 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"xiaozhi-esp32-server-golang/internal/util/breaker"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
+	log "xiaozhi-esp32-server-golang/logger"
+)
+
+const typeFailover = "failover"
+
+// Provider 与 tts.BaseTTSProvider 一致, 单独定义以避免循环引用
+type Provider interface {
+	TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error)
+	TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (outputChan chan []byte, err error)
+}
+
+// Factory 根据提供者类型和配置创建成员
+type Factory func(provider string, config map[string]interface{}) (Provider, error)
+
+type member struct {
+	name          string
+	provider      Provider
+	sampleRate    int // 成员实际输出的采样率, 0 表示与会话一致
+	frameDuration int // 成员实际输出的帧时长, 0 表示与会话一致
+	breaker       *breaker.Breaker
+}
+
+// FailoverTTSProvider 按顺序尝试多个 TTS, 首帧超时或出错时切换到下一个
+type FailoverTTSProvider struct {
+	members           []*member
+	firstFrameTimeout time.Duration
+}
+
+// NewFailoverTTSProvider 创建 TTS 故障转移链
+// 配置项: providers 成员列表; first_frame_timeout_ms 首帧超时; failure_threshold 熔断阈值; cooldown_seconds 熔断冷却时间
+func NewFailoverTTSProvider(config map[string]interface{}, factory Factory) (*FailoverTTSProvider, error) {
+	p := &FailoverTTSProvider{
+		firstFrameTimeout: 3 * time.Second,
+	}
+	if ms := getInt(config["first_frame_timeout_ms"]); ms > 0 {
+		p.firstFrameTimeout = time.Duration(ms) * time.Millisecond
+	}
+	threshold := 3
+	if n := getInt(config["failure_threshold"]); n > 0 {
+		threshold = n
+	}
+	cooldown := 30 * time.Second
+	if n := getInt(config["cooldown_seconds"]); n > 0 {
+		cooldown = time.Duration(n) * time.Second
+	}
+
+	items, _ := config["providers"].([]interface{})
+	for _, item := range items {
+		m := &member{}
+		var providerType string
+		var memberConfig map[string]interface{}
+		switch v := item.(type) {
+		case string:
+			m.name = v
+		case map[string]interface{}:
+			m.name, _ = v["name"].(string)
+			providerType, _ = v["provider"].(string)
+			memberConfig, _ = v["config"].(map[string]interface{})
+			m.sampleRate = getInt(v["sample_rate"])
+			m.frameDuration = getInt(v["frame_duration"])
+		}
+		if m.name == "" {
+			m.name = providerType
+		}
+		if m.name == "" {
+			continue
+		}
+		// 配置文件中 tts.<name> 的 name 即提供者类型
+		if providerType == "" {
+			providerType = m.name
+		}
+		if providerType == typeFailover {
+			return nil, fmt.Errorf("TTS链成员 %s 不能是 failover 类型", m.name)
+		}
+		if memberConfig == nil {
+			memberConfig = viper.GetStringMap("tts." + m.name)
+		}
+
+		provider, err := factory(providerType, memberConfig)
+		if err != nil {
+			return nil, fmt.Errorf("创建TTS链成员 %s 失败: %v", m.name, err)
+		}
+		m.provider = provider
+		m.breaker = breaker.Get("tts:"+m.name, threshold, cooldown)
+		p.members = append(p.members, m)
+	}
+	if len(p.members) == 0 {
+		return nil, errors.New("TTS链未配置可用的成员")
+	}
+	return p, nil
+}
+
+// candidates 熔断中的成员排在最后作为兜底
+func (p *FailoverTTSProvider) candidates() []*member {
+	var healthy, broken []*member
+	for _, m := range p.members {
+		if m.breaker.Allow() {
+			healthy = append(healthy, m)
+		} else {
+			broken = append(broken, m)
+		}
+	}
+	return append(healthy, broken...)
+}
+
+func (p *FailoverTTSProvider) onFailure(m *member, err error) {
+	metrics.IncProviderError("tts", m.name)
+	if m.breaker.Failure() {
+		log.Warnf("TTS链成员 %s 合成失败: %v, 已熔断", m.name, err)
+		return
+	}
+	log.Warnf("TTS链成员 %s 合成失败: %v", m.name, err)
+}
+
+// TextToSpeech 收集流式输出的全部帧
+func (p *FailoverTTSProvider) TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
+	outputChan, err := p.TextToSpeechStream(ctx, text, sampleRate, channels, frameDuration)
+	if err != nil {
+		return nil, err
+	}
+	var frames [][]byte
+	for frame := range outputChan {
+		frames = append(frames, frame)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+// TextToSpeechStream 依次尝试各成员直到收到首帧, 成员输出格式与会话不一致时按会话音频格式转码
+// 已开始输出音频后成员再出错不会切换, 避免同一句话重复播放
+func (p *FailoverTTSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	var lastErr error
+	for _, m := range p.candidates() {
+		memberRate, memberFrameDuration := sampleRate, frameDuration
+		if m.sampleRate > 0 {
+			memberRate = m.sampleRate
+		}
+		if m.frameDuration > 0 {
+			memberFrameDuration = m.frameDuration
+		}
+
+		memberCtx, cancel := context.WithCancel(ctx)
+		first, stream, err := p.start(memberCtx, m, text, memberRate, channels, memberFrameDuration)
+		if err != nil {
+			cancel()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			p.onFailure(m, err)
+			lastErr = err
+			continue
+		}
+		m.breaker.Success()
+
+		// 成员未配置输出格式时, 部分 TTS 会忽略请求的格式按自身固定格式输出, 以首帧的实际帧时长为准
+		// Opus 解码不依赖编码时的采样率, 采样率不一致时直接按会话采样率解码即可
+		if m.frameDuration == 0 {
+			if duration, ok := opusPacketDurationMs(first); ok {
+				memberFrameDuration = duration
+			}
+		}
+		var tc *transcoder
+		if memberRate != sampleRate || memberFrameDuration != frameDuration {
+			log.Debugf("TTS链成员 %s 输出 %dHz/%dms, 转码为 %dHz/%dms", m.name, memberRate, memberFrameDuration, sampleRate, frameDuration)
+			tc, err = newTranscoder(memberRate, memberFrameDuration, sampleRate, frameDuration, channels)
+			if err != nil {
+				cancel()
+				drain(stream)
+				return nil, err
+			}
+		}
+
+		outputChan := make(chan []byte, 10)
+		go func() {
+			defer cancel()
+			defer close(outputChan)
+			defer drain(stream)
+			forward(ctx, first, stream, tc, outputChan)
+		}()
+		return outputChan, nil
+	}
+	return nil, fmt.Errorf("TTS链所有成员均合成失败: %v", lastErr)
+}
+
+// start 请求成员并等待首帧
+func (p *FailoverTTSProvider) start(ctx context.Context, m *member, text string, sampleRate int, channels int, frameDuration int) ([]byte, chan []byte, error) {
+	stream, err := m.provider.TextToSpeechStream(ctx, text, sampleRate, channels, frameDuration)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timer := time.NewTimer(p.firstFrameTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		drain(stream)
+		return nil, nil, ctx.Err()
+	case <-timer.C:
+		drain(stream)
+		return nil, nil, fmt.Errorf("首帧超时(%v)", p.firstFrameTimeout)
+	case frame, ok := <-stream:
+		if !ok {
+			return nil, nil, errors.New("未返回任何音频")
+		}
+		return frame, stream, nil
+	}
+}
+
+// forward 转发成员输出, tc 不为空时转码
+func forward(ctx context.Context, first []byte, stream chan []byte, tc *transcoder, outputChan chan []byte) {
+	send := func(frame []byte) bool {
+		frames := [][]byte{frame}
+		if tc != nil {
+			var err error
+			if frames, err = tc.Write(frame); err != nil {
+				log.Warnf("TTS链转码失败: %v", err)
+				return true
+			}
+		}
+		for _, f := range frames {
+			select {
+			case outputChan <- f:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
+
+	if !send(first) {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frame, ok := <-stream:
+			if !ok {
+				if tc != nil {
+					for _, f := range tc.Flush() {
+						select {
+						case outputChan <- f:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+				return
+			}
+			if !send(frame) {
+				return
+			}
+		}
+	}
+}
+
+// drain 放弃成员后继续读空通道, 避免其协程阻塞
+func drain(stream chan []byte) {
+	go func() {
+		for range stream {
+		}
+	}()
+}
+
+func getInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
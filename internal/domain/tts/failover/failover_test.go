@@ -0,0 +1,179 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xiaozhi-esp32-server-golang/internal/domain/tts/mock"
+)
+
+// fakeProvider mode: ok 正常返回; fail 直接报错; empty 不返回音频; fixed 忽略请求的格式; hang 不返回直到取消
+type fakeProvider struct {
+	*mock.MockTTSProvider
+	mode  string
+	calls int32
+}
+
+func newFake(mode string) *fakeProvider {
+	return &fakeProvider{
+		MockTTSProvider: mock.NewMockTTSProvider(map[string]interface{}{"ms_per_char": 200}),
+		mode:            mode,
+	}
+}
+
+func (f *fakeProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	atomic.AddInt32(&f.calls, 1)
+	switch f.mode {
+	case "fail":
+		return nil, errors.New("fail")
+	case "empty":
+		ch := make(chan []byte)
+		close(ch)
+		return ch, nil
+	case "fixed":
+		// 忽略请求的格式, 固定输出 24k/20ms
+		return f.MockTTSProvider.TextToSpeechStream(ctx, text, 24000, channels, 20)
+	case "hang":
+		ch := make(chan []byte)
+		go func() {
+			<-ctx.Done()
+			close(ch)
+		}()
+		return ch, nil
+	}
+	return f.MockTTSProvider.TextToSpeechStream(ctx, text, sampleRate, channels, frameDuration)
+}
+
+func newTestProvider(t *testing.T, fakes map[string]*fakeProvider, providers []interface{}) *FailoverTTSProvider {
+	p, err := NewFailoverTTSProvider(map[string]interface{}{
+		"first_frame_timeout_ms": 100,
+		"failure_threshold":      2,
+		"cooldown_seconds":       60,
+		"providers":              providers,
+	}, func(provider string, config map[string]interface{}) (Provider, error) {
+		return fakes[config["fake"].(string)], nil
+	})
+	require.NoError(t, err)
+	return p
+}
+
+func item(name string, extra map[string]interface{}) map[string]interface{} {
+	m := map[string]interface{}{"name": name, "provider": "fake", "config": map[string]interface{}{"fake": name}}
+	for k, v := range extra {
+		m[k] = v
+	}
+	return m
+}
+
+func TestFailover(t *testing.T) {
+	fakes := map[string]*fakeProvider{
+		"failover_hang":  newFake("hang"),
+		"failover_fail":  newFake("fail"),
+		"failover_empty": newFake("empty"),
+		"failover_ok":    newFake("ok"),
+	}
+	p := newTestProvider(t, fakes, []interface{}{
+		item("failover_hang", nil),
+		item("failover_fail", nil),
+		item("failover_empty", nil),
+		item("failover_ok", nil),
+	})
+
+	start := time.Now()
+	frames, err := p.TextToSpeech(context.Background(), "一二三", 16000, 1, 60)
+	require.NoError(t, err)
+	assert.Len(t, frames, 10)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// 连续失败达到阈值后熔断, 后续请求直接使用健康成员
+	for i := 0; i < 2; i++ {
+		_, err = p.TextToSpeech(context.Background(), "一二三", 16000, 1, 60)
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 2, fakes["failover_hang"].calls)
+	assert.EqualValues(t, 2, fakes["failover_fail"].calls)
+	assert.EqualValues(t, 2, fakes["failover_empty"].calls)
+	assert.EqualValues(t, 3, fakes["failover_ok"].calls)
+}
+
+func TestFailoverAllFailed(t *testing.T) {
+	fakes := map[string]*fakeProvider{"all_fail": newFake("fail")}
+	p := newTestProvider(t, fakes, []interface{}{item("all_fail", nil)})
+
+	_, err := p.TextToSpeechStream(context.Background(), "你好", 16000, 1, 60)
+	assert.Error(t, err)
+}
+
+func TestFailoverTranscode(t *testing.T) {
+	fakes := map[string]*fakeProvider{
+		"transcode_fail": newFake("fail"),
+		"transcode_24k":  newFake("ok"),
+	}
+	p := newTestProvider(t, fakes, []interface{}{
+		item("transcode_fail", nil),
+		item("transcode_24k", map[string]interface{}{"sample_rate": 24000, "frame_duration": 20}),
+	})
+
+	// 1s 音频: 24k/20ms 共 50 帧, 转为 16k/60ms 后为 16 个整帧加 1 个补齐帧
+	frames, err := p.TextToSpeech(context.Background(), "一二三四五", 16000, 1, 60)
+	require.NoError(t, err)
+	assert.Len(t, frames, 17)
+}
+
+func TestFailoverNormalizeByDefault(t *testing.T) {
+	fakes := map[string]*fakeProvider{
+		"normalize_fail":  newFake("fail"),
+		"normalize_fixed": newFake("fixed"),
+	}
+	p := newTestProvider(t, fakes, []interface{}{
+		item("normalize_fail", nil),
+		item("normalize_fixed", nil),
+	})
+
+	// 未配置成员的输出格式, 按首帧实际的 20ms 帧时长转为会话的 60ms
+	frames, err := p.TextToSpeech(context.Background(), "一二三四五", 16000, 1, 60)
+	require.NoError(t, err)
+	assert.Len(t, frames, 17)
+	for _, frame := range frames {
+		duration, ok := opusPacketDurationMs(frame)
+		assert.True(t, ok)
+		assert.Equal(t, 60, duration)
+	}
+}
+
+func TestOpusPacketDuration(t *testing.T) {
+	cases := []struct {
+		packet   []byte
+		duration int
+		ok       bool
+	}{
+		{[]byte{0x08}, 20, true},       // SILK NB 20ms 单帧
+		{[]byte{0x18}, 60, true},       // SILK NB 60ms 单帧
+		{[]byte{0xf8}, 20, true},       // CELT FB 20ms 单帧
+		{[]byte{0xf9}, 40, true},       // CELT FB 20ms 两帧
+		{[]byte{0xfb, 0x03}, 60, true}, // CELT FB 20ms 三帧
+		{[]byte{0xe0}, 0, false},       // CELT 2.5ms
+		{[]byte{}, 0, false},
+	}
+	for _, c := range cases {
+		duration, ok := opusPacketDurationMs(c.packet)
+		assert.Equal(t, c.ok, ok, "%x", c.packet)
+		assert.Equal(t, c.duration, duration, "%x", c.packet)
+	}
+}
+
+func TestFailoverConfigError(t *testing.T) {
+	_, err := NewFailoverTTSProvider(map[string]interface{}{
+		"providers": []interface{}{map[string]interface{}{"provider": "failover"}},
+	}, nil)
+	assert.Error(t, err)
+
+	_, err = NewFailoverTTSProvider(map[string]interface{}{}, nil)
+	assert.Error(t, err)
+}
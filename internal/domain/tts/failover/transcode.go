@@ -0,0 +1,155 @@
+package failover
+
+import (
+	"fmt"
+
+	"xiaozhi-esp32-server-golang/internal/util"
+
+	"gopkg.in/hraban/opus.v2"
+)
+
+// transcoder 将成员输出的 Opus 帧转换为会话的采样率和帧时长
+type transcoder struct {
+	fromRate  int
+	toRate    int
+	channels  int
+	frameSize int // 输出每帧每声道的采样数
+
+	decoder   *opus.Decoder
+	encoder   *opus.Encoder
+	decodeBuf []int16
+	opusBuf   []byte
+	pending   []int16 // 尚未凑满一帧的 PCM, 多声道交错存放
+}
+
+func newTranscoder(fromRate, fromFrameDuration, toRate, toFrameDuration, channels int) (*transcoder, error) {
+	decoder, err := opus.NewDecoder(fromRate, channels)
+	if err != nil {
+		return nil, fmt.Errorf("创建Opus解码器失败: %v", err)
+	}
+	encoder, err := opus.NewEncoder(toRate, channels, opus.AppAudio)
+	if err != nil {
+		return nil, fmt.Errorf("创建Opus编码器失败: %v", err)
+	}
+	return &transcoder{
+		fromRate:  fromRate,
+		toRate:    toRate,
+		channels:  channels,
+		frameSize: toRate * toFrameDuration / 1000,
+		decoder:   decoder,
+		encoder:   encoder,
+		// opus 单帧最长 120ms
+		decodeBuf: make([]int16, fromRate*120/1000*channels),
+		opusBuf:   make([]byte, 4000),
+	}, nil
+}
+
+// Write 解码一帧输入, 返回凑满的输出帧
+func (t *transcoder) Write(frame []byte) ([][]byte, error) {
+	n, err := t.decoder.Decode(frame, t.decodeBuf)
+	if err != nil {
+		return nil, fmt.Errorf("解码Opus帧失败: %v", err)
+	}
+	pcm := t.decodeBuf[:n*t.channels]
+	if t.fromRate != t.toRate {
+		pcm = t.resample(pcm)
+	}
+	t.pending = append(t.pending, pcm...)
+
+	var frames [][]byte
+	size := t.frameSize * t.channels
+	for len(t.pending) >= size {
+		out, err := t.encode(t.pending[:size])
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, out)
+		t.pending = t.pending[size:]
+	}
+	return frames, nil
+}
+
+// Flush 输出剩余数据, 不足一帧补静音
+func (t *transcoder) Flush() [][]byte {
+	if len(t.pending) == 0 {
+		return nil
+	}
+	pcm := make([]int16, t.frameSize*t.channels)
+	copy(pcm, t.pending)
+	t.pending = nil
+	out, err := t.encode(pcm)
+	if err != nil {
+		return nil
+	}
+	return [][]byte{out}
+}
+
+func (t *transcoder) encode(pcm []int16) ([]byte, error) {
+	n, err := t.encoder.Encode(pcm, t.opusBuf)
+	if err != nil {
+		return nil, fmt.Errorf("编码Opus帧失败: %v", err)
+	}
+	out := make([]byte, n)
+	copy(out, t.opusBuf[:n])
+	return out, nil
+}
+
+// resample 按声道分别线性重采样
+func (t *transcoder) resample(pcm []int16) []int16 {
+	samples := len(pcm) / t.channels
+	if samples == 0 {
+		return nil
+	}
+	var out []int16
+	for ch := 0; ch < t.channels; ch++ {
+		input := make([]float32, samples)
+		for i := 0; i < samples; i++ {
+			input[i] = float32(pcm[i*t.channels+ch]) / 32767
+		}
+		resampled := util.Float32SliceToInt16Slice(util.ResampleLinearFloat32(input, t.fromRate, t.toRate))
+		if out == nil {
+			out = make([]int16, len(resampled)*t.channels)
+		}
+		for i := 0; i < len(resampled) && i*t.channels+ch < len(out); i++ {
+			out[i*t.channels+ch] = resampled[i]
+		}
+	}
+	return out
+}
+
+// opusPacketDurationMs 根据 Opus 包的 TOC 字节计算包时长（毫秒）, 无法解析或不是整毫秒时返回 false
+func opusPacketDurationMs(packet []byte) (int, bool) {
+	if len(packet) == 0 {
+		return 0, false
+	}
+	toc := packet[0]
+	config := int(toc >> 3)
+
+	// 单帧时长, 单位 0.1ms
+	var frameDuration int
+	switch {
+	case config < 12: // SILK
+		frameDuration = []int{100, 200, 400, 600}[config%4]
+	case config < 16: // Hybrid
+		frameDuration = []int{100, 200}[config%2]
+	default: // CELT
+		frameDuration = []int{25, 50, 100, 200}[config%4]
+	}
+
+	frameCount := 1
+	switch toc & 0x3 {
+	case 1, 2:
+		frameCount = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, false
+		}
+		frameCount = int(packet[1] & 0x3f)
+	}
+
+	total := frameDuration * frameCount
+	if total == 0 || total%10 != 0 {
+		return 0, false
+	}
+	return total / 10, true
+}
@@ -0,0 +1,140 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"gopkg.in/hraban/opus.v2"
+)
+
+const (
+	ModeTone    = "tone"
+	ModeSilence = "silence"
+)
+
+// MockTTSProvider 离线 TTS, 按文本长度生成正弦音或静音的 Opus 帧, 用于测试
+type MockTTSProvider struct {
+	Mode       string
+	Frequency  float64
+	MsPerChar  int
+	FrameDelay time.Duration
+	// StreamingInput 是否支持流式输入文本
+	StreamingInput bool
+}
+
+// NewMockTTSProvider 创建 mock TTS
+// 配置项: mode tone/silence; frequency 正弦音频率; ms_per_char 每个字对应的音频时长; frame_delay_ms 流式输出的帧间隔;
+// streaming_input 是否支持流式输入文本
+func NewMockTTSProvider(config map[string]interface{}) *MockTTSProvider {
+	p := &MockTTSProvider{
+		Mode:      ModeTone,
+		Frequency: 440,
+		MsPerChar: 200,
+	}
+	if mode, ok := config["mode"].(string); ok && mode != "" {
+		p.Mode = mode
+	}
+	if frequency := getFloat(config["frequency"]); frequency > 0 {
+		p.Frequency = frequency
+	}
+	if msPerChar := int(getFloat(config["ms_per_char"])); msPerChar > 0 {
+		p.MsPerChar = msPerChar
+	}
+	p.FrameDelay = time.Duration(getFloat(config["frame_delay_ms"])) * time.Millisecond
+	p.StreamingInput, _ = config["streaming_input"].(bool)
+	return p
+}
+
+// TextToSpeech 生成全部 Opus 帧
+func (p *MockTTSProvider) TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
+	enc, err := opus.NewEncoder(sampleRate, channels, opus.AppAudio)
+	if err != nil {
+		return nil, fmt.Errorf("创建Opus编码器失败: %v", err)
+	}
+
+	frameSize := sampleRate * frameDuration / 1000
+	frameCount := p.frameCount(text, frameDuration)
+	pcm := make([]int16, frameSize*channels)
+	opusBuffer := make([]byte, 1000)
+
+	frames := make([][]byte, 0, frameCount)
+	for i := 0; i < frameCount; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		p.fillPcm(pcm, i*frameSize, sampleRate, channels)
+		n, err := enc.Encode(pcm, opusBuffer)
+		if err != nil {
+			return nil, fmt.Errorf("编码Opus帧失败: %v", err)
+		}
+		frame := make([]byte, n)
+		copy(frame, opusBuffer[:n])
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// TextToSpeechStream 逐帧输出 Opus 数据
+func (p *MockTTSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	frames, err := p.TextToSpeech(ctx, text, sampleRate, channels, frameDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	outputChan := make(chan []byte, 100)
+	go func() {
+		defer close(outputChan)
+		for _, frame := range frames {
+			if p.FrameDelay > 0 {
+				time.Sleep(p.FrameDelay)
+			}
+			select {
+			case outputChan <- frame:
+			case <-ctx.Done():
+				log.Debugf("mock tts 上下文已取消, text: %s", text)
+				return
+			}
+		}
+	}()
+	return outputChan, nil
+}
+
+// frameCount 按文本字数计算帧数, 至少一帧
+func (p *MockTTSProvider) frameCount(text string, frameDuration int) int {
+	durationMs := len([]rune(text)) * p.MsPerChar
+	count := (durationMs + frameDuration - 1) / frameDuration
+	if count < 1 {
+		count = 1
+	}
+	return count
+}
+
+// fillPcm 填充一帧 PCM, offset 为该帧起始的采样点序号, 保证相邻帧的相位连续
+func (p *MockTTSProvider) fillPcm(pcm []int16, offset int, sampleRate int, channels int) {
+	for i := 0; i < len(pcm)/channels; i++ {
+		var sample int16
+		if p.Mode == ModeTone {
+			t := float64(offset+i) / float64(sampleRate)
+			sample = int16(math.Sin(2*math.Pi*p.Frequency*t) * math.MaxInt16 * 0.3)
+		}
+		for c := 0; c < channels; c++ {
+			pcm[i*channels+c] = sample
+		}
+	}
+}
+
+func getFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	tts_common "xiaozhi-esp32-server-golang/internal/domain/tts/common"
+
+	"gopkg.in/hraban/opus.v2"
+)
+
+// SupportStreamingInput 配置 streaming_input 时支持流式输入文本
+func (p *MockTTSProvider) SupportStreamingInput() bool {
+	return p.StreamingInput
+}
+
+// StartSession 建立流式输入会话, 按累计字数生成音频帧, 整句合成与分段输入的总帧数一致
+func (p *MockTTSProvider) StartSession(ctx context.Context, sampleRate int, channels int, frameDuration int) (tts_common.StreamingSession, error) {
+	enc, err := opus.NewEncoder(sampleRate, channels, opus.AppAudio)
+	if err != nil {
+		return nil, fmt.Errorf("创建Opus编码器失败: %v", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &mockSession{
+		p:             p,
+		ctx:           ctx,
+		cancel:        cancel,
+		enc:           enc,
+		sampleRate:    sampleRate,
+		channels:      channels,
+		frameDuration: frameDuration,
+		textChan:      make(chan string, 100),
+		outputChan:    make(chan []byte, 100),
+	}
+	go s.run()
+	return s, nil
+}
+
+type mockSession struct {
+	p             *MockTTSProvider
+	ctx           context.Context
+	cancel        context.CancelFunc
+	enc           *opus.Encoder
+	sampleRate    int
+	channels      int
+	frameDuration int
+	textChan      chan string
+	outputChan    chan []byte
+
+	finishOnce sync.Once
+	emitted    int
+	offsets    tts_common.TextOffsets
+}
+
+func (s *mockSession) run() {
+	defer close(s.outputChan)
+	durationMs := 0
+	chars := 0
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case text, ok := <-s.textChan:
+			if !ok {
+				// 剩余不足一帧的部分向上取整, 至少一帧
+				count := max((durationMs+s.frameDuration-1)/s.frameDuration, 1)
+				s.emit(count)
+				return
+			}
+			s.offsets.Mark(durationMs/s.frameDuration, chars)
+			chars += tts_common.CountChars(text)
+			durationMs += len([]rune(text)) * s.p.MsPerChar
+			if !s.emit(durationMs / s.frameDuration) {
+				return
+			}
+		}
+	}
+}
+
+// emit 输出帧直到累计帧数达到 count
+func (s *mockSession) emit(count int) bool {
+	frameSize := s.sampleRate * s.frameDuration / 1000
+	pcm := make([]int16, frameSize*s.channels)
+	opusBuffer := make([]byte, 1000)
+	for ; s.emitted < count; s.emitted++ {
+		s.p.fillPcm(pcm, s.emitted*frameSize, s.sampleRate, s.channels)
+		n, err := s.enc.Encode(pcm, opusBuffer)
+		if err != nil {
+			return false
+		}
+		frame := make([]byte, n)
+		copy(frame, opusBuffer[:n])
+		if s.p.FrameDelay > 0 {
+			time.Sleep(s.p.FrameDelay)
+		}
+		select {
+		case s.outputChan <- frame:
+		case <-s.ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (s *mockSession) AppendText(text string) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case s.textChan <- text:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *mockSession) Finish() error {
+	s.finishOnce.Do(func() {
+		close(s.textChan)
+	})
+	return nil
+}
+
+func (s *mockSession) OpusChan() chan []byte {
+	return s.outputChan
+}
+
+func (s *mockSession) TextOffset(frame int) int {
+	return s.offsets.TextOffset(frame)
+}
+
+func (s *mockSession) Close() {
+	s.cancel()
+}
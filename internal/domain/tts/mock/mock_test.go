@@ -0,0 +1,50 @@
+package mock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockTTSFrameCount(t *testing.T) {
+	provider := NewMockTTSProvider(map[string]interface{}{"ms_per_char": 100})
+
+	frames, err := provider.TextToSpeech(context.Background(), "你好小智", 16000, 1, 60)
+	assert.NoError(t, err)
+	// 4 个字 * 100ms, 向上取整到 60ms 帧
+	assert.Len(t, frames, 7)
+
+	outputChan, err := provider.TextToSpeechStream(context.Background(), "", 24000, 1, 20)
+	assert.NoError(t, err)
+	count := 0
+	for range outputChan {
+		count++
+	}
+	assert.Equal(t, 1, count)
+}
+
+func TestMockTTSStreamingInput(t *testing.T) {
+	provider := NewMockTTSProvider(map[string]interface{}{"ms_per_char": 100, "streaming_input": true})
+	assert.True(t, provider.SupportStreamingInput())
+
+	session, err := provider.StartSession(context.Background(), 16000, 1, 60)
+	assert.NoError(t, err)
+	defer session.Close()
+	for _, text := range []string{"你好", "小", "智"} {
+		assert.NoError(t, session.AppendText(text))
+	}
+	assert.NoError(t, session.Finish())
+
+	count := 0
+	for range session.OpusChan() {
+		count++
+	}
+	// 与整句合成的帧数一致
+	assert.Equal(t, 7, count)
+
+	// 每段文本的音频起始帧: "小" 从 200ms 开始, "智" 从 300ms 开始
+	assert.Equal(t, 0, session.TextOffset(2))
+	assert.Equal(t, 2, session.TextOffset(3))
+	assert.Equal(t, 3, session.TextOffset(5))
+}
@@ -0,0 +1,190 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"xiaozhi-esp32-server-golang/internal/util"
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"github.com/gopxl/beep"
+)
+
+// 支持的 response_format, opus 为 Ogg 封装
+var supportedFormats = map[string]bool{"pcm": true, "wav": true, "mp3": true, "opus": true}
+
+// OpenAITTSProvider 调用 OpenAI 兼容的 /audio/speech 接口, 适用于 Kokoro、CosyVoice、GPT-SoVITS 等封装
+type OpenAITTSProvider struct {
+	BaseURL        string  // 如 http://127.0.0.1:8880/v1
+	APIKey         string  // 为空时不发送 Authorization
+	Model          string  // 如 tts-1、kokoro
+	Voice          string  // 音色
+	Speed          float64 // 语速, 0 表示使用服务端默认值
+	Instructions   string  // 语气、情感等指令, 部分模型支持
+	ResponseFormat string  // pcm/wav/mp3/opus
+	PcmSampleRate  int     // pcm 格式的采样率, 接口返回的 pcm 不带头部
+	client         *http.Client
+}
+
+// NewOpenAITTSProvider 从配置创建
+// 配置项: base_url、api_key、model、voice、speed、instructions、response_format、pcm_sample_rate、timeout
+func NewOpenAITTSProvider(config map[string]interface{}) *OpenAITTSProvider {
+	p := &OpenAITTSProvider{
+		Model:          "tts-1",
+		Voice:          "alloy",
+		ResponseFormat: "pcm",
+		PcmSampleRate:  24000,
+	}
+	p.BaseURL, _ = config["base_url"].(string)
+	p.APIKey, _ = config["api_key"].(string)
+	if model, ok := config["model"].(string); ok && model != "" {
+		p.Model = model
+	}
+	if voice, ok := config["voice"].(string); ok && voice != "" {
+		p.Voice = voice
+	}
+	p.Speed = getFloat(config["speed"])
+	p.Instructions, _ = config["instructions"].(string)
+	if format, ok := config["response_format"].(string); ok && format != "" {
+		p.ResponseFormat = strings.ToLower(format)
+	}
+	if sampleRate := int(getFloat(config["pcm_sample_rate"])); sampleRate > 0 {
+		p.PcmSampleRate = sampleRate
+	}
+	timeout := 30
+	if t := int(getFloat(config["timeout"])); t > 0 {
+		timeout = t
+	}
+	if p.BaseURL == "" {
+		p.BaseURL = "https://api.openai.com/v1"
+	}
+	p.BaseURL = strings.TrimRight(p.BaseURL, "/")
+	// 超时只限制建立连接和等待响应头, 流式响应体的读取由 ctx 控制
+	p.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost:   10,
+			IdleConnTimeout:       90 * time.Second,
+			ResponseHeaderTimeout: time.Duration(timeout) * time.Second,
+		},
+	}
+	return p
+}
+
+// TextToSpeech 合成全部 Opus 帧
+func (p *OpenAITTSProvider) TextToSpeech(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) ([][]byte, error) {
+	outputChan, err := p.TextToSpeechStream(ctx, text, sampleRate, channels, frameDuration)
+	if err != nil {
+		return nil, err
+	}
+	var frames [][]byte
+	for frame := range outputChan {
+		frames = append(frames, frame)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("openai tts 未返回音频")
+	}
+	return frames, nil
+}
+
+// TextToSpeechStream 请求接口后边接收边解码, 按会话的采样率和帧时长输出 Opus 帧
+// 接口返回错误时直接返回, 解码中途出错时关闭输出通道
+func (p *OpenAITTSProvider) TextToSpeechStream(ctx context.Context, text string, sampleRate int, channels int, frameDuration int) (chan []byte, error) {
+	if !supportedFormats[p.ResponseFormat] {
+		return nil, fmt.Errorf("不支持的音频格式: %s", p.ResponseFormat)
+	}
+	startTs := time.Now().UnixMilli()
+
+	payload := map[string]interface{}{
+		"model":           p.Model,
+		"input":           text,
+		"voice":           p.Voice,
+		"response_format": p.ResponseFormat,
+	}
+	if p.Speed > 0 {
+		payload["speed"] = p.Speed
+	}
+	if p.Instructions != "" {
+		payload["instructions"] = p.Instructions
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+"/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, data)
+	}
+
+	outputChan := make(chan []byte, 100)
+	decoder, err := util.CreateAudioDecoderWithSampleRate(ctx, resp.Body, outputChan, frameDuration, p.ResponseFormat, sampleRate)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("创建音频解码器失败: %v", err)
+	}
+	if p.ResponseFormat == "pcm" {
+		decoder.WithFormat(beep.Format{
+			SampleRate:  beep.SampleRate(p.PcmSampleRate),
+			NumChannels: 1,
+			Precision:   2,
+		})
+	}
+
+	go func() {
+		defer resp.Body.Close()
+		// 解码器退出时关闭 outputChan
+		if err := decoder.Run(startTs); err != nil {
+			log.Errorf("openai tts 音频解码失败: %v", err)
+			return
+		}
+		if ctx.Err() != nil {
+			log.Debugf("TTS流式合成取消, 文本: %s", text)
+			return
+		}
+		log.Infof("tts耗时: 从输入至获取音频数据结束耗时: %d ms", time.Now().UnixMilli()-startTs)
+	}()
+
+	return outputChan, nil
+}
+
+func getFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	return 0
+}
@@ -0,0 +1,225 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/hraban/opus.v2"
+)
+
+// writeChunked 按奇数字节分块写出, 模拟采样点被拆开的分块传输
+func writeChunked(w http.ResponseWriter, data []byte) {
+	for len(data) > 0 {
+		n := min(1001, len(data))
+		w.Write(data[:n])
+		w.(http.Flusher).Flush()
+		data = data[n:]
+	}
+}
+
+// sine 440Hz 正弦波
+func sine(samples int, sampleRate int, amplitude float64) []int16 {
+	pcm := make([]int16, samples)
+	for i := range pcm {
+		pcm[i] = int16(amplitude * math.Sin(2*math.Pi*440*float64(i)/float64(sampleRate)))
+	}
+	return pcm
+}
+
+func pcm16(pcm []int16) []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, pcm)
+	return buf.Bytes()
+}
+
+// decodeFrames 用 libopus 解码输出的帧, 每帧应为 16k 下的 20ms, 返回拼接后的 PCM
+func decodeFrames(t *testing.T, frames [][]byte) []int16 {
+	dec, err := opus.NewDecoder(16000, 1)
+	require.NoError(t, err)
+	buf := make([]int16, 16000*120/1000)
+	var pcm []int16
+	for _, frame := range frames {
+		n, err := dec.Decode(frame, buf)
+		require.NoError(t, err)
+		require.Equal(t, 320, n)
+		pcm = append(pcm, buf[:n]...)
+	}
+	return pcm
+}
+
+func rms(pcm []int16) float64 {
+	var sum float64
+	for _, v := range pcm {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(pcm)))
+}
+
+// assertLevel 跳过第一帧的编解码延迟, 比较正弦波的有效值
+func assertLevel(t *testing.T, pcm []int16, amplitude float64) {
+	expected := amplitude / math.Sqrt2
+	assert.InDelta(t, expected, rms(pcm[320:]), expected*0.3)
+}
+
+func oggPage(headerType byte, packets ...[]byte) []byte {
+	var segments []byte
+	var data []byte
+	for _, packet := range packets {
+		n := len(packet)
+		for ; n >= 255; n -= 255 {
+			segments = append(segments, 255)
+		}
+		segments = append(segments, byte(n))
+		data = append(data, packet...)
+	}
+	page := []byte("OggS")
+	page = append(page, 0, headerType)
+	page = append(page, make([]byte, 20)...) // granule、serial、sequence、crc
+	page = append(page, byte(len(segments)))
+	page = append(page, segments...)
+	return append(page, data...)
+}
+
+func collect(t *testing.T, config map[string]interface{}, body func(w http.ResponseWriter, r *http.Request)) [][]byte {
+	server := httptest.NewServer(http.HandlerFunc(body))
+	defer server.Close()
+	config["base_url"] = server.URL + "/v1/"
+	frames, err := NewOpenAITTSProvider(config).TextToSpeech(context.Background(), "你好", 16000, 1, 20)
+	require.NoError(t, err)
+	return frames
+}
+
+func TestOpenAITTSPcm(t *testing.T) {
+	frames := collect(t, map[string]interface{}{
+		"api_key":      "sk-test",
+		"model":        "kokoro",
+		"voice":        "zf_xiaobei",
+		"speed":        1.2,
+		"instructions": "温柔一点",
+	}, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/audio/speech", r.URL.Path)
+		assert.Equal(t, "Bearer sk-test", r.Header.Get("Authorization"))
+		var payload map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		assert.Equal(t, map[string]interface{}{
+			"model":           "kokoro",
+			"input":           "你好",
+			"voice":           "zf_xiaobei",
+			"speed":           1.2,
+			"instructions":    "温柔一点",
+			"response_format": "pcm",
+		}, payload)
+		// 0.5 秒 24k 单声道
+		writeChunked(w, pcm16(sine(12000, 24000, 8000)))
+	})
+
+	// 重采样到 16k 后按 20ms 分帧
+	require.Len(t, frames, 25)
+	assertLevel(t, decodeFrames(t, frames), 8000)
+}
+
+func TestOpenAITTSWav(t *testing.T) {
+	frames := collect(t, map[string]interface{}{"response_format": "wav"}, func(w http.ResponseWriter, r *http.Request) {
+		buf := new(bytes.Buffer)
+		buf.WriteString("RIFF")
+		binary.Write(buf, binary.LittleEndian, uint32(0xFFFFFFFF))
+		buf.WriteString("WAVEfmt ")
+		binary.Write(buf, binary.LittleEndian, []uint32{16})
+		binary.Write(buf, binary.LittleEndian, []uint16{1, 2})
+		binary.Write(buf, binary.LittleEndian, []uint32{16000, 16000 * 4})
+		binary.Write(buf, binary.LittleEndian, []uint16{4, 16})
+		// 流式 WAV 常带有 LIST 块, data 长度未知
+		buf.WriteString("LIST")
+		binary.Write(buf, binary.LittleEndian, uint32(3))
+		buf.Write([]byte{'a', 'b', 'c', 0})
+		buf.WriteString("data")
+		binary.Write(buf, binary.LittleEndian, uint32(0xFFFFFFFF))
+		// 左右声道同相, 混为单声道后为两者的平均
+		left, right := sine(1700, 16000, 2000), sine(1700, 16000, 6000)
+		for i := range left {
+			binary.Write(buf, binary.LittleEndian, []int16{left[i], right[i]})
+		}
+		writeChunked(w, buf.Bytes())
+	})
+
+	// 1700 个采样点, 最后不足一帧的部分补零
+	require.Len(t, frames, 6)
+	pcm := decodeFrames(t, frames)
+	assertLevel(t, pcm[:1600], 4000)
+}
+
+func TestOpenAITTSOggOpus(t *testing.T) {
+	frames := collect(t, map[string]interface{}{"response_format": "opus"}, func(w http.ResponseWriter, r *http.Request) {
+		head := []byte("OpusHead")
+		head = append(head, 1, 1)
+		head = binary.LittleEndian.AppendUint16(head, 960) // pre-skip 20ms
+		head = append(head, make([]byte, 7)...)
+		stream := oggPage(2, head)
+		stream = append(stream, oggPage(0, []byte("OpusTags"))...)
+		// 每个包 20ms, 跨越多个 lacing 段, 最后一个包跨页
+		packets := encodeOpus(t, 4)
+		stream = append(stream, oggPage(0, packets[:3]...)...)
+		// 按 255 字节整段切开并去掉末尾的 0 lacing 值, 使数据包在下一页继续
+		packet := packets[3]
+		split := len(packet) / 255 * 255
+		if split == len(packet) {
+			split -= 255
+		}
+		last := oggPage(0, packet[:split])
+		last[26]--
+		stream = append(stream, last[:27+split/255]...)
+		stream = append(stream, last[28+split/255:]...)
+		stream = append(stream, oggPage(1, packet[split:])...)
+		writeChunked(w, stream)
+	})
+
+	// 去掉 20ms 的 pre-skip 后为 3 帧
+	require.Len(t, frames, 3)
+	pcm := decodeFrames(t, frames)
+	assert.Greater(t, rms(pcm[320:]), 8000/math.Sqrt2*0.5)
+}
+
+// encodeOpus 编码 count 个 48k 20ms 的 Opus 包, 叠加噪声并使用最高码率, 使每个包超过 255 字节
+func encodeOpus(t *testing.T, count int) [][]byte {
+	enc, err := opus.NewEncoder(48000, 1, opus.AppAudio)
+	require.NoError(t, err)
+	require.NoError(t, enc.SetBitrateToMax())
+	pcm := sine(960*count, 48000, 8000)
+	noise := rand.New(rand.NewSource(1))
+	for i := range pcm {
+		pcm[i] += int16(noise.Intn(8000) - 4000)
+	}
+	buf := make([]byte, 4000)
+	packets := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		n, err := enc.Encode(pcm[i*960:(i+1)*960], buf)
+		require.NoError(t, err)
+		require.Greater(t, n, 255)
+		packets = append(packets, append([]byte(nil), buf[:n]...))
+	}
+	return packets
+}
+
+func TestOpenAITTSError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "voice not found", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	provider := NewOpenAITTSProvider(map[string]interface{}{"base_url": server.URL})
+	_, err := provider.TextToSpeechStream(context.Background(), "你好", 16000, 1, 20)
+	assert.ErrorContains(t, err, "voice not found")
+
+	provider = NewOpenAITTSProvider(map[string]interface{}{"base_url": server.URL, "response_format": "flac"})
+	_, err = provider.TextToSpeechStream(context.Background(), "你好", 16000, 1, 20)
+	assert.Error(t, err)
+}
@@ -6,25 +6,34 @@ import (
 	"xiaozhi-esp32-server-golang/internal/domain/vad/inter"
 	"xiaozhi-esp32-server-golang/internal/domain/vad/silero_vad"
 	"xiaozhi-esp32-server-golang/internal/domain/vad/webrtc_vad"
+	"xiaozhi-esp32-server-golang/internal/util/metrics"
 )
 
 func AcquireVAD(provider string, config map[string]interface{}) (inter.VAD, error) {
+	var vad inter.VAD
+	var err error
 	switch provider {
 	case constants.VadTypeSileroVad:
-		return silero_vad.AcquireVAD(config)
+		vad, err = silero_vad.AcquireVAD(config)
 	case constants.VadTypeWebRTCVad:
-		return webrtc_vad.AcquireVAD(config)
+		vad, err = webrtc_vad.AcquireVAD(config)
 	default:
 		return nil, errors.New("invalid vad provider")
 	}
+	if err == nil {
+		metrics.VadInUse.WithLabelValues(provider).Inc()
+	}
+	return vad, err
 }
 
 func ReleaseVAD(vad inter.VAD) error {
 	//根据vad的类型，调用对应的ReleaseVAD方法
 	switch vad.(type) {
 	case *webrtc_vad.WebRTCVAD:
+		metrics.VadInUse.WithLabelValues(constants.VadTypeWebRTCVad).Dec()
 		return webrtc_vad.ReleaseVAD(vad)
 	case *silero_vad.SileroVAD:
+		metrics.VadInUse.WithLabelValues(constants.VadTypeSileroVad).Dec()
 		return silero_vad.ReleaseVAD(vad)
 	default:
 		return errors.New("invalid vad type")
@@ -146,6 +146,11 @@ type SileroVAD struct {
 	sampleRate       int   // 采样率
 	channels         int   // 通道数
 	mu               sync.Mutex
+
+	// 会话指定的最小静音时长(毫秒), 语音后静音未达到该时长前仍判定为有声音, 0 表示不保持
+	minSilenceMs   int64
+	inSpeech       bool
+	silenceSamples int // 语音后累计的静音采样数
 }
 
 // NewSileroVAD 创建SileroVAD实例
@@ -224,7 +229,31 @@ func (s *SileroVAD) IsVAD(pcmData []float32) (bool, error) {
 		}
 	}
 
-	return len(segments) > 0, nil
+	if len(segments) > 0 {
+		s.inSpeech = true
+		s.silenceSamples = 0
+		return true, nil
+	}
+
+	// 检测器在每次检测前都会被重置, 语音后的静音时长在此累计
+	if s.inSpeech && s.minSilenceMs > 0 {
+		s.silenceSamples += len(pcmData) / s.channels
+		if int64(s.silenceSamples)*1000 < s.minSilenceMs*int64(s.sampleRate) {
+			return true, nil
+		}
+	}
+	s.inSpeech = false
+	return false, nil
+}
+
+// SetMinSilenceDuration 设置会话的最小静音时长(毫秒), 0 表示不保持, 同时清空已累计的静音
+func (s *SileroVAD) SetMinSilenceDuration(silenceMs int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.minSilenceMs = silenceMs
+	s.inSpeech = false
+	s.silenceSamples = 0
 }
 
 // Close 关闭并释放资源
@@ -264,7 +293,22 @@ func AcquireVAD(config map[string]interface{}) (VAD, error) {
 		return nil, errors.New("VAD资源池尚未初始化")
 	}
 
-	return globalVADResourcePool.AcquireVAD()
+	vad, err := globalVADResourcePool.AcquireVAD()
+	if err != nil {
+		return nil, err
+	}
+
+	// 会话指定了与资源池不同的最小静音时长时, 在获取到的实例上生效
+	var minSilenceMs int64
+	if silenceMs, ok := config["min_silence_duration_ms"].(int64); ok && silenceMs > 0 {
+		if poolSilenceMs, _ := globalVADResourcePool.defaultConfig["min_silence_duration_ms"].(int64); silenceMs != poolSilenceMs {
+			minSilenceMs = silenceMs
+		}
+	}
+	if sileroVAD, ok := vad.(*SileroVAD); ok {
+		sileroVAD.SetMinSilenceDuration(minSilenceMs)
+	}
+	return vad, nil
 }
 
 // ReleaseVAD 释放一个VAD实例
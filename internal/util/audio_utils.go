@@ -3,8 +3,10 @@ package util
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"time"
 
 	log "xiaozhi-esp32-server-golang/logger"
@@ -168,15 +170,97 @@ func (d *AudioDecoder) WithFormat(format beep.Format) *AudioDecoder {
 
 func (d *AudioDecoder) Run(startTs int64) error {
 	if d.AudioFormat == "wav" {
-		d.RunWavDecoder(startTs, false)
+		return d.RunWavDecoder(startTs, false)
 	} else if d.AudioFormat == "pcm" {
-		d.RunWavDecoder(startTs, true)
+		return d.RunWavDecoder(startTs, true)
 	} else if d.AudioFormat == "mp3" {
 		return d.RunMp3Decoder(startTs)
+	} else if d.AudioFormat == "opus" {
+		return d.RunOggOpusDecoder(startTs)
 	}
 	return nil
 }
 
+// readWavHeader 读取 WAV 头部直到 data 块, 兼容 fmt 之外还有 LIST 等块的文件
+// 流式返回的 WAV 中 data 长度可能为 0 或 0xFFFFFFFF, 因此不使用该长度
+func readWavHeader(r io.Reader) (sampleRate int, channels int, err error) {
+	riff := make([]byte, 12)
+	if _, err := io.ReadFull(r, riff); err != nil {
+		return 0, 0, fmt.Errorf("读取WAV头部失败: %v", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return 0, 0, fmt.Errorf("不是有效的WAV数据")
+	}
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			return 0, 0, fmt.Errorf("读取WAV头部失败: %v", err)
+		}
+		size := int(binary.LittleEndian.Uint32(chunkHeader[4:8]))
+		switch string(chunkHeader[0:4]) {
+		case "data":
+			if sampleRate == 0 {
+				return 0, 0, fmt.Errorf("WAV缺少fmt块")
+			}
+			return sampleRate, channels, nil
+		case "fmt ":
+			fmtChunk := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, fmtChunk); err != nil || size < 16 {
+				return 0, 0, fmt.Errorf("读取WAV fmt块失败: %v", err)
+			}
+			channels = int(binary.LittleEndian.Uint16(fmtChunk[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:8]))
+			if bits := binary.LittleEndian.Uint16(fmtChunk[14:16]); bits != 16 {
+				return 0, 0, fmt.Errorf("仅支持16位WAV, 当前: %d位", bits)
+			}
+		default:
+			// 块按偶数字节对齐
+			if _, err := io.CopyN(io.Discard, r, int64(size+size%2)); err != nil {
+				return 0, 0, fmt.Errorf("读取WAV头部失败: %v", err)
+			}
+		}
+	}
+}
+
+// EncodeWav 将 float32 PCM(多声道交错)编码为 16 位 WAV
+func EncodeWav(samples []float32, sampleRate int, channels int) []byte {
+	dataSize := len(samples) * 2
+	buf := bytes.NewBuffer(make([]byte, 0, 44+dataSize))
+	buf.WriteString("RIFF")
+	binary.Write(buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(buf, binary.LittleEndian, uint32(16))
+	binary.Write(buf, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(buf, binary.LittleEndian, uint16(channels))
+	binary.Write(buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(buf, binary.LittleEndian, uint32(sampleRate*channels*2))
+	binary.Write(buf, binary.LittleEndian, uint16(channels*2))
+	binary.Write(buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	binary.Write(buf, binary.LittleEndian, uint32(dataSize))
+	for _, sample := range samples {
+		sample = float32(math.Max(-1, math.Min(1, float64(sample))))
+		binary.Write(buf, binary.LittleEndian, int16(sample*math.MaxInt16))
+	}
+	return buf.Bytes()
+}
+
+// resampleFrame 重采样一帧并补齐或截断到 size 个采样点, 保证能被 opus 编码
+func resampleFrame(pcm []int16, fromRate int, toRate int, size int) []int16 {
+	if fromRate != toRate {
+		pcmFloat32 := PCM16BytesToFloat32(Int16SliceToBytes(pcm))
+		pcm = Float32SliceToInt16Slice(ResampleLinearFloat32(pcmFloat32, fromRate, toRate))
+	}
+	if len(pcm) == size {
+		return pcm
+	}
+	frame := make([]int16, size)
+	copy(frame, pcm)
+	return frame
+}
+
+// RunWavDecoder 解码 16 位 WAV 或原始 PCM(小端), 多声道取平均转为单声道
+// 指定了目标采样率时重采样, 否则按原采样率编码
 func (d *AudioDecoder) RunWavDecoder(startTs int64, isRaw bool) error {
 	defer close(d.outputOpusChan)
 
@@ -184,20 +268,11 @@ func (d *AudioDecoder) RunWavDecoder(startTs int64, isRaw bool) error {
 	var channels int
 
 	if !isRaw {
-		// WAV文件头部固定为44字节
-		headerSize := 44
-		header := make([]byte, headerSize)
-		_, err := io.ReadFull(d.pipeReader, header)
+		var err error
+		sampleRate, channels, err = readWavHeader(d.pipeReader)
 		if err != nil {
-			return fmt.Errorf("读取WAV头部失败: %v", err)
+			return err
 		}
-
-		// 从WAV头部获取基本参数
-		// 采样率: 字节24-27
-		sampleRate = int(uint32(header[24]) | uint32(header[25])<<8 | uint32(header[26])<<16 | uint32(header[27])<<24)
-		// 通道数: 字节22-23
-		channels = int(uint16(header[22]) | uint16(header[23])<<8)
-
 		log.Debugf("WAV格式: %d Hz, %d 通道", sampleRate, channels)
 	} else {
 		// 对于原始PCM数据，使用format中的参数
@@ -205,89 +280,106 @@ func (d *AudioDecoder) RunWavDecoder(startTs int64, isRaw bool) error {
 		channels = d.format.NumChannels
 		log.Debugf("原始PCM格式: %d Hz, %d 通道", sampleRate, channels)
 	}
+	if sampleRate <= 0 {
+		return fmt.Errorf("无效的采样率: %d", sampleRate)
+	}
+	if channels <= 0 {
+		channels = 1
+	}
 
 	// 始终使用单通道输出
-	outputChannels := 1
 	if channels > 1 {
 		log.Debugf("将多声道音频转换为单声道输出")
 	}
 
-	enc, err := opus.NewEncoder(int(sampleRate), outputChannels, opus.AppAudio)
+	opusSampleRate := sampleRate
+	if d.targetSampleRate > 0 {
+		opusSampleRate = d.targetSampleRate
+	}
+	enc, err := opus.NewEncoder(opusSampleRate, 1, opus.AppAudio)
 	if err != nil {
 		return fmt.Errorf("创建Opus编码器失败: %v", err)
 	}
 	d.enc = enc
 
 	//opus相关配置及缓冲区
-	frameDurationMs := d.perFrameDurationMs              //每帧时长(ms)
-	frameSize := sampleRate * frameDurationMs / 1000     //每帧采样点数
-	pcmBuffer := make([]int16, frameSize*outputChannels) //PCM缓冲区
-	opusBuffer := make([]byte, 1000)                     //Opus输出缓冲区
+	frameSize := sampleRate * d.perFrameDurationMs / 1000         //每帧采样点数(原采样率)
+	opusFrameSize := opusSampleRate * d.perFrameDurationMs / 1000 //每帧采样点数(编码采样率)
+	pcmBuffer := make([]int16, frameSize)
+	opusBuffer := make([]byte, 1000)
 
-	// 用于读取原始PCM数据的缓冲区
-	rawBuffer := make([]byte, frameSize*channels*2) // 16位采样=2字节
+	// 分块传输时一次读取可能不是完整的采样点, 剩余字节留到下次处理
+	bytesPerSample := 2 * channels
+	readBuffer := make([]byte, frameSize*bytesPerSample)
+	var pending []byte
 	currentFramePos := 0
 	var firstFrame bool
 
+	encodeFrame := func(pcm []int16) bool {
+		n, err := d.enc.Encode(resampleFrame(pcm, sampleRate, opusSampleRate, opusFrameSize), opusBuffer)
+		if err != nil {
+			log.Errorf("PCM编码失败: %v", err)
+			return true
+		}
+		frameData := make([]byte, n)
+		copy(frameData, opusBuffer[:n])
+		if !firstFrame {
+			firstFrame = true
+			log.Infof("tts云端->首帧解码完成耗时: %d ms", time.Now().UnixMilli()-startTs)
+		}
+		select {
+		case <-d.ctx.Done():
+			return false
+		case d.outputOpusChan <- frameData:
+			return true
+		}
+	}
+
 	for {
 		select {
 		case <-d.ctx.Done():
 			log.Debugf("wavDecoder context done, exit")
 			return nil
 		default:
-			// 读取PCM数据
-			n, err := d.pipeReader.Read(rawBuffer)
-			if err == io.EOF {
-				// 处理剩余不足一帧的数据
-				if currentFramePos > 0 {
-					paddedFrame := make([]int16, frameSize)
-					copy(paddedFrame, pcmBuffer[:currentFramePos])
-
-					// 编码最后一帧
-					if n, err := d.enc.Encode(paddedFrame, opusBuffer); err == nil {
-						frameData := make([]byte, n)
-						copy(frameData, opusBuffer[:n])
-						d.outputOpusChan <- frameData
-					}
-				}
-				return nil
-			}
-			if err != nil {
-				return fmt.Errorf("读取PCM数据失败: %v", err)
-			}
+		}
 
-			// 将字节数据转换为int16采样点
-			samplesRead := n / (2 * channels) // 每个采样2字节,考虑通道数
+		n, readErr := d.pipeReader.Read(readBuffer)
+		if n > 0 {
+			pending = append(pending, readBuffer[:n]...)
+			samplesRead := len(pending) / bytesPerSample
 			for i := 0; i < samplesRead; i++ {
 				// 对于多通道,取平均值
 				var sampleSum int32
 				for ch := 0; ch < channels; ch++ {
-					pos := i*channels*2 + ch*2
-					sample := int16(uint16(rawBuffer[pos]) | uint16(rawBuffer[pos+1])<<8)
-					sampleSum += int32(sample)
+					pos := i*bytesPerSample + ch*2
+					sampleSum += int32(int16(binary.LittleEndian.Uint16(pending[pos:])))
 				}
-
-				// 计算多通道平均值
-				avgSample := int16(sampleSum / int32(channels))
-				pcmBuffer[currentFramePos] = avgSample
+				pcmBuffer[currentFramePos] = int16(sampleSum / int32(channels))
 				currentFramePos++
 
 				// 如果缓冲区已满,进行编码
 				if currentFramePos == frameSize {
-					if n, err := d.enc.Encode(pcmBuffer, opusBuffer); err == nil {
-						frameData := make([]byte, n)
-						copy(frameData, opusBuffer[:n])
-
-						if !firstFrame {
-							firstFrame = true
-							log.Infof("tts云端->首帧解码完成耗时: %d ms", time.Now().UnixMilli()-startTs)
-						}
-
-						d.outputOpusChan <- frameData
-					}
 					currentFramePos = 0
+					if !encodeFrame(pcmBuffer) {
+						log.Debugf("wavDecoder context done, exit")
+						return nil
+					}
 				}
 			}
+			pending = append(pending[:0], pending[samplesRead*bytesPerSample:]...)
+		}
+
+		if readErr == io.EOF {
+			// 处理剩余不足一帧的数据
+			if currentFramePos > 0 {
+				paddedFrame := make([]int16, frameSize)
+				copy(paddedFrame, pcmBuffer[:currentFramePos])
+				encodeFrame(paddedFrame)
+			}
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("读取PCM数据失败: %v", readErr)
 		}
 	}
 }
@@ -0,0 +1,94 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+type state int
+
+const (
+	stateClosed   state = iota // 正常放行
+	stateOpen                  // 熔断中, 冷却期内拒绝
+	stateHalfOpen              // 冷却期已过, 只放行一个试探请求
+)
+
+// Breaker 连续失败达到阈值后熔断, 冷却期过后进入半开状态, 只放行一个试探请求:
+// 试探成功则恢复, 失败则重新熔断
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     state
+	openUntil time.Time
+	probeAt   time.Time // 半开状态下放行试探请求的时间
+}
+
+// 熔断状态按名称全局共享, 提供者每个会话都会重新创建
+var (
+	breakers   = make(map[string]*Breaker)
+	breakersMu sync.Mutex
+)
+
+// Get 获取指定名称的熔断器, 不存在时创建, 已存在时更新阈值和冷却时间
+func Get(name string, threshold int, cooldown time.Duration) *Breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[name]
+	if !ok {
+		b = &Breaker{}
+		breakers[name] = b
+	}
+	b.mu.Lock()
+	b.threshold = threshold
+	b.cooldown = cooldown
+	b.mu.Unlock()
+	return b
+}
+
+// Allow 是否允许请求, 半开状态下只有第一个调用者获得试探机会
+// 试探请求超过冷却时间仍未上报结果时视为丢失, 重新放行一个试探
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	switch b.state {
+	case stateOpen:
+		if now.Before(b.openUntil) {
+			return false
+		}
+		b.state = stateHalfOpen
+		b.probeAt = now
+		return true
+	case stateHalfOpen:
+		if now.Sub(b.probeAt) < b.cooldown {
+			return false
+		}
+		b.probeAt = now
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.state = stateClosed
+	b.openUntil = time.Time{}
+}
+
+// Failure 记录失败, 返回是否进入熔断, 半开状态下试探失败直接重新熔断
+func (b *Breaker) Failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.state = stateOpen
+		b.openUntil = time.Now().Add(b.cooldown)
+		return true
+	}
+	return false
+}
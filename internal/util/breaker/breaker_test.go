@@ -0,0 +1,68 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakerOpen(t *testing.T) {
+	b := &Breaker{threshold: 2, cooldown: time.Hour}
+
+	assert.False(t, b.Failure())
+	assert.True(t, b.Allow())
+	assert.True(t, b.Failure())
+	assert.False(t, b.Allow())
+
+	b.Success()
+	assert.True(t, b.Allow())
+}
+
+func TestBreakerHalfOpenSingleProbe(t *testing.T) {
+	b := &Breaker{threshold: 1, cooldown: 20 * time.Millisecond}
+	assert.True(t, b.Failure())
+	assert.False(t, b.Allow())
+
+	time.Sleep(30 * time.Millisecond)
+	// 冷却期过后只放行一个试探请求
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+	assert.False(t, b.Allow())
+
+	// 试探成功后恢复
+	b.Success()
+	assert.True(t, b.Allow())
+	assert.True(t, b.Allow())
+}
+
+func TestBreakerHalfOpenProbeFailure(t *testing.T) {
+	b := &Breaker{threshold: 3, cooldown: 20 * time.Millisecond}
+	for i := 0; i < 3; i++ {
+		b.Failure()
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, b.Allow())
+	// 试探失败直接重新熔断, 需再等待冷却期
+	assert.True(t, b.Failure())
+	assert.False(t, b.Allow())
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+}
+
+func TestBreakerLostProbe(t *testing.T) {
+	b := &Breaker{threshold: 1, cooldown: 20 * time.Millisecond}
+	b.Failure()
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+
+	// 试探请求未上报结果, 超过冷却时间后重新放行一个试探
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+}
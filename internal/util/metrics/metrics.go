@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "xiaozhi"
+
+// 首包延迟的桶, 单位秒
+var latencyBuckets = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.75, 1, 1.5, 2, 3, 5, 10}
+
+var (
+	ActiveSessions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_sessions",
+		Help:      "当前活跃会话数",
+	}, []string{"transport"})
+
+	VadInUse = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "vad_pool_in_use",
+		Help:      "VAD 资源池中正在使用的实例数",
+	}, []string{"provider"})
+
+	AsrFirstResultLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "asr_first_result_latency_seconds",
+		Help:      "用户停止说话到获取 ASR 结果的耗时",
+		Buckets:   latencyBuckets,
+	})
+
+	LlmFirstTokenLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_first_token_latency_seconds",
+		Help:      "LLM 请求到首个响应的耗时",
+		Buckets:   latencyBuckets,
+	})
+
+	TtsFirstFrameLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tts_first_frame_latency_seconds",
+		Help:      "TTS 请求到首帧音频下发的耗时",
+		Buckets:   latencyBuckets,
+	})
+
+	ProviderErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_errors_total",
+		Help:      "各服务提供者的错误次数",
+	}, []string{"type", "provider"})
+
+	McpToolCallDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mcp_tool_call_duration_seconds",
+		Help:      "MCP 工具调用耗时",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"tool", "status"})
+
+	TtsCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tts_cache_requests_total",
+		Help:      "TTS 缓存查询次数, result 为 hit/miss",
+	}, []string{"provider", "result"})
+
+	TtsCacheSavedChars = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tts_cache_saved_chars_total",
+		Help:      "命中 TTS 缓存而免于合成的字符数",
+	}, []string{"provider"})
+
+	BargeIns = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "barge_in_total",
+		Help:      "服务端检测到用户说话而打断 tts 播放的次数",
+	})
+
+	UdpPacketDrops = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "udp_packet_drops_total",
+		Help:      "UDP 会话接收队列已满而丢弃的包数",
+	})
+
+	UdpPacketEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "udp_packet_events_total",
+		Help:      "UDP 音频收包异常, type 为 lost/reordered/late/duplicate/replayed/resynced",
+	}, []string{"type"})
+)
+
+// ObserveMs 以毫秒记录耗时
+func ObserveMs(histogram prometheus.Observer, ms int64) {
+	histogram.Observe(float64(ms) / 1000)
+}
+
+// ObserveDuration 记录从 start 开始的耗时
+func ObserveDuration(histogram prometheus.Observer, start time.Time) {
+	histogram.Observe(time.Since(start).Seconds())
+}
+
+// IncProviderError 记录服务提供者错误, type 为 asr/llm/tts/vad
+func IncProviderError(providerType string, provider string) {
+	ProviderErrors.WithLabelValues(providerType, provider).Inc()
+}
+
+// Handler 返回 /metrics 的 http 处理器
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve 在独立端口暴露 /metrics, 与设备连接的公网端口分开; token 非空时需携带 Authorization: Bearer <token>
+func Serve(listenAddr string, token string) error {
+	handler := Handler()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			authToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(authToken), []byte(token)) != 1 {
+				http.Error(w, "认证失败", http.StatusUnauthorized)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+	return http.ListenAndServe(listenAddr, mux)
+}
@@ -0,0 +1,186 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	log "xiaozhi-esp32-server-golang/logger"
+
+	"gopkg.in/hraban/opus.v2"
+)
+
+// oggPacketReader 从 Ogg 流中按顺序读取数据包, 处理跨页的数据包
+type oggPacketReader struct {
+	r       *bufio.Reader
+	packets [][]byte
+	partial []byte
+}
+
+func newOggPacketReader(r io.Reader) *oggPacketReader {
+	return &oggPacketReader{r: bufio.NewReader(r)}
+}
+
+// readPage 读取一页并拆分出其中完整的数据包
+func (o *oggPacketReader) readPage() error {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(o.r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return io.EOF
+		}
+		return err
+	}
+	if string(header[0:4]) != "OggS" {
+		return fmt.Errorf("无效的Ogg页")
+	}
+	segmentTable := make([]byte, header[26])
+	if _, err := io.ReadFull(o.r, segmentTable); err != nil {
+		return fmt.Errorf("读取Ogg页失败: %v", err)
+	}
+	pageSize := 0
+	for _, lacing := range segmentTable {
+		pageSize += int(lacing)
+	}
+	data := make([]byte, pageSize)
+	if _, err := io.ReadFull(o.r, data); err != nil {
+		return fmt.Errorf("读取Ogg页失败: %v", err)
+	}
+
+	// lacing 值为 255 表示数据包在下一段继续
+	offset := 0
+	for _, lacing := range segmentTable {
+		o.partial = append(o.partial, data[offset:offset+int(lacing)]...)
+		offset += int(lacing)
+		if lacing < 255 {
+			o.packets = append(o.packets, o.partial)
+			o.partial = nil
+		}
+	}
+	return nil
+}
+
+// ReadPacket 返回下一个数据包, 流结束时返回 io.EOF
+func (o *oggPacketReader) ReadPacket() ([]byte, error) {
+	for len(o.packets) == 0 {
+		if err := o.readPage(); err != nil {
+			return nil, err
+		}
+	}
+	packet := o.packets[0]
+	o.packets = o.packets[1:]
+	return packet, nil
+}
+
+// RunOggOpusDecoder 解码 Ogg 封装的 Opus, 转为单声道并按 perFrameDurationMs 重新分帧编码
+// 未指定目标采样率时按 48000 输出
+func (d *AudioDecoder) RunOggOpusDecoder(startTs int64) error {
+	defer close(d.outputOpusChan)
+
+	reader := newOggPacketReader(d.pipeReader)
+	head, err := reader.ReadPacket()
+	if err != nil {
+		return fmt.Errorf("读取OpusHead失败: %v", err)
+	}
+	if len(head) < 19 || !bytes.HasPrefix(head, []byte("OpusHead")) {
+		return fmt.Errorf("不是有效的Ogg Opus数据")
+	}
+	channels := int(head[9])
+	if channels < 1 || channels > 2 {
+		return fmt.Errorf("不支持的Opus声道数: %d", channels)
+	}
+
+	sampleRate := 48000
+	if d.targetSampleRate > 0 {
+		sampleRate = d.targetSampleRate
+	}
+	dec, err := opus.NewDecoder(sampleRate, channels)
+	if err != nil {
+		return fmt.Errorf("创建Opus解码器失败: %v", err)
+	}
+	enc, err := opus.NewEncoder(sampleRate, 1, opus.AppAudio)
+	if err != nil {
+		return fmt.Errorf("创建Opus编码器失败: %v", err)
+	}
+	d.enc = enc
+
+	// pre-skip 以 48k 采样点计, 为编码器延迟, 需丢弃
+	preSkip := int(binary.LittleEndian.Uint16(head[10:12])) * sampleRate / 48000
+	frameSize := sampleRate * d.perFrameDurationMs / 1000
+	decodeBuffer := make([]int16, sampleRate*120/1000*channels) // 单包最长120ms
+	opusBuffer := make([]byte, 1000)
+	var pcmBuffer []int16
+	var firstFrame bool
+
+	sendFrame := func(pcm []int16) bool {
+		n, err := d.enc.Encode(pcm, opusBuffer)
+		if err != nil {
+			log.Errorf("PCM编码失败: %v", err)
+			return true
+		}
+		frameData := make([]byte, n)
+		copy(frameData, opusBuffer[:n])
+		if !firstFrame {
+			firstFrame = true
+			log.Infof("tts云端->首帧解码完成耗时: %d ms", time.Now().UnixMilli()-startTs)
+		}
+		select {
+		case <-d.ctx.Done():
+			return false
+		case d.outputOpusChan <- frameData:
+			return true
+		}
+	}
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			log.Debugf("oggOpusDecoder context done, exit")
+			return nil
+		default:
+		}
+
+		packet, err := reader.ReadPacket()
+		if err == io.EOF {
+			if len(pcmBuffer) > 0 {
+				paddedFrame := make([]int16, frameSize)
+				copy(paddedFrame, pcmBuffer)
+				sendFrame(paddedFrame)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// 跳过 OpusTags 等非音频包
+		if len(packet) == 0 || bytes.HasPrefix(packet, []byte("OpusTags")) {
+			continue
+		}
+
+		n, err := dec.Decode(packet, decodeBuffer)
+		if err != nil {
+			log.Errorf("Opus解码失败: %v", err)
+			continue
+		}
+		for i := 0; i < n; i++ {
+			var sampleSum int32
+			for ch := 0; ch < channels; ch++ {
+				sampleSum += int32(decodeBuffer[i*channels+ch])
+			}
+			if preSkip > 0 {
+				preSkip--
+				continue
+			}
+			pcmBuffer = append(pcmBuffer, int16(sampleSum/int32(channels)))
+		}
+		for len(pcmBuffer) >= frameSize {
+			if !sendFrame(pcmBuffer[:frameSize]) {
+				log.Debugf("oggOpusDecoder context done, exit")
+				return nil
+			}
+			pcmBuffer = pcmBuffer[frameSize:]
+		}
+	}
+}
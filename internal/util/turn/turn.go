@@ -0,0 +1,58 @@
+package turn
+
+import "sync"
+
+// Collector 按轮次收集一个会话的数据, 会话录音与对话记录共用
+// 一轮在首次写入时创建, 结束时满足 keep 的轮次按顺序编号后交给 flush, 否则丢弃
+type Collector[T any] struct {
+	newTurn func() *T
+	keep    func(t *T) bool
+	flush   func(index int, t *T)
+
+	mu    sync.Mutex
+	index int
+	cur   *T
+}
+
+// NewCollector flush 在锁外调用, 耗时操作需自行异步
+func NewCollector[T any](newTurn func() *T, keep func(t *T) bool, flush func(index int, t *T)) *Collector[T] {
+	return &Collector[T]{
+		newTurn: newTurn,
+		keep:    keep,
+		flush:   flush,
+	}
+}
+
+// Update 在锁内修改当前轮, 当前轮不存在时先创建
+func (c *Collector[T]) Update(f func(t *T)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cur == nil {
+		c.cur = c.newTurn()
+	}
+	f(c.cur)
+}
+
+// UpdateCurrent 只在当前轮已存在时修改, 用于不应单独开启一轮的标记
+func (c *Collector[T]) UpdateCurrent(f func(t *T)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cur != nil {
+		f(c.cur)
+	}
+}
+
+// End 结束当前轮, 下次写入时开始新的一轮
+func (c *Collector[T]) End() {
+	c.mu.Lock()
+	t := c.cur
+	c.cur = nil
+	if t == nil || !c.keep(t) {
+		c.mu.Unlock()
+		return
+	}
+	c.index++
+	index := c.index
+	c.mu.Unlock()
+	c.flush(index, t)
+}
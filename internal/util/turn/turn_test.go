@@ -0,0 +1,43 @@
+package turn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type item struct {
+	text   string
+	marked bool
+}
+
+func TestCollector(t *testing.T) {
+	var flushed []string
+	var indexes []int
+	c := NewCollector(
+		func() *item { return &item{} },
+		func(t *item) bool { return t.text != "" },
+		func(index int, t *item) {
+			indexes = append(indexes, index)
+			flushed = append(flushed, t.text)
+		},
+	)
+
+	// 没有开始的轮次不会被标记创建
+	c.UpdateCurrent(func(t *item) { t.marked = true })
+	c.End()
+
+	c.Update(func(t *item) { t.marked = true })
+	c.End()
+
+	c.Update(func(t *item) { t.text = "a" })
+	c.Update(func(t *item) { t.text += "b" })
+	c.End()
+	c.End()
+
+	c.Update(func(t *item) { t.text = "c" })
+	c.End()
+
+	assert.Equal(t, []string{"ab", "c"}, flushed)
+	assert.Equal(t, []int{1, 2}, indexes)
+}
@@ -0,0 +1,130 @@
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 临时开启调试日志的设备, 全局级别高于 debug 时只有这些设备的会话级 logger(WithDevice)输出调试日志
+var (
+	deviceDebugMu    sync.RWMutex
+	deviceDebug      = make(map[string]time.Time) // 设备ID -> 到期时间
+	deviceDebugCount atomic.Int32
+)
+
+// SetDeviceDebug 为设备临时开启调试日志, 到期后自动恢复, duration <= 0 时立即关闭
+func SetDeviceDebug(deviceID string, duration time.Duration) {
+	deviceDebugMu.Lock()
+	defer deviceDebugMu.Unlock()
+	if duration <= 0 {
+		delete(deviceDebug, deviceID)
+	} else {
+		until := time.Now().Add(duration)
+		deviceDebug[deviceID] = until
+		time.AfterFunc(duration, func() { expireDeviceDebug(deviceID, until) })
+	}
+	deviceDebugCount.Store(int32(len(deviceDebug)))
+}
+
+// expireDeviceDebug 到期后移除, 期间重新设置过的不处理
+func expireDeviceDebug(deviceID string, until time.Time) {
+	deviceDebugMu.Lock()
+	defer deviceDebugMu.Unlock()
+	if current, ok := deviceDebug[deviceID]; ok && current.Equal(until) {
+		delete(deviceDebug, deviceID)
+		deviceDebugCount.Store(int32(len(deviceDebug)))
+	}
+}
+
+// DeviceDebugUntil 返回设备调试日志的到期时间, 未开启时返回 false
+func DeviceDebugUntil(deviceID string) (time.Time, bool) {
+	deviceDebugMu.RLock()
+	defer deviceDebugMu.RUnlock()
+	until, ok := deviceDebug[deviceID]
+	if !ok || time.Now().After(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+func deviceDebugEnabled() bool {
+	return deviceDebugCount.Load() > 0
+}
+
+// deviceDebugActive 设备的调试日志未到期
+func deviceDebugActive(deviceID string) bool {
+	if deviceID == "" || !deviceDebugEnabled() {
+		return false
+	}
+	_, ok := DeviceDebugUntil(deviceID)
+	return ok
+}
+
+// DeviceLogger 会话级 logger, 日志带 device_id 字段, 设备临时开启调试时即使全局级别高于 debug 也输出调试日志
+// nil 时与包级函数相同
+type DeviceLogger struct {
+	deviceID string
+}
+
+// WithDevice 返回设备的会话级 logger
+func WithDevice(deviceID string) *DeviceLogger {
+	return &DeviceLogger{deviceID: deviceID}
+}
+
+func (l *DeviceLogger) with(entry *log.Entry) *log.Entry {
+	if l == nil {
+		return entry
+	}
+	return entry.WithField("device_id", l.deviceID)
+}
+
+// debugEntry 返回输出调试日志的 entry, 不需要输出时返回 nil
+func (l *DeviceLogger) debugEntry(entry *log.Entry) *log.Entry {
+	if log.IsLevelEnabled(log.DebugLevel) {
+		return l.with(entry)
+	}
+	if l != nil && deviceDebugActive(l.deviceID) {
+		return debugEntry(l.with(entry))
+	}
+	return nil
+}
+
+func (l *DeviceLogger) Debug(args ...interface{}) {
+	if entry := l.debugEntry(addCallerField()); entry != nil {
+		entry.Debug(args...)
+	}
+}
+
+func (l *DeviceLogger) Debugf(format string, args ...interface{}) {
+	if entry := l.debugEntry(addCallerField()); entry != nil {
+		entry.Debugf(format, args...)
+	}
+}
+
+func (l *DeviceLogger) Infof(format string, args ...interface{}) {
+	l.with(addCallerField()).Infof(format, args...)
+}
+
+func (l *DeviceLogger) Warnf(format string, args ...interface{}) {
+	l.with(addCallerField()).Warnf(format, args...)
+}
+
+func (l *DeviceLogger) Errorf(format string, args ...interface{}) {
+	l.with(addCallerField()).Errorf(format, args...)
+}
+
+// debugEntry 全局级别未开启 debug 时, 用 debug 级别的 logger 输出设备的调试日志
+func debugEntry(entry *log.Entry) *log.Entry {
+	std := log.StandardLogger()
+	debugLogger := &log.Logger{
+		Out:       std.Out,
+		Hooks:     std.Hooks,
+		Formatter: std.Formatter,
+		Level:     log.DebugLevel,
+		ExitFunc:  std.ExitFunc,
+	}
+	return log.NewEntry(debugLogger).WithFields(entry.Data)
+}
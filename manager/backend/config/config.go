@@ -11,6 +11,7 @@ type Config struct {
 	Server   ServerConfig   `json:"server"`
 	Database DatabaseConfig `json:"database"`
 	JWT      JWTConfig      `json:"jwt"`
+	Firmware FirmwareConfig `json:"firmware"`
 }
 
 type ServerConfig struct {
@@ -26,6 +27,12 @@ type DatabaseConfig struct {
 	Database string `json:"database"`
 }
 
+// FirmwareConfig 固件存储配置
+type FirmwareConfig struct {
+	StorageDir  string `json:"storage_dir"`  // 固件文件存储目录
+	DownloadURL string `json:"download_url"` // 设备可访问的下载地址前缀, 为空时使用请求的Host
+}
+
 type JWTConfig struct {
 	Secret     string `json:"secret"`
 	ExpireHour int    `json:"expire_hour"`
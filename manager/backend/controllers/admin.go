@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -47,12 +48,14 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 
 	// 构建配置响应
 	type ConfigResponse struct {
-		VAD     models.Config `json:"vad"`
-		ASR     models.Config `json:"asr"`
-		LLM     models.Config `json:"llm"`
-		TTS     models.Config `json:"tts"`
-		Prompt  string        `json:"prompt"`
-		AgentID string        `json:"agent_id"`
+		VAD         models.Config `json:"vad"`
+		ASR         models.Config `json:"asr"`
+		LLM         models.Config `json:"llm"`
+		TTS         models.Config `json:"tts"`
+		Prompt      string        `json:"prompt"`
+		AgentID     string        `json:"agent_id"`
+		ASRSpeed    string        `json:"asr_speed"`
+		RecordAudio bool          `json:"record_audio"` // 是否录制该设备的会话音频
 	}
 
 	var response ConfigResponse
@@ -76,6 +79,7 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 		// 设备存在，查找智能体
 		deviceFound = true
 		response.AgentID = fmt.Sprintf("%d", device.AgentID)
+		response.RecordAudio = device.RecordAudio
 		log.Printf("设备 %s 存在，AgentID: %d", deviceID, device.AgentID)
 		if err := ac.DB.First(&agent, device.AgentID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
@@ -88,6 +92,7 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 			}
 		} else {
 			response.Prompt = agent.CustomPrompt
+			response.ASRSpeed = agent.ASRSpeed
 			log.Printf("智能体 %d 存在，使用自定义提示词", device.AgentID)
 		}
 	}
@@ -134,6 +139,9 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 		}
 	}
 
+	// chain 类型需要内联成员配置
+	ac.expandCompositeConfig(&response.LLM, "llm", "chain")
+
 	// 获取TTS配置
 	if deviceFound && agent.ID != 0 && agent.TTSConfigID != nil && *agent.TTSConfigID != "" {
 		// 如果智能体指定了TTS配置，尝试使用它
@@ -152,9 +160,78 @@ func (ac *AdminController) GetDeviceConfigs(c *gin.Context) {
 		}
 	}
 
+	// failover 类型需要内联成员配置
+	ac.expandCompositeConfig(&response.TTS, "tts", "failover")
+
 	c.JSON(http.StatusOK, gin.H{"data": response})
 }
 
+// isCompositeConfig 判断配置是否为组合类型, LLM 链记录在 json_data 的 type 中, TTS 链记录在提供商中
+func isCompositeConfig(config *models.Config, data map[string]interface{}, compositeType string) bool {
+	return config.Provider == compositeType || data["type"] == compositeType
+}
+
+// expandCompositeConfig 将组合类型配置(LLM chain、TTS failover)中按配置ID引用的成员的提供商和配置内联到 json_data
+// configType 为成员的配置类型, 不存在、未启用或同为组合类型的成员会被忽略
+func (ac *AdminController) expandCompositeConfig(config *models.Config, configType, compositeType string) {
+	label := strings.ToUpper(configType) + "链"
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(config.JsonData), &data); err != nil {
+		if config.Provider == compositeType {
+			log.Printf("解析%s %s 配置失败: %v", label, config.ConfigID, err)
+		}
+		return
+	}
+	if !isCompositeConfig(config, data, compositeType) {
+		return
+	}
+
+	items, _ := data["providers"].([]interface{})
+	members := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		var member map[string]interface{}
+		switch v := item.(type) {
+		case string:
+			member = map[string]interface{}{"name": v}
+		case map[string]interface{}:
+			member = v
+		default:
+			continue
+		}
+		if _, ok := member["config"]; ok {
+			members = append(members, member)
+			continue
+		}
+
+		name, _ := member["name"].(string)
+		var memberConfig models.Config
+		if err := ac.DB.Where("config_id = ? AND type = ? AND enabled = ?", name, configType, true).First(&memberConfig).Error; err != nil {
+			log.Printf("%s %s 的成员 %s 不存在或未启用: %v", label, config.ConfigID, name, err)
+			continue
+		}
+		var memberData map[string]interface{}
+		if err := json.Unmarshal([]byte(memberConfig.JsonData), &memberData); err != nil {
+			log.Printf("解析%s成员 %s 配置失败: %v", label, name, err)
+			continue
+		}
+		if isCompositeConfig(&memberConfig, memberData, compositeType) {
+			log.Printf("%s %s 的成员 %s 不能是 %s 类型", label, config.ConfigID, name, compositeType)
+			continue
+		}
+		member["provider"] = memberConfig.Provider
+		member["config"] = memberData
+		members = append(members, member)
+	}
+	data["providers"] = members
+
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("序列化%s %s 配置失败: %v", label, config.ConfigID, err)
+		return
+	}
+	config.JsonData = string(jsonData)
+}
+
 // GetSystemConfigs 获取系统配置信息，包括mqtt, mqtt_server, udp, ota, mcp, local_mcp
 func (ac *AdminController) GetSystemConfigs(c *gin.Context) {
 	// 一次性获取所有相关配置（包括启用和未启用的）
@@ -743,6 +820,127 @@ func (ac *AdminController) GetDevices(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": devices})
 }
 
+// SpeakToDevice 通过主程序向在线设备下发主动播报
+func (ac *AdminController) SpeakToDevice(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var device models.Device
+	if err := ac.DB.First(&device, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在"})
+		return
+	}
+
+	var req struct {
+		Text      string `json:"text" binding:"required"`
+		UseLlm    bool   `json:"use_llm"`
+		Interrupt bool   `json:"interrupt"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if ac.WebSocketController == nil || !ac.WebSocketController.HasConnectedClient() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "主程序未连接"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	response, err := ac.WebSocketController.RequestDeviceSpeak(ctx, device.DeviceName, req.Text, req.UseLlm, req.Interrupt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("下发主动播报失败: %v", err)})
+		return
+	}
+	if response.Status != http.StatusOK {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("下发主动播报失败: %s", response.Error)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response.Body})
+}
+
+// CallDeviceMcpTool 通过主程序调用在线设备上报的MCP工具
+func (ac *AdminController) CallDeviceMcpTool(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var device models.Device
+	if err := ac.DB.First(&device, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在"})
+		return
+	}
+
+	var req struct {
+		Tool      string                 `json:"tool" binding:"required"`
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if ac.WebSocketController == nil || !ac.WebSocketController.HasConnectedClient() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "主程序未连接"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 20*time.Second)
+	defer cancel()
+	response, err := ac.WebSocketController.RequestDeviceMcpCall(ctx, device.DeviceName, req.Tool, req.Arguments)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("调用设备工具失败: %v", err)})
+		return
+	}
+	if response.Status != http.StatusOK {
+		c.JSON(response.Status, gin.H{"error": fmt.Sprintf("调用设备工具失败: %s", response.Error)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response.Body})
+}
+
+// GetClusterNodes 获取已连接的主程序节点
+func (ac *AdminController) GetClusterNodes(c *gin.Context) {
+	if ac.WebSocketController == nil {
+		c.JSON(http.StatusOK, gin.H{"data": []interface{}{}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": ac.WebSocketController.GetConnectedNodes()})
+}
+
+// RevokeDeviceToken 吊销设备的websocket令牌, 设备需重新OTA获取新令牌
+func (ac *AdminController) RevokeDeviceToken(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var device models.Device
+	if err := ac.DB.First(&device, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在"})
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	// 请求体可为空, 为空时吊销设备全部令牌
+	_ = c.ShouldBindJSON(&req)
+
+	if ac.WebSocketController == nil || !ac.WebSocketController.HasConnectedClient() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "主程序未连接"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	response, err := ac.WebSocketController.RequestRevokeDeviceToken(ctx, device.DeviceName, req.Token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("吊销令牌失败: %v", err)})
+		return
+	}
+	if response.Status != http.StatusOK {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("吊销令牌失败: %s", response.Error)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response.Body})
+}
+
 // 验证设备代码是否存在
 func (ac *AdminController) ValidateDeviceCode(c *gin.Context) {
 	deviceCode := c.Query("code")
@@ -765,10 +963,11 @@ func (ac *AdminController) ValidateDeviceCode(c *gin.Context) {
 
 func (ac *AdminController) CreateDevice(c *gin.Context) {
 	var req struct {
-		UserID     uint   `json:"user_id" binding:"required"`
-		DeviceCode string `json:"device_code"`
-		DeviceName string `json:"device_name"`
-		AgentID    uint   `json:"agent_id"`
+		UserID      uint   `json:"user_id" binding:"required"`
+		DeviceCode  string `json:"device_code"`
+		DeviceName  string `json:"device_name"`
+		AgentID     uint   `json:"agent_id"`
+		RecordAudio bool   `json:"record_audio"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -800,6 +999,8 @@ func (ac *AdminController) CreateDevice(c *gin.Context) {
 			}
 			existingDevice.AgentID = req.AgentID // 更新智能体ID
 			existingDevice.Activated = true      // 激活设备
+			existingDevice.ClientID = ""         // 重新激活, 绑定之后首次上报的 Client-Id
+			existingDevice.RecordAudio = req.RecordAudio
 
 			if err := ac.DB.Save(&existingDevice).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设备失败"})
@@ -821,11 +1022,12 @@ func (ac *AdminController) CreateDevice(c *gin.Context) {
 
 	// 创建设备
 	device := models.Device{
-		UserID:     req.UserID,
-		DeviceCode: req.DeviceCode,
-		DeviceName: req.DeviceName,
-		AgentID:    req.AgentID, // 使用请求中的智能体ID
-		Activated:  true,        // 管理员创建的设备默认已激活
+		UserID:      req.UserID,
+		DeviceCode:  req.DeviceCode,
+		DeviceName:  req.DeviceName,
+		AgentID:     req.AgentID, // 使用请求中的智能体ID
+		Activated:   true,        // 管理员创建的设备默认已激活
+		RecordAudio: req.RecordAudio,
 	}
 
 	if err := ac.DB.Create(&device).Error; err != nil {
@@ -849,11 +1051,12 @@ func (ac *AdminController) UpdateDevice(c *gin.Context) {
 	}
 
 	var updateData struct {
-		UserID     uint   `json:"user_id"`
-		DeviceCode string `json:"device_code"`
-		DeviceName string `json:"device_name"`
-		Activated  bool   `json:"activated"`
-		AgentID    uint   `json:"agent_id"`
+		UserID      uint   `json:"user_id"`
+		DeviceCode  string `json:"device_code"`
+		DeviceName  string `json:"device_name"`
+		Activated   bool   `json:"activated"`
+		AgentID     uint   `json:"agent_id"`
+		RecordAudio bool   `json:"record_audio"`
 	}
 
 	if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -866,7 +1069,12 @@ func (ac *AdminController) UpdateDevice(c *gin.Context) {
 	device.DeviceCode = updateData.DeviceCode
 	device.DeviceName = updateData.DeviceName
 	device.Activated = updateData.Activated
+	// 取消激活时解除 Client-Id 绑定, 重新激活后绑定新的 Client-Id
+	if !device.Activated {
+		device.ClientID = ""
+	}
 	device.AgentID = updateData.AgentID
+	device.RecordAudio = updateData.RecordAudio
 
 	if err := ac.DB.Save(&device).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设备失败"})
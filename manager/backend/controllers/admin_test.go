@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestExpandCompositeConfig(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Config{}))
+	ac := &AdminController{DB: db}
+
+	require.NoError(t, db.Create([]models.Config{
+		{Type: "llm", Name: "a", ConfigID: "llm-a", Provider: "openai", JsonData: `{"type":"openai","model_name":"a"}`, Enabled: true},
+		{Type: "llm", Name: "chain", ConfigID: "llm-chain", Provider: "openai", JsonData: `{"type":"chain","providers":["llm-a"]}`, Enabled: true},
+		{Type: "tts", Name: "edge", ConfigID: "tts-edge", Provider: "edge", JsonData: `{"voice":"x"}`, Enabled: true},
+		{Type: "tts", Name: "failover", ConfigID: "tts-failover", Provider: "failover", JsonData: `{"providers":["tts-edge"]}`, Enabled: true},
+	}).Error)
+	// 未启用的成员会被忽略
+	require.NoError(t, db.Model(&models.Config{}).Create(map[string]interface{}{
+		"type": "llm", "name": "b", "config_id": "llm-b", "provider": "openai", "json_data": `{"type":"openai"}`, "enabled": false,
+	}).Error)
+
+	expand := func(config models.Config, configType, compositeType string) []interface{} {
+		ac.expandCompositeConfig(&config, configType, compositeType)
+		var data map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(config.JsonData), &data))
+		members, _ := data["providers"].([]interface{})
+		return members
+	}
+
+	// 成员不能同为组合类型
+	members := expand(models.Config{
+		ConfigID: "chain-1",
+		Provider: "openai",
+		JsonData: `{"type":"chain","providers":["llm-a","llm-b","llm-chain",{"name":"inline","config":{"type":"ollama"}}]}`,
+	}, "llm", "chain")
+	require.Len(t, members, 2)
+	first := members[0].(map[string]interface{})
+	assert.Equal(t, "llm-a", first["name"])
+	assert.Equal(t, "openai", first["provider"])
+	assert.Equal(t, "a", first["config"].(map[string]interface{})["model_name"])
+	assert.Equal(t, "inline", members[1].(map[string]interface{})["name"])
+
+	members = expand(models.Config{
+		ConfigID: "failover-1",
+		Provider: "failover",
+		JsonData: `{"providers":["tts-edge","tts-failover"]}`,
+	}, "tts", "failover")
+	require.Len(t, members, 1)
+	first = members[0].(map[string]interface{})
+	assert.Equal(t, "edge", first["provider"])
+	assert.Equal(t, "x", first["config"].(map[string]interface{})["voice"])
+
+	// 非组合类型的配置保持不变
+	plain := models.Config{Provider: "edge", JsonData: `{"voice":"x"}`}
+	ac.expandCompositeConfig(&plain, "tts", "failover")
+	assert.Equal(t, `{"voice":"x"}`, plain.JsonData)
+}
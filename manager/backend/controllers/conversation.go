@@ -0,0 +1,454 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 导出时每批从数据库读取的轮次数
+const exportBatchSize = 500
+
+type ConversationController struct {
+	DB                  *gorm.DB
+	WebSocketController *WebSocketController
+}
+
+// saveConversationTurn 保存主程序推送的一轮对话, 会话不存在时创建
+func saveConversationTurn(db *gorm.DB, body map[string]interface{}) error {
+	var req struct {
+		SessionID       string          `json:"session_id"`
+		DeviceID        string          `json:"device_id"`
+		AgentID         string          `json:"agent_id"`
+		TurnIndex       int             `json:"turn_index"`
+		StartTime       time.Time       `json:"start_time"`
+		UserText        string          `json:"user_text"`
+		AssistantText   string          `json:"assistant_text"`
+		ToolCalls       json.RawMessage `json:"tool_calls"`
+		Interrupted     bool            `json:"interrupted"`
+		AsrMs           int64           `json:"asr_ms"`
+		LlmFirstTokenMs int64           `json:"llm_first_token_ms"`
+		TtsFirstFrameMs int64           `json:"tts_first_frame_ms"`
+		TotalMs         int64           `json:"total_ms"`
+	}
+	if err := mapToStruct(body, &req); err != nil {
+		return fmt.Errorf("解析对话记录失败: %v", err)
+	}
+	if req.SessionID == "" {
+		return fmt.Errorf("缺少session_id")
+	}
+	if req.StartTime.IsZero() {
+		req.StartTime = time.Now()
+	}
+
+	// 用户和智能体以设备当前的归属为准
+	agentID, _ := strconv.Atoi(req.AgentID)
+	var userID uint
+	var device models.Device
+	if err := db.Where("device_name = ?", req.DeviceID).First(&device).Error; err == nil {
+		userID = device.UserID
+		agentID = int(device.AgentID)
+	}
+
+	turn := models.ConversationTurn{
+		SessionID:       req.SessionID,
+		DeviceName:      req.DeviceID,
+		AgentID:         uint(agentID),
+		UserID:          userID,
+		TurnIndex:       req.TurnIndex,
+		UserText:        req.UserText,
+		AssistantText:   req.AssistantText,
+		Interrupted:     req.Interrupted,
+		AsrMs:           req.AsrMs,
+		LlmFirstTokenMs: req.LlmFirstTokenMs,
+		TtsFirstFrameMs: req.TtsFirstFrameMs,
+		TotalMs:         req.TotalMs,
+		StartedAt:       req.StartTime,
+	}
+	if len(req.ToolCalls) > 0 && string(req.ToolCalls) != "null" {
+		turn.ToolCalls = string(req.ToolCalls)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&turn).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		var session models.ConversationSession
+		err := tx.Where("session_id = ?", req.SessionID).First(&session).Error
+		if err == gorm.ErrRecordNotFound {
+			session = models.ConversationSession{
+				SessionID:    req.SessionID,
+				DeviceName:   turn.DeviceName,
+				AgentID:      turn.AgentID,
+				UserID:       turn.UserID,
+				TurnCount:    1,
+				StartedAt:    turn.StartedAt,
+				LastActiveAt: now,
+			}
+			return tx.Create(&session).Error
+		} else if err != nil {
+			return err
+		}
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"turn_count":     gorm.Expr("turn_count + ?", 1),
+			"last_active_at": now,
+		}).Error
+	})
+}
+
+// parseTimeParam 支持 2006-01-02 和 RFC3339, 仅日期的结束时间包含当天
+func parseTimeParam(value string, isEnd bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("时间格式错误: %s", value)
+	}
+	if isEnd {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// applyConversationFilter 按设备、智能体、用户和时间范围过滤, 会话和轮次通用
+func applyConversationFilter(c *gin.Context, query *gorm.DB) (*gorm.DB, error) {
+	if deviceName := c.Query("device_name"); deviceName != "" {
+		query = query.Where("device_name = ?", deviceName)
+	}
+	if agentID := c.Query("agent_id"); agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if startTime := c.Query("start_time"); startTime != "" {
+		t, err := parseTimeParam(startTime, false)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("started_at >= ?", t)
+	}
+	if endTime := c.Query("end_time"); endTime != "" {
+		t, err := parseTimeParam(endTime, true)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("started_at < ?", t)
+	}
+	return query, nil
+}
+
+// applyKeywordFilter 在用户输入和回复中搜索关键词
+func applyKeywordFilter(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if keyword := c.Query("keyword"); keyword != "" {
+		like := "%" + keyword + "%"
+		query = query.Where("(user_text LIKE ? OR assistant_text LIKE ?)", like, like)
+	}
+	return query
+}
+
+func getPageParams(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	return page, pageSize
+}
+
+// GetConversations 分页获取会话列表
+// GET /api/admin/conversations?device_name=&agent_id=&user_id=&start_time=&end_time=&keyword=&page=&page_size=
+func (cc *ConversationController) GetConversations(c *gin.Context) {
+	query, err := applyConversationFilter(c, cc.DB.Model(&models.ConversationSession{}))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 关键词匹配任意一轮即返回该会话
+	if c.Query("keyword") != "" {
+		turnQuery := applyKeywordFilter(c, cc.DB.Model(&models.ConversationTurn{}).Select("session_id"))
+		query = query.Where("session_id IN (?)", turnQuery)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询会话失败"})
+		return
+	}
+	page, pageSize := getPageParams(c)
+	var sessions []models.ConversationSession
+	if err := query.Order("started_at desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询会话失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": sessions, "total": total, "page": page, "page_size": pageSize})
+}
+
+// SearchConversationTurns 分页搜索对话轮次, 条件同 GetConversations
+// GET /api/admin/conversations/turns
+func (cc *ConversationController) SearchConversationTurns(c *gin.Context) {
+	query, err := applyConversationFilter(c, cc.DB.Model(&models.ConversationTurn{}))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query = applyKeywordFilter(c, query)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询对话记录失败"})
+		return
+	}
+	page, pageSize := getPageParams(c)
+	var turns []models.ConversationTurn
+	if err := query.Order("started_at desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&turns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询对话记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": turns, "total": total, "page": page, "page_size": pageSize})
+}
+
+// GetConversation 获取会话及其全部轮次
+func (cc *ConversationController) GetConversation(c *gin.Context) {
+	sessionID := c.Param("session_id")
+	var session models.ConversationSession
+	if err := cc.DB.Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+	var turns []models.ConversationTurn
+	if err := cc.DB.Where("session_id = ?", sessionID).Order("turn_index").Find(&turns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询对话记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"session": session, "turns": turns}})
+}
+
+// ExportConversations 按条件导出对话轮次, format 为 json(默认) 或 csv
+// 按写入顺序分批读取并边读边写, 不限制导出的总数
+// GET /api/admin/conversations/export
+func (cc *ConversationController) ExportConversations(c *gin.Context) {
+	query, err := applyConversationFilter(c, cc.DB.Model(&models.ConversationTurn{}))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query = applyKeywordFilter(c, query)
+
+	fileName := "conversations_" + time.Now().Format("20060102150405")
+	var writeBatch func(turns []models.ConversationTurn) error
+	var finish func()
+	if c.Query("format") != "csv" {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename="+fileName+".json")
+		c.Writer.WriteString("[")
+		first := true
+		writeBatch = func(turns []models.ConversationTurn) error {
+			for _, turn := range turns {
+				data, err := json.Marshal(turn)
+				if err != nil {
+					return err
+				}
+				if !first {
+					c.Writer.WriteString(",")
+				}
+				first = false
+				if _, err := c.Writer.Write(data); err != nil {
+					return err
+				}
+			}
+			c.Writer.Flush()
+			return nil
+		}
+		finish = func() {
+			c.Writer.WriteString("]")
+		}
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", "attachment; filename="+fileName+".csv")
+		// 带 BOM, Excel 打开中文不乱码
+		c.Writer.WriteString("\xEF\xBB\xBF")
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"时间", "会话ID", "设备", "智能体ID", "用户ID", "轮次", "用户输入", "回复", "工具调用", "被打断",
+			"识别耗时(ms)", "LLM首响应(ms)", "TTS首帧(ms)", "总耗时(ms)"})
+		writeBatch = func(turns []models.ConversationTurn) error {
+			for _, turn := range turns {
+				w.Write([]string{
+					turn.StartedAt.Format("2006-01-02 15:04:05"),
+					turn.SessionID,
+					turn.DeviceName,
+					strconv.Itoa(int(turn.AgentID)),
+					strconv.Itoa(int(turn.UserID)),
+					strconv.Itoa(turn.TurnIndex),
+					turn.UserText,
+					turn.AssistantText,
+					turn.ToolCalls,
+					strconv.FormatBool(turn.Interrupted),
+					strconv.FormatInt(turn.AsrMs, 10),
+					strconv.FormatInt(turn.LlmFirstTokenMs, 10),
+					strconv.FormatInt(turn.TtsFirstFrameMs, 10),
+					strconv.FormatInt(turn.TotalMs, 10),
+				})
+			}
+			w.Flush()
+			return w.Error()
+		}
+		finish = func() {}
+	}
+	c.Status(http.StatusOK)
+
+	var turns []models.ConversationTurn
+	err = query.FindInBatches(&turns, exportBatchSize, func(tx *gorm.DB, batch int) error {
+		return writeBatch(turns)
+	}).Error
+	if err != nil {
+		// 响应头已发送, 只能中断输出, 不完整的文件无法被正常解析
+		log.Printf("导出对话记录失败: %v", err)
+		return
+	}
+	finish()
+}
+
+// DeleteConversation 删除单个会话及其轮次
+func (cc *ConversationController) DeleteConversation(c *gin.Context) {
+	sessionID := c.Param("session_id")
+	err := cc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", sessionID).Delete(&models.ConversationTurn{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("session_id = ?", sessionID).Delete(&models.ConversationSession{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除会话失败"})
+		return
+	}
+	log.Printf("已删除会话 %s 的对话记录", sessionID)
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// DeleteConversations 按条件批量删除对话记录
+// 未指定时间范围时为隐私删除, 同时通知主程序删除所涉及设备在 Redis 中的 LLM 历史、记忆摘要以及会话录音;
+// 指定时间范围时只删除范围内的对话记录
+// DELETE /api/admin/conversations?device_name=&user_id=&agent_id=&start_time=&end_time=
+func (cc *ConversationController) DeleteConversations(c *gin.Context) {
+	if c.Query("device_name") == "" && c.Query("user_id") == "" && c.Query("agent_id") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "device_name、user_id、agent_id至少指定一个"})
+		return
+	}
+	if _, err := applyConversationFilter(c, cc.DB); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	privacyDelete := c.Query("start_time") == "" && c.Query("end_time") == ""
+	var deviceNames []string
+	if privacyDelete {
+		if cc.WebSocketController == nil || !cc.WebSocketController.HasConnectedClient() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "主程序未连接, 无法删除设备的对话记忆和录音"})
+			return
+		}
+		var err error
+		if deviceNames, err = cc.findDeviceNames(c); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询设备失败: " + err.Error()})
+			return
+		}
+	}
+
+	var deletedTurns, deletedSessions int64
+	err := cc.DB.Transaction(func(tx *gorm.DB) error {
+		turnQuery, _ := applyConversationFilter(c, tx.Model(&models.ConversationTurn{}))
+		result := turnQuery.Delete(&models.ConversationTurn{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deletedTurns = result.RowsAffected
+
+		// 删除已没有轮次的会话
+		sessionQuery, _ := applyConversationFilter(c, tx.Model(&models.ConversationSession{}))
+		result = sessionQuery.Where("session_id NOT IN (?)", tx.Model(&models.ConversationTurn{}).Select("session_id")).
+			Delete(&models.ConversationSession{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deletedSessions = result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除对话记录失败: " + err.Error()})
+		return
+	}
+	log.Printf("按条件删除对话记录: %s, 轮次: %d, 会话: %d", c.Request.URL.RawQuery, deletedTurns, deletedSessions)
+
+	data := gin.H{"deleted_turns": deletedTurns, "deleted_sessions": deletedSessions, "deleted_devices": deviceNames}
+	var failed []string
+	for _, deviceName := range deviceNames {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Minute)
+		response, err := cc.WebSocketController.RequestDeleteDeviceData(ctx, deviceName)
+		cancel()
+		if err == nil && response.Status != http.StatusOK {
+			err = fmt.Errorf("%s", response.Error)
+		}
+		if err != nil {
+			log.Printf("删除设备 %s 的对话记忆和录音失败: %v", deviceName, err)
+			failed = append(failed, deviceName)
+		}
+	}
+	if len(failed) > 0 {
+		data["failed_devices"] = failed
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "部分设备的对话记忆和录音删除失败, 请重试", "data": data})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// findDeviceNames 隐私删除涉及的设备: 有对话记录的设备以及当前归属于该用户或智能体的设备
+func (cc *ConversationController) findDeviceNames(c *gin.Context) ([]string, error) {
+	var fromTurns []string
+	turnQuery, _ := applyConversationFilter(c, cc.DB.Model(&models.ConversationTurn{}))
+	if err := turnQuery.Distinct("device_name").Pluck("device_name", &fromTurns).Error; err != nil {
+		return nil, err
+	}
+
+	var fromDevices []string
+	deviceQuery := cc.DB.Model(&models.Device{})
+	if deviceName := c.Query("device_name"); deviceName != "" {
+		deviceQuery = deviceQuery.Where("device_name = ?", deviceName)
+	}
+	if agentID := c.Query("agent_id"); agentID != "" {
+		deviceQuery = deviceQuery.Where("agent_id = ?", agentID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		deviceQuery = deviceQuery.Where("user_id = ?", userID)
+	}
+	if err := deviceQuery.Pluck("device_name", &fromDevices).Error; err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var deviceNames []string
+	for _, name := range append(fromTurns, fromDevices...) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			deviceNames = append(deviceNames, name)
+		}
+	}
+	return deviceNames, nil
+}
@@ -46,14 +46,33 @@ func generateChallenge() string {
 		randomBytes[10:16])
 }
 
-// 1. 判断设备是否已激活
+// clientMismatchMessage 设备已绑定其它 Client-Id 时的提示
+const clientMismatchMessage = "设备已被其他客户端激活, 需重新激活"
+
+// bindClient 检查 clientId 是否为设备激活时绑定的 Client-Id, clientId 为空时不检查(服务端已校验过令牌)
+// 在绑定 Client-Id 之前激活的设备, 绑定首次上报的 Client-Id
+func (dac *DeviceActivationController) bindClient(device *models.Device, clientId string) (bool, error) {
+	if clientId == "" || device.ClientID == clientId {
+		return true, nil
+	}
+	if device.ClientID != "" {
+		return false, nil
+	}
+	device.ClientID = clientId
+	if err := dac.DB.Model(device).Update("client_id", clientId).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// 1. 判断设备是否已激活, 传入 client_id 时还需与激活时绑定的一致
 // GET /api/public/device/check-activation?device_id=xxx&client_id=xxx
 func (dac *DeviceActivationController) CheckDeviceActivation(c *gin.Context) {
 	deviceId := c.Query("device_id")
 	clientId := c.Query("client_id")
 
-	if deviceId == "" || clientId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "device_id和client_id参数必填"})
+	if deviceId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "device_id参数必填"})
 		return
 	}
 
@@ -71,6 +90,21 @@ func (dac *DeviceActivationController) CheckDeviceActivation(c *gin.Context) {
 		return
 	}
 
+	if device.Activated {
+		bound, err := dac.bindClient(&device, clientId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设备信息失败"})
+			return
+		}
+		if !bound {
+			c.JSON(http.StatusOK, gin.H{
+				"activated": false,
+				"message":   clientMismatchMessage,
+			})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"activated": device.Activated,
 		"message": func() string {
@@ -88,8 +122,8 @@ func (dac *DeviceActivationController) GetActivationInfo(c *gin.Context) {
 	deviceId := c.Query("device_id")
 	clientId := c.Query("client_id")
 
-	if deviceId == "" || clientId == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "device_id和client_id参数必填"})
+	if deviceId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "device_id参数必填"})
 		return
 	}
 
@@ -119,8 +153,20 @@ func (dac *DeviceActivationController) GetActivationInfo(c *gin.Context) {
 		}
 	}
 
-	// 如果设备已激活，直接返回状态
+	// 如果设备已激活，直接返回状态, 已绑定其它 Client-Id 时不下发激活码
 	if device.Activated {
+		bound, err := dac.bindClient(&device, clientId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设备信息失败"})
+			return
+		}
+		if !bound {
+			c.JSON(http.StatusOK, gin.H{
+				"activated": false,
+				"message":   clientMismatchMessage,
+			})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"activated": true,
 			"message":   "设备已激活",
@@ -213,6 +259,21 @@ func (dac *DeviceActivationController) ActivateDevice(c *gin.Context) {
 
 	// 检查设备是否已经激活
 	if device.Activated {
+		bound, err := dac.bindClient(&device, req.ClientId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"error":   "更新设备信息失败",
+			})
+			return
+		}
+		if !bound {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"error":   clientMismatchMessage,
+			})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "设备已激活",
@@ -245,8 +306,9 @@ func (dac *DeviceActivationController) ActivateDevice(c *gin.Context) {
 		return
 	}
 
-	// 激活设备
+	// 激活设备并绑定 Client-Id
 	device.Activated = true
+	device.ClientID = req.ClientId
 	if err := dac.DB.Save(&device).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newActivationTestRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Device{}))
+
+	dac := &DeviceActivationController{DB: db}
+	r := gin.New()
+	r.GET("/api/public/device/check-activation", dac.CheckDeviceActivation)
+	r.GET("/api/public/device/activation-info", dac.GetActivationInfo)
+	r.POST("/api/public/device/activate", dac.ActivateDevice)
+	return r, db
+}
+
+func doActivationRequest(r *gin.Engine, method, url string, body interface{}) (int, map[string]interface{}) {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, url, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestActivationBindsClientId(t *testing.T) {
+	r, db := newActivationTestRouter(t)
+	require.NoError(t, db.Create(&models.Device{
+		UserID:     1,
+		DeviceName: "ba:8f:17:de:94:94",
+		DeviceCode: "123456",
+		Challenge:  "challenge-1",
+	}).Error)
+
+	activate := func(clientId string) int {
+		code, _ := doActivationRequest(r, http.MethodPost, "/api/public/device/activate", map[string]string{
+			"device_id":     "ba:8f:17:de:94:94",
+			"client_id":     clientId,
+			"challenge":     "challenge-1",
+			"algorithm":     "hmac-sha256",
+			"serial_number": "sn",
+			"hmac":          "hmac",
+		})
+		return code
+	}
+	check := func(clientId string) bool {
+		_, resp := doActivationRequest(r, http.MethodGet, "/api/public/device/check-activation?device_id=ba:8f:17:de:94:94&client_id="+clientId, nil)
+		return resp["activated"] == true
+	}
+
+	assert.Equal(t, http.StatusOK, activate("client-1"))
+	assert.True(t, check("client-1"))
+
+	// 只知道 Device-Id 的其它客户端视为未激活, 服务端不会签发令牌, 也拿不到激活码
+	assert.False(t, check("client-2"))
+	_, info := doActivationRequest(r, http.MethodGet, "/api/public/device/activation-info?device_id=ba:8f:17:de:94:94&client_id=client-2", nil)
+	assert.Equal(t, false, info["activated"])
+	assert.Nil(t, info["challenge"])
+	assert.Equal(t, http.StatusForbidden, activate("client-2"))
+
+	// 取消激活后可由新的客户端重新激活
+	require.NoError(t, db.Model(&models.Device{}).Where("device_name = ?", "ba:8f:17:de:94:94").
+		Updates(map[string]interface{}{"activated": false, "client_id": ""}).Error)
+	assert.Equal(t, http.StatusOK, activate("client-2"))
+	assert.True(t, check("client-2"))
+	assert.False(t, check("client-1"))
+}
+
+func TestActivationBindsFirstClientOfLegacyDevice(t *testing.T) {
+	r, db := newActivationTestRouter(t)
+	// 绑定 Client-Id 之前已激活的设备
+	require.NoError(t, db.Create(&models.Device{
+		UserID:     1,
+		DeviceName: "legacy",
+		DeviceCode: "654321",
+		Activated:  true,
+	}).Error)
+
+	_, resp := doActivationRequest(r, http.MethodGet, "/api/public/device/check-activation?device_id=legacy&client_id=client-1", nil)
+	assert.Equal(t, true, resp["activated"])
+	_, resp = doActivationRequest(r, http.MethodGet, "/api/public/device/check-activation?device_id=legacy&client_id=client-2", nil)
+	assert.Equal(t, false, resp["activated"])
+	// 服务端已校验过令牌的会话不带 client_id
+	_, resp = doActivationRequest(r, http.MethodGet, "/api/public/device/check-activation?device_id=legacy", nil)
+	assert.Equal(t, true, resp["activated"])
+}
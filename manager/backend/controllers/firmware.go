@@ -0,0 +1,649 @@
+package controllers
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"xiaozhi/manager/backend/config"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	RolloutStatusActive     = "active"
+	RolloutStatusPaused     = "paused"
+	RolloutStatusRolledBack = "rolled_back"
+
+	UpgradeStatusPending = "pending"
+	UpgradeStatusSuccess = "success"
+	UpgradeStatusFailed  = "failed"
+
+	// 同一灰度下发给设备超过该次数仍未升级成功, 视为失败并不再下发
+	maxUpgradeAttempts = 3
+)
+
+type FirmwareController struct {
+	DB          *gorm.DB
+	StorageDir  string
+	DownloadURL string
+}
+
+func NewFirmwareController(db *gorm.DB, cfg config.FirmwareConfig) *FirmwareController {
+	storageDir := cfg.StorageDir
+	if storageDir == "" {
+		storageDir = "data/firmware"
+	}
+	return &FirmwareController{
+		DB:          db,
+		StorageDir:  storageDir,
+		DownloadURL: strings.TrimRight(cfg.DownloadURL, "/"),
+	}
+}
+
+// GetFirmwares 获取固件列表, 可按 board_type 过滤
+func (fc *FirmwareController) GetFirmwares(c *gin.Context) {
+	var firmwares []models.Firmware
+	query := fc.DB.Order("board_type, id desc")
+	if boardType := c.Query("board_type"); boardType != "" {
+		query = query.Where("board_type = ?", boardType)
+	}
+	if err := query.Find(&firmwares).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取固件列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": firmwares})
+}
+
+// UploadFirmware 上传固件, multipart 表单: file, board_type, version, description
+func (fc *FirmwareController) UploadFirmware(c *gin.Context) {
+	boardType := strings.TrimSpace(c.PostForm("board_type"))
+	version := strings.TrimSpace(c.PostForm("version"))
+	if !isSafePathPart(boardType) || !isSafePathPart(version) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "board_type或version不合法"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未上传固件文件"})
+		return
+	}
+	if file.Size == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "固件文件为空"})
+		return
+	}
+
+	var count int64
+	fc.DB.Model(&models.Firmware{}).Where("board_type = ? AND version = ?", boardType, version).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该板型的固件版本已存在"})
+		return
+	}
+
+	fileName := filepath.Base(file.Filename)
+	dir := filepath.Join(fc.StorageDir, boardType, version)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("创建固件目录失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存固件失败"})
+		return
+	}
+	filePath := filepath.Join(dir, fileName)
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取固件文件失败"})
+		return
+	}
+	defer src.Close()
+
+	dst, err := os.Create(filePath)
+	if err != nil {
+		log.Printf("创建固件文件失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存固件失败"})
+		return
+	}
+	hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(dst, hash), src)
+	dst.Close()
+	if err != nil {
+		os.Remove(filePath)
+		log.Printf("写入固件文件失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存固件失败"})
+		return
+	}
+
+	firmware := models.Firmware{
+		BoardType:   boardType,
+		Version:     version,
+		FileName:    fileName,
+		FilePath:    filePath,
+		Size:        size,
+		Md5:         hex.EncodeToString(hash.Sum(nil)),
+		Description: c.PostForm("description"),
+	}
+	if err := fc.DB.Create(&firmware).Error; err != nil {
+		os.Remove(filePath)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存固件记录失败"})
+		return
+	}
+
+	log.Printf("固件上传成功: board=%s, version=%s, size=%d", boardType, version, size)
+	c.JSON(http.StatusCreated, gin.H{"data": firmware})
+}
+
+// DeleteFirmware 删除固件, 存在进行中的灰度时不允许删除
+func (fc *FirmwareController) DeleteFirmware(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var firmware models.Firmware
+	if err := fc.DB.First(&firmware, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "固件不存在"})
+		return
+	}
+
+	var count int64
+	fc.DB.Model(&models.FirmwareRollout{}).Where("firmware_id = ? AND status IN ?", firmware.ID, []string{RolloutStatusActive, RolloutStatusPaused}).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该固件存在未结束的灰度发布，请先回滚"})
+		return
+	}
+
+	if err := fc.DB.Delete(&firmware).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除固件失败"})
+		return
+	}
+	if err := os.Remove(firmware.FilePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("删除固件文件失败: %v", err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// GetRollouts 获取灰度发布列表及升级统计
+func (fc *FirmwareController) GetRollouts(c *gin.Context) {
+	var rollouts []models.FirmwareRollout
+	query := fc.DB.Order("id desc")
+	if boardType := c.Query("board_type"); boardType != "" {
+		query = query.Where("board_type = ?", boardType)
+	}
+	if err := query.Find(&rollouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取灰度发布列表失败"})
+		return
+	}
+
+	type RolloutWithStats struct {
+		models.FirmwareRollout
+		Version string         `json:"version"`
+		Stats   map[string]int `json:"stats"`
+	}
+
+	result := make([]RolloutWithStats, 0, len(rollouts))
+	for _, rollout := range rollouts {
+		item := RolloutWithStats{
+			FirmwareRollout: rollout,
+			Stats: map[string]int{
+				UpgradeStatusPending: 0,
+				UpgradeStatusSuccess: 0,
+				UpgradeStatusFailed:  0,
+			},
+		}
+
+		var firmware models.Firmware
+		if err := fc.DB.First(&firmware, rollout.FirmwareID).Error; err == nil {
+			item.Version = firmware.Version
+		}
+
+		var counts []struct {
+			Status string
+			Count  int
+		}
+		fc.DB.Model(&models.FirmwareUpgrade{}).Select("status, count(*) as count").
+			Where("rollout_id = ?", rollout.ID).Group("status").Scan(&counts)
+		for _, cnt := range counts {
+			item.Stats[cnt.Status] = cnt.Count
+		}
+		result = append(result, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// rolloutRequest 更新时仅修改请求中携带的字段
+type rolloutRequest struct {
+	FirmwareID      uint    `json:"firmware_id"`
+	Percentage      *int    `json:"percentage"`
+	DeviceAllowlist *string `json:"device_allowlist"`
+	AgentID         *uint   `json:"agent_id"`
+	Status          string  `json:"status"`
+	AllowDowngrade  *bool   `json:"allow_downgrade"`
+}
+
+// CreateRollout 创建灰度发布
+func (fc *FirmwareController) CreateRollout(c *gin.Context) {
+	var req rolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var firmware models.Firmware
+	if err := fc.DB.First(&firmware, req.FirmwareID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "固件不存在"})
+		return
+	}
+
+	rollout := models.FirmwareRollout{
+		FirmwareID: firmware.ID,
+		BoardType:  firmware.BoardType,
+		Status:     RolloutStatusActive,
+	}
+	if req.Percentage != nil {
+		rollout.Percentage = *req.Percentage
+	}
+	if req.DeviceAllowlist != nil {
+		rollout.DeviceAllowlist = normalizeAllowlist(*req.DeviceAllowlist)
+	}
+	if req.AgentID != nil {
+		rollout.AgentID = *req.AgentID
+	}
+	if req.AllowDowngrade != nil {
+		rollout.AllowDowngrade = *req.AllowDowngrade
+	}
+	if rollout.Percentage < 0 || rollout.Percentage > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "percentage取值范围为0-100"})
+		return
+	}
+
+	if err := fc.DB.Create(&rollout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建灰度发布失败"})
+		return
+	}
+	log.Printf("创建固件灰度发布: board=%s, version=%s, percentage=%d", firmware.BoardType, firmware.Version, rollout.Percentage)
+	c.JSON(http.StatusCreated, gin.H{"data": rollout})
+}
+
+// UpdateRollout 调整灰度比例、白名单、智能体或暂停/恢复, 未携带的字段保持不变
+func (fc *FirmwareController) UpdateRollout(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var rollout models.FirmwareRollout
+	if err := fc.DB.First(&rollout, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "灰度发布不存在"})
+		return
+	}
+	if rollout.Status == RolloutStatusRolledBack {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "已回滚的灰度发布不能修改"})
+		return
+	}
+
+	var req rolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Percentage != nil {
+		if *req.Percentage < 0 || *req.Percentage > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "percentage取值范围为0-100"})
+			return
+		}
+		rollout.Percentage = *req.Percentage
+	}
+	switch req.Status {
+	case "":
+	case RolloutStatusActive, RolloutStatusPaused:
+		rollout.Status = req.Status
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status仅支持active或paused"})
+		return
+	}
+	if req.DeviceAllowlist != nil {
+		rollout.DeviceAllowlist = normalizeAllowlist(*req.DeviceAllowlist)
+	}
+	if req.AgentID != nil {
+		rollout.AgentID = *req.AgentID
+	}
+	if req.AllowDowngrade != nil {
+		rollout.AllowDowngrade = *req.AllowDowngrade
+	}
+
+	if err := fc.DB.Save(&rollout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新灰度发布失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": rollout})
+}
+
+// RollbackRollout 回滚灰度发布, 停止下发并将未完成的升级标记为失败
+// 请求体可携带 firmware_id, 为已下发过的设备创建回退到该固件的灰度, 允许下发更低的版本
+func (fc *FirmwareController) RollbackRollout(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var rollout models.FirmwareRollout
+	if err := fc.DB.First(&rollout, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "灰度发布不存在"})
+		return
+	}
+
+	var req struct {
+		FirmwareID uint `json:"firmware_id"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var target models.Firmware
+	if req.FirmwareID != 0 {
+		if err := fc.DB.First(&target, req.FirmwareID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "回退的固件不存在"})
+			return
+		}
+		if target.BoardType != rollout.BoardType || target.ID == rollout.FirmwareID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "回退的固件须为同板型的其他版本"})
+			return
+		}
+	}
+
+	var downgrade *models.FirmwareRollout
+	err := fc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&rollout).Update("status", RolloutStatusRolledBack).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.FirmwareUpgrade{}).
+			Where("rollout_id = ? AND status = ?", rollout.ID, UpgradeStatusPending).
+			Update("status", UpgradeStatusFailed).Error; err != nil {
+			return err
+		}
+		if target.ID == 0 {
+			return nil
+		}
+
+		// 仅回退本次灰度下发过的设备, 仍是旧版本的设备与回退固件版本一致, 不会重复下发
+		var deviceNames []string
+		if err := tx.Model(&models.FirmwareUpgrade{}).Where("rollout_id = ?", rollout.ID).
+			Pluck("device_name", &deviceNames).Error; err != nil {
+			return err
+		}
+		downgrade = &models.FirmwareRollout{
+			FirmwareID:      target.ID,
+			BoardType:       target.BoardType,
+			DeviceAllowlist: strings.Join(deviceNames, ","),
+			Status:          RolloutStatusActive,
+			AllowDowngrade:  true,
+		}
+		return tx.Create(downgrade).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "回滚灰度发布失败"})
+		return
+	}
+	if downgrade != nil {
+		log.Printf("固件灰度发布 %d 已回滚, 回退到版本 %s, 灰度发布 %d", rollout.ID, target.Version, downgrade.ID)
+		c.JSON(http.StatusOK, gin.H{"message": "回滚成功", "data": downgrade})
+		return
+	}
+	log.Printf("固件灰度发布 %d 已回滚", rollout.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "回滚成功"})
+}
+
+// GetRolloutUpgrades 获取灰度发布下各设备的升级记录
+func (fc *FirmwareController) GetRolloutUpgrades(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var upgrades []models.FirmwareUpgrade
+	query := fc.DB.Where("rollout_id = ?", id).Order("updated_at desc")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&upgrades).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取升级记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": upgrades})
+}
+
+// checkFirmwareRequest 设备OTA时由服务端转发的设备信息
+type checkFirmwareRequest struct {
+	DeviceId string `json:"device_id" binding:"required"`
+	ClientId string `json:"client_id" binding:"required"`
+	Board    string `json:"board" binding:"required"`
+	Version  string `json:"version" binding:"required"`
+}
+
+// CheckFirmware 设备OTA时检查是否有可升级的固件, 并记录升级进度
+// POST /api/public/firmware/check
+// 仅处理已登记的设备, 设备已绑定 Client-Id 时 client_id 须一致
+func (fc *FirmwareController) CheckFirmware(c *gin.Context) {
+	var req checkFirmwareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "device_id、client_id、board和version参数必填"})
+		return
+	}
+	deviceId, boardType, version := req.DeviceId, req.Board, req.Version
+
+	var device models.Device
+	if err := fc.DB.Where("device_name = ?", deviceId).First(&device).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusOK, gin.H{"data": nil})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询设备失败"})
+		return
+	}
+	if device.ClientID != "" && device.ClientID != req.ClientId {
+		c.JSON(http.StatusForbidden, gin.H{"error": clientMismatchMessage})
+		return
+	}
+
+	// 设备上报的版本与待升级版本一致, 记为升级成功
+	var pendings []models.FirmwareUpgrade
+	fc.DB.Where("device_name = ? AND status = ?", deviceId, UpgradeStatusPending).Find(&pendings)
+	for _, upgrade := range pendings {
+		if compareVersion(upgrade.ToVersion, version) != 0 {
+			continue
+		}
+		now := time.Now()
+		fc.DB.Model(&upgrade).Updates(map[string]interface{}{"status": UpgradeStatusSuccess, "completed_at": &now})
+	}
+
+	var rollouts []models.FirmwareRollout
+	if err := fc.DB.Where("board_type = ? AND status = ?", boardType, RolloutStatusActive).Order("id desc").Find(&rollouts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询灰度发布失败"})
+		return
+	}
+
+	for _, rollout := range rollouts {
+		if !rolloutMatchDevice(&rollout, deviceId, device.AgentID) {
+			continue
+		}
+		var firmware models.Firmware
+		if err := fc.DB.First(&firmware, rollout.FirmwareID).Error; err != nil {
+			continue
+		}
+		// 仅下发更高的版本, 显式回退的灰度允许下发更低的版本
+		cmp := compareVersion(firmware.Version, version)
+		if cmp == 0 || (cmp < 0 && !rollout.AllowDowngrade) {
+			continue
+		}
+
+		offered, err := fc.recordUpgradeOffer(&rollout, deviceId, version, firmware.Version)
+		if err != nil {
+			log.Printf("记录设备 %s 升级信息失败: %v", deviceId, err)
+			continue
+		}
+		if !offered {
+			continue
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{
+			"version": firmware.Version,
+			"url":     fc.downloadURL(c, firmware.ID),
+			"md5":     firmware.Md5,
+			"size":    firmware.Size,
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": nil})
+}
+
+// recordUpgradeOffer 记录一次下发, 多次下发仍未升级成功的设备标记为失败并不再下发
+func (fc *FirmwareController) recordUpgradeOffer(rollout *models.FirmwareRollout, deviceId, fromVersion, toVersion string) (bool, error) {
+	var upgrade models.FirmwareUpgrade
+	err := fc.DB.Where("rollout_id = ? AND device_name = ?", rollout.ID, deviceId).First(&upgrade).Error
+	if err == gorm.ErrRecordNotFound {
+		upgrade = models.FirmwareUpgrade{
+			RolloutID:   rollout.ID,
+			DeviceName:  deviceId,
+			FromVersion: fromVersion,
+			ToVersion:   toVersion,
+			Status:      UpgradeStatusPending,
+			Attempts:    1,
+		}
+		return true, fc.DB.Create(&upgrade).Error
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if upgrade.Status != UpgradeStatusPending {
+		return false, nil
+	}
+	if upgrade.Attempts >= maxUpgradeAttempts {
+		log.Printf("设备 %s 升级到 %s 失败次数过多, 停止下发", deviceId, toVersion)
+		return false, fc.DB.Model(&upgrade).Update("status", UpgradeStatusFailed).Error
+	}
+	return true, fc.DB.Model(&upgrade).Update("attempts", upgrade.Attempts+1).Error
+}
+
+// DownloadFirmware 下载固件文件
+func (fc *FirmwareController) DownloadFirmware(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var firmware models.Firmware
+	if err := fc.DB.First(&firmware, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "固件不存在"})
+		return
+	}
+	c.FileAttachment(firmware.FilePath, firmware.FileName)
+}
+
+func (fc *FirmwareController) downloadURL(c *gin.Context, firmwareID uint) string {
+	baseURL := fc.DownloadURL
+	if baseURL == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+			scheme = proto
+		}
+		baseURL = scheme + "://" + c.Request.Host
+	}
+	return fmt.Sprintf("%s/api/public/firmware/download/%d", baseURL, firmwareID)
+}
+
+// rolloutMatchDevice 白名单设备直接命中, 其余设备需满足智能体限制并落在灰度比例内
+func rolloutMatchDevice(rollout *models.FirmwareRollout, deviceId string, agentID uint) bool {
+	for _, item := range strings.Split(rollout.DeviceAllowlist, ",") {
+		if item != "" && item == deviceId {
+			return true
+		}
+	}
+	if rollout.AgentID != 0 && rollout.AgentID != agentID {
+		return false
+	}
+	// 以 灰度ID+设备ID 分桶, 扩大比例时已命中的设备保持命中
+	bucket := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%d:%s", rollout.ID, deviceId))) % 100
+	return int(bucket) < rollout.Percentage
+}
+
+// compareVersion 按语义化版本比较, 忽略前缀 v 和 + 之后的构建信息
+// 预发布版本低于对应的正式版本, 如 1.2.0-beta < 1.2.0
+func compareVersion(a, b string) int {
+	coreA, preA := splitVersion(a)
+	coreB, preB := splitVersion(b)
+	if cmp := compareIdentifiers(strings.Split(coreA, "."), strings.Split(coreB, "."), true); cmp != 0 {
+		return cmp
+	}
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return compareIdentifiers(strings.Split(preA, "."), strings.Split(preB, "."), false)
+}
+
+// splitVersion 拆分出版本核心和预发布部分
+func splitVersion(v string) (string, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		return v[:i], v[i+1:]
+	}
+	return v, ""
+}
+
+// compareIdentifiers 逐段比较, 数字段按数值比较且低于非数字段, 非数字段按字典序比较
+// 版本核心缺少的段视为 0, 预发布部分前缀相同时段数多的更高
+func compareIdentifiers(pa, pb []string, padZero bool) int {
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		if !padZero && (i >= len(pa) || i >= len(pb)) {
+			if i >= len(pa) {
+				return -1
+			}
+			return 1
+		}
+		sa, sb := "0", "0"
+		if i < len(pa) {
+			sa = pa[i]
+		}
+		if i < len(pb) {
+			sb = pb[i]
+		}
+		na, errA := strconv.ParseUint(sa, 10, 64)
+		nb, errB := strconv.ParseUint(sb, 10, 64)
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				if na > nb {
+					return 1
+				}
+				return -1
+			}
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			if cmp := strings.Compare(sa, sb); cmp != 0 {
+				return cmp
+			}
+		}
+	}
+	return 0
+}
+
+func normalizeAllowlist(allowlist string) string {
+	items := strings.FieldsFunc(allowlist, func(r rune) bool {
+		return r == ',' || r == '\n' || r == ' '
+	})
+	return strings.Join(items, ",")
+}
+
+func isSafePathPart(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, `/\`)
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"xiaozhi/manager/backend/config"
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCompareVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.0", "1.2.0", 0},
+		{"v1.2.0", "1.2.0", 0},
+		{"1.2", "1.2.0", 0},
+		{"1.2.1", "1.2.0", 1},
+		{"1.10.0", "1.9.0", 1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.2.0-beta", "1.2.0", -1},
+		{"1.2.0", "1.2.0-rc.1", 1},
+		{"1.2.0-alpha", "1.2.0-beta", -1},
+		{"1.2.0-alpha", "1.2.0-alpha.1", -1},
+		{"1.2.0-alpha.1", "1.2.0-alpha.beta", -1},
+		{"1.2.0-beta.2", "1.2.0-beta.11", -1},
+		{"1.2.0-rc.1", "1.1.9", 1},
+		{"1.2.0+build.5", "1.2.0+build.7", 0},
+		{"1.2.0-beta+exp", "1.2.0-beta", 0},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, compareVersion(tt.a, tt.b), "%s vs %s", tt.a, tt.b)
+		assert.Equal(t, -tt.want, compareVersion(tt.b, tt.a), "%s vs %s", tt.b, tt.a)
+	}
+}
+
+func TestCheckFirmwareVerifiesClientId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Device{}, &models.Firmware{}, &models.FirmwareRollout{}, &models.FirmwareUpgrade{}))
+	fc := NewFirmwareController(db, config.FirmwareConfig{DownloadURL: "http://manager"})
+	r := gin.New()
+	r.POST("/api/public/firmware/check", fc.CheckFirmware)
+
+	require.NoError(t, db.Create(&models.Device{UserID: 1, DeviceName: "ba:8f:17:de:94:94", ClientID: "client-1", Activated: true}).Error)
+	firmware := models.Firmware{BoardType: "esp32-s3", Version: "1.2.0"}
+	require.NoError(t, db.Create(&firmware).Error)
+	require.NoError(t, db.Create(&models.FirmwareRollout{
+		FirmwareID:      firmware.ID,
+		BoardType:       "esp32-s3",
+		DeviceAllowlist: "ba:8f:17:de:94:94",
+		Status:          RolloutStatusActive,
+	}).Error)
+
+	check := func(deviceId, clientId string) (int, map[string]interface{}) {
+		return doActivationRequest(r, http.MethodPost, "/api/public/firmware/check", map[string]string{
+			"device_id": deviceId,
+			"client_id": clientId,
+			"board":     "esp32-s3",
+			"version":   "1.1.0",
+		})
+	}
+
+	// 仅知道 Device-Id 的其它客户端不能获取固件, 也不会改变升级记录
+	code, _ := check("ba:8f:17:de:94:94", "client-2")
+	assert.Equal(t, http.StatusForbidden, code)
+	var count int64
+	db.Model(&models.FirmwareUpgrade{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// 未登记的设备不下发
+	code, resp := check("00:00:00:00:00:00", "client-1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, resp["data"])
+
+	code, resp = check("ba:8f:17:de:94:94", "client-1")
+	assert.Equal(t, http.StatusOK, code)
+	data, _ := resp["data"].(map[string]interface{})
+	assert.Equal(t, "1.2.0", data["version"])
+	db.Model(&models.FirmwareUpgrade{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// 只接受 POST
+	code, _ = doActivationRequest(r, http.MethodGet, "/api/public/firmware/check?device_id=ba:8f:17:de:94:94&client_id=client-1&board=esp32-s3&version=1.1.0", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
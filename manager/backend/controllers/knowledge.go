@@ -0,0 +1,328 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"xiaozhi/manager/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxKnowledgeFileSize  = 5 << 20 // 单个文档最大 5MB
+	knowledgeChunkSize    = 500     // 分块的最大字数
+	knowledgeChunkOverlap = 100     // 相邻分块重叠的最大字数, 避免一句话的上下文被切断
+)
+
+// 支持上传的文档类型, 均按纯文本处理
+var knowledgeFileExts = map[string]bool{".txt": true, ".md": true, ".markdown": true}
+
+type KnowledgeController struct {
+	DB                  *gorm.DB
+	WebSocketController *WebSocketController
+}
+
+// splitSentences 按换行和句末标点切分, 标点保留在句尾
+func splitSentences(text string) []string {
+	var sentences []string
+	var current strings.Builder
+	flush := func() {
+		if sentence := strings.TrimSpace(current.String()); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		current.Reset()
+	}
+	for _, r := range text {
+		if r == '\n' {
+			flush()
+			continue
+		}
+		current.WriteRune(r)
+		switch r {
+		case '。', '！', '？', '；', '!', '?', ';':
+			flush()
+		}
+	}
+	flush()
+	return sentences
+}
+
+// splitKnowledgeChunks 将文档按句子合并为不超过 size 字的分块
+// 新分块以上一分块末尾不超过 overlap 字的完整句子开头, 超长的句子按字数硬切
+func splitKnowledgeChunks(text string, size int, overlap int) []string {
+	text = strings.TrimPrefix(text, "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var sentences []string
+	for _, sentence := range splitSentences(text) {
+		runes := []rune(sentence)
+		for len(runes) > size {
+			sentences = append(sentences, string(runes[:size]))
+			runes = runes[size:]
+		}
+		sentences = append(sentences, string(runes))
+	}
+
+	var chunks []string
+	var current []string
+	currentLen := 0   // 含句子间的换行
+	newChunk := false // current 中是否有未输出过的句子
+	for _, sentence := range sentences {
+		n := utf8.RuneCountInString(sentence)
+		if len(current) > 0 && currentLen+1+n > size && newChunk {
+			chunks = append(chunks, strings.Join(current, "\n"))
+			// 保留末尾的句子作为重叠部分
+			keep := len(current)
+			keepLen := 0
+			for keep > 0 {
+				l := utf8.RuneCountInString(current[keep-1]) + 1
+				if keepLen+l > overlap || keepLen+l+n > size {
+					break
+				}
+				keepLen += l
+				keep--
+			}
+			current = append([]string(nil), current[keep:]...)
+			currentLen = max(keepLen-1, 0)
+			newChunk = false
+		}
+		if len(current) > 0 {
+			currentLen++
+		}
+		current = append(current, sentence)
+		currentLen += n
+		newChunk = true
+	}
+	if newChunk {
+		chunks = append(chunks, strings.Join(current, "\n"))
+	}
+	return chunks
+}
+
+// loadKnowledgeChunks 获取智能体的全部分块, 供主程序向量化
+func loadKnowledgeChunks(db *gorm.DB, agentID string) ([]gin.H, error) {
+	var documents []models.KnowledgeDocument
+	if err := db.Where("agent_id = ?", agentID).Find(&documents).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(documents))
+	for _, document := range documents {
+		names[document.ID] = document.Name
+	}
+
+	var chunks []models.KnowledgeChunk
+	if err := db.Where("agent_id = ?", agentID).Order("document_id, chunk_index").Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	result := make([]gin.H, 0, len(chunks))
+	for _, chunk := range chunks {
+		name, ok := names[chunk.DocumentID]
+		if !ok {
+			continue
+		}
+		result = append(result, gin.H{
+			"id":            strconv.FormatUint(uint64(chunk.ID), 10),
+			"document_id":   strconv.FormatUint(uint64(chunk.DocumentID), 10),
+			"document_name": name,
+			"content":       chunk.Content,
+		})
+	}
+	return result, nil
+}
+
+// loadKnowledgeAgentIDs 获取有知识库文档的智能体ID
+func loadKnowledgeAgentIDs(db *gorm.DB) ([]string, error) {
+	var ids []uint
+	if err := db.Model(&models.KnowledgeDocument{}).Distinct("agent_id").Pluck("agent_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	agentIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		agentIDs = append(agentIDs, strconv.FormatUint(uint64(id), 10))
+	}
+	return agentIDs, nil
+}
+
+// findAgent 管理员可操作任意智能体, 普通用户只能操作自己的
+func (kc *KnowledgeController) findAgent(c *gin.Context) (*models.Agent, bool) {
+	query := kc.DB.Where("id = ?", c.Param("id"))
+	if role, _ := c.Get("role"); role != "admin" {
+		userID, _ := c.Get("user_id")
+		query = query.Where("user_id = ?", userID)
+	}
+	var agent models.Agent
+	if err := query.First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "智能体不存在"})
+		return nil, false
+	}
+	return &agent, true
+}
+
+// notifyChanged 通知主程序重新同步知识库, 主程序未连接时由其定期同步
+func (kc *KnowledgeController) notifyChanged(agentID uint) {
+	if kc.WebSocketController == nil || !kc.WebSocketController.HasConnectedClient() {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := kc.WebSocketController.RequestInvalidateKnowledge(ctx, strconv.FormatUint(uint64(agentID), 10)); err != nil {
+			log.Printf("通知主程序知识库变更失败, agent_id: %d, err: %v", agentID, err)
+		}
+	}()
+}
+
+// GetDocuments 获取智能体的知识库文档
+func (kc *KnowledgeController) GetDocuments(c *gin.Context) {
+	agent, ok := kc.findAgent(c)
+	if !ok {
+		return
+	}
+	var documents []models.KnowledgeDocument
+	if err := kc.DB.Where("agent_id = ?", agent.ID).Order("id DESC").Find(&documents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取知识库文档失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": documents})
+}
+
+// UploadDocument 上传文本文档并分块, 也可通过 name 和 content 表单字段直接提交文本
+func (kc *KnowledgeController) UploadDocument(c *gin.Context) {
+	agent, ok := kc.findAgent(c)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(c.PostForm("name"))
+	content := c.PostForm("content")
+	if file, err := c.FormFile("file"); err == nil {
+		ext := strings.ToLower(filepath.Ext(file.Filename))
+		if !knowledgeFileExts[ext] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "仅支持 txt、md 格式的文档"})
+			return
+		}
+		if file.Size > maxKnowledgeFileSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "文档不能超过5MB"})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文档失败"})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(f, maxKnowledgeFileSize))
+		f.Close()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文档失败"})
+			return
+		}
+		content = string(data)
+		if name == "" {
+			name = file.Filename
+		}
+	}
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文档名称不能为空"})
+		return
+	}
+	if len(content) > maxKnowledgeFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文档不能超过5MB"})
+		return
+	}
+	if !utf8.ValidString(content) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文档需为UTF-8编码"})
+		return
+	}
+	texts := splitKnowledgeChunks(content, knowledgeChunkSize, knowledgeChunkOverlap)
+	if len(texts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文档内容为空"})
+		return
+	}
+
+	document := models.KnowledgeDocument{
+		AgentID:    agent.ID,
+		UserID:     agent.UserID,
+		Name:       name,
+		Size:       int64(len(content)),
+		ChunkCount: len(texts),
+	}
+	err := kc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&document).Error; err != nil {
+			return err
+		}
+		chunks := make([]models.KnowledgeChunk, 0, len(texts))
+		for i, text := range texts {
+			chunks = append(chunks, models.KnowledgeChunk{
+				DocumentID: document.ID,
+				AgentID:    agent.ID,
+				ChunkIndex: i,
+				Content:    text,
+			})
+		}
+		return tx.CreateInBatches(chunks, 100).Error
+	})
+	if err != nil {
+		log.Printf("保存知识库文档失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存知识库文档失败"})
+		return
+	}
+
+	log.Printf("智能体 %d 上传知识库文档: %s, 分块: %d", agent.ID, name, len(texts))
+	kc.notifyChanged(agent.ID)
+	c.JSON(http.StatusOK, gin.H{"data": document})
+}
+
+// GetDocumentChunks 查看文档的分块结果
+func (kc *KnowledgeController) GetDocumentChunks(c *gin.Context) {
+	agent, ok := kc.findAgent(c)
+	if !ok {
+		return
+	}
+	var document models.KnowledgeDocument
+	if err := kc.DB.Where("id = ? AND agent_id = ?", c.Param("doc_id"), agent.ID).First(&document).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文档不存在"})
+		return
+	}
+	var chunks []models.KnowledgeChunk
+	if err := kc.DB.Where("document_id = ?", document.ID).Order("chunk_index").Find(&chunks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取文档分块失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"document": document, "chunks": chunks}})
+}
+
+// DeleteDocument 删除文档及其分块
+func (kc *KnowledgeController) DeleteDocument(c *gin.Context) {
+	agent, ok := kc.findAgent(c)
+	if !ok {
+		return
+	}
+	var document models.KnowledgeDocument
+	if err := kc.DB.Where("id = ? AND agent_id = ?", c.Param("doc_id"), agent.ID).First(&document).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文档不存在"})
+		return
+	}
+	err := kc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", document.ID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&document).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("删除文档失败: %v", err)})
+		return
+	}
+
+	kc.notifyChanged(agent.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
@@ -91,6 +91,13 @@ func (sc *SetupController) InitializeDatabase(c *gin.Context) {
 		&models.Agent{},
 		&models.Config{},
 		&models.GlobalRole{},
+		&models.Firmware{},
+		&models.FirmwareRollout{},
+		&models.FirmwareUpgrade{},
+		&models.ConversationSession{},
+		&models.ConversationTurn{},
+		&models.KnowledgeDocument{},
+		&models.KnowledgeChunk{},
 	)
 	if err != nil {
 		tx.Rollback()
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,15 +19,20 @@ import (
 )
 
 type WebSocketController struct {
-	DB            *gorm.DB
-	upgrader      websocket.Upgrader
-	currentClient *WebSocketClient
+	DB       *gorm.DB
+	upgrader websocket.Upgrader
+	// 多实例部署时每个主程序节点一个连接, key 为客户端ID
+	clients map[string]*WebSocketClient
+	// 设备当前连接的客户端ID, 由设备上线/离线请求维护
+	deviceClients map[string]string
 	clientMutex   sync.RWMutex
 }
 
 // WebSocketClient 连接到Manager Backend的客户端
 type WebSocketClient struct {
 	ID           string
+	NodeID       string // 主程序节点ID, 来自连接时的 Node-Id 请求头
+	ConnectedAt  time.Time
 	conn         *websocket.Conn
 	controller   *WebSocketController
 	requestChans map[string]chan *WebSocketResponse
@@ -61,7 +67,8 @@ func NewWebSocketController(db *gorm.DB) *WebSocketController {
 				return true // 允许所有来源，生产环境应该限制
 			},
 		},
-		currentClient: nil,
+		clients:       make(map[string]*WebSocketClient),
+		deviceClients: make(map[string]string),
 	}
 }
 
@@ -74,19 +81,29 @@ func (ctrl *WebSocketController) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	// 如果有现有连接，先断开
+	// 未携带节点ID的旧版主程序按单节点处理
+	clientID := uuid.New().String()
+	nodeID := c.GetHeader("Node-Id")
+	if nodeID == "" {
+		nodeID = "default"
+	}
+
+	// 同一节点重连时断开旧连接
 	ctrl.clientMutex.Lock()
-	if ctrl.currentClient != nil && ctrl.currentClient.isConnected {
-		log.Printf("断开现有连接: %s", ctrl.currentClient.ID)
-		ctrl.currentClient.conn.Close()
-		ctrl.currentClient.isConnected = false
+	for _, existing := range ctrl.clients {
+		if existing.NodeID == nodeID && existing.isConnected {
+			log.Printf("节点 %s 重连, 断开现有连接: %s", nodeID, existing.ID)
+			existing.conn.Close()
+			existing.isConnected = false
+		}
 	}
 	ctrl.clientMutex.Unlock()
 
 	// 创建新的客户端
-	clientID := uuid.New().String()
 	client := &WebSocketClient{
 		ID:           clientID,
+		NodeID:       nodeID,
+		ConnectedAt:  time.Now(),
 		conn:         conn,
 		controller:   ctrl,
 		requestChans: make(map[string]chan *WebSocketResponse),
@@ -95,12 +112,11 @@ func (ctrl *WebSocketController) HandleWebSocket(c *gin.Context) {
 		stopChan:     make(chan struct{}),
 	}
 
-	// 设置为当前客户端
 	ctrl.clientMutex.Lock()
-	ctrl.currentClient = client
+	ctrl.clients[clientID] = client
 	ctrl.clientMutex.Unlock()
 
-	log.Printf("新的WebSocket客户端已连接: %s", clientID)
+	log.Printf("新的WebSocket客户端已连接: %s, 节点: %s", clientID, nodeID)
 
 	// 启动客户端消息处理
 	go client.handleMessages()
@@ -114,53 +130,86 @@ func (ctrl *WebSocketController) removeClient(clientID string) {
 	ctrl.clientMutex.Lock()
 	defer ctrl.clientMutex.Unlock()
 
-	if ctrl.currentClient != nil && ctrl.currentClient.ID == clientID {
-		// 发送停止信号给心跳检测
-		select {
-		case ctrl.currentClient.stopChan <- struct{}{}:
-			log.Printf("已发送停止信号给客户端: %s", clientID)
-		default:
-			// 通道可能已满或已关闭，忽略
-		}
+	client, ok := ctrl.clients[clientID]
+	if !ok {
+		return
+	}
+	// 发送停止信号给心跳检测
+	select {
+	case client.stopChan <- struct{}{}:
+		log.Printf("已发送停止信号给客户端: %s", clientID)
+	default:
+		// 通道可能已满或已关闭，忽略
+	}
 
-		// 确保客户端状态正确设置
-		ctrl.currentClient.isConnected = false
-		ctrl.currentClient = nil
-		log.Printf("WebSocket客户端已断开: %s", clientID)
+	// 确保客户端状态正确设置
+	client.isConnected = false
+	delete(ctrl.clients, clientID)
+	for deviceID, id := range ctrl.deviceClients {
+		if id == clientID {
+			delete(ctrl.deviceClients, deviceID)
+		}
 	}
+	log.Printf("WebSocket客户端已断开: %s, 节点: %s", clientID, client.NodeID)
 }
 
-// 获取当前连接的客户端
-func (ctrl *WebSocketController) GetCurrentClient() *WebSocketClient {
-	ctrl.clientMutex.RLock()
-	defer ctrl.clientMutex.RUnlock()
-	return ctrl.currentClient
+// 记录设备连接的客户端, 下发设备相关请求时路由到该客户端
+func (ctrl *WebSocketController) bindDevice(deviceID, clientID string) {
+	ctrl.clientMutex.Lock()
+	defer ctrl.clientMutex.Unlock()
+	ctrl.deviceClients[deviceID] = clientID
 }
 
-// 检查是否有连接的客户端
-func (ctrl *WebSocketController) HasConnectedClient() bool {
+// 设备离线时清除路由, 设备已切换到其它客户端时保留
+func (ctrl *WebSocketController) unbindDevice(deviceID, clientID string) {
+	ctrl.clientMutex.Lock()
+	defer ctrl.clientMutex.Unlock()
+	if ctrl.deviceClients[deviceID] == clientID {
+		delete(ctrl.deviceClients, deviceID)
+	}
+}
+
+// 获取已连接的客户端
+func (ctrl *WebSocketController) connectedClients() []*WebSocketClient {
 	ctrl.clientMutex.RLock()
 	defer ctrl.clientMutex.RUnlock()
-	return ctrl.currentClient != nil && ctrl.currentClient.isConnected
+	clients := make([]*WebSocketClient, 0, len(ctrl.clients))
+	for _, client := range ctrl.clients {
+		if client.isConnected {
+			clients = append(clients, client)
+		}
+	}
+	return clients
 }
 
-// 向当前客户端发送消息
-func (ctrl *WebSocketController) SendToCurrentClient(message interface{}) error {
+// 获取设备所在的客户端, 设备不在线时返回任一已连接的客户端, 由主程序在节点间转发
+func (ctrl *WebSocketController) GetDeviceClient(deviceID string) *WebSocketClient {
 	ctrl.clientMutex.RLock()
-	client := ctrl.currentClient
+	if clientID, ok := ctrl.deviceClients[deviceID]; ok {
+		if client, ok := ctrl.clients[clientID]; ok && client.isConnected {
+			ctrl.clientMutex.RUnlock()
+			return client
+		}
+	}
 	ctrl.clientMutex.RUnlock()
 
-	if client == nil || !client.isConnected {
-		return fmt.Errorf("没有连接的客户端")
+	if clients := ctrl.connectedClients(); len(clients) > 0 {
+		return clients[0]
 	}
+	return nil
+}
 
-	return client.conn.WriteJSON(message)
+// 检查是否有连接的客户端
+func (ctrl *WebSocketController) HasConnectedClient() bool {
+	return len(ctrl.connectedClients()) > 0
 }
 
-// 广播消息给当前客户端（保持接口一致性）
+// 广播消息给所有客户端
 func (ctrl *WebSocketController) Broadcast(message interface{}) {
-	if err := ctrl.SendToCurrentClient(message); err != nil {
-		log.Printf("广播消息失败: %v", err)
+	for _, client := range ctrl.connectedClients() {
+		if err := client.conn.WriteJSON(message); err != nil {
+			log.Printf("向客户端 %s 广播消息失败: %v", client.ID, err)
+		}
 	}
 }
 
@@ -299,6 +348,15 @@ func (client *WebSocketClient) processRequest(request *WebSocketRequest) {
 	case "/api/device/inactive":
 		client.handleDeviceInactiveRequest(request)
 
+	case "/api/conversation/turn":
+		client.handleConversationTurnRequest(request)
+
+	case "/api/knowledge/chunks":
+		client.handleKnowledgeChunksRequest(request)
+
+	case "/api/knowledge/agents":
+		client.handleKnowledgeAgentsRequest(request)
+
 	default:
 		log.Printf("未知的请求路径: %s", request.Path)
 		client.sendResponse(request.ID, 404, nil, "Unknown endpoint")
@@ -372,8 +430,9 @@ func (client *WebSocketClient) handleDeviceActiveRequest(request *WebSocketReque
 		"message":        "设备活跃时间更新成功",
 	}
 
+	client.controller.bindDevice(deviceID, client.ID)
 	client.sendResponse(request.ID, 200, response, "")
-	log.Printf("设备 %s 活跃时间已更新为: %s", deviceID, now.Format(time.RFC3339))
+	log.Printf("设备 %s 活跃时间已更新为: %s, 节点: %s", deviceID, now.Format(time.RFC3339), client.NodeID)
 }
 
 // 处理设备离线请求
@@ -393,6 +452,7 @@ func (client *WebSocketClient) handleDeviceInactiveRequest(request *WebSocketReq
 	}
 
 	log.Printf("处理设备离线请求，device_id: %s", deviceID)
+	client.controller.unbindDevice(deviceID, client.ID)
 
 	// 将设备最后活跃时间设置为0（离线状态）
 	result := client.controller.DB.Model(&models.Device{}).
@@ -422,6 +482,48 @@ func (client *WebSocketClient) handleDeviceInactiveRequest(request *WebSocketReq
 	log.Printf("设备 %s 已设置为离线状态", deviceID)
 }
 
+// 处理主程序推送的对话记录
+func (client *WebSocketClient) handleConversationTurnRequest(request *WebSocketRequest) {
+	if err := saveConversationTurn(client.controller.DB, request.Body); err != nil {
+		log.Printf("保存对话记录失败: %v", err)
+		client.sendResponse(request.ID, 500, nil, fmt.Sprintf("保存对话记录失败: %v", err))
+		return
+	}
+	client.sendResponse(request.ID, 200, map[string]interface{}{"message": "对话记录已保存"}, "")
+}
+
+// 处理主程序拉取智能体知识库分块的请求
+func (client *WebSocketClient) handleKnowledgeChunksRequest(request *WebSocketRequest) {
+	agentID, _ := request.Body["agent_id"].(string)
+	if agentID == "" {
+		client.sendResponse(request.ID, 400, nil, "缺少agent_id参数")
+		return
+	}
+	chunks, err := loadKnowledgeChunks(client.controller.DB, agentID)
+	if err != nil {
+		log.Printf("获取知识库分块失败: %v", err)
+		client.sendResponse(request.ID, 500, nil, fmt.Sprintf("获取知识库分块失败: %v", err))
+		return
+	}
+	client.sendResponse(request.ID, 200, map[string]interface{}{
+		"agent_id": agentID,
+		"chunks":   chunks,
+	}, "")
+}
+
+// 处理主程序获取有知识库的智能体的请求, 用于启动时预先构建索引
+func (client *WebSocketClient) handleKnowledgeAgentsRequest(request *WebSocketRequest) {
+	agentIDs, err := loadKnowledgeAgentIDs(client.controller.DB)
+	if err != nil {
+		log.Printf("获取有知识库的智能体失败: %v", err)
+		client.sendResponse(request.ID, 500, nil, fmt.Sprintf("获取有知识库的智能体失败: %v", err))
+		return
+	}
+	client.sendResponse(request.ID, 200, map[string]interface{}{
+		"agent_ids": agentIDs,
+	}, "")
+}
+
 // 发送响应
 func (client *WebSocketClient) sendResponse(requestID string, status int, body map[string]interface{}, errorMsg string) {
 	response := WebSocketResponse{
@@ -547,32 +649,65 @@ func mapToStruct(data map[string]interface{}, target interface{}) error {
 	return json.Unmarshal(jsonData, target)
 }
 
-// 向当前客户端发送请求并等待响应
+// 向客户端发送请求并等待响应, 请求携带 device_id 时发送到设备所在的客户端
 func (ctrl *WebSocketController) SendRequestToClient(ctx context.Context, method, path string, body map[string]interface{}) (*WebSocketResponse, error) {
-	ctrl.clientMutex.RLock()
-	client := ctrl.currentClient
-	ctrl.clientMutex.RUnlock()
-
-	if client == nil || !client.isConnected {
+	deviceID, _ := body["device_id"].(string)
+	client := ctrl.GetDeviceClient(deviceID)
+	if client == nil {
 		return nil, fmt.Errorf("没有连接的客户端")
 	}
 
 	return client.SendRequestWithResponse(ctx, method, path, body)
 }
 
-// 请求客户端MCP工具列表
+// 向所有客户端发送请求, 返回第一个成功的响应, 全部失败时返回最后一个错误
+func (ctrl *WebSocketController) BroadcastRequest(ctx context.Context, method, path string, body map[string]interface{}) (*WebSocketResponse, error) {
+	clients := ctrl.connectedClients()
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("没有连接的客户端")
+	}
+
+	type result struct {
+		response *WebSocketResponse
+		err      error
+	}
+	results := make(chan result, len(clients))
+	for _, client := range clients {
+		go func(client *WebSocketClient) {
+			response, err := client.SendRequestWithResponse(ctx, method, path, body)
+			if err != nil {
+				log.Printf("向节点 %s 发送请求 %s 失败: %v", client.NodeID, path, err)
+			}
+			results <- result{response: response, err: err}
+		}(client)
+	}
+
+	var first *WebSocketResponse
+	var lastErr error
+	for range clients {
+		r := <-results
+		if r.err != nil {
+			lastErr = r.err
+			continue
+		}
+		if first == nil || (first.Status != http.StatusOK && r.response.Status == http.StatusOK) {
+			first = r.response
+		}
+	}
+	if first == nil {
+		return nil, lastErr
+	}
+	return first, nil
+}
+
+// 请求客户端MCP工具列表, 多个节点时合并各节点返回的工具
 func (ctrl *WebSocketController) RequestMcpToolsFromClient(ctx context.Context, agentID string) ([]string, error) {
 	log.Printf("开始请求客户端MCP工具列表，agentID: %s", agentID)
 
-	// 检查客户端连接状态
-	ctrl.clientMutex.RLock()
-	client := ctrl.currentClient
-	isConnected := client != nil && client.isConnected
-	ctrl.clientMutex.RUnlock()
-
-	log.Printf("客户端连接状态: connected=%v, client=%v", isConnected, client != nil)
+	clients := ctrl.connectedClients()
+	log.Printf("客户端连接状态: connected=%v, clients=%d", len(clients) > 0, len(clients))
 
-	if !isConnected {
+	if len(clients) == 0 {
 		return nil, fmt.Errorf("没有连接的客户端")
 	}
 
@@ -582,13 +717,40 @@ func (ctrl *WebSocketController) RequestMcpToolsFromClient(ctx context.Context,
 
 	log.Printf("向客户端发送MCP工具列表请求: %s /api/mcp/tools", "GET")
 
-	// 发送请求到客户端
-	response, err := ctrl.SendRequestToClient(ctx, "GET", "/api/mcp/tools", body)
-	if err != nil {
-		log.Printf("请求客户端MCP工具列表失败: %v", err)
-		return nil, fmt.Errorf("请求客户端MCP工具列表失败: %v", err)
+	tools := []string{}
+	seen := make(map[string]bool)
+	var lastErr error
+	succeeded := false
+	for _, client := range clients {
+		response, err := client.SendRequestWithResponse(ctx, "GET", "/api/mcp/tools", body)
+		if err != nil {
+			log.Printf("请求节点 %s MCP工具列表失败: %v", client.NodeID, err)
+			lastErr = fmt.Errorf("请求客户端MCP工具列表失败: %v", err)
+			continue
+		}
+		nodeTools, err := parseMcpToolsResponse(response)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		succeeded = true
+		for _, tool := range nodeTools {
+			if !seen[tool] {
+				seen[tool] = true
+				tools = append(tools, tool)
+			}
+		}
+	}
+	if !succeeded {
+		return nil, lastErr
 	}
 
+	log.Printf("成功解析工具列表: %v", tools)
+	return tools, nil
+}
+
+// 解析客户端返回的MCP工具列表
+func parseMcpToolsResponse(response *WebSocketResponse) ([]string, error) {
 	log.Printf("收到客户端响应: status=%d, body=%+v", response.Status, response.Body)
 
 	// 检查响应状态
@@ -632,8 +794,6 @@ func (ctrl *WebSocketController) RequestMcpToolsFromClient(ctx context.Context,
 		log.Printf("无法解析工具列表格式: %T", toolsData)
 		return nil, fmt.Errorf("无法解析工具列表格式: %T", toolsData)
 	}
-
-	log.Printf("成功解析工具列表: %v", tools)
 	return tools, nil
 }
 
@@ -648,6 +808,47 @@ func (ctrl *WebSocketController) RequestDeviceActivation(ctx context.Context, de
 	})
 }
 
+// 请求客户端向设备下发主动播报
+func (ctrl *WebSocketController) RequestDeviceSpeak(ctx context.Context, deviceID, text string, useLlm, interrupt bool) (*WebSocketResponse, error) {
+	return ctrl.SendRequestToClient(ctx, "POST", "/api/device/speak", map[string]interface{}{
+		"device_id": deviceID,
+		"text":      text,
+		"use_llm":   useLlm,
+		"interrupt": interrupt,
+	})
+}
+
+// 请求客户端调用设备上报的MCP工具
+func (ctrl *WebSocketController) RequestDeviceMcpCall(ctx context.Context, deviceID, tool string, arguments map[string]interface{}) (*WebSocketResponse, error) {
+	return ctrl.SendRequestToClient(ctx, "POST", "/api/device/mcp/call", map[string]interface{}{
+		"device_id": deviceID,
+		"tool":      tool,
+		"arguments": arguments,
+	})
+}
+
+// 请求客户端吊销设备令牌, token 为空时吊销设备全部令牌, 多个节点时通知所有节点
+func (ctrl *WebSocketController) RequestRevokeDeviceToken(ctx context.Context, deviceID, token string) (*WebSocketResponse, error) {
+	return ctrl.BroadcastRequest(ctx, "POST", "/api/auth/revoke", map[string]interface{}{
+		"device_id": deviceID,
+		"token":     token,
+	})
+}
+
+// 通知所有客户端智能体知识库已变更
+func (ctrl *WebSocketController) RequestInvalidateKnowledge(ctx context.Context, agentID string) (*WebSocketResponse, error) {
+	return ctrl.BroadcastRequest(ctx, "POST", "/api/knowledge/invalidate", map[string]interface{}{
+		"agent_id": agentID,
+	})
+}
+
+// 请求客户端删除设备的对话记忆和录音, 多个节点时通知所有节点
+func (ctrl *WebSocketController) RequestDeleteDeviceData(ctx context.Context, deviceID string) (*WebSocketResponse, error) {
+	return ctrl.BroadcastRequest(ctx, "POST", "/api/device/data/delete", map[string]interface{}{
+		"device_id": deviceID,
+	})
+}
+
 // 请求客户端ping
 func (ctrl *WebSocketController) RequestPingFromClient(ctx context.Context) (*WebSocketResponse, error) {
 	return ctrl.SendRequestToClient(ctx, "GET", "/api/server/ping", nil)
@@ -655,11 +856,9 @@ func (ctrl *WebSocketController) RequestPingFromClient(ctx context.Context) (*We
 
 // 异步发送请求到客户端（不等待响应）
 func (ctrl *WebSocketController) SendRequestToClientAsync(method, path string, body map[string]interface{}) error {
-	ctrl.clientMutex.RLock()
-	client := ctrl.currentClient
-	ctrl.clientMutex.RUnlock()
-
-	if client == nil || !client.isConnected {
+	deviceID, _ := body["device_id"].(string)
+	client := ctrl.GetDeviceClient(deviceID)
+	if client == nil {
 		return fmt.Errorf("没有连接的客户端")
 	}
 
@@ -668,20 +867,47 @@ func (ctrl *WebSocketController) SendRequestToClientAsync(method, path string, b
 
 // 获取客户端连接状态
 func (ctrl *WebSocketController) GetClientConnectionStatus() map[string]interface{} {
-	ctrl.clientMutex.RLock()
-	defer ctrl.clientMutex.RUnlock()
-
-	if ctrl.currentClient == nil {
+	clients := ctrl.connectedClients()
+	if len(clients) == 0 {
 		return map[string]interface{}{
 			"connected": false,
 			"client_id": "",
+			"nodes":     []map[string]interface{}{},
 			"message":   "没有连接的客户端",
 		}
 	}
 
 	return map[string]interface{}{
-		"connected": ctrl.currentClient.isConnected,
-		"client_id": ctrl.currentClient.ID,
+		"connected": true,
+		"client_id": clients[0].ID,
+		"nodes":     ctrl.GetConnectedNodes(),
 		"message":   "客户端已连接",
 	}
 }
+
+// 获取已连接的主程序节点及各节点在线的设备数
+func (ctrl *WebSocketController) GetConnectedNodes() []map[string]interface{} {
+	ctrl.clientMutex.RLock()
+	defer ctrl.clientMutex.RUnlock()
+
+	devices := make(map[string]int)
+	for _, clientID := range ctrl.deviceClients {
+		devices[clientID]++
+	}
+	nodes := make([]map[string]interface{}, 0, len(ctrl.clients))
+	for _, client := range ctrl.clients {
+		if !client.isConnected {
+			continue
+		}
+		nodes = append(nodes, map[string]interface{}{
+			"node_id":      client.NodeID,
+			"client_id":    client.ID,
+			"devices":      devices[client.ID],
+			"connected_at": client.ConnectedAt.Format(time.RFC3339),
+		})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i]["node_id"].(string) < nodes[j]["node_id"].(string)
+	})
+	return nodes
+}
@@ -25,6 +25,8 @@ type Device struct {
 	Challenge    string     `json:"challenge" gorm:"type:varchar(128)"`      // 激活挑战码
 	PreSecretKey string     `json:"pre_secret_key" gorm:"type:varchar(128)"` // 预激活密钥
 	Activated    bool       `json:"activated" gorm:"default:false"`          // 设备是否已激活
+	ClientID     string     `json:"client_id" gorm:"type:varchar(100)"`      // 激活时绑定的 Client-Id, 其它 Client-Id 需重新激活
+	RecordAudio  bool       `json:"record_audio" gorm:"default:false"`       // 是否开启会话录音
 	LastActiveAt *time.Time `json:"last_active_at"`
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
@@ -68,3 +70,101 @@ type GlobalRole struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+// 固件模型, 按板型+版本存储
+type Firmware struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	BoardType   string    `json:"board_type" gorm:"type:varchar(100);not null;uniqueIndex:board_version,priority:1"` // 板型, 对应OTA请求中的board.type
+	Version     string    `json:"version" gorm:"type:varchar(50);not null;uniqueIndex:board_version,priority:2"`
+	FileName    string    `json:"file_name" gorm:"type:varchar(255)"`
+	FilePath    string    `json:"-" gorm:"type:varchar(500)"`
+	Size        int64     `json:"size"`
+	Md5         string    `json:"md5" gorm:"type:varchar(32)"`
+	Description string    `json:"description" gorm:"type:text"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// 固件灰度发布模型
+type FirmwareRollout struct {
+	ID              uint      `json:"id" gorm:"primarykey"`
+	FirmwareID      uint      `json:"firmware_id" gorm:"not null;index"`
+	BoardType       string    `json:"board_type" gorm:"type:varchar(100);not null;index"`
+	Percentage      int       `json:"percentage" gorm:"default:0"`                     // 灰度比例 0-100
+	DeviceAllowlist string    `json:"device_allowlist" gorm:"type:text"`               // 白名单设备ID, 逗号分隔, 不受比例限制
+	AgentID         uint      `json:"agent_id" gorm:"default:0"`                       // 仅对该智能体下的设备生效, 0表示不限
+	Status          string    `json:"status" gorm:"type:varchar(20);default:'active'"` // active, paused, rolled_back
+	AllowDowngrade  bool      `json:"allow_downgrade" gorm:"default:false"`            // 显式回退, 允许下发比设备当前版本更低的固件
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// 设备固件升级记录
+type FirmwareUpgrade struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	RolloutID   uint       `json:"rollout_id" gorm:"not null;uniqueIndex:rollout_device,priority:1"`
+	DeviceName  string     `json:"device_name" gorm:"type:varchar(100);not null;uniqueIndex:rollout_device,priority:2"`
+	FromVersion string     `json:"from_version" gorm:"type:varchar(50)"`
+	ToVersion   string     `json:"to_version" gorm:"type:varchar(50)"`
+	Status      string     `json:"status" gorm:"type:varchar(20);default:'pending'"` // pending, success, failed
+	Attempts    int        `json:"attempts" gorm:"default:0"`                        // 下发次数
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// 对话会话, 设备每次连接(hello)为一个会话
+type ConversationSession struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	SessionID    string    `json:"session_id" gorm:"type:varchar(100);not null;uniqueIndex"`
+	DeviceName   string    `json:"device_name" gorm:"type:varchar(100);index"`
+	AgentID      uint      `json:"agent_id" gorm:"default:0;index"`
+	UserID       uint      `json:"user_id" gorm:"default:0;index"`
+	TurnCount    int       `json:"turn_count" gorm:"default:0"`
+	StartedAt    time.Time `json:"started_at" gorm:"index"`
+	LastActiveAt time.Time `json:"last_active_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// 对话轮次, 由主程序每轮对话结束后推送
+type ConversationTurn struct {
+	ID              uint      `json:"id" gorm:"primarykey"`
+	SessionID       string    `json:"session_id" gorm:"type:varchar(100);not null;index"`
+	DeviceName      string    `json:"device_name" gorm:"type:varchar(100);index"`
+	AgentID         uint      `json:"agent_id" gorm:"default:0;index"`
+	UserID          uint      `json:"user_id" gorm:"default:0;index"`
+	TurnIndex       int       `json:"turn_index"`
+	UserText        string    `json:"user_text" gorm:"type:text"`
+	AssistantText   string    `json:"assistant_text" gorm:"type:text"`
+	ToolCalls       string    `json:"tool_calls" gorm:"type:text"` // 工具调用, JSON数组
+	Interrupted     bool      `json:"interrupted" gorm:"default:false"`
+	AsrMs           int64     `json:"asr_ms"`             // 耗时均为毫秒
+	LlmFirstTokenMs int64     `json:"llm_first_token_ms"` // LLM首个响应
+	TtsFirstFrameMs int64     `json:"tts_first_frame_ms"` // TTS首帧
+	TotalMs         int64     `json:"total_ms"`
+	StartedAt       time.Time `json:"started_at" gorm:"index"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// 知识库文档, 上传后在内控完成分块, 主程序按智能体拉取分块并向量化
+type KnowledgeDocument struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	AgentID    uint      `json:"agent_id" gorm:"not null;index"`
+	UserID     uint      `json:"user_id" gorm:"not null;index"`
+	Name       string    `json:"name" gorm:"type:varchar(255);not null"`
+	Size       int64     `json:"size"` // 原文字节数
+	ChunkCount int       `json:"chunk_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// 知识库分块
+type KnowledgeChunk struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	DocumentID uint      `json:"document_id" gorm:"not null;index"`
+	AgentID    uint      `json:"agent_id" gorm:"not null;index"`
+	ChunkIndex int       `json:"chunk_index"`
+	Content    string    `json:"content" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at"`
+}
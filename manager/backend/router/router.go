@@ -1,6 +1,7 @@
 package router
 
 import (
+	"xiaozhi/manager/backend/config"
 	"xiaozhi/manager/backend/controllers"
 	"xiaozhi/manager/backend/middleware"
 
@@ -9,7 +10,7 @@ import (
 	"gorm.io/gorm"
 )
 
-func Setup(db *gorm.DB) *gin.Engine {
+func Setup(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	r := gin.Default()
 
 	// CORS配置
@@ -26,6 +27,9 @@ func Setup(db *gorm.DB) *gin.Engine {
 	userController := &controllers.UserController{DB: db, WebSocketController: webSocketController}
 	deviceActivationController := &controllers.DeviceActivationController{DB: db}
 	setupController := &controllers.SetupController{DB: db}
+	firmwareController := controllers.NewFirmwareController(db, cfg.Firmware)
+	conversationController := &controllers.ConversationController{DB: db, WebSocketController: webSocketController}
+	knowledgeController := &controllers.KnowledgeController{DB: db, WebSocketController: webSocketController}
 
 	// API路由组
 	api := r.Group("/api")
@@ -43,6 +47,10 @@ func Setup(db *gorm.DB) *gin.Engine {
 		api.GET("/public/device/activation-info", deviceActivationController.GetActivationInfo)
 		api.POST("/public/device/activate", deviceActivationController.ActivateDevice)
 
+		// 固件OTA相关公开接口（无需认证）
+		api.POST("/public/firmware/check", firmwareController.CheckFirmware)
+		api.GET("/public/firmware/download/:id", firmwareController.DownloadFirmware)
+
 		// 内部服务接口（无需认证）
 		api.GET("/configs", adminController.GetDeviceConfigs)
 		api.GET("/system/configs", adminController.GetSystemConfigs)
@@ -83,6 +91,12 @@ func Setup(db *gorm.DB) *gin.Engine {
 				// MCP接入点
 				user.GET("/agents/:id/mcp-endpoint", userController.GetAgentMCPEndpoint)
 				user.GET("/agents/:id/mcp-tools", userController.GetAgentMcpTools)
+
+				// 知识库
+				user.GET("/agents/:id/knowledge", knowledgeController.GetDocuments)
+				user.POST("/agents/:id/knowledge", knowledgeController.UploadDocument)
+				user.GET("/agents/:id/knowledge/:doc_id", knowledgeController.GetDocumentChunks)
+				user.DELETE("/agents/:id/knowledge/:doc_id", knowledgeController.DeleteDocument)
 			}
 
 			// 管理员路由
@@ -164,6 +178,10 @@ func Setup(db *gorm.DB) *gin.Engine {
 				admin.POST("/devices", adminController.CreateDevice)
 				admin.PUT("/devices/:id", adminController.UpdateDevice)
 				admin.DELETE("/devices/:id", adminController.DeleteDevice)
+				admin.POST("/devices/:id/speak", adminController.SpeakToDevice)
+				admin.POST("/devices/:id/revoke-token", adminController.RevokeDeviceToken)
+				admin.POST("/devices/:id/mcp/call", adminController.CallDeviceMcpTool)
+				admin.GET("/cluster/nodes", adminController.GetClusterNodes)
 
 				// 智能体管理
 				admin.GET("/agents", adminController.GetAgents)
@@ -172,6 +190,30 @@ func Setup(db *gorm.DB) *gin.Engine {
 				admin.DELETE("/agents/:id", adminController.DeleteAgent)
 				admin.GET("/agents/:id/mcp-endpoint", adminController.GetAgentMCPEndpoint)
 				admin.GET("/agents/:id/mcp-tools", adminController.GetAgentMcpTools)
+				admin.GET("/agents/:id/knowledge", knowledgeController.GetDocuments)
+				admin.POST("/agents/:id/knowledge", knowledgeController.UploadDocument)
+				admin.GET("/agents/:id/knowledge/:doc_id", knowledgeController.GetDocumentChunks)
+				admin.DELETE("/agents/:id/knowledge/:doc_id", knowledgeController.DeleteDocument)
+
+				// 固件管理
+				admin.GET("/firmwares", firmwareController.GetFirmwares)
+				admin.POST("/firmwares", firmwareController.UploadFirmware)
+				admin.DELETE("/firmwares/:id", firmwareController.DeleteFirmware)
+
+				// 固件灰度发布
+				admin.GET("/firmware-rollouts", firmwareController.GetRollouts)
+				admin.POST("/firmware-rollouts", firmwareController.CreateRollout)
+				admin.PUT("/firmware-rollouts/:id", firmwareController.UpdateRollout)
+				admin.POST("/firmware-rollouts/:id/rollback", firmwareController.RollbackRollout)
+				admin.GET("/firmware-rollouts/:id/upgrades", firmwareController.GetRolloutUpgrades)
+
+				// 对话记录
+				admin.GET("/conversations", conversationController.GetConversations)
+				admin.GET("/conversations/turns", conversationController.SearchConversationTurns)
+				admin.GET("/conversations/export", conversationController.ExportConversations)
+				admin.GET("/conversations/:session_id", conversationController.GetConversation)
+				admin.DELETE("/conversations", conversationController.DeleteConversations)
+				admin.DELETE("/conversations/:session_id", conversationController.DeleteConversation)
 
 				// 用户管理
 				admin.GET("/users", adminController.GetUsers)